@@ -8,8 +8,11 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/KZY20112001/infinivest-backend/internal/analytics"
+	"github.com/KZY20112001/infinivest-backend/internal/commons"
 	"github.com/KZY20112001/infinivest-backend/internal/conf"
 	"github.com/KZY20112001/infinivest-backend/internal/db"
+	"github.com/KZY20112001/infinivest-backend/internal/middlewares"
 	"github.com/KZY20112001/infinivest-backend/internal/models"
 	"github.com/KZY20112001/infinivest-backend/internal/routes"
 	"github.com/KZY20112001/infinivest-backend/internal/setup"
@@ -35,7 +38,13 @@ func init() {
 	if err != nil {
 		log.Fatalf("error in connecting to database: %v", err.Error())
 	}
-	postgresDB.AutoMigrate(&models.User{}, &models.Profile{}, &models.RoboPortfolio{}, &models.RoboPortfolioCategory{}, &models.RoboPortfolioAsset{}, &models.RoboPortfolioTransaction{}, &models.ManualPortfolio{}, &models.ManualPortfolioAsset{}, &models.ManualPortfolioTransaction{}, &models.RebalanceEvent{})
+	// robo portfolios used to be unique per user
+	if postgresDB.Migrator().HasIndex(&models.RoboPortfolio{}, "idx_robo_portfolios_user_id") {
+		if err := postgresDB.Migrator().DropIndex(&models.RoboPortfolio{}, "idx_robo_portfolios_user_id"); err != nil {
+			log.Fatalf("error in dropping robo portfolio user index: %v", err.Error())
+		}
+	}
+	postgresDB.AutoMigrate(&models.User{}, &models.Profile{}, &models.RoboPortfolio{}, &models.RoboPortfolioCategory{}, &models.RoboPortfolioAsset{}, &models.RoboPortfolioLot{}, &models.RoboPortfolioTransaction{}, &models.ManualPortfolio{}, &models.ManualPortfolioAsset{}, &models.ManualPortfolioTarget{}, &models.ManualPortfolioTransaction{}, &models.Order{}, &models.OrderFill{}, &models.RebalanceEvent{}, &models.RebalanceEventAsset{}, &models.AllocationVersion{}, &models.AllocationTarget{}, &models.Goal{}, &models.ExclusionRule{}, &models.AssetMetadata{}, &models.Transfer{}, &models.Watchlist{}, &models.WatchlistItem{}, &models.PriceAlert{})
 
 	redisClient, err = db.ConnectToRedis()
 	if err != nil {
@@ -52,26 +61,37 @@ func main() {
 	}
 
 	appConf := conf.LoadConfig()
+	assumptions, err := analytics.LoadCapitalMarketAssumptions(appConf.CapitalMarketAssumptionsFile)
+	if err != nil {
+		log.Fatalf("unable to load capital market assumptions, %v", err)
+	}
 
 	s3Client := s3.NewFromConfig(cfg)
 	presignClient := s3.NewPresignClient(s3Client)
 
 	// init repositories
-	userRepo, profileRepo, roboPortfolioRepo, manualPortfolioRepo, s3Repo, genAIRepo := setup.Repositories(
+	userRepo, profileRepo, roboPortfolioRepo, manualPortfolioRepo, s3Repo, genAIRepo, goalRepo, screeningRepo, transferRepo, watchlistRepo := setup.Repositories(
 		postgresDB, presignClient, appConf.FlaskMicroserviceURL,
 	)
+	if err := screeningRepo.SeedAssetMetadata(commons.DefaultAssetMetadata); err != nil {
+		log.Fatalf("unable to seed asset metadata, %v", err)
+	}
+	fxRateRepo, err := setup.FXRateRepository(appConf)
+	if err != nil {
+		log.Fatalf("unable to load fx rates, %v", err)
+	}
 
 	// init redis
-	roboPortfolioRedis, notificationRedis := setup.Redis(redisClient)
+	roboPortfolioRedis, notificationRedis, idempotencyRedis := setup.Redis(redisClient)
 
 	// init services
-	userService, profileService, roboPortfolioService, manualPortfolioService, notificationService, s3Service, genAIService := setup.Services(
-		roboPortfolioRedis, notificationRedis, userRepo, profileRepo, roboPortfolioRepo, manualPortfolioRepo, s3Repo, genAIRepo,
+	userService, profileService, roboPortfolioService, manualPortfolioService, notificationService, s3Service, genAIService, goalService, screeningService, transferService, watchlistService := setup.Services(
+		roboPortfolioRedis, notificationRedis, userRepo, profileRepo, roboPortfolioRepo, manualPortfolioRepo, s3Repo, genAIRepo, goalRepo, screeningRepo, transferRepo, watchlistRepo, fxRateRepo, assumptions, appConf.RebalanceFeeRate, appConf.AlertCooldown, appConf.FXRateTTL,
 	)
 
 	// init handlers
-	userHandler, profileHandler, roboPortfolioHandler, manualPortfolioHandler, noficationHandler, s3Handler := setup.Handlers(
-		userService, profileService, roboPortfolioService, manualPortfolioService, notificationService, s3Service, genAIService,
+	userHandler, profileHandler, roboPortfolioHandler, manualPortfolioHandler, noficationHandler, s3Handler, goalHandler, screeningHandler, transferHandler, watchlistHandler := setup.Handlers(
+		userService, profileService, roboPortfolioService, manualPortfolioService, notificationService, s3Service, genAIService, goalService, screeningService, transferService, watchlistService,
 	)
 
 	// init schedulers
@@ -79,8 +99,20 @@ func main() {
 		roboPortfolioService, roboPortfolioRepo, roboPortfolioRedis,
 	)
 
+	driftMonitor := setup.DriftMonitor(
+		roboPortfolioService, roboPortfolioRepo, roboPortfolioRedis, appConf,
+	)
+
+	orderMonitor := setup.OrderMonitor(manualPortfolioService, appConf)
+
+	alertMonitor := setup.AlertMonitor(watchlistService, appConf)
+
 	portfolioScheduler.Start(ctx)
-	r := routes.RegisterRoutes(userHandler, profileHandler, roboPortfolioHandler, manualPortfolioHandler, noficationHandler, s3Handler)
+	driftMonitor.Start(ctx)
+	orderMonitor.Start(ctx)
+	alertMonitor.Start(ctx)
+	idempotency := middlewares.IdempotencyMiddleware(idempotencyRedis, appConf.IdempotencyKeyTTL)
+	r := routes.RegisterRoutes(userHandler, profileHandler, roboPortfolioHandler, manualPortfolioHandler, noficationHandler, s3Handler, goalHandler, screeningHandler, transferHandler, watchlistHandler, idempotency)
 	srv := &http.Server{
 		Addr:    ":8080",
 		Handler: r,
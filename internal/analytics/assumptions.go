@@ -0,0 +1,115 @@
+package analytics
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+)
+
+// CategoryAssumption holds the annualised expected return and volatility of a robo portfolio category.
+type CategoryAssumption struct {
+	ExpectedReturn float64 `json:"expectedReturn"`
+	Volatility     float64 `json:"volatility"`
+}
+
+var (
+	DefaultCapitalMarketAssumptions = map[string]CategoryAssumption{
+		"largeCapBlend":       {ExpectedReturn: 0.070, Volatility: 0.160},
+		"smallCapBlend":       {ExpectedReturn: 0.080, Volatility: 0.200},
+		"internationalStocks": {ExpectedReturn: 0.065, Volatility: 0.170},
+		"emergingMarkets":     {ExpectedReturn: 0.075, Volatility: 0.220},
+		"intermediateBonds":   {ExpectedReturn: 0.035, Volatility: 0.050},
+		"internationalBonds":  {ExpectedReturn: 0.030, Volatility: 0.060},
+		"cash":                {ExpectedReturn: 0.020, Volatility: 0.005},
+	}
+
+	// used for categories that have no assumption configured
+	fallbackAssumption = CategoryAssumption{ExpectedReturn: 0.050, Volatility: 0.120}
+
+	categoryClasses = map[string]string{
+		"largeCapBlend":       "equity",
+		"smallCapBlend":       "equity",
+		"internationalStocks": "equity",
+		"emergingMarkets":     "equity",
+		"intermediateBonds":   "bond",
+		"internationalBonds":  "bond",
+		"cash":                "cash",
+	}
+)
+
+func getAssumption(assumptions map[string]CategoryAssumption, category string) CategoryAssumption {
+	if assumption, exists := assumptions[category]; exists {
+		return assumption
+	}
+	return fallbackAssumption
+}
+
+// CategoryClass returns "equity", "bond" or "cash" for a robo portfolio category.
+func CategoryClass(category string) string {
+	if class, exists := categoryClasses[category]; exists {
+		return class
+	}
+	return "equity"
+}
+
+func correlation(a, b string) float64 {
+	if a == b {
+		return 1
+	}
+	classA, classB := CategoryClass(a), CategoryClass(b)
+	switch {
+	case classA == "cash" || classB == "cash":
+		return 0
+	case classA == "equity" && classB == "equity":
+		return 0.8
+	case classA == "bond" && classB == "bond":
+		return 0.6
+	default:
+		return 0.1
+	}
+}
+
+// PortfolioExpectations returns the expected annual return and volatility of a portfolio
+// whose category weights (fractions summing to 1) are given.
+func PortfolioExpectations(weights map[string]float64, assumptions map[string]CategoryAssumption) (float64, float64) {
+	expectedReturn := 0.0
+	variance := 0.0
+	for categoryA, weightA := range weights {
+		assumptionA := getAssumption(assumptions, categoryA)
+		expectedReturn += weightA * assumptionA.ExpectedReturn
+		for categoryB, weightB := range weights {
+			assumptionB := getAssumption(assumptions, categoryB)
+			variance += weightA * weightB * assumptionA.Volatility * assumptionB.Volatility * correlation(categoryA, categoryB)
+		}
+	}
+	return expectedReturn, math.Sqrt(math.Max(variance, 0))
+}
+
+// LoadCapitalMarketAssumptions reads a JSON file of category -> {expectedReturn, volatility} and merges it
+// over the defaults. An empty path returns the defaults.
+func LoadCapitalMarketAssumptions(path string) (map[string]CategoryAssumption, error) {
+	assumptions := make(map[string]CategoryAssumption, len(DefaultCapitalMarketAssumptions))
+	for category, assumption := range DefaultCapitalMarketAssumptions {
+		assumptions[category] = assumption
+	}
+	if path == "" {
+		return assumptions, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read capital market assumptions: %w", err)
+	}
+	var overrides map[string]CategoryAssumption
+	if err := json.Unmarshal(data, &overrides); err != nil {
+		return nil, fmt.Errorf("failed to parse capital market assumptions: %w", err)
+	}
+	for category, assumption := range overrides {
+		if assumption.Volatility < 0 {
+			return nil, fmt.Errorf("invalid volatility for category %s", category)
+		}
+		assumptions[category] = assumption
+	}
+	return assumptions, nil
+}
@@ -0,0 +1,132 @@
+package analytics
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+)
+
+var OutcomePercentiles = []int{10, 25, 50, 75, 90}
+
+const (
+	// every step of the contribution search runs a full simulation, so it uses fewer trials than a projection
+	maxSearchTrials = 500
+	maxSearchSteps  = 25
+)
+
+type SimulationInput struct {
+	Weights             map[string]float64 // category -> fraction of the portfolio, summing to 1
+	InitialValue        float64
+	MonthlyContribution float64
+	Months              int
+	TargetAmount        float64
+	Trials              int
+	Seed                int64
+}
+
+type OutcomeBand struct {
+	Month       int             `json:"month"`
+	Percentiles map[int]float64 `json:"percentiles"`
+}
+
+type SimulationResult struct {
+	SuccessProbability float64         `json:"successProbability"`
+	FinalPercentiles   map[int]float64 `json:"finalPercentiles"`
+	Bands              []OutcomeBand   `json:"bands"` // one band per year and one at the final month
+}
+
+// SimulatePortfolio runs a Monte Carlo simulation of monthly log-normal portfolio returns
+// with a contribution added at the end of every month.
+func SimulatePortfolio(in SimulationInput, assumptions map[string]CategoryAssumption) SimulationResult {
+	expectedReturn, volatility := PortfolioExpectations(in.Weights, assumptions)
+	monthlyDrift := (expectedReturn - volatility*volatility/2) / 12
+	monthlyVolatility := volatility / math.Sqrt(12)
+
+	bandMonths := []int{}
+	for month := 12; month < in.Months; month += 12 {
+		bandMonths = append(bandMonths, month)
+	}
+	bandMonths = append(bandMonths, in.Months)
+	bandValues := make([][]float64, len(bandMonths))
+	for i := range bandValues {
+		bandValues[i] = make([]float64, in.Trials)
+	}
+
+	rng := rand.New(rand.NewSource(in.Seed))
+	successes := 0
+	for trial := 0; trial < in.Trials; trial++ {
+		value := in.InitialValue
+		bandIdx := 0
+		for month := 1; month <= in.Months; month++ {
+			value = value*math.Exp(monthlyDrift+monthlyVolatility*rng.NormFloat64()) + in.MonthlyContribution
+			if month == bandMonths[bandIdx] {
+				bandValues[bandIdx][trial] = value
+				bandIdx++
+			}
+		}
+		if in.Months == 0 {
+			bandValues[0][trial] = value
+		}
+		if value >= in.TargetAmount {
+			successes++
+		}
+	}
+
+	result := SimulationResult{
+		SuccessProbability: float64(successes) / float64(in.Trials),
+		Bands:              make([]OutcomeBand, len(bandMonths)),
+	}
+	for i, month := range bandMonths {
+		result.Bands[i] = OutcomeBand{Month: month, Percentiles: percentiles(bandValues[i], OutcomePercentiles)}
+	}
+	result.FinalPercentiles = result.Bands[len(result.Bands)-1].Percentiles
+	return result
+}
+
+// RequiredMonthlyContribution searches for the smallest monthly contribution that reaches
+// the target amount with at least the given probability.
+func RequiredMonthlyContribution(in SimulationInput, assumptions map[string]CategoryAssumption, confidence float64) float64 {
+	trial := in
+	trial.Trials = min(in.Trials, maxSearchTrials)
+	successAt := func(contribution float64) bool {
+		trial.MonthlyContribution = contribution
+		return SimulatePortfolio(trial, assumptions).SuccessProbability >= confidence
+	}
+	if successAt(0) {
+		return 0
+	}
+	if in.Months == 0 {
+		return math.Max(in.TargetAmount-in.InitialValue, 0)
+	}
+
+	low, high := 0.0, math.Max(in.TargetAmount/float64(in.Months), 1)
+	for i := 0; i < 20 && !successAt(high); i++ {
+		low = high
+		high *= 2
+	}
+	// stop once the bracket is narrower than a cent
+	for i := 0; i < maxSearchSteps && high-low > 0.01; i++ {
+		mid := (low + high) / 2
+		if successAt(mid) {
+			high = mid
+		} else {
+			low = mid
+		}
+	}
+	return math.Ceil(high*100) / 100
+}
+
+func percentiles(values []float64, points []int) map[int]float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	res := make(map[int]float64, len(points))
+	for _, point := range points {
+		if len(sorted) == 0 {
+			res[point] = 0
+			continue
+		}
+		idx := int(math.Round(float64(point) / 100 * float64(len(sorted)-1)))
+		res[point] = math.Round(sorted[idx]*100) / 100
+	}
+	return res
+}
@@ -0,0 +1,181 @@
+package analytics
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+var (
+	riskFreeAssumptions = map[string]CategoryAssumption{"cash": {ExpectedReturn: 0, Volatility: 0}}
+	growthAssumptions   = map[string]CategoryAssumption{"cash": {ExpectedReturn: 0.12, Volatility: 0}}
+)
+
+func TestSimulatePortfolio(t *testing.T) {
+	tests := []struct {
+		name        string
+		in          SimulationInput
+		assumptions map[string]CategoryAssumption
+		wantFinal   float64
+		wantSuccess float64
+		wantBands   []int
+	}{
+		{
+			name: "contributions only",
+			in: SimulationInput{
+				Weights: map[string]float64{"cash": 1}, InitialValue: 1000, MonthlyContribution: 100,
+				Months: 30, TargetAmount: 4000, Trials: 50, Seed: 1,
+			},
+			assumptions: riskFreeAssumptions,
+			wantFinal:   4000,
+			wantSuccess: 1,
+			wantBands:   []int{12, 24, 30},
+		},
+		{
+			name: "target out of reach",
+			in: SimulationInput{
+				Weights: map[string]float64{"cash": 1}, InitialValue: 1000, MonthlyContribution: 100,
+				Months: 12, TargetAmount: 5000, Trials: 50, Seed: 1,
+			},
+			assumptions: riskFreeAssumptions,
+			wantFinal:   2200,
+			wantSuccess: 0,
+			wantBands:   []int{12},
+		},
+		{
+			name: "growth compounds monthly",
+			in: SimulationInput{
+				Weights: map[string]float64{"cash": 1}, InitialValue: 1000,
+				Months: 12, TargetAmount: 1100, Trials: 50, Seed: 1,
+			},
+			assumptions: growthAssumptions,
+			wantFinal:   math.Round(1000*math.Exp(0.12)*100) / 100,
+			wantSuccess: 1,
+			wantBands:   []int{12},
+		},
+		{
+			name: "no months left",
+			in: SimulationInput{
+				Weights: map[string]float64{"cash": 1}, InitialValue: 1000,
+				Months: 0, TargetAmount: 1000, Trials: 50, Seed: 1,
+			},
+			assumptions: riskFreeAssumptions,
+			wantFinal:   1000,
+			wantSuccess: 1,
+			wantBands:   []int{0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := SimulatePortfolio(tt.in, tt.assumptions)
+			if result.SuccessProbability != tt.wantSuccess {
+				t.Errorf("SuccessProbability = %v, want %v", result.SuccessProbability, tt.wantSuccess)
+			}
+			months := make([]int, len(result.Bands))
+			for i, band := range result.Bands {
+				months[i] = band.Month
+			}
+			if !reflect.DeepEqual(months, tt.wantBands) {
+				t.Errorf("band months = %v, want %v", months, tt.wantBands)
+			}
+			for _, point := range OutcomePercentiles {
+				if math.Abs(result.FinalPercentiles[point]-tt.wantFinal) > 0.01 {
+					t.Errorf("FinalPercentiles[%d] = %v, want %v", point, result.FinalPercentiles[point], tt.wantFinal)
+				}
+			}
+		})
+	}
+}
+
+func TestSimulatePortfolioIsReproducible(t *testing.T) {
+	in := SimulationInput{
+		Weights: map[string]float64{"largeCapBlend": 0.6, "intermediateBonds": 0.4}, InitialValue: 10000,
+		MonthlyContribution: 200, Months: 60, TargetAmount: 30000, Trials: 200, Seed: 42,
+	}
+	first := SimulatePortfolio(in, DefaultCapitalMarketAssumptions)
+	second := SimulatePortfolio(in, DefaultCapitalMarketAssumptions)
+	if !reflect.DeepEqual(first, second) {
+		t.Fatalf("simulations with the same seed differ")
+	}
+	final := first.FinalPercentiles
+	for i := 1; i < len(OutcomePercentiles); i++ {
+		if final[OutcomePercentiles[i]] < final[OutcomePercentiles[i-1]] {
+			t.Errorf("percentile %d is below percentile %d", OutcomePercentiles[i], OutcomePercentiles[i-1])
+		}
+	}
+}
+
+func TestRequiredMonthlyContribution(t *testing.T) {
+	tests := []struct {
+		name        string
+		in          SimulationInput
+		assumptions map[string]CategoryAssumption
+		want        float64
+	}{
+		{
+			name: "already funded",
+			in: SimulationInput{
+				Weights: map[string]float64{"cash": 1}, InitialValue: 2000,
+				Months: 12, TargetAmount: 1000, Trials: 50, Seed: 1,
+			},
+			assumptions: riskFreeAssumptions,
+			want:        0,
+		},
+		{
+			name: "contributions make up the gap",
+			in: SimulationInput{
+				Weights: map[string]float64{"cash": 1}, InitialValue: 0,
+				Months: 12, TargetAmount: 1200, Trials: 50, Seed: 1,
+			},
+			assumptions: riskFreeAssumptions,
+			want:        100,
+		},
+		{
+			name: "target larger than the first guess",
+			in: SimulationInput{
+				Weights: map[string]float64{"cash": 1}, InitialValue: 600,
+				Months: 6, TargetAmount: 3000, Trials: 50, Seed: 1,
+			},
+			assumptions: riskFreeAssumptions,
+			want:        400,
+		},
+		{
+			name: "no months left",
+			in: SimulationInput{
+				Weights: map[string]float64{"cash": 1}, InitialValue: 400,
+				Months: 0, TargetAmount: 1000, Trials: 50, Seed: 1,
+			},
+			assumptions: riskFreeAssumptions,
+			want:        600,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := RequiredMonthlyContribution(tt.in, tt.assumptions, 0.8)
+			// the search stops at cent precision and rounds up
+			if got < tt.want || got > tt.want+0.02 {
+				t.Errorf("RequiredMonthlyContribution() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequiredMonthlyContributionMeetsConfidence(t *testing.T) {
+	in := SimulationInput{
+		Weights: map[string]float64{"largeCapBlend": 0.8, "intermediateBonds": 0.2}, InitialValue: 5000,
+		Months: 120, TargetAmount: 100000, Trials: maxSearchTrials, Seed: 7,
+	}
+	const confidence = 0.8
+
+	required := RequiredMonthlyContribution(in, DefaultCapitalMarketAssumptions, confidence)
+	in.MonthlyContribution = required
+	if p := SimulatePortfolio(in, DefaultCapitalMarketAssumptions).SuccessProbability; p < confidence {
+		t.Errorf("success probability at %v = %v, want at least %v", required, p, confidence)
+	}
+	in.MonthlyContribution = required - 1
+	if p := SimulatePortfolio(in, DefaultCapitalMarketAssumptions).SuccessProbability; p >= confidence {
+		t.Errorf("success probability at %v = %v, want below %v", in.MonthlyContribution, p, confidence)
+	}
+}
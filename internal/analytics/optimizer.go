@@ -0,0 +1,224 @@
+package analytics
+
+import (
+	"fmt"
+	"math"
+)
+
+var RoboCategories = []string{
+	"largeCapBlend",
+	"smallCapBlend",
+	"internationalStocks",
+	"emergingMarkets",
+	"intermediateBonds",
+	"internationalBonds",
+	"cash",
+}
+
+// RiskConstraints bounds the mean-variance optimisation for a risk level
+type RiskConstraints struct {
+	RiskAversion      float64
+	MaxEquity         float64 // upper bound on the sum of equity categories
+	MinCash           float64
+	MaxCategoryWeight float64
+	Excluded          []string // categories that get no weight, e.g. because screening leaves nothing to buy in them
+}
+
+var RiskLevelConstraints = map[string]RiskConstraints{
+	"conservative":            {RiskAversion: 6, MaxEquity: 0.35, MinCash: 0.10, MaxCategoryWeight: 0.45},
+	"moderately-conservative": {RiskAversion: 4, MaxEquity: 0.50, MinCash: 0.07, MaxCategoryWeight: 0.40},
+	"moderate":                {RiskAversion: 3, MaxEquity: 0.65, MinCash: 0.05, MaxCategoryWeight: 0.40},
+	"moderately-aggressive":   {RiskAversion: 2, MaxEquity: 0.80, MinCash: 0.03, MaxCategoryWeight: 0.40},
+	"aggressive":              {RiskAversion: 1.2, MaxEquity: 0.95, MinCash: 0.02, MaxCategoryWeight: 0.45},
+}
+
+// OptimizeMeanVariance maximises w'mu - (riskAversion/2) w'Sigma w over the robo categories, subject to the
+// weights summing to 1 and the bounds of the given constraints. The result maps category -> fraction.
+func OptimizeMeanVariance(assumptions map[string]CategoryAssumption, constraints RiskConstraints) (map[string]float64, error) {
+	n := len(RoboCategories)
+	mu := make([]float64, n)
+	sigma := make([][]float64, n)
+	lower := make([]float64, n)
+	upper := make([]float64, n)
+	isEquity := make([]bool, n)
+	excluded := make(map[string]bool, len(constraints.Excluded))
+	for _, category := range constraints.Excluded {
+		excluded[category] = true
+	}
+	for i, categoryA := range RoboCategories {
+		assumptionA := getAssumption(assumptions, categoryA)
+		mu[i] = assumptionA.ExpectedReturn
+		sigma[i] = make([]float64, n)
+		for j, categoryB := range RoboCategories {
+			assumptionB := getAssumption(assumptions, categoryB)
+			sigma[i][j] = assumptionA.Volatility * assumptionB.Volatility * correlation(categoryA, categoryB)
+		}
+		upper[i] = constraints.MaxCategoryWeight
+		isEquity[i] = CategoryClass(categoryA) == "equity"
+		if categoryA == "cash" {
+			lower[i] = constraints.MinCash
+			upper[i] = math.Max(constraints.MaxCategoryWeight, constraints.MinCash)
+		} else if excluded[categoryA] {
+			upper[i] = 0
+		}
+	}
+
+	sumLower, sumUpper := 0.0, 0.0
+	for i := range lower {
+		sumLower += lower[i]
+		sumUpper += upper[i]
+	}
+	if sumLower > 1 || sumUpper < 1 {
+		return nil, fmt.Errorf("risk constraints are infeasible")
+	}
+
+	// step size from a bound on the largest eigenvalue of the hessian
+	trace := 0.0
+	for i := range sigma {
+		trace += sigma[i][i]
+	}
+	step := 1 / (constraints.RiskAversion * trace)
+
+	weights := project(equalWeights(n), lower, upper, isEquity, constraints.MaxEquity)
+	for iter := 0; iter < 2000; iter++ {
+		next := make([]float64, n)
+		for i := range weights {
+			gradient := mu[i]
+			for j := range weights {
+				gradient -= constraints.RiskAversion * sigma[i][j] * weights[j]
+			}
+			next[i] = weights[i] + step*gradient
+		}
+		next = project(next, lower, upper, isEquity, constraints.MaxEquity)
+
+		change := 0.0
+		for i := range next {
+			change += math.Abs(next[i] - weights[i])
+		}
+		weights = next
+		if change < 1e-10 {
+			break
+		}
+	}
+
+	res := make(map[string]float64, n)
+	for i, category := range RoboCategories {
+		res[category] = weights[i]
+	}
+	return res, nil
+}
+
+// ToPercentages converts fractional weights to percentages with two decimals that sum to exactly 100
+func ToPercentages(weights map[string]float64) map[string]float64 {
+	res := make(map[string]float64, len(weights))
+	total := 0.0
+	largest := ""
+	for category, weight := range weights {
+		res[category] = math.Round(weight*10000) / 100
+		total += res[category]
+		if largest == "" || res[category] > res[largest] {
+			largest = category
+		}
+	}
+	if largest != "" {
+		res[largest] = math.Round((res[largest]+100-total)*100) / 100
+	}
+	return res
+}
+
+func equalWeights(n int) []float64 {
+	weights := make([]float64, n)
+	for i := range weights {
+		weights[i] = 1 / float64(n)
+	}
+	return weights
+}
+
+// project finds the closest point to v that satisfies the box, budget and equity constraints
+// using Dykstra's alternating projections.
+func project(v, lower, upper []float64, isEquity []bool, maxEquity float64) []float64 {
+	n := len(v)
+	x := append([]float64(nil), v...)
+	p := make([]float64, n)
+	q := make([]float64, n)
+	for iter := 0; iter < 200; iter++ {
+		y := make([]float64, n)
+		for i := range x {
+			y[i] = x[i] + p[i]
+		}
+		y = projectBudgetBox(y, lower, upper)
+		for i := range x {
+			p[i] = x[i] + p[i] - y[i]
+		}
+
+		z := make([]float64, n)
+		for i := range y {
+			z[i] = y[i] + q[i]
+		}
+		z = projectEquityCap(z, isEquity, maxEquity)
+		for i := range y {
+			q[i] = y[i] + q[i] - z[i]
+		}
+
+		change := 0.0
+		for i := range z {
+			change += math.Abs(z[i] - x[i])
+		}
+		x = z
+		if change < 1e-12 {
+			break
+		}
+	}
+	return projectBudgetBox(x, lower, upper)
+}
+
+// projectBudgetBox projects onto {sum(w) = 1, lower <= w <= upper} by bisecting on a uniform shift
+func projectBudgetBox(v, lower, upper []float64) []float64 {
+	shifted := func(tau float64) ([]float64, float64) {
+		w := make([]float64, len(v))
+		total := 0.0
+		for i := range v {
+			w[i] = math.Min(math.Max(v[i]-tau, lower[i]), upper[i])
+			total += w[i]
+		}
+		return w, total
+	}
+	low, high := -1.0, 1.0
+	for _, value := range v {
+		low = math.Min(low, value-1)
+		high = math.Max(high, value+1)
+	}
+	for i := 0; i < 100; i++ {
+		mid := (low + high) / 2
+		if _, total := shifted(mid); total > 1 {
+			low = mid
+		} else {
+			high = mid
+		}
+	}
+	w, _ := shifted((low + high) / 2)
+	return w
+}
+
+// projectEquityCap projects onto the half-space {sum of equity weights <= maxEquity}
+func projectEquityCap(v []float64, isEquity []bool, maxEquity float64) []float64 {
+	equityTotal := 0.0
+	equityCount := 0
+	for i := range v {
+		if isEquity[i] {
+			equityTotal += v[i]
+			equityCount++
+		}
+	}
+	if equityTotal <= maxEquity || equityCount == 0 {
+		return v
+	}
+	w := append([]float64(nil), v...)
+	excess := (equityTotal - maxEquity) / float64(equityCount)
+	for i := range w {
+		if isEquity[i] {
+			w[i] -= excess
+		}
+	}
+	return w
+}
@@ -0,0 +1,129 @@
+package analytics
+
+import (
+	"math"
+	"testing"
+)
+
+const weightTolerance = 1e-6
+
+func TestOptimizeMeanVariance(t *testing.T) {
+	for riskLevel, constraints := range RiskLevelConstraints {
+		t.Run(riskLevel, func(t *testing.T) {
+			weights, err := OptimizeMeanVariance(DefaultCapitalMarketAssumptions, constraints)
+			if err != nil {
+				t.Fatalf("OptimizeMeanVariance() error = %v", err)
+			}
+			if len(weights) != len(RoboCategories) {
+				t.Fatalf("got %d categories, want %d", len(weights), len(RoboCategories))
+			}
+
+			total, equity := 0.0, 0.0
+			for category, weight := range weights {
+				total += weight
+				if CategoryClass(category) == "equity" {
+					equity += weight
+				}
+				if weight < -weightTolerance {
+					t.Errorf("%s weight = %v, want non-negative", category, weight)
+				}
+				if category != "cash" && weight > constraints.MaxCategoryWeight+weightTolerance {
+					t.Errorf("%s weight = %v, want at most %v", category, weight, constraints.MaxCategoryWeight)
+				}
+			}
+			if math.Abs(total-1) > weightTolerance {
+				t.Errorf("weights sum to %v, want 1", total)
+			}
+			if equity > constraints.MaxEquity+weightTolerance {
+				t.Errorf("equity weight = %v, want at most %v", equity, constraints.MaxEquity)
+			}
+			if weights["cash"] < constraints.MinCash-weightTolerance {
+				t.Errorf("cash weight = %v, want at least %v", weights["cash"], constraints.MinCash)
+			}
+		})
+	}
+}
+
+func TestOptimizeMeanVarianceRiskOrdering(t *testing.T) {
+	equityWeight := func(riskLevel string) float64 {
+		weights, err := OptimizeMeanVariance(DefaultCapitalMarketAssumptions, RiskLevelConstraints[riskLevel])
+		if err != nil {
+			t.Fatalf("OptimizeMeanVariance(%s) error = %v", riskLevel, err)
+		}
+		equity := 0.0
+		for category, weight := range weights {
+			if CategoryClass(category) == "equity" {
+				equity += weight
+			}
+		}
+		return equity
+	}
+
+	levels := []string{"conservative", "moderately-conservative", "moderate", "moderately-aggressive", "aggressive"}
+	previous := -1.0
+	for _, level := range levels {
+		equity := equityWeight(level)
+		if equity < previous-weightTolerance {
+			t.Errorf("%s equity weight %v is below the previous level's %v", level, equity, previous)
+		}
+		previous = equity
+	}
+}
+
+func TestOptimizeMeanVarianceInfeasible(t *testing.T) {
+	tests := []struct {
+		name        string
+		constraints RiskConstraints
+	}{
+		{name: "category caps below the budget", constraints: RiskConstraints{RiskAversion: 3, MaxEquity: 1, MaxCategoryWeight: 0.1}},
+		{name: "cash floor above the budget", constraints: RiskConstraints{RiskAversion: 3, MaxEquity: 1, MinCash: 1.2, MaxCategoryWeight: 0.4}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := OptimizeMeanVariance(DefaultCapitalMarketAssumptions, tt.constraints); err == nil {
+				t.Errorf("OptimizeMeanVariance() error = nil, want infeasible")
+			}
+		})
+	}
+}
+
+func TestToPercentages(t *testing.T) {
+	tests := []struct {
+		name    string
+		weights map[string]float64
+		want    map[string]float64
+	}{
+		{
+			name:    "exact split",
+			weights: map[string]float64{"largeCapBlend": 0.6, "cash": 0.4},
+			want:    map[string]float64{"largeCapBlend": 60, "cash": 40},
+		},
+		{
+			name:    "rounding remainder goes to the largest category",
+			weights: map[string]float64{"largeCapBlend": 1.0 / 3, "smallCapBlend": 1.0 / 3, "cash": 1.0 / 3},
+		},
+		{
+			name:    "empty",
+			weights: map[string]float64{},
+			want:    map[string]float64{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ToPercentages(tt.weights)
+			total := 0.0
+			for category, percentage := range got {
+				total += percentage
+				if math.Abs(percentage*100-math.Round(percentage*100)) > 1e-9 {
+					t.Errorf("%s = %v, want two decimals", category, percentage)
+				}
+				if want, exists := tt.want[category]; tt.want != nil && (!exists || math.Abs(want-percentage) > 1e-9) {
+					t.Errorf("%s = %v, want %v", category, percentage, want)
+				}
+			}
+			if len(got) > 0 && math.Abs(total-100) > 1e-9 {
+				t.Errorf("percentages sum to %v, want 100", total)
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package analytics
+
+import (
+	"math"
+	"sort"
+)
+
+const (
+	TradingDaysPerYear  = 252
+	DefaultRiskFreeRate = 0.02
+	VaRConfidence       = 0.95
+)
+
+// RiskMetrics are computed from daily returns. Volatility and returns are annualised,
+// drawdown, VaR and CVaR are daily fractions of the portfolio value.
+type RiskMetrics struct {
+	Observations           int     `json:"observations"`
+	AnnualizedReturn       float64 `json:"annualizedReturn"`
+	Volatility             float64 `json:"volatility"`
+	SharpeRatio            float64 `json:"sharpeRatio"`
+	SortinoRatio           float64 `json:"sortinoRatio"`
+	MaxDrawdown            float64 `json:"maxDrawdown"`
+	Beta                   float64 `json:"beta"`
+	ValueAtRisk            float64 `json:"valueAtRisk"`
+	ConditionalValueAtRisk float64 `json:"conditionalValueAtRisk"`
+	Confidence             float64 `json:"confidence"`
+}
+
+// DailyReturns converts a value series into simple period returns
+func DailyReturns(values []float64) []float64 {
+	returns := make([]float64, 0, len(values))
+	for i := 1; i < len(values); i++ {
+		if values[i-1] == 0 {
+			returns = append(returns, 0)
+			continue
+		}
+		returns = append(returns, values[i]/values[i-1]-1)
+	}
+	return returns
+}
+
+// ComputeRiskMetrics derives risk statistics from aligned daily portfolio and benchmark returns
+func ComputeRiskMetrics(returns, benchmarkReturns []float64, riskFreeRate float64) RiskMetrics {
+	metrics := RiskMetrics{Observations: len(returns), Confidence: VaRConfidence}
+	if len(returns) < 2 {
+		return metrics
+	}
+
+	meanReturn := mean(returns)
+	dailyVolatility := stdDev(returns, meanReturn)
+	dailyRiskFree := riskFreeRate / TradingDaysPerYear
+
+	metrics.AnnualizedReturn = math.Pow(1+meanReturn, TradingDaysPerYear) - 1
+	metrics.Volatility = dailyVolatility * math.Sqrt(TradingDaysPerYear)
+	if dailyVolatility > 0 {
+		metrics.SharpeRatio = (meanReturn - dailyRiskFree) / dailyVolatility * math.Sqrt(TradingDaysPerYear)
+	}
+
+	downsideSquares := 0.0
+	for _, r := range returns {
+		if r < dailyRiskFree {
+			downsideSquares += (r - dailyRiskFree) * (r - dailyRiskFree)
+		}
+	}
+	if downsideDeviation := math.Sqrt(downsideSquares / float64(len(returns))); downsideDeviation > 0 {
+		metrics.SortinoRatio = (meanReturn - dailyRiskFree) / downsideDeviation * math.Sqrt(TradingDaysPerYear)
+	}
+
+	metrics.MaxDrawdown = maxDrawdown(returns)
+	metrics.ValueAtRisk, metrics.ConditionalValueAtRisk = historicalVaR(returns, VaRConfidence)
+
+	if len(benchmarkReturns) == len(returns) {
+		benchmarkMean := mean(benchmarkReturns)
+		covariance, benchmarkVariance := 0.0, 0.0
+		for i := range returns {
+			covariance += (returns[i] - meanReturn) * (benchmarkReturns[i] - benchmarkMean)
+			benchmarkVariance += (benchmarkReturns[i] - benchmarkMean) * (benchmarkReturns[i] - benchmarkMean)
+		}
+		if benchmarkVariance > 0 {
+			metrics.Beta = covariance / benchmarkVariance
+		}
+	}
+	return metrics
+}
+
+func mean(values []float64) float64 {
+	total := 0.0
+	for _, v := range values {
+		total += v
+	}
+	return total / float64(len(values))
+}
+
+func stdDev(values []float64, mean float64) float64 {
+	total := 0.0
+	for _, v := range values {
+		total += (v - mean) * (v - mean)
+	}
+	return math.Sqrt(total / float64(len(values)-1))
+}
+
+// maxDrawdown returns the largest peak-to-trough loss of the compounded returns as a positive fraction
+func maxDrawdown(returns []float64) float64 {
+	value, peak, drawdown := 1.0, 1.0, 0.0
+	for _, r := range returns {
+		value *= 1 + r
+		peak = math.Max(peak, value)
+		drawdown = math.Max(drawdown, 1-value/peak)
+	}
+	return drawdown
+}
+
+// historicalVaR returns the one-day value at risk and expected shortfall as positive loss fractions
+func historicalVaR(returns []float64, confidence float64) (float64, float64) {
+	sorted := append([]float64(nil), returns...)
+	sort.Float64s(sorted)
+	tail := int(math.Floor((1 - confidence) * float64(len(sorted))))
+	if tail < 1 {
+		tail = 1
+	}
+	valueAtRisk := -sorted[tail-1]
+	expectedShortfall := -mean(sorted[:tail])
+	return math.Max(valueAtRisk, 0), math.Max(expectedShortfall, 0)
+}
@@ -0,0 +1,178 @@
+package analytics
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func approxEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestDailyReturns(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []float64
+		want   []float64
+	}{
+		{name: "empty", values: nil, want: []float64{}},
+		{name: "single value", values: []float64{100}, want: []float64{}},
+		{name: "gains and losses", values: []float64{100, 110, 99}, want: []float64{0.1, -0.1}},
+		{name: "zero value", values: []float64{0, 100, 50}, want: []float64{0, -0.5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := DailyReturns(tt.values)
+			if len(got) != len(tt.want) {
+				t.Fatalf("DailyReturns() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if !approxEqual(got[i], tt.want[i]) {
+					t.Errorf("DailyReturns()[%d] = %v, want %v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestMaxDrawdown(t *testing.T) {
+	tests := []struct {
+		name    string
+		returns []float64
+		want    float64
+	}{
+		{name: "only gains", returns: []float64{0.01, 0.02, 0.03}, want: 0},
+		{name: "single loss", returns: []float64{0.1, -0.2}, want: 0.2},
+		{name: "compounded losses", returns: []float64{-0.1, -0.1, 0.5}, want: 0.19},
+		{name: "deepest of two drawdowns", returns: []float64{-0.1, 0.2, -0.3, 0.1}, want: 0.3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := maxDrawdown(tt.returns); !approxEqual(got, tt.want) {
+				t.Errorf("maxDrawdown() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHistoricalVaR(t *testing.T) {
+	twenty := make([]float64, 20)
+	for i := range twenty {
+		twenty[i] = float64(i-5) / 100 // -0.05 ... 0.14
+	}
+	forty := make([]float64, 40)
+	for i := range forty {
+		forty[i] = float64(i-10) / 100 // -0.10 ... 0.29
+	}
+
+	tests := []struct {
+		name          string
+		returns       []float64
+		wantVaR       float64
+		wantShortfall float64
+	}{
+		{name: "single worst day", returns: twenty, wantVaR: 0.05, wantShortfall: 0.05},
+		{name: "two tail days", returns: forty, wantVaR: 0.09, wantShortfall: 0.095},
+		{name: "short history uses the worst day", returns: []float64{0.01, -0.03, 0.02}, wantVaR: 0.03, wantShortfall: 0.03},
+		{name: "no losses", returns: []float64{0.01, 0.02, 0.03}, wantVaR: 0, wantShortfall: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			valueAtRisk, shortfall := historicalVaR(tt.returns, VaRConfidence)
+			if !approxEqual(valueAtRisk, tt.wantVaR) {
+				t.Errorf("value at risk = %v, want %v", valueAtRisk, tt.wantVaR)
+			}
+			if !approxEqual(shortfall, tt.wantShortfall) {
+				t.Errorf("expected shortfall = %v, want %v", shortfall, tt.wantShortfall)
+			}
+		})
+	}
+}
+
+func TestComputeRiskMetrics(t *testing.T) {
+	returns := []float64{0.01, -0.02, 0.015, 0.005, -0.01}
+
+	tests := []struct {
+		name      string
+		returns   []float64
+		benchmark []float64
+		check     func(t *testing.T, metrics RiskMetrics)
+	}{
+		{
+			name:    "too few observations",
+			returns: []float64{0.01},
+			check: func(t *testing.T, metrics RiskMetrics) {
+				want := RiskMetrics{Observations: 1, Confidence: VaRConfidence}
+				if !reflect.DeepEqual(metrics, want) {
+					t.Errorf("metrics = %+v, want %+v", metrics, want)
+				}
+			},
+		},
+		{
+			name:      "benchmark equal to the portfolio",
+			returns:   returns,
+			benchmark: returns,
+			check: func(t *testing.T, metrics RiskMetrics) {
+				if !approxEqual(metrics.Beta, 1) {
+					t.Errorf("Beta = %v, want 1", metrics.Beta)
+				}
+			},
+		},
+		{
+			name:      "benchmark moving twice as much",
+			returns:   returns,
+			benchmark: []float64{0.02, -0.04, 0.03, 0.01, -0.02},
+			check: func(t *testing.T, metrics RiskMetrics) {
+				if !approxEqual(metrics.Beta, 0.5) {
+					t.Errorf("Beta = %v, want 0.5", metrics.Beta)
+				}
+			},
+		},
+		{
+			name:      "misaligned benchmark is ignored",
+			returns:   returns,
+			benchmark: []float64{0.01},
+			check: func(t *testing.T, metrics RiskMetrics) {
+				if metrics.Beta != 0 {
+					t.Errorf("Beta = %v, want 0", metrics.Beta)
+				}
+			},
+		},
+		{
+			name:    "annualised statistics",
+			returns: returns,
+			check: func(t *testing.T, metrics RiskMetrics) {
+				meanReturn := 0.0
+				wantVolatility := 0.0
+				for _, r := range returns {
+					meanReturn += r / float64(len(returns))
+				}
+				for _, r := range returns {
+					wantVolatility += (r - meanReturn) * (r - meanReturn)
+				}
+				wantVolatility = math.Sqrt(wantVolatility/float64(len(returns)-1)) * math.Sqrt(TradingDaysPerYear)
+				if !approxEqual(metrics.Volatility, wantVolatility) {
+					t.Errorf("Volatility = %v, want %v", metrics.Volatility, wantVolatility)
+				}
+				if want := math.Pow(1+meanReturn, TradingDaysPerYear) - 1; !approxEqual(metrics.AnnualizedReturn, want) {
+					t.Errorf("AnnualizedReturn = %v, want %v", metrics.AnnualizedReturn, want)
+				}
+				if !approxEqual(metrics.ValueAtRisk, 0.02) || !approxEqual(metrics.ConditionalValueAtRisk, 0.02) {
+					t.Errorf("VaR = %v, CVaR = %v, want 0.02", metrics.ValueAtRisk, metrics.ConditionalValueAtRisk)
+				}
+				if !approxEqual(metrics.MaxDrawdown, 0.02) {
+					t.Errorf("MaxDrawdown = %v, want 0.02", metrics.MaxDrawdown)
+				}
+				if metrics.Observations != len(returns) {
+					t.Errorf("Observations = %d, want %d", metrics.Observations, len(returns))
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.check(t, ComputeRiskMetrics(tt.returns, tt.benchmark, DefaultRiskFreeRate))
+		})
+	}
+}
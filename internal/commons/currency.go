@@ -0,0 +1,113 @@
+package commons
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/KZY20112001/infinivest-backend/internal/commons/decimal"
+)
+
+// DefaultCurrency is used for users, portfolios and assets that have no currency of their own
+const DefaultCurrency = "USD"
+
+const (
+	// share counts are booked to a millionth of a share and prices to a ten-thousandth of the quote currency
+	SharePlaces = 6
+	PricePlaces = 4
+)
+
+var (
+	// exchange suffixes of listings that are not quoted in US dollars
+	exchangeCurrencies = map[string]string{
+		"L":  "GBP",
+		"TO": "CAD",
+		"V":  "CAD",
+		"DE": "EUR",
+		"F":  "EUR",
+		"PA": "EUR",
+		"AS": "EUR",
+		"MI": "EUR",
+		"MC": "EUR",
+		"SW": "CHF",
+		"T":  "JPY",
+		"HK": "HKD",
+		"SI": "SGD",
+		"AX": "AUD",
+	}
+
+	// digits after the point of currencies whose minor unit is not a hundredth
+	currencyPlaces = map[string]int{
+		"JPY": 0,
+		"KRW": 0,
+		"BHD": 3,
+		"KWD": 3,
+	}
+
+	// rates per US dollar used when no FX rates file is configured
+	DefaultFXRates = map[string]decimal.Decimal{
+		"USD": decimal.One,
+		"EUR": decimal.MustParse("0.92"),
+		"GBP": decimal.MustParse("0.79"),
+		"CAD": decimal.MustParse("1.36"),
+		"CHF": decimal.MustParse("0.88"),
+		"JPY": decimal.MustParse("151.5"),
+		"HKD": decimal.MustParse("7.82"),
+		"SGD": decimal.MustParse("1.35"),
+		"AUD": decimal.MustParse("1.52"),
+	}
+)
+
+// NormalizeCurrency returns the upper case ISO 4217 code, or the default currency when none is given
+func NormalizeCurrency(currency string) (string, error) {
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	if currency == "" {
+		return DefaultCurrency, nil
+	}
+	if len(currency) != 3 || strings.Trim(currency, "ABCDEFGHIJKLMNOPQRSTUVWXYZ") != "" {
+		return "", fmt.Errorf("invalid currency code: %s", currency)
+	}
+	return currency, nil
+}
+
+// CurrencyPlaces is the number of digits after the point amounts in the currency are booked at
+func CurrencyPlaces(currency string) int {
+	if places, exists := currencyPlaces[currency]; exists {
+		return places
+	}
+	return 2
+}
+
+// MinorUnit is the smallest amount of the currency, such as 0.01 for USD
+func MinorUnit(currency string) decimal.Decimal {
+	return decimal.New(1, -CurrencyPlaces(currency))
+}
+
+// RoundCash rounds an amount half to even to the currency's minor unit
+func RoundCash(amount decimal.Decimal, currency string) decimal.Decimal {
+	return amount.RoundBank(CurrencyPlaces(currency))
+}
+
+// FormatCash formats an amount with the currency's minor unit digits, such as "12.50"
+func FormatCash(amount decimal.Decimal, currency string) string {
+	return amount.StringFixed(CurrencyPlaces(currency))
+}
+
+// RoundShares truncates a share count to the booked precision, so a trade never exceeds what it was sized from
+func RoundShares(shares decimal.Decimal) decimal.Decimal {
+	return shares.Truncate(SharePlaces)
+}
+
+// RoundPrice rounds a price or cost per share half to even to the booked precision
+func RoundPrice(price decimal.Decimal) decimal.Decimal {
+	return price.RoundBank(PricePlaces)
+}
+
+// SymbolCurrency returns the currency an asset is quoted in from the exchange suffix of its symbol
+func SymbolCurrency(symbol string) string {
+	if i := strings.LastIndex(symbol, "."); i >= 0 {
+		if currency, exists := exchangeCurrencies[strings.ToUpper(symbol[i+1:])]; exists {
+			return currency
+		}
+	}
+	return DefaultCurrency
+}
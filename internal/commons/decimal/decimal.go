@@ -0,0 +1,320 @@
+// Package decimal provides the fixed-point numbers used for money, prices, share counts and exchange rates.
+//
+// A Decimal holds a value with Scale digits after the point, so sums and differences are exact. Products and
+// quotients are rounded half to even at Scale and the result of a calculation is rounded to the precision it
+// is booked at with Round, RoundBank or Truncate. Decimals are stored as numeric in Postgres and serialize to
+// JSON as strings; numbers are accepted when decoding.
+package decimal
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+)
+
+// Scale is the number of digits kept after the decimal point
+const Scale = 8
+
+var (
+	// a plain decimal literal, the exponent is bounded so parsing cannot allocate huge numbers
+	literalRegex = regexp.MustCompile(`^[+-]?(\d+\.?\d*|\.\d+)([eE][+-]?\d{1,3})?$`)
+
+	scaleFactor = pow10(Scale)
+	bigOne      = big.NewInt(1)
+
+	Zero = Decimal{}
+	One  = NewFromInt(1)
+)
+
+// Decimal is a fixed-point number. The zero value is 0.
+type Decimal struct {
+	v *big.Int // the value times 10^Scale, nil for zero
+}
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+// New returns value * 10^exp, rounding half to even at Scale
+func New(value int64, exp int) Decimal {
+	v := new(big.Int).Mul(big.NewInt(value), scaleFactor)
+	if exp >= 0 {
+		return Decimal{v: v.Mul(v, pow10(exp))}
+	}
+	return Decimal{v: quoRoundHalfEven(v, pow10(-exp))}
+}
+
+func NewFromInt(i int64) Decimal {
+	return Decimal{v: new(big.Int).Mul(big.NewInt(i), scaleFactor)}
+}
+
+// NewFromFloat converts f, rounding half to even at Scale. NaN and infinities convert to zero.
+func NewFromFloat(f float64) Decimal {
+	r := new(big.Rat)
+	if r.SetFloat64(f) == nil {
+		return Zero
+	}
+	return fromRat(r)
+}
+
+// Parse reads a decimal such as "-12.345" or "1e-3", rounding half to even at Scale. Fractions like "1/3",
+// other bases and exponents of more than three digits are rejected.
+func Parse(s string) (Decimal, error) {
+	s = strings.TrimSpace(s)
+	if !literalRegex.MatchString(s) {
+		return Zero, fmt.Errorf("invalid decimal: %q", s)
+	}
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return Zero, fmt.Errorf("invalid decimal: %q", s)
+	}
+	return fromRat(r), nil
+}
+
+// MustParse is Parse for constants, it panics on invalid input
+func MustParse(s string) Decimal {
+	d, err := Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+func fromRat(r *big.Rat) Decimal {
+	num := new(big.Int).Mul(r.Num(), scaleFactor)
+	return Decimal{v: quoRoundHalfEven(num, r.Denom())}
+}
+
+// quoRoundHalfEven divides a by b, rounding half to even
+func quoRoundHalfEven(a, b *big.Int) *big.Int {
+	q, rem := new(big.Int).QuoRem(a, b, new(big.Int))
+	if rem.Sign() == 0 {
+		return q
+	}
+	cmp := new(big.Int).Abs(new(big.Int).Lsh(rem, 1)).Cmp(new(big.Int).Abs(b))
+	if cmp > 0 || (cmp == 0 && q.Bit(0) == 1) {
+		if (a.Sign() < 0) != (b.Sign() < 0) {
+			q.Sub(q, bigOne)
+		} else {
+			q.Add(q, bigOne)
+		}
+	}
+	return q
+}
+
+func (d Decimal) int() *big.Int {
+	if d.v == nil {
+		return new(big.Int)
+	}
+	return d.v
+}
+
+func (d Decimal) Add(o Decimal) Decimal {
+	return Decimal{v: new(big.Int).Add(d.int(), o.int())}
+}
+
+func (d Decimal) Sub(o Decimal) Decimal {
+	return Decimal{v: new(big.Int).Sub(d.int(), o.int())}
+}
+
+// Mul multiplies, rounding half to even at Scale
+func (d Decimal) Mul(o Decimal) Decimal {
+	return Decimal{v: quoRoundHalfEven(new(big.Int).Mul(d.int(), o.int()), scaleFactor)}
+}
+
+// Div divides, rounding half to even at Scale. It panics when o is zero.
+func (d Decimal) Div(o Decimal) Decimal {
+	if o.IsZero() {
+		panic("decimal: division by zero")
+	}
+	return Decimal{v: quoRoundHalfEven(new(big.Int).Mul(d.int(), scaleFactor), o.int())}
+}
+
+// MulFloat multiplies by a ratio such as a weight or a fee rate
+func (d Decimal) MulFloat(f float64) Decimal {
+	return d.Mul(NewFromFloat(f))
+}
+
+func (d Decimal) Neg() Decimal {
+	return Decimal{v: new(big.Int).Neg(d.int())}
+}
+
+func (d Decimal) Abs() Decimal {
+	return Decimal{v: new(big.Int).Abs(d.int())}
+}
+
+func (d Decimal) Cmp(o Decimal) int {
+	return d.int().Cmp(o.int())
+}
+
+func (d Decimal) Equal(o Decimal) bool              { return d.Cmp(o) == 0 }
+func (d Decimal) LessThan(o Decimal) bool           { return d.Cmp(o) < 0 }
+func (d Decimal) LessThanOrEqual(o Decimal) bool    { return d.Cmp(o) <= 0 }
+func (d Decimal) GreaterThan(o Decimal) bool        { return d.Cmp(o) > 0 }
+func (d Decimal) GreaterThanOrEqual(o Decimal) bool { return d.Cmp(o) >= 0 }
+
+func (d Decimal) Sign() int        { return d.int().Sign() }
+func (d Decimal) IsZero() bool     { return d.Sign() == 0 }
+func (d Decimal) IsPositive() bool { return d.Sign() > 0 }
+func (d Decimal) IsNegative() bool { return d.Sign() < 0 }
+
+// Round rounds half away from zero to places digits after the point
+func (d Decimal) Round(places int) Decimal {
+	return d.round(places, func(q *big.Int, twiceRem int) bool {
+		return twiceRem >= 0
+	})
+}
+
+// RoundBank rounds half to even to places digits after the point
+func (d Decimal) RoundBank(places int) Decimal {
+	return d.round(places, func(q *big.Int, twiceRem int) bool {
+		return twiceRem > 0 || (twiceRem == 0 && q.Bit(0) == 1)
+	})
+}
+
+// Truncate drops the digits after places, rounding towards zero
+func (d Decimal) Truncate(places int) Decimal {
+	return d.round(places, func(*big.Int, int) bool { return false })
+}
+
+// round keeps places digits; away reports whether to move the truncated quotient away from zero given how twice
+// the remainder compares to the unit being dropped
+func (d Decimal) round(places int, away func(q *big.Int, twiceRem int) bool) Decimal {
+	if places >= Scale {
+		return d
+	}
+	if places < 0 {
+		places = 0
+	}
+	unit := pow10(Scale - places)
+	q, rem := new(big.Int).QuoRem(d.int(), unit, new(big.Int))
+	if rem.Sign() != 0 {
+		twiceRem := new(big.Int).Abs(new(big.Int).Lsh(rem, 1)).Cmp(unit)
+		if away(q, twiceRem) {
+			if d.IsNegative() {
+				q.Sub(q, bigOne)
+			} else {
+				q.Add(q, bigOne)
+			}
+		}
+	}
+	return Decimal{v: q.Mul(q, unit)}
+}
+
+// Float64 returns the nearest float, for statistics and display ratios
+func (d Decimal) Float64() float64 {
+	f, _ := new(big.Rat).SetFrac(d.int(), scaleFactor).Float64()
+	return f
+}
+
+// String formats d without trailing zeros, such as "12.5" or "-0.001"
+func (d Decimal) String() string {
+	s := d.StringFixed(Scale)
+	if strings.Contains(s, ".") {
+		s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	}
+	if s == "-0" {
+		return "0"
+	}
+	return s
+}
+
+// StringFixed formats d rounded half away from zero with exactly places digits after the point
+func (d Decimal) StringFixed(places int) string {
+	if places > Scale {
+		places = Scale
+	}
+	if places < 0 {
+		places = 0
+	}
+	v := d.Round(places).int()
+	digits := new(big.Int).Abs(v).String()
+	if len(digits) <= Scale {
+		digits = strings.Repeat("0", Scale-len(digits)+1) + digits
+	}
+	point := len(digits) - Scale
+	s := digits[:point]
+	if places > 0 {
+		s += "." + digits[point:point+places]
+	}
+	if v.Sign() < 0 {
+		s = "-" + s
+	}
+	return s
+}
+
+func Min(first Decimal, rest ...Decimal) Decimal {
+	for _, d := range rest {
+		if d.LessThan(first) {
+			first = d
+		}
+	}
+	return first
+}
+
+func Max(first Decimal, rest ...Decimal) Decimal {
+	for _, d := range rest {
+		if d.GreaterThan(first) {
+			first = d
+		}
+	}
+	return first
+}
+
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// UnmarshalJSON accepts strings and numbers
+func (d *Decimal) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(string(data), `"`)
+	if s == "null" || s == "" {
+		*d = Zero
+		return nil
+	}
+	parsed, err := Parse(s)
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
+
+func (d Decimal) Value() (driver.Value, error) {
+	return d.String(), nil
+}
+
+func (d *Decimal) Scan(value any) error {
+	switch v := value.(type) {
+	case nil:
+		*d = Zero
+	case string:
+		return d.scanString(v)
+	case []byte:
+		return d.scanString(string(v))
+	case float64:
+		*d = NewFromFloat(v)
+	case int64:
+		*d = NewFromInt(v)
+	default:
+		return fmt.Errorf("cannot scan %T into a decimal", value)
+	}
+	return nil
+}
+
+func (d *Decimal) scanString(s string) error {
+	parsed, err := Parse(s)
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
+
+// GormDataType stores decimals as numeric, existing double precision columns are converted by AutoMigrate
+func (Decimal) GormDataType() string {
+	return "numeric"
+}
@@ -0,0 +1,241 @@
+package decimal
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{input: "0", want: "0"},
+		{input: "12.345", want: "12.345"},
+		{input: "-12.345", want: "-12.345"},
+		{input: "+7", want: "7"},
+		{input: " 1.50 ", want: "1.5"},
+		{input: ".5", want: "0.5"},
+		{input: "5.", want: "5"},
+		{input: "1e-3", want: "0.001"},
+		{input: "2.5E2", want: "250"},
+		{input: "0.000000005", want: "0"},            // half to even at Scale
+		{input: "0.000000015", want: "0.00000002"},   // half to even at Scale
+		{input: "-0.000000025", want: "-0.00000002"}, // half to even at Scale
+		{input: "", wantErr: true},
+		{input: "abc", wantErr: true},
+		{input: "1/3", wantErr: true},
+		{input: "0x10", wantErr: true},
+		{input: "1_000", wantErr: true},
+		{input: "1e1000", wantErr: true},
+		{input: "NaN", wantErr: true},
+		{input: "Inf", wantErr: true},
+		{input: "1.2.3", wantErr: true},
+		{input: "-", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := Parse(tt.input)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Parse(%q) = %s, want an error", tt.input, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse(%q) error = %v", tt.input, err)
+			}
+			if got.String() != tt.want {
+				t.Errorf("Parse(%q) = %s, want %s", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRounding(t *testing.T) {
+	tests := []struct {
+		value     string
+		places    int
+		round     string
+		roundBank string
+		truncate  string
+	}{
+		{value: "2.345", places: 2, round: "2.35", roundBank: "2.34", truncate: "2.34"},
+		{value: "2.355", places: 2, round: "2.36", roundBank: "2.36", truncate: "2.35"},
+		{value: "-2.345", places: 2, round: "-2.35", roundBank: "-2.34", truncate: "-2.34"},
+		{value: "2.5", places: 0, round: "3", roundBank: "2", truncate: "2"},
+		{value: "3.5", places: 0, round: "4", roundBank: "4", truncate: "3"},
+		{value: "-0.5", places: 0, round: "-1", roundBank: "0", truncate: "0"},
+		{value: "1.2346", places: 3, round: "1.235", roundBank: "1.235", truncate: "1.234"},
+		{value: "1.23", places: 8, round: "1.23", roundBank: "1.23", truncate: "1.23"},
+		{value: "12.5", places: -1, round: "13", roundBank: "12", truncate: "12"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			d := MustParse(tt.value)
+			if got := d.Round(tt.places).String(); got != tt.round {
+				t.Errorf("Round(%d) = %s, want %s", tt.places, got, tt.round)
+			}
+			if got := d.RoundBank(tt.places).String(); got != tt.roundBank {
+				t.Errorf("RoundBank(%d) = %s, want %s", tt.places, got, tt.roundBank)
+			}
+			if got := d.Truncate(tt.places).String(); got != tt.truncate {
+				t.Errorf("Truncate(%d) = %s, want %s", tt.places, got, tt.truncate)
+			}
+		})
+	}
+}
+
+func TestArithmetic(t *testing.T) {
+	tests := []struct {
+		name string
+		got  Decimal
+		want string
+	}{
+		{name: "add is exact", got: MustParse("0.1").Add(MustParse("0.2")), want: "0.3"},
+		{name: "sub", got: MustParse("1").Sub(MustParse("1.00000001")), want: "-0.00000001"},
+		{name: "mul", got: MustParse("1.5").Mul(MustParse("-2.25")), want: "-3.375"},
+		{name: "mul rounds half to even", got: MustParse("0.00000001").Mul(MustParse("0.5")), want: "0"},
+		{name: "mul float", got: MustParse("200").MulFloat(0.015), want: "3"},
+		{name: "div", got: MustParse("10").Div(MustParse("4")), want: "2.5"},
+		{name: "div repeating", got: One.Div(MustParse("3")), want: "0.33333333"},
+		{name: "div rounds up", got: MustParse("2").Div(MustParse("3")), want: "0.66666667"},
+		{name: "div negative", got: MustParse("-2").Div(MustParse("3")), want: "-0.66666667"},
+		{name: "div half to even", got: MustParse("0.00000001").Div(MustParse("2")), want: "0"},
+		{name: "div half to even odd", got: MustParse("0.00000003").Div(MustParse("2")), want: "0.00000002"},
+		{name: "neg", got: MustParse("4.2").Neg(), want: "-4.2"},
+		{name: "abs", got: MustParse("-4.2").Abs(), want: "4.2"},
+		{name: "min", got: Min(MustParse("3"), MustParse("-1"), MustParse("2")), want: "-1"},
+		{name: "max", got: Max(MustParse("3"), MustParse("-1"), MustParse("5")), want: "5"},
+		{name: "from float", got: NewFromFloat(0.1), want: "0.1"},
+		{name: "new with exponent", got: New(12345, -2), want: "123.45"},
+		{name: "zero value", got: Decimal{}.Add(Zero), want: "0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got.String() != tt.want {
+				t.Errorf("got %s, want %s", tt.got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDivByZeroPanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Div by zero did not panic")
+		}
+	}()
+	One.Div(Zero)
+}
+
+func TestStringFixed(t *testing.T) {
+	tests := []struct {
+		value  string
+		places int
+		want   string
+	}{
+		{value: "12.5", places: 2, want: "12.50"},
+		{value: "0.005", places: 2, want: "0.01"},
+		{value: "-0.004", places: 2, want: "0.00"},
+		{value: "1234.5678", places: 0, want: "1235"},
+		{value: "0.00000001", places: 10, want: "0.00000001"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			if got := MustParse(tt.value).StringFixed(tt.places); got != tt.want {
+				t.Errorf("StringFixed(%d) = %s, want %s", tt.places, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJSON(t *testing.T) {
+	type payload struct {
+		Amount Decimal `json:"amount"`
+	}
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{name: "string", input: `{"amount":"12.34"}`, want: `{"amount":"12.34"}`},
+		{name: "number", input: `{"amount":12.34}`, want: `{"amount":"12.34"}`},
+		{name: "null", input: `{"amount":null}`, want: `{"amount":"0"}`},
+		{name: "exponent", input: `{"amount":1e2}`, want: `{"amount":"100"}`},
+		{name: "fraction", input: `{"amount":"1/3"}`, wantErr: true},
+		{name: "text", input: `{"amount":"ten"}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var p payload
+			err := json.Unmarshal([]byte(tt.input), &p)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Unmarshal(%s) = %s, want an error", tt.input, p.Amount)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unmarshal(%s) error = %v", tt.input, err)
+			}
+			out, err := json.Marshal(p)
+			if err != nil {
+				t.Fatalf("Marshal error = %v", err)
+			}
+			if string(out) != tt.want {
+				t.Errorf("round trip of %s = %s, want %s", tt.input, out, tt.want)
+			}
+		})
+	}
+}
+
+func TestValueScan(t *testing.T) {
+	tests := []struct {
+		name    string
+		scanned any
+		want    string
+		wantErr bool
+	}{
+		{name: "numeric text", scanned: "123.45600000", want: "123.456"},
+		{name: "numeric bytes", scanned: []byte("-0.00000001"), want: "-0.00000001"},
+		{name: "double precision", scanned: 0.25, want: "0.25"},
+		{name: "integer", scanned: int64(42), want: "42"},
+		{name: "null", scanned: nil, want: "0"},
+		{name: "not a number", scanned: "NaN", wantErr: true},
+		{name: "unsupported type", scanned: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := MustParse("99")
+			err := d.Scan(tt.scanned)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Scan(%v) = %s, want an error", tt.scanned, d)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Scan(%v) error = %v", tt.scanned, err)
+			}
+			if d.String() != tt.want {
+				t.Errorf("Scan(%v) = %s, want %s", tt.scanned, d, tt.want)
+			}
+
+			// what is written back scans to the same value
+			value, err := d.Value()
+			if err != nil {
+				t.Fatalf("Value() error = %v", err)
+			}
+			var roundTrip Decimal
+			if err := roundTrip.Scan(value); err != nil {
+				t.Fatalf("Scan(Value()) error = %v", err)
+			}
+			if !roundTrip.Equal(d) {
+				t.Errorf("Scan(Value()) = %s, want %s", roundTrip, d)
+			}
+		})
+	}
+}
@@ -12,18 +12,25 @@ var (
 	ErrInternal           = errors.New("internal Error")
 	ErrNil                = errors.New("nil value")
 	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrUnavailable        = errors.New("service unavailable")
+	ErrPartialFill        = errors.New("request can only be partially filled")
 )
 
 func HandleError(c *gin.Context, err error) {
 	if err != nil {
-		switch err {
-		case gorm.ErrDuplicatedKey:
+		// sentinels are usually wrapped with context, so match them anywhere in the chain
+		switch {
+		case errors.Is(err, gorm.ErrDuplicatedKey):
 			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
-		case gorm.ErrRecordNotFound:
+		case errors.Is(err, gorm.ErrRecordNotFound):
 			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
-		case ErrInternal:
+		case errors.Is(err, ErrPartialFill):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case errors.Is(err, ErrInternal):
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		case ErrNil:
+		case errors.Is(err, ErrUnavailable):
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		case errors.Is(err, ErrNil):
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		default:
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
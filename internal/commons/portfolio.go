@@ -2,9 +2,49 @@ package commons
 
 import (
 	"fmt"
+	"regexp"
 	"time"
 )
 
+const (
+	// a loss is disallowed if the same security is bought within this window around the sale
+	WashSaleWindow          = 30 * 24 * time.Hour
+	DefaultHarvestThreshold = 5.0 // percent
+
+	// manual portfolios trade a holding back to target once it is this far off, in percent of the target value
+	DefaultManualRebalanceThreshold = 3.0
+
+	DefaultGlidePathEndEquity = 30.0 // percent
+	DefaultGlidePathEndCash   = 10.0 // percent
+	// category targets only move once the glide path has shifted by at least this many percentage points
+	GlidePathStep = 1.0
+
+	// stop and trailing-stop buys fill at the market price once triggered, so they reserve this much above the stop
+	StopOrderReserveBuffer = 0.05
+)
+
+// tickers such as VOO, BRK.B, VOD.L, BTC-USD or ^GSPC
+var symbolRegex = regexp.MustCompile(`^[A-Z0-9^][A-Z0-9.\-=^]{0,19}$`)
+
+// IsValidSymbol reports whether symbol is an upper-case ticker that is safe to pass to the price service
+func IsValidSymbol(symbol string) bool {
+	return symbolRegex.MatchString(symbol)
+}
+
+type SubstituteAsset struct {
+	Symbol string
+	Name   string
+}
+
+type AssetProfile struct {
+	Symbol   string
+	Name     string
+	Category string
+	Sector   string
+	ESGScore float64
+	Approved bool
+}
+
 var (
 	RebalancingThresholds = map[string]float64{
 		"daily":      10.0, // ±10%
@@ -15,6 +55,151 @@ var (
 		"biannually": 1.0,  // ±1%
 		"annually":   0.5,  // ±0.5%
 	}
+
+	AllocationEngines = map[string]bool{
+		"genai": true,
+		"local": true,
+	}
+
+	// similar funds from the same category that can replace a harvested position
+	TaxLossHarvestingSubstitutes = map[string][]SubstituteAsset{
+		"VOO":  {{Symbol: "IVV", Name: "iShares Core S&P 500 ETF"}, {Symbol: "SPLG", Name: "SPDR Portfolio S&P 500 ETF"}},
+		"IVV":  {{Symbol: "VOO", Name: "Vanguard S&P 500 ETF"}, {Symbol: "SPLG", Name: "SPDR Portfolio S&P 500 ETF"}},
+		"SPY":  {{Symbol: "IVV", Name: "iShares Core S&P 500 ETF"}, {Symbol: "VOO", Name: "Vanguard S&P 500 ETF"}},
+		"SPLG": {{Symbol: "VOO", Name: "Vanguard S&P 500 ETF"}, {Symbol: "IVV", Name: "iShares Core S&P 500 ETF"}},
+		"VTI":  {{Symbol: "ITOT", Name: "iShares Core S&P Total U.S. Stock Market ETF"}, {Symbol: "SCHB", Name: "Schwab U.S. Broad Market ETF"}},
+		"ITOT": {{Symbol: "VTI", Name: "Vanguard Total Stock Market ETF"}, {Symbol: "SCHB", Name: "Schwab U.S. Broad Market ETF"}},
+		"SCHB": {{Symbol: "VTI", Name: "Vanguard Total Stock Market ETF"}, {Symbol: "ITOT", Name: "iShares Core S&P Total U.S. Stock Market ETF"}},
+		"VB":   {{Symbol: "IJR", Name: "iShares Core S&P Small-Cap ETF"}, {Symbol: "SCHA", Name: "Schwab U.S. Small-Cap ETF"}},
+		"IJR":  {{Symbol: "VB", Name: "Vanguard Small-Cap ETF"}, {Symbol: "SCHA", Name: "Schwab U.S. Small-Cap ETF"}},
+		"SCHA": {{Symbol: "VB", Name: "Vanguard Small-Cap ETF"}, {Symbol: "IJR", Name: "iShares Core S&P Small-Cap ETF"}},
+		"IWM":  {{Symbol: "VB", Name: "Vanguard Small-Cap ETF"}, {Symbol: "IJR", Name: "iShares Core S&P Small-Cap ETF"}},
+		"VEA":  {{Symbol: "IEFA", Name: "iShares Core MSCI EAFE ETF"}, {Symbol: "SCHF", Name: "Schwab International Equity ETF"}},
+		"IEFA": {{Symbol: "VEA", Name: "Vanguard FTSE Developed Markets ETF"}, {Symbol: "SCHF", Name: "Schwab International Equity ETF"}},
+		"SCHF": {{Symbol: "VEA", Name: "Vanguard FTSE Developed Markets ETF"}, {Symbol: "IEFA", Name: "iShares Core MSCI EAFE ETF"}},
+		"VXUS": {{Symbol: "IXUS", Name: "iShares Core MSCI Total International Stock ETF"}, {Symbol: "VEU", Name: "Vanguard FTSE All-World ex-US ETF"}},
+		"IXUS": {{Symbol: "VXUS", Name: "Vanguard Total International Stock ETF"}, {Symbol: "VEU", Name: "Vanguard FTSE All-World ex-US ETF"}},
+		"VWO":  {{Symbol: "IEMG", Name: "iShares Core MSCI Emerging Markets ETF"}, {Symbol: "SCHE", Name: "Schwab Emerging Markets Equity ETF"}},
+		"IEMG": {{Symbol: "VWO", Name: "Vanguard FTSE Emerging Markets ETF"}, {Symbol: "SCHE", Name: "Schwab Emerging Markets Equity ETF"}},
+		"EEM":  {{Symbol: "IEMG", Name: "iShares Core MSCI Emerging Markets ETF"}, {Symbol: "VWO", Name: "Vanguard FTSE Emerging Markets ETF"}},
+		"BND":  {{Symbol: "AGG", Name: "iShares Core U.S. Aggregate Bond ETF"}, {Symbol: "SCHZ", Name: "Schwab U.S. Aggregate Bond ETF"}},
+		"AGG":  {{Symbol: "BND", Name: "Vanguard Total Bond Market ETF"}, {Symbol: "SCHZ", Name: "Schwab U.S. Aggregate Bond ETF"}},
+		"SCHZ": {{Symbol: "BND", Name: "Vanguard Total Bond Market ETF"}, {Symbol: "AGG", Name: "iShares Core U.S. Aggregate Bond ETF"}},
+		"BIV":  {{Symbol: "IEI", Name: "iShares 3-7 Year Treasury Bond ETF"}, {Symbol: "SCHR", Name: "Schwab Intermediate-Term U.S. Treasury ETF"}},
+		"IEI":  {{Symbol: "BIV", Name: "Vanguard Intermediate-Term Bond ETF"}, {Symbol: "SCHR", Name: "Schwab Intermediate-Term U.S. Treasury ETF"}},
+		"BNDX": {{Symbol: "IAGG", Name: "iShares Core International Aggregate Bond ETF"}, {Symbol: "BWX", Name: "SPDR Bloomberg International Treasury Bond ETF"}},
+		"IAGG": {{Symbol: "BNDX", Name: "Vanguard Total International Bond ETF"}, {Symbol: "BWX", Name: "SPDR Bloomberg International Treasury Bond ETF"}},
+	}
+
+	ExclusionRuleTypes = map[string]bool{
+		"symbol":  true,
+		"sector":  true,
+		"min-esg": true,
+	}
+
+	// metadata seeded for commonly recommended funds; approved funds can replace excluded ones in the same category
+	DefaultAssetMetadata = []AssetProfile{
+		{Symbol: "VOO", Name: "Vanguard S&P 500 ETF", Category: "largeCapBlend", Sector: "diversified", ESGScore: 6.4, Approved: true},
+		{Symbol: "IVV", Name: "iShares Core S&P 500 ETF", Category: "largeCapBlend", Sector: "diversified", ESGScore: 6.4, Approved: true},
+		{Symbol: "SPY", Name: "SPDR S&P 500 ETF Trust", Category: "largeCapBlend", Sector: "diversified", ESGScore: 6.4},
+		{Symbol: "VTI", Name: "Vanguard Total Stock Market ETF", Category: "largeCapBlend", Sector: "diversified", ESGScore: 6.1, Approved: true},
+		{Symbol: "ESGU", Name: "iShares ESG Aware MSCI USA ETF", Category: "largeCapBlend", Sector: "diversified", ESGScore: 7.6, Approved: true},
+		{Symbol: "ESGV", Name: "Vanguard ESG U.S. Stock ETF", Category: "largeCapBlend", Sector: "diversified", ESGScore: 7.4, Approved: true},
+		{Symbol: "XLE", Name: "Energy Select Sector SPDR Fund", Category: "largeCapBlend", Sector: "fossil-fuels", ESGScore: 3.9},
+		{Symbol: "MO", Name: "Altria Group", Category: "largeCapBlend", Sector: "tobacco", ESGScore: 2.8},
+		{Symbol: "PM", Name: "Philip Morris International", Category: "largeCapBlend", Sector: "tobacco", ESGScore: 3.5},
+		{Symbol: "VB", Name: "Vanguard Small-Cap ETF", Category: "smallCapBlend", Sector: "diversified", ESGScore: 5.2, Approved: true},
+		{Symbol: "IJR", Name: "iShares Core S&P Small-Cap ETF", Category: "smallCapBlend", Sector: "diversified", ESGScore: 5.0, Approved: true},
+		{Symbol: "IWM", Name: "iShares Russell 2000 ETF", Category: "smallCapBlend", Sector: "diversified", ESGScore: 4.8},
+		{Symbol: "ESML", Name: "iShares ESG Aware MSCI USA Small-Cap ETF", Category: "smallCapBlend", Sector: "diversified", ESGScore: 6.9, Approved: true},
+		{Symbol: "VEA", Name: "Vanguard FTSE Developed Markets ETF", Category: "internationalStocks", Sector: "diversified", ESGScore: 7.0, Approved: true},
+		{Symbol: "IEFA", Name: "iShares Core MSCI EAFE ETF", Category: "internationalStocks", Sector: "diversified", ESGScore: 7.0, Approved: true},
+		{Symbol: "VXUS", Name: "Vanguard Total International Stock ETF", Category: "internationalStocks", Sector: "diversified", ESGScore: 6.5},
+		{Symbol: "ESGD", Name: "iShares ESG Aware MSCI EAFE ETF", Category: "internationalStocks", Sector: "diversified", ESGScore: 8.1, Approved: true},
+		{Symbol: "VWO", Name: "Vanguard FTSE Emerging Markets ETF", Category: "emergingMarkets", Sector: "diversified", ESGScore: 4.9, Approved: true},
+		{Symbol: "IEMG", Name: "iShares Core MSCI Emerging Markets ETF", Category: "emergingMarkets", Sector: "diversified", ESGScore: 4.9, Approved: true},
+		{Symbol: "EEM", Name: "iShares MSCI Emerging Markets ETF", Category: "emergingMarkets", Sector: "diversified", ESGScore: 4.8},
+		{Symbol: "ESGE", Name: "iShares ESG Aware MSCI EM ETF", Category: "emergingMarkets", Sector: "diversified", ESGScore: 6.6, Approved: true},
+		{Symbol: "BND", Name: "Vanguard Total Bond Market ETF", Category: "intermediateBonds", Sector: "fixed-income", ESGScore: 6.0, Approved: true},
+		{Symbol: "AGG", Name: "iShares Core U.S. Aggregate Bond ETF", Category: "intermediateBonds", Sector: "fixed-income", ESGScore: 6.0, Approved: true},
+		{Symbol: "BIV", Name: "Vanguard Intermediate-Term Bond ETF", Category: "intermediateBonds", Sector: "fixed-income", ESGScore: 6.2},
+		{Symbol: "EAGG", Name: "iShares ESG Aware U.S. Aggregate Bond ETF", Category: "intermediateBonds", Sector: "fixed-income", ESGScore: 7.2, Approved: true},
+		{Symbol: "BNDX", Name: "Vanguard Total International Bond ETF", Category: "internationalBonds", Sector: "fixed-income", ESGScore: 7.1, Approved: true},
+		{Symbol: "IAGG", Name: "iShares Core International Aggregate Bond ETF", Category: "internationalBonds", Sector: "fixed-income", ESGScore: 7.1, Approved: true},
+		{Symbol: "BGRN", Name: "iShares USD Green Bond ETF", Category: "internationalBonds", Sector: "fixed-income", ESGScore: 8.0, Approved: true},
+	}
+
+	// shape of the glide path: "early" de-risks mostly at the start, "late" mostly near the target date
+	GlidePathCurves = map[string]bool{
+		"linear": true,
+		"early":  true,
+		"late":   true,
+	}
+
+	// market orders are placed through the buy and sell endpoints
+	OrderTypes = map[string]bool{
+		"limit":         true,
+		"stop":          true,
+		"stop-limit":    true,
+		"trailing-stop": true,
+	}
+
+	OrderSides = map[string]bool{
+		"buy":  true,
+		"sell": true,
+	}
+
+	// orders in these states still hold their reservation and can be cancelled
+	OpenOrderStatuses = []string{"pending", "partially-filled"}
+
+	// good-till-cancelled or expiring at the end of the day
+	OrderTimesInForce = map[string]bool{
+		"gtc": true,
+		"day": true,
+	}
+
+	TransferKinds = map[string]bool{
+		"cash":    true,
+		"in-kind": true,
+	}
+
+	TransferPortfolioTypes = map[string]bool{
+		"manual": true,
+		"robo":   true,
+	}
+
+	PriceAlertTypes = map[string]bool{
+		"above":        true,
+		"below":        true,
+		"percent-move": true,
+	}
+
+	// how new money is split across a robo portfolio's holdings
+	DepositStrategies = map[string]bool{
+		"pro-rata":          true,
+		"underweight-first": true,
+	}
+
+	WithdrawalStrategies = map[string]bool{
+		"pro-rata":         true,
+		"overweight-first": true,
+		"min-gains":        true,
+	}
+
+	AllocationChangeReasons = map[string]bool{
+		"initial":          true, // targets in place before versions were recorded
+		"recommendation":   true,
+		"user-edit":        true,
+		"glide-path":       true,
+		"tax-loss-harvest": true,
+	}
+
+	RoboPortfolioGoals = map[string]bool{
+		"retirement": true,
+		"house":      true,
+		"education":  true,
+		"general":    true,
+	}
 )
 
 func GetNextRebalanceTime(freq string) (time.Time, error) {
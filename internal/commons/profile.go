@@ -0,0 +1,70 @@
+package commons
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	InvestmentHorizonYears = map[string]int{
+		"short":       3,
+		"short-term":  3,
+		"medium":      7,
+		"medium-term": 7,
+		"long":        15,
+		"long-term":   15,
+	}
+
+	horizonNumberRegex = regexp.MustCompile(`\d+`)
+)
+
+// ParseInvestmentHorizon converts the free-text profile horizon (e.g. "long-term", "10 years", "5-10 years")
+// into a number of years. Ranges resolve to their upper bound.
+func ParseInvestmentHorizon(horizon string) (int, error) {
+	normalized := strings.ToLower(strings.TrimSpace(horizon))
+	if years, exists := InvestmentHorizonYears[normalized]; exists {
+		return years, nil
+	}
+	numbers := horizonNumberRegex.FindAllString(normalized, -1)
+	if len(numbers) == 0 {
+		return 0, fmt.Errorf("invalid investment horizon: %s", horizon)
+	}
+	years, err := strconv.Atoi(numbers[len(numbers)-1])
+	if err != nil || years <= 0 {
+		return 0, fmt.Errorf("invalid investment horizon: %s", horizon)
+	}
+	return years, nil
+}
+
+var (
+	RiskLevels = []string{"conservative", "moderately-conservative", "moderate", "moderately-aggressive", "aggressive"}
+
+	riskLevelAliases = map[string]string{
+		"low":                     "conservative",
+		"1":                       "conservative",
+		"conservative":            "conservative",
+		"medium-low":              "moderately-conservative",
+		"2":                       "moderately-conservative",
+		"moderately-conservative": "moderately-conservative",
+		"medium":                  "moderate",
+		"3":                       "moderate",
+		"moderate":                "moderate",
+		"medium-high":             "moderately-aggressive",
+		"4":                       "moderately-aggressive",
+		"moderately-aggressive":   "moderately-aggressive",
+		"high":                    "aggressive",
+		"5":                       "aggressive",
+		"aggressive":              "aggressive",
+	}
+)
+
+// NormalizeRiskLevel maps the different spellings of a risk tolerance onto one of RiskLevels.
+func NormalizeRiskLevel(level string) (string, error) {
+	normalized := strings.ReplaceAll(strings.ToLower(strings.TrimSpace(level)), " ", "-")
+	if riskLevel, exists := riskLevelAliases[normalized]; exists {
+		return riskLevel, nil
+	}
+	return "", fmt.Errorf("invalid risk tolerance level: %s", level)
+}
@@ -0,0 +1,113 @@
+package commons
+
+import (
+	"fmt"
+	"math"
+)
+
+type RiskAnswerOption struct {
+	ID    string `json:"id"`
+	Text  string `json:"text"`
+	Score int    `json:"score"`
+}
+
+type RiskQuestion struct {
+	ID      string             `json:"id"`
+	Text    string             `json:"text"`
+	Options []RiskAnswerOption `json:"options"`
+}
+
+type RiskQuestionnaire struct {
+	Version   int            `json:"version"`
+	Questions []RiskQuestion `json:"questions"`
+}
+
+// questionnaires are never edited once published, submitted answers keep referring to their version
+const CurrentRiskQuestionnaireVersion = 1
+
+var RiskQuestionnaires = map[int]RiskQuestionnaire{
+	1: {
+		Version: 1,
+		Questions: []RiskQuestion{
+			{ID: "horizon", Text: "When do you expect to need most of this money?", Options: []RiskAnswerOption{
+				{ID: "lt-3", Text: "Within 3 years", Score: 1},
+				{ID: "3-5", Text: "In 3 to 5 years", Score: 2},
+				{ID: "5-10", Text: "In 5 to 10 years", Score: 3},
+				{ID: "10-20", Text: "In 10 to 20 years", Score: 4},
+				{ID: "gt-20", Text: "In more than 20 years", Score: 5},
+			}},
+			{ID: "drawdown", Text: "Your portfolio falls 20% in a month. What do you do?", Options: []RiskAnswerOption{
+				{ID: "sell-all", Text: "Sell everything", Score: 1},
+				{ID: "sell-some", Text: "Sell some to limit further losses", Score: 2},
+				{ID: "hold", Text: "Hold and wait for a recovery", Score: 3},
+				{ID: "buy-some", Text: "Invest a little more", Score: 4},
+				{ID: "buy-more", Text: "Invest significantly more", Score: 5},
+			}},
+			{ID: "goal", Text: "Which best describes your investment goal?", Options: []RiskAnswerOption{
+				{ID: "preserve", Text: "Preserve what I have", Score: 1},
+				{ID: "income", Text: "Generate steady income", Score: 2},
+				{ID: "balanced", Text: "Balance growth and stability", Score: 3},
+				{ID: "growth", Text: "Grow my wealth over time", Score: 4},
+				{ID: "max-growth", Text: "Maximise growth, accepting large swings", Score: 5},
+			}},
+			{ID: "experience", Text: "How much investing experience do you have?", Options: []RiskAnswerOption{
+				{ID: "none", Text: "None", Score: 1},
+				{ID: "some", Text: "Some, mostly savings products or funds", Score: 2},
+				{ID: "moderate", Text: "I have invested in stocks or ETFs for a few years", Score: 3},
+				{ID: "extensive", Text: "I actively manage a diversified portfolio", Score: 4},
+			}},
+			{ID: "income-stability", Text: "How stable is your income?", Options: []RiskAnswerOption{
+				{ID: "unstable", Text: "Irregular or uncertain", Score: 1},
+				{ID: "somewhat", Text: "Somewhat stable", Score: 2},
+				{ID: "stable", Text: "Stable", Score: 3},
+				{ID: "very-stable", Text: "Very stable with savings to spare", Score: 4},
+			}},
+			{ID: "emergency-fund", Text: "How many months of expenses do you hold in cash outside this portfolio?", Options: []RiskAnswerOption{
+				{ID: "none", Text: "Less than one", Score: 1},
+				{ID: "1-3", Text: "One to three", Score: 2},
+				{ID: "3-6", Text: "Three to six", Score: 3},
+				{ID: "gt-6", Text: "More than six", Score: 4},
+			}},
+		},
+	},
+}
+
+// ScoreRiskQuestionnaire scores answers (question ID -> option ID) on a 0-100 scale and maps the score onto
+// RiskLevels in equal bands. Every question must be answered.
+func ScoreRiskQuestionnaire(version int, answers map[string]string) (float64, string, error) {
+	questionnaire, exists := RiskQuestionnaires[version]
+	if !exists {
+		return 0, "", fmt.Errorf("invalid questionnaire version: %d", version)
+	}
+	total, minimum, maximum := 0, 0, 0
+	for _, question := range questionnaire.Questions {
+		answer, answered := answers[question.ID]
+		if !answered {
+			return 0, "", fmt.Errorf("question %s is not answered", question.ID)
+		}
+		found := false
+		lowest, highest := math.MaxInt, math.MinInt
+		for _, option := range question.Options {
+			lowest, highest = min(lowest, option.Score), max(highest, option.Score)
+			if option.ID == answer {
+				total += option.Score
+				found = true
+			}
+		}
+		if !found {
+			return 0, "", fmt.Errorf("invalid answer %s to question %s", answer, question.ID)
+		}
+		minimum += lowest
+		maximum += highest
+	}
+	if len(answers) != len(questionnaire.Questions) {
+		return 0, "", fmt.Errorf("answers given for unknown questions")
+	}
+
+	score := float64(total-minimum) / float64(maximum-minimum) * 100
+	band := int(score / 100 * float64(len(RiskLevels)))
+	if band >= len(RiskLevels) {
+		band = len(RiskLevels) - 1
+	}
+	return score, RiskLevels[band], nil
+}
@@ -0,0 +1,78 @@
+package commons
+
+import (
+	"math"
+	"testing"
+)
+
+func TestScoreRiskQuestionnaire(t *testing.T) {
+	lowest := map[string]string{
+		"horizon": "lt-3", "drawdown": "sell-all", "goal": "preserve",
+		"experience": "none", "income-stability": "unstable", "emergency-fund": "none",
+	}
+	with := func(changes map[string]string) map[string]string {
+		answers := make(map[string]string, len(lowest))
+		for question, option := range lowest {
+			answers[question] = option
+		}
+		for question, option := range changes {
+			if option == "" {
+				delete(answers, question)
+				continue
+			}
+			answers[question] = option
+		}
+		return answers
+	}
+
+	tests := []struct {
+		name      string
+		version   int
+		answers   map[string]string
+		wantScore float64
+		wantLevel string
+		wantErr   bool
+	}{
+		{name: "lowest answers", version: 1, answers: lowest, wantScore: 0, wantLevel: "conservative"},
+		{
+			name: "highest answers", version: 1, wantScore: 100, wantLevel: "aggressive",
+			answers: with(map[string]string{
+				"horizon": "gt-20", "drawdown": "buy-more", "goal": "max-growth",
+				"experience": "extensive", "income-stability": "very-stable", "emergency-fund": "gt-6",
+			}),
+		},
+		{
+			name: "middle answers", version: 1, wantScore: 12.0 / 21 * 100, wantLevel: "moderate",
+			answers: with(map[string]string{
+				"horizon": "5-10", "drawdown": "hold", "goal": "balanced",
+				"experience": "moderate", "income-stability": "stable", "emergency-fund": "3-6",
+			}),
+		},
+		{name: "just below the first band edge", version: 1, answers: with(map[string]string{"horizon": "gt-20"}), wantScore: 4.0 / 21 * 100, wantLevel: "conservative"},
+		{name: "just above the first band edge", version: 1, answers: with(map[string]string{"horizon": "gt-20", "experience": "some"}), wantScore: 5.0 / 21 * 100, wantLevel: "moderately-conservative"},
+		{name: "unknown version", version: 99, answers: lowest, wantErr: true},
+		{name: "unanswered question", version: 1, answers: with(map[string]string{"goal": ""}), wantErr: true},
+		{name: "unknown option", version: 1, answers: with(map[string]string{"goal": "retire-early"}), wantErr: true},
+		{name: "unknown question", version: 1, answers: with(map[string]string{"age": "30"}), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			score, level, err := ScoreRiskQuestionnaire(tt.version, tt.answers)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ScoreRiskQuestionnaire() = %v, %s, want an error", score, level)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ScoreRiskQuestionnaire() error = %v", err)
+			}
+			if math.Abs(score-tt.wantScore) > 1e-9 {
+				t.Errorf("score = %v, want %v", score, tt.wantScore)
+			}
+			if level != tt.wantLevel {
+				t.Errorf("level = %s, want %s", level, tt.wantLevel)
+			}
+		})
+	}
+}
@@ -1,16 +1,54 @@
 package conf
 
 import (
+	"log"
 	"os"
+	"strconv"
+	"time"
 )
 
 type Config struct {
-	FlaskMicroserviceURL string
+	FlaskMicroserviceURL         string
+	CapitalMarketAssumptionsFile string
+
+	// drift monitor
+	DriftBand          float64 // percentage points an asset may deviate from its target weight
+	DriftCooldown      time.Duration
+	DriftCheckInterval time.Duration
+
+	RebalanceFeeRate float64 // fraction of each rebalance trade charged as a fee
+
+	OrderCheckInterval time.Duration // how often pending manual portfolio orders are checked against prices
+
+	// watchlist price alerts
+	AlertCheckInterval time.Duration
+	AlertCooldown      time.Duration // minimum time between two deliveries of the same alert
+
+	// currency conversion, FXProvider is "file" or "http"
+	FXProvider  string
+	FXRatesFile string
+	FXRatesURL  string
+	FXRateTTL   time.Duration
+
+	IdempotencyKeyTTL time.Duration // how long responses to requests with an Idempotency-Key are kept for replay
 }
 
 func LoadConfig() *Config {
 	return &Config{
-		FlaskMicroserviceURL: getEnv("FLASK_MICROSERVICE_URL", "http://localhost:5000"),
+		FlaskMicroserviceURL:         getEnv("FLASK_MICROSERVICE_URL", "http://localhost:5000"),
+		CapitalMarketAssumptionsFile: getEnv("CAPITAL_MARKET_ASSUMPTIONS_FILE", ""),
+		DriftBand:                    getEnvFloat("DRIFT_BAND", 5),
+		DriftCooldown:                getEnvDuration("DRIFT_COOLDOWN", 72*time.Hour),
+		DriftCheckInterval:           getEnvDuration("DRIFT_CHECK_INTERVAL", 24*time.Hour),
+		RebalanceFeeRate:             getEnvFloat("REBALANCE_FEE_RATE", 0),
+		OrderCheckInterval:           getEnvDuration("ORDER_CHECK_INTERVAL", time.Minute),
+		AlertCheckInterval:           getEnvDuration("ALERT_CHECK_INTERVAL", 5*time.Minute),
+		AlertCooldown:                getEnvDuration("ALERT_COOLDOWN", 24*time.Hour),
+		FXProvider:                   getEnv("FX_PROVIDER", "file"),
+		FXRatesFile:                  getEnv("FX_RATES_FILE", ""),
+		FXRatesURL:                   getEnv("FX_RATES_URL", "https://api.frankfurter.app"),
+		FXRateTTL:                    getEnvDuration("FX_RATE_TTL", time.Hour),
+		IdempotencyKeyTTL:            getEnvDuration("IDEMPOTENCY_KEY_TTL", 24*time.Hour),
 	}
 }
 
@@ -20,3 +58,29 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+func getEnvFloat(key string, defaultValue float64) float64 {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return defaultValue
+	}
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		log.Printf("invalid value %q for %s, using %v\n", value, key, defaultValue)
+		return defaultValue
+	}
+	return parsed
+}
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return defaultValue
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil || parsed <= 0 {
+		log.Printf("invalid value %q for %s, using %v\n", value, key, defaultValue)
+		return defaultValue
+	}
+	return parsed
+}
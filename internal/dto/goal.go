@@ -0,0 +1,29 @@
+package dto
+
+import (
+	"github.com/KZY20112001/infinivest-backend/internal/analytics"
+	"github.com/KZY20112001/infinivest-backend/internal/commons/decimal"
+)
+
+type GoalRequest struct {
+	Name                string          `json:"name"`
+	RoboPortfolioID     uint            `json:"roboPortfolioID"`
+	TargetAmount        decimal.Decimal `json:"targetAmount"`
+	TargetDate          string          `json:"targetDate,omitempty"` // YYYY-MM-DD, defaults to the profile's investment horizon
+	MonthlyContribution decimal.Decimal `json:"monthlyContribution"`
+}
+
+type GoalProjectionResponse struct {
+	GoalID                      uint                    `json:"goalID"`
+	CurrentValue                decimal.Decimal         `json:"currentValue"`
+	TargetAmount                decimal.Decimal         `json:"targetAmount"`
+	Months                      int                     `json:"months"`
+	ExpectedReturn              float64                 `json:"expectedReturn"`
+	Volatility                  float64                 `json:"volatility"`
+	SuccessProbability          float64                 `json:"successProbability"`
+	FinalPercentiles            map[int]float64         `json:"finalPercentiles"`
+	Bands                       []analytics.OutcomeBand `json:"bands"`
+	MonthlyContribution         decimal.Decimal         `json:"monthlyContribution"`
+	RequiredMonthlyContribution decimal.Decimal         `json:"requiredMonthlyContribution"`
+	Confidence                  float64                 `json:"confidence"`
+}
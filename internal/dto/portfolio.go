@@ -1,5 +1,11 @@
 package dto
 
+import (
+	"time"
+
+	"github.com/KZY20112001/infinivest-backend/internal/commons/decimal"
+)
+
 type RoboAdvisorPortfolio struct {
 	LargeCapBlend       float64 `json:"largeCapBlend"`
 	SmallCapBlend       float64 `json:"smallCapBlend"`
@@ -13,12 +19,37 @@ type RoboAdvisorPortfolio struct {
 type RoboAdvisorRecommendationResponse struct {
 	Portfolio RoboAdvisorPortfolio `json:"portfolio"`
 	Reason    string               `json:"reason"`
+	Engine    string               `json:"engine,omitempty"` // "genai" or "local"
+
+	ExcludedCategories []string `json:"excludedCategories,omitempty"` // categories the user's screening rules leave nothing to invest in
 }
 
 type RoboPortfolioSummaryResponse struct {
-	RebalanceFreq string  `json:"rebalanceFreq"`
-	TotalValue    float64 `json:"totalValue"`
-	TotalInvested float64 `json:"totalInvested"`
+	ID            uint            `json:"id"`
+	Name          string          `json:"name"`
+	Goal          string          `json:"goal"`
+	RebalanceFreq string          `json:"rebalanceFreq"`
+	TotalValue    decimal.Decimal `json:"totalValue"`
+	TotalInvested decimal.Decimal `json:"totalInvested"`
+
+	IsPaused    bool       `json:"isPaused"`
+	PausedUntil *time.Time `json:"pausedUntil,omitempty"`
+	BaseCurrencyValuation
+
+	Error string `json:"error,omitempty"` // set when the portfolio could not be valued, leaving the amounts empty
+}
+
+// BaseCurrencyValuation is a portfolio summary converted from the portfolio currency into the user's base
+// currency. AssetGain comes from price moves in the assets' quote currencies and FxGain from exchange rate
+// moves since the assets were bought; together they are the unrealized gain.
+type BaseCurrencyValuation struct {
+	Currency          string          `json:"currency"`
+	BaseCurrency      string          `json:"baseCurrency"`
+	FxRate            decimal.Decimal `json:"fxRate"` // from the portfolio currency to the base currency
+	TotalValueBase    decimal.Decimal `json:"totalValueBase"`
+	TotalInvestedBase decimal.Decimal `json:"totalInvestedBase"`
+	AssetGain         decimal.Decimal `json:"assetGain"`
+	FxGain            decimal.Decimal `json:"fxGain"`
 }
 
 type AssetAllocationRequest struct {
@@ -37,44 +68,306 @@ type Assets struct {
 }
 
 type AssetAllocationResponse struct {
-	Allocations map[string]Assets `json:"allocations"`
+	Allocations   map[string]Assets       `json:"allocations"`
+	Substitutions []ScreeningSubstitution `json:"substitutions,omitempty"`
+}
+
+type ExclusionRuleRequest struct {
+	Type        string  `json:"type"`
+	Value       string  `json:"value"`
+	MinESGScore float64 `json:"minESGScore"`
+}
+
+// ScreeningSubstitution is an excluded asset that was replaced by an approved one from the same category
+type ScreeningSubstitution struct {
+	Category         string `json:"category"`
+	Symbol           string `json:"symbol"`
+	Name             string `json:"name"`
+	SubstituteSymbol string `json:"substituteSymbol"`
+	SubstituteName   string `json:"substituteName"`
+	Reason           string `json:"reason"`
 }
 
 type ConfirmPortfolioRequest struct {
+	Name        string             `json:"name"`
+	Goal        string             `json:"goal"`
 	Portfolio   map[string]float64 `json:"portfolio"`
 	Allocations map[string]Assets  `json:"allocations"`
 	Frequency   string             `json:"frequency"`
+
+	DepositStrategy string `json:"depositStrategy"`
+}
+
+type PauseRebalancingRequest struct {
+	ResumeAt string `json:"resumeAt"` // optional, YYYY-MM-DD
+}
+
+type UpdateGlidePathRequest struct {
+	Enabled             bool     `json:"enabled"`
+	Curve               string   `json:"curve"`
+	TargetDate          string   `json:"targetDate"` // defaults to the profile's investment horizon
+	EndEquityPercentage *float64 `json:"endEquityPercentage"`
+	EndCashPercentage   *float64 `json:"endCashPercentage"`
+}
+
+type GlidePathPoint struct {
+	Date             time.Time `json:"date"`
+	EquityPercentage float64   `json:"equityPercentage"`
+	BondPercentage   float64   `json:"bondPercentage"`
+	CashPercentage   float64   `json:"cashPercentage"`
+}
+
+type GlidePathResponse struct {
+	Enabled    bool             `json:"enabled"`
+	Curve      string           `json:"curve"`
+	StartDate  *time.Time       `json:"startDate"`
+	TargetDate *time.Time       `json:"targetDate"`
+	Current    GlidePathPoint   `json:"current"`
+	Schedule   []GlidePathPoint `json:"schedule"`
+}
+
+type UpdateAllocationRequest struct {
+	Portfolio   map[string]float64 `json:"portfolio"`
+	Allocations map[string]Assets  `json:"allocations"`
+}
+
+type AllocationChange struct {
+	Category       string  `json:"category"`
+	Symbol         string  `json:"symbol,omitempty"`
+	Name           string  `json:"name,omitempty"`
+	FromPercentage float64 `json:"fromPercentage"`
+	ToPercentage   float64 `json:"toPercentage"`
+	Change         float64 `json:"change"`
+}
+
+type AllocationDiff struct {
+	FromVersion int                `json:"fromVersion"`
+	ToVersion   int                `json:"toVersion"`
+	Changes     []AllocationChange `json:"changes"`
 }
 
 type UpdateRebalanceFreqRequest struct {
 	Frequency string `json:"frequency"`
 }
 
+type UpdateTaxLossHarvestingRequest struct {
+	Enabled   bool    `json:"enabled"`
+	Threshold float64 `json:"threshold"`
+}
+
+type UpdateDepositStrategyRequest struct {
+	Strategy string `json:"strategy"`
+}
+
+// DepositAllocation is the share of a deposit that goes to a single holding. Cash has no symbol.
+type DepositAllocation struct {
+	Category     string          `json:"category"`
+	Symbol       string          `json:"symbol,omitempty"`
+	Name         string          `json:"name,omitempty"`
+	CurrentValue decimal.Decimal `json:"currentValue"`
+	TargetValue  decimal.Decimal `json:"targetValue"`
+	Amount       decimal.Decimal `json:"amount"`
+	Price        decimal.Decimal `json:"price,omitempty"`
+	Shares       decimal.Decimal `json:"shares,omitempty"`
+}
+
+type DepositPlan struct {
+	Strategy     string              `json:"strategy"`
+	Amount       decimal.Decimal     `json:"amount"`
+	CurrentValue decimal.Decimal     `json:"currentValue"`
+	Allocations  []DepositAllocation `json:"allocations"`
+}
+
 type AddMoneyRequest struct {
-	Amount float64 `json:"amount"`
+	Amount decimal.Decimal `json:"amount"`
 }
 
 type WithdrawMoneyRequest struct {
-	Amount float64 `json:"amount"`
+	Amount       decimal.Decimal `json:"amount"`
+	Strategy     string          `json:"strategy"`
+	AllowPartial bool            `json:"allowPartial"`
+}
+
+type WithdrawalSale struct {
+	Category     string          `json:"category"`
+	Symbol       string          `json:"symbol"`
+	Name         string          `json:"name"`
+	Shares       decimal.Decimal `json:"shares"`
+	Price        decimal.Decimal `json:"price"`
+	Amount       decimal.Decimal `json:"amount"`
+	CostBasis    decimal.Decimal `json:"costBasis"`
+	RealizedGain decimal.Decimal `json:"realizedGain"`
+}
+
+// HoldingDrift compares a holding's share of the portfolio with its target, in percent. Cash has no symbol.
+type HoldingDrift struct {
+	Category          string  `json:"category"`
+	Symbol            string  `json:"symbol,omitempty"`
+	TargetPercentage  float64 `json:"targetPercentage"`
+	CurrentPercentage float64 `json:"currentPercentage"`
+	Drift             float64 `json:"drift"`
+}
+
+type ManualTarget struct {
+	Symbol     string  `json:"symbol"`
+	Name       string  `json:"name"`
+	Percentage float64 `json:"percentage"`
+}
+
+// ManualTargetsRequest sets the target weights of a manual portfolio; the rest of 100% is held as cash
+type ManualTargetsRequest struct {
+	Targets   []ManualTarget `json:"targets"`
+	Threshold float64        `json:"threshold"` // percent of the target value, defaults to 3
+}
+
+type ManualRebalanceRequest struct {
+	Execute bool `json:"execute"`
+}
+
+type ManualRebalanceTrade struct {
+	Symbol            string          `json:"symbol"`
+	Name              string          `json:"name"`
+	Side              string          `json:"side"`
+	Shares            decimal.Decimal `json:"shares"`
+	Price             decimal.Decimal `json:"price"`    // in Currency
+	Currency          string          `json:"currency"` // the asset's quote currency
+	FxRate            decimal.Decimal `json:"fxRate"`   // from Currency to the portfolio currency
+	Amount            decimal.Decimal `json:"amount"`   // in the portfolio currency
+	CurrentPercentage float64         `json:"currentPercentage"`
+	TargetPercentage  float64         `json:"targetPercentage"`
+}
+
+type ManualRebalanceResponse struct {
+	Threshold  float64                `json:"threshold"`
+	TotalValue decimal.Decimal        `json:"totalValue"`
+	Executed   bool                   `json:"executed"`
+	Trades     []ManualRebalanceTrade `json:"trades"`
+	CashBefore decimal.Decimal        `json:"cashBefore"`
+	CashAfter  decimal.Decimal        `json:"cashAfter"`
+}
+
+type ClosePortfolioRequest struct {
+	ManualPortfolioName string `json:"manualPortfolioName"` // optional, receives the proceeds
+}
+
+type ClosePortfolioResult struct {
+	CashAmount          decimal.Decimal  `json:"cashAmount"`
+	ProceedsAmount      decimal.Decimal  `json:"proceedsAmount"`
+	WithdrawnAmount     decimal.Decimal  `json:"withdrawnAmount"`
+	RealizedGain        decimal.Decimal  `json:"realizedGain"`
+	Sales               []WithdrawalSale `json:"sales"`
+	ManualPortfolioName string           `json:"manualPortfolioName,omitempty"`
+	DepositedAmount     decimal.Decimal  `json:"depositedAmount"` // credited to the manual portfolio, in its currency
+}
+
+type PortfolioDriftResponse struct {
+	TotalValue decimal.Decimal `json:"totalValue"`
+	MaxDrift   float64         `json:"maxDrift"` // largest absolute drift of any asset or category
+	Assets     []HoldingDrift  `json:"assets"`
+	Categories []HoldingDrift  `json:"categories"`
+}
+
+type WithdrawalResult struct {
+	Strategy        string           `json:"strategy"`
+	RequestedAmount decimal.Decimal  `json:"requestedAmount"`
+	WithdrawnAmount decimal.Decimal  `json:"withdrawnAmount"`
+	CashUsed        decimal.Decimal  `json:"cashUsed"`
+	RealizedGain    decimal.Decimal  `json:"realizedGain"`
+	Partial         bool             `json:"partial"`
+	Executed        bool             `json:"executed"`
+	Sales           []WithdrawalSale `json:"sales"`
+	Drift           []HoldingDrift   `json:"drift"`
 }
 
 type ManualPortfolioRequest struct {
-	Name string `json:"name"`
+	Name     string `json:"name"`
+	Currency string `json:"currency,omitempty"` // defaults to the user's base currency
 }
 
 type ManualPortfolioBuyAssetRequest struct {
-	Symbol       string  `json:"symbol"`
-	Name         string  `json:"name"`
-	SharesAmount float64 `json:"sharesAmount"`
+	Symbol       string          `json:"symbol"`
+	Name         string          `json:"name"`
+	SharesAmount decimal.Decimal `json:"sharesAmount"`
 }
 
 type ManualPortfolioSellAssetRequest struct {
-	Symbol       string  `json:"symbol"`
-	SharesAmount float64 `json:"sharesAmount"`
+	Symbol       string          `json:"symbol"`
+	SharesAmount decimal.Decimal `json:"sharesAmount"`
+}
+
+type PlaceOrderRequest struct {
+	Symbol       string           `json:"symbol"`
+	Name         string           `json:"name"`
+	Side         string           `json:"side"`
+	OrderType    string           `json:"orderType"`
+	TimeInForce  string           `json:"timeInForce"`
+	SharesAmount decimal.Decimal  `json:"sharesAmount"`
+	LimitPrice   *decimal.Decimal `json:"limitPrice"`
+	StopPrice    *decimal.Decimal `json:"stopPrice"`
+	TrailAmount  *decimal.Decimal `json:"trailAmount"`
+	TrailPercent *float64         `json:"trailPercent"`
+}
+
+// ImportColumnMapping names the CSV columns of a broker statement. TypeValues maps the broker's action to
+// "buy", "sell", "deposit", "withdrawal", "dividend" or "cash", which is a deposit or withdrawal by its sign.
+type ImportColumnMapping struct {
+	Date       string            `json:"date"`
+	Type       string            `json:"type"`
+	Symbol     string            `json:"symbol"`
+	Name       string            `json:"name"`
+	Shares     string            `json:"shares"`
+	Price      string            `json:"price"`
+	Amount     string            `json:"amount"`
+	Fee        string            `json:"fee"`
+	DateFormat string            `json:"dateFormat"`
+	TypeValues map[string]string `json:"typeValues"`
+}
+
+type ImportRow struct {
+	Line   int             `json:"line"`
+	Date   string          `json:"date"`
+	Type   string          `json:"type"`
+	Symbol string          `json:"symbol,omitempty"`
+	Shares decimal.Decimal `json:"shares,omitempty"`
+	Price  decimal.Decimal `json:"price,omitempty"`
+	Amount decimal.Decimal `json:"amount"`
+	Fee    decimal.Decimal `json:"fee,omitempty"`
+	Status string          `json:"status"` // "valid", "duplicate", "error" or "imported"
+	Error  string          `json:"error,omitempty"`
+}
+
+type ImportResult struct {
+	Preset     string          `json:"preset"`
+	Committed  bool            `json:"committed"`
+	Rows       []ImportRow     `json:"rows"`
+	Valid      int             `json:"valid"`
+	Duplicates int             `json:"duplicates"`
+	Errors     int             `json:"errors"`
+	Imported   int             `json:"imported"`
+	TotalCash  decimal.Decimal `json:"totalCash"` // after the import
+}
+
+// TransferEndpoint identifies a manual portfolio by name or a robo portfolio by ID
+type TransferEndpoint struct {
+	Type string `json:"type"`
+	Name string `json:"name"`
+	ID   uint   `json:"id"`
+}
+
+type TransferRequest struct {
+	Kind   string           `json:"kind"`
+	From   TransferEndpoint `json:"from"`
+	To     TransferEndpoint `json:"to"`
+	Amount decimal.Decimal  `json:"amount"` // for cash transfers
+	Symbol string           `json:"symbol"` // for in-kind transfers
+	Shares decimal.Decimal  `json:"shares"`
 }
 
 type ManualPortfolioSummaryResponse struct {
-	TotalValue    float64 `json:"totalValue"`
-	TotalInvested float64 `json:"totalInvested"`
-	Name          string  `json:"name"`
+	TotalValue    decimal.Decimal `json:"totalValue"`
+	TotalInvested decimal.Decimal `json:"totalInvested"`
+	Name          string          `json:"name"`
+	BaseCurrencyValuation
+
+	Error string `json:"error,omitempty"` // set when the portfolio could not be converted into the base currency, leaving the base-currency amounts empty
 }
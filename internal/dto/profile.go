@@ -1,14 +1,28 @@
 package dto
 
+import "github.com/KZY20112001/infinivest-backend/internal/commons/decimal"
+
 type ProfileRequest struct {
 	FirstName  string `json:"first_name"`
 	LastName   string `json:"last_name,omitempty"`
 	ProfileUrl string `json:"profile_url,omitempty"`
 	ProfileID  string `json:"profile_id,omitempty"`
 
-	RiskTolerance     string  `json:"risk_tolerance,omitempty"`
-	InvestmentStyle   string  `json:"investment_style,omitempty"`
-	InvestmentHorizon string  `json:"investment_horizon,omitempty"`
-	AnnualIncome      float64 `json:"annual_income,omitempty"`
-	ExperienceLevel   string  `json:"experience_level,omitempty"`
+	RiskTolerance     string          `json:"risk_tolerance,omitempty"`
+	InvestmentStyle   string          `json:"investment_style,omitempty"`
+	InvestmentHorizon string          `json:"investment_horizon,omitempty"`
+	AnnualIncome      decimal.Decimal `json:"annual_income,omitempty"`
+	ExperienceLevel   string          `json:"experience_level,omitempty"`
+	BaseCurrency      string          `json:"base_currency,omitempty"`
+}
+
+type RiskQuestionnaireRequest struct {
+	Version int               `json:"version"`
+	Answers map[string]string `json:"answers"` // question ID -> option ID
+}
+
+type RiskAssessmentResponse struct {
+	Version   int     `json:"version"`
+	Score     float64 `json:"score"`
+	RiskLevel string  `json:"riskLevel"`
 }
@@ -0,0 +1,22 @@
+package dto
+
+import (
+	"github.com/KZY20112001/infinivest-backend/internal/analytics"
+	"github.com/KZY20112001/infinivest-backend/internal/commons/decimal"
+)
+
+type PricePoint struct {
+	Date  string  `json:"date"` // YYYY-MM-DD
+	Close float64 `json:"close"`
+}
+
+type PortfolioRiskResponse struct {
+	analytics.RiskMetrics
+	Benchmark               string          `json:"benchmark"`
+	TotalValue              decimal.Decimal `json:"totalValue"`
+	ValueAtRiskAmount       decimal.Decimal `json:"valueAtRiskAmount"`
+	ExpectedShortfallAmount decimal.Decimal `json:"expectedShortfallAmount"`
+	HistoryStart            string          `json:"historyStart"`
+	HistoryEnd              string          `json:"historyEnd"`
+	UnpricedSymbols         []string        `json:"unpricedSymbols,omitempty"`
+}
@@ -0,0 +1,39 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/KZY20112001/infinivest-backend/internal/commons/decimal"
+	"github.com/KZY20112001/infinivest-backend/internal/models"
+)
+
+type WatchlistRequest struct {
+	Name string `json:"name" binding:"required"`
+}
+
+type WatchlistSymbolRequest struct {
+	Symbol string `json:"symbol" binding:"required"`
+}
+
+type PriceAlertRequest struct {
+	Type      string          `json:"type"` // "above", "below" or "percent-move"
+	Threshold decimal.Decimal `json:"threshold"`
+}
+
+// WatchlistQuote is a watched symbol with its latest price and the change from the previous close
+type WatchlistQuote struct {
+	ID               uint                 `json:"id"`
+	Symbol           string               `json:"symbol"`
+	Price            *decimal.Decimal     `json:"price"`
+	PreviousClose    *decimal.Decimal     `json:"previousClose"`
+	DayChange        *decimal.Decimal     `json:"dayChange"`
+	DayChangePercent *float64             `json:"dayChangePercent"`
+	Alerts           []*models.PriceAlert `json:"alerts"`
+}
+
+type WatchlistResponse struct {
+	ID        uint             `json:"id"`
+	Name      string           `json:"name"`
+	CreatedAt time.Time        `json:"createdAt"`
+	Items     []WatchlistQuote `json:"items"`
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/KZY20112001/infinivest-backend/internal/commons"
+	"github.com/KZY20112001/infinivest-backend/internal/dto"
+	"github.com/KZY20112001/infinivest-backend/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+type GoalHandler struct {
+	service services.GoalService
+}
+
+func NewGoalHandler(gs services.GoalService) *GoalHandler {
+	return &GoalHandler{service: gs}
+}
+
+func (h *GoalHandler) CreateGoal(c *gin.Context) {
+	var req dto.GoalRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	userID := c.GetUint("id")
+	goal, err := h.service.CreateGoal(userID, req)
+	if err != nil {
+		commons.HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"goal": goal})
+}
+
+func (h *GoalHandler) GetGoals(c *gin.Context) {
+	userID := c.GetUint("id")
+	goals, err := h.service.GetGoals(userID)
+	if err != nil {
+		commons.HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"goals": goals})
+}
+
+func (h *GoalHandler) GetGoal(c *gin.Context) {
+	goalID, err := parseIDParam(c, "id")
+	if err != nil {
+		commons.HandleError(c, err)
+		return
+	}
+	userID := c.GetUint("id")
+	goal, err := h.service.GetGoal(userID, goalID)
+	if err != nil {
+		commons.HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"goal": goal})
+}
+
+func (h *GoalHandler) UpdateGoal(c *gin.Context) {
+	goalID, err := parseIDParam(c, "id")
+	if err != nil {
+		commons.HandleError(c, err)
+		return
+	}
+	var req dto.GoalRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	userID := c.GetUint("id")
+	goal, err := h.service.UpdateGoal(userID, goalID, req)
+	if err != nil {
+		commons.HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"goal": goal})
+}
+
+func (h *GoalHandler) DeleteGoal(c *gin.Context) {
+	goalID, err := parseIDParam(c, "id")
+	if err != nil {
+		commons.HandleError(c, err)
+		return
+	}
+	userID := c.GetUint("id")
+	if err := h.service.DeleteGoal(userID, goalID); err != nil {
+		commons.HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Goal deleted successfully"})
+}
+
+func (h *GoalHandler) GetGoalProjection(c *gin.Context) {
+	goalID, err := parseIDParam(c, "id")
+	if err != nil {
+		commons.HandleError(c, err)
+		return
+	}
+	userID := c.GetUint("id")
+	projection, err := h.service.GetGoalProjection(userID, goalID)
+	if err != nil {
+		commons.HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"projection": projection})
+}
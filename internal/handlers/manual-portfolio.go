@@ -1,6 +1,8 @@
 package handlers
 
 import (
+	"encoding/json"
+	"fmt"
 	"net/http"
 	"strconv"
 
@@ -68,7 +70,7 @@ func (h *ManualPortfolioHandler) CreateManualPortfolio(c *gin.Context) {
 		return
 	}
 	userID := c.GetUint("id")
-	if err := h.service.CreateManualPortfolio(userID, req.Name); err != nil {
+	if err := h.service.CreateManualPortfolio(userID, req.Name, req.Currency); err != nil {
 		commons.HandleError(c, err)
 		return
 	}
@@ -151,6 +153,63 @@ func (h *ManualPortfolioHandler) SellAssetForManualPortfolio(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Shares sold successfully"})
 }
 
+func (h *ManualPortfolioHandler) PlaceOrder(c *gin.Context) {
+	var req dto.PlaceOrderRequest
+	userID := c.GetUint("id")
+	portfolioName := c.Param("name")
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	order, err := h.service.PlaceOrder(userID, portfolioName, req)
+	if err != nil {
+		commons.HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"order": order})
+}
+
+func (h *ManualPortfolioHandler) GetOrders(c *gin.Context) {
+	userID := c.GetUint("id")
+	portfolioName := c.Param("name")
+	orders, err := h.service.GetOrders(userID, portfolioName, c.Query("status"))
+	if err != nil {
+		commons.HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"orders": orders})
+}
+
+func (h *ManualPortfolioHandler) GetOrder(c *gin.Context) {
+	orderID, err := parseIDParam(c, "id")
+	if err != nil {
+		commons.HandleError(c, err)
+		return
+	}
+	userID := c.GetUint("id")
+	order, err := h.service.GetOrder(userID, orderID)
+	if err != nil {
+		commons.HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"order": order})
+}
+
+func (h *ManualPortfolioHandler) CancelOrder(c *gin.Context) {
+	orderID, err := parseIDParam(c, "id")
+	if err != nil {
+		commons.HandleError(c, err)
+		return
+	}
+	userID := c.GetUint("id")
+	order, err := h.service.CancelOrder(c.Request.Context(), userID, orderID)
+	if err != nil {
+		commons.HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Order cancelled successfully", "order": order})
+}
+
 func (h *ManualPortfolioHandler) DeleteManualPortfolio(c *gin.Context) {
 	portfolioName := c.Param("name")
 	userID := c.GetUint("id")
@@ -183,3 +242,107 @@ func (h *ManualPortfolioHandler) GetManualPortfolioTransactions(c *gin.Context)
 	}
 	c.JSON(http.StatusOK, gin.H{"transactions": transactions})
 }
+
+func (h *ManualPortfolioHandler) GetManualPortfolioRisk(c *gin.Context) {
+	portfolioName := c.Param("name")
+	userID := c.GetUint("id")
+	benchmark, days, err := parseRiskQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	risk, err := h.service.GetManualPortfolioRisk(userID, portfolioName, benchmark, days)
+	if err != nil {
+		commons.HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"risk": risk})
+}
+
+// ImportTransactions previews a broker statement, or saves it when the "commit" form field is true
+func (h *ManualPortfolioHandler) ImportTransactions(c *gin.Context) {
+	userID := c.GetUint("id")
+	portfolioName := c.Param("name")
+	file, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var mapping *dto.ImportColumnMapping
+	if raw := c.PostForm("mapping"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &mapping); err != nil {
+			commons.HandleError(c, fmt.Errorf("invalid column mapping: %w", err))
+			return
+		}
+	}
+	commit, _ := strconv.ParseBool(c.DefaultPostForm("commit", "false"))
+
+	result, err := h.service.ImportManualPortfolioTransactions(userID, portfolioName, file, c.PostForm("preset"), mapping, commit)
+	if err != nil {
+		commons.HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"import": result})
+}
+
+func (h *ManualPortfolioHandler) ExportManualPortfolioTransactions(c *gin.Context) {
+	userID := c.GetUint("id")
+	portfolioName := c.Param("name")
+	format, from, to, err := parseExportQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	export, err := h.service.ExportManualPortfolioTransactions(userID, portfolioName, format, from, to)
+	if err != nil {
+		commons.HandleError(c, err)
+		return
+	}
+	streamTransactionExport(c, export)
+}
+
+func (h *ManualPortfolioHandler) UpdateManualPortfolioTargets(c *gin.Context) {
+	var req dto.ManualTargetsRequest
+	userID := c.GetUint("id")
+	portfolioName := c.Param("name")
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	portfolio, err := h.service.UpdateManualPortfolioTargets(userID, portfolioName, req)
+	if err != nil {
+		commons.HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"targets": portfolio.Targets, "rebalanceThreshold": portfolio.RebalanceThreshold})
+}
+
+func (h *ManualPortfolioHandler) GetManualPortfolioDrift(c *gin.Context) {
+	userID := c.GetUint("id")
+	portfolioName := c.Param("name")
+	drift, err := h.service.GetManualPortfolioDrift(userID, portfolioName)
+	if err != nil {
+		commons.HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, drift)
+}
+
+// RebalanceManualPortfolio previews the rebalancing trades, or executes them when "execute" is true
+func (h *ManualPortfolioHandler) RebalanceManualPortfolio(c *gin.Context) {
+	var req dto.ManualRebalanceRequest
+	userID := c.GetUint("id")
+	portfolioName := c.Param("name")
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	result, err := h.service.RebalanceManualPortfolio(userID, portfolioName, req.Execute)
+	if err != nil {
+		commons.HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
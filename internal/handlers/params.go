@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/KZY20112001/infinivest-backend/internal/commons"
+	"github.com/KZY20112001/infinivest-backend/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+func parseIDParam(c *gin.Context, key string) (uint, error) {
+	id, err := strconv.ParseUint(c.Param(key), 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s parameter", key)
+	}
+	return uint(id), nil
+}
+
+func parseRiskQuery(c *gin.Context) (string, int, error) {
+	benchmark := strings.ToUpper(c.DefaultQuery("benchmark", services.DefaultRiskBenchmark))
+	if !commons.IsValidSymbol(benchmark) {
+		return "", 0, fmt.Errorf("invalid benchmark parameter")
+	}
+	days := services.DefaultRiskLookbackDays
+	if daysStr := c.Query("days"); daysStr != "" {
+		parsedDays, err := strconv.Atoi(daysStr)
+		if err != nil || parsedDays < 5 || parsedDays > services.MaxRiskLookbackDays {
+			return "", 0, fmt.Errorf("invalid days parameter")
+		}
+		days = parsedDays
+	}
+	return benchmark, days, nil
+}
+
+// parseExportQuery reads the export format and the optional from and to dates, both inclusive
+func parseExportQuery(c *gin.Context) (string, *time.Time, *time.Time, error) {
+	format := strings.ToLower(c.DefaultQuery("format", "csv"))
+	var from, to *time.Time
+	if fromStr := c.Query("from"); fromStr != "" {
+		parsed, err := time.Parse("2006-01-02", fromStr)
+		if err != nil {
+			return "", nil, nil, fmt.Errorf("invalid from parameter, expected YYYY-MM-DD")
+		}
+		from = &parsed
+	}
+	if toStr := c.Query("to"); toStr != "" {
+		parsed, err := time.Parse("2006-01-02", toStr)
+		if err != nil {
+			return "", nil, nil, fmt.Errorf("invalid to parameter, expected YYYY-MM-DD")
+		}
+		parsed = parsed.AddDate(0, 0, 1)
+		to = &parsed
+	}
+	if from != nil && to != nil && !from.Before(*to) {
+		return "", nil, nil, fmt.Errorf("from must not be after to")
+	}
+	return format, from, to, nil
+}
+
+// streamTransactionExport writes the export as a download; errors after the first byte can only be logged
+func streamTransactionExport(c *gin.Context, export *services.TransactionExport) {
+	c.Header("Content-Type", export.ContentType)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", export.Filename))
+	c.Status(http.StatusOK)
+	if err := export.WriteTo(c.Writer); err != nil {
+		log.Printf("Failed to export transactions to %s: %v\n", export.Filename, err)
+	}
+}
@@ -1,7 +1,9 @@
 package handlers
 
 import (
+	"fmt"
 	"net/http"
+	"strconv"
 
 	"github.com/KZY20112001/infinivest-backend/internal/commons"
 	"github.com/KZY20112001/infinivest-backend/internal/dto"
@@ -47,6 +49,39 @@ func (h *ProfileHandler) UpdateProfile(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Successfully updated the profile"})
 }
 
+func (h *ProfileHandler) GetRiskQuestionnaire(c *gin.Context) {
+	version := 0
+	if versionStr := c.Query("version"); versionStr != "" {
+		parsed, err := strconv.Atoi(versionStr)
+		if err != nil {
+			commons.HandleError(c, fmt.Errorf("invalid version parameter"))
+			return
+		}
+		version = parsed
+	}
+	questionnaire, err := h.profileService.GetRiskQuestionnaire(version)
+	if err != nil {
+		commons.HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"questionnaire": questionnaire})
+}
+
+func (h *ProfileHandler) SubmitRiskQuestionnaire(c *gin.Context) {
+	var req dto.RiskQuestionnaireRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	userID := c.GetUint("id")
+	assessment, err := h.profileService.SubmitRiskQuestionnaire(userID, req)
+	if err != nil {
+		commons.HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"assessment": assessment})
+}
+
 func (h *ProfileHandler) GetProfile(c *gin.Context) {
 	userID := c.GetUint("id")
 	profile, err := h.profileService.GetProfile(userID)
@@ -1,9 +1,11 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/KZY20112001/infinivest-backend/internal/commons"
 	"github.com/KZY20112001/infinivest-backend/internal/dto"
@@ -12,35 +14,52 @@ import (
 )
 
 type RoboPortfolioHandler struct {
-	service      services.RoboPortfolioService
-	genAIService services.GenAIService
+	service          services.RoboPortfolioService
+	genAIService     services.GenAIService
+	screeningService services.ScreeningService
+	profileService   services.ProfileService
 }
 
-func NewRoboPortfolioHandler(ps services.RoboPortfolioService, gs services.GenAIService) *RoboPortfolioHandler {
-	return &RoboPortfolioHandler{service: ps, genAIService: gs}
+func NewRoboPortfolioHandler(ps services.RoboPortfolioService, gs services.GenAIService, ss services.ScreeningService, prs services.ProfileService) *RoboPortfolioHandler {
+	return &RoboPortfolioHandler{service: ps, genAIService: gs, screeningService: ss, profileService: prs}
 }
 
 func (h *RoboPortfolioHandler) GenerateRoboAdvisorPortfolio(c *gin.Context) {
-	bankName := c.PostForm("bank_name")
-	if bankName == "" {
-		commons.HandleError(c, fmt.Errorf("bank name is required"))
+	engine := c.DefaultPostForm("engine", "genai")
+	if !commons.AllocationEngines[engine] {
+		commons.HandleError(c, fmt.Errorf("invalid allocation engine"))
 		return
 	}
 
-	riskToleranceLevel := c.PostForm("risk_tolerance_level")
-	if riskToleranceLevel == "" {
-		commons.HandleError(c, fmt.Errorf("risk tolerance level is required"))
+	// the level comes from the user's risk questionnaire, a more conservative one may be requested
+	riskToleranceLevel, err := h.profileService.ResolveRiskLevel(c.GetUint("id"), c.PostForm("risk_tolerance_level"))
+	if err != nil {
+		commons.HandleError(c, err)
 		return
 	}
 
+	// the local optimizer does not use the bank statement
+	bankName := c.PostForm("bank_name")
 	bankStatement, err := c.FormFile("bank_statement")
+	if engine == "genai" {
+		if bankName == "" {
+			commons.HandleError(c, fmt.Errorf("bank name is required"))
+			return
+		}
+		if err != nil {
+			commons.HandleError(c, err)
+			return
+		}
+	}
 
+	// categories the user's screening rules leave nothing to invest in get no weight
+	excludedCategories, err := h.screeningService.ExcludedCategories(c.GetUint("id"))
 	if err != nil {
 		commons.HandleError(c, err)
 		return
 	}
 
-	recommendation, err := h.genAIService.GenerateRoboAdvisorPortfolio(bankStatement, bankName, riskToleranceLevel)
+	recommendation, err := h.genAIService.GenerateRoboAdvisorPortfolio(bankStatement, bankName, riskToleranceLevel, engine, excludedCategories)
 	if err != nil {
 		commons.HandleError(c, err)
 		return
@@ -60,6 +79,12 @@ func (h *RoboPortfolioHandler) GenerateAssetAllocation(c *gin.Context) {
 		commons.HandleError(c, err)
 		return
 	}
+	userID := c.GetUint("id")
+	assetAllocations.Allocations, assetAllocations.Substitutions, err = h.screeningService.ScreenAllocations(userID, assetAllocations.Allocations)
+	if err != nil {
+		commons.HandleError(c, err)
+		return
+	}
 
 	c.JSON(http.StatusOK, assetAllocations)
 }
@@ -75,18 +100,71 @@ func (h *RoboPortfolioHandler) ConfirmGeneratedRoboPortfolio(c *gin.Context) {
 		commons.HandleError(c, fmt.Errorf("invalid rebalance frequency"))
 		return
 	}
+	if req.Name == "" {
+		commons.HandleError(c, fmt.Errorf("portfolio name is required"))
+		return
+	}
+	if req.Goal == "" {
+		req.Goal = "general"
+	}
+	if req.DepositStrategy == "" {
+		req.DepositStrategy = "pro-rata"
+	}
+	if !commons.DepositStrategies[req.DepositStrategy] {
+		commons.HandleError(c, fmt.Errorf("invalid deposit strategy"))
+		return
+	}
+	if !commons.RoboPortfolioGoals[req.Goal] {
+		commons.HandleError(c, fmt.Errorf("invalid portfolio goal"))
+		return
+	}
 	userID := c.GetUint("id")
-	err := h.service.ConfirmGeneratedRoboPortfolio(req, userID)
+	if err := h.profileService.CheckAllocationSuitability(userID, req.Portfolio); err != nil {
+		commons.HandleError(c, err)
+		return
+	}
+	allocations, substitutions, err := h.screeningService.ScreenAllocations(userID, req.Allocations)
 	if err != nil {
 		commons.HandleError(c, err)
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"message": "Successfully created the portfolio"})
+	req.Allocations = allocations
+	portfolio, err := h.service.ConfirmGeneratedRoboPortfolio(req, userID)
+	if err != nil {
+		commons.HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Successfully created the portfolio", "id": portfolio.ID, "substitutions": substitutions})
+}
+
+func (h *RoboPortfolioHandler) GetRoboPortfolios(c *gin.Context) {
+	userID := c.GetUint("id")
+	portfolios, err := h.service.GetRoboPortfolios(userID)
+	if err != nil {
+		commons.HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"portfolios": portfolios})
+}
+
+func (h *RoboPortfolioHandler) GetRoboPortfoliosSummaries(c *gin.Context) {
+	userID := c.GetUint("id")
+	summaries, err := h.service.GetRoboPortfoliosSummaries(userID)
+	if err != nil {
+		commons.HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"summaries": summaries})
 }
 
 func (h *RoboPortfolioHandler) GetRoboPortfolioDetails(c *gin.Context) {
+	portfolioID, err := parseIDParam(c, "id")
+	if err != nil {
+		commons.HandleError(c, err)
+		return
+	}
 	userID := c.GetUint("id")
-	portfolio, err := h.service.GetRoboPortfolioDetails(userID)
+	portfolio, err := h.service.GetRoboPortfolioDetails(userID, portfolioID)
 	if err != nil {
 		commons.HandleError(c, err)
 		return
@@ -95,8 +173,13 @@ func (h *RoboPortfolioHandler) GetRoboPortfolioDetails(c *gin.Context) {
 }
 
 func (h *RoboPortfolioHandler) GetRoboPortfolioSummary(c *gin.Context) {
+	portfolioID, err := parseIDParam(c, "id")
+	if err != nil {
+		commons.HandleError(c, err)
+		return
+	}
 	userID := c.GetUint("id")
-	summary, err := h.service.GetRoboPortfolioSummary(userID)
+	summary, err := h.service.GetRoboPortfolioSummary(userID, portfolioID)
 	if err != nil {
 		commons.HandleError(c, err)
 		return
@@ -105,13 +188,18 @@ func (h *RoboPortfolioHandler) GetRoboPortfolioSummary(c *gin.Context) {
 }
 
 func (h *RoboPortfolioHandler) AddMoneyToRoboPortfolio(c *gin.Context) {
+	portfolioID, err := parseIDParam(c, "id")
+	if err != nil {
+		commons.HandleError(c, err)
+		return
+	}
 	var req dto.AddMoneyRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 	userID := c.GetUint("id")
-	portfolio, err := h.service.AddMoneyToRoboPortfolio(c.Request.Context(), userID, req.Amount)
+	portfolio, err := h.service.AddMoneyToRoboPortfolio(c.Request.Context(), userID, portfolioID, req.Amount)
 	if err != nil {
 		commons.HandleError(c, err)
 		return
@@ -119,22 +207,65 @@ func (h *RoboPortfolioHandler) AddMoneyToRoboPortfolio(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"portfolio": portfolio})
 }
 
+func (h *RoboPortfolioHandler) PreviewDeposit(c *gin.Context) {
+	portfolioID, err := parseIDParam(c, "id")
+	if err != nil {
+		commons.HandleError(c, err)
+		return
+	}
+	var req dto.AddMoneyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !req.Amount.IsPositive() {
+		commons.HandleError(c, fmt.Errorf("amount must be positive"))
+		return
+	}
+	userID := c.GetUint("id")
+	plan, err := h.service.PreviewDeposit(userID, portfolioID, req.Amount)
+	if err != nil {
+		commons.HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"plan": plan})
+}
+
 func (h *RoboPortfolioHandler) WithDrawMoneyFromRoboPortfolio(c *gin.Context) {
+	portfolioID, err := parseIDParam(c, "id")
+	if err != nil {
+		commons.HandleError(c, err)
+		return
+	}
 	var req dto.WithdrawMoneyRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if req.Strategy != "" && !commons.WithdrawalStrategies[req.Strategy] {
+		commons.HandleError(c, fmt.Errorf("invalid withdrawal strategy"))
+		return
+	}
 	userID := c.GetUint("id")
-	amountWithdrawn, err := h.service.WithDrawMoneyFromRoboPortfolio(c.Request.Context(), userID, req.Amount)
+	result, err := h.service.WithDrawMoneyFromRoboPortfolio(c.Request.Context(), userID, portfolioID, req)
+	if errors.Is(err, commons.ErrPartialFill) {
+		// return the plan so the caller can confirm with allowPartial
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "withdrawal": result})
+		return
+	}
 	if err != nil {
 		commons.HandleError(c, err)
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"amount": amountWithdrawn})
+	c.JSON(http.StatusOK, gin.H{"amount": result.WithdrawnAmount, "withdrawal": result})
 }
 
 func (h *RoboPortfolioHandler) UpdateRebalanceFreq(c *gin.Context) {
+	portfolioID, err := parseIDParam(c, "id")
+	if err != nil {
+		commons.HandleError(c, err)
+		return
+	}
 	var req dto.UpdateRebalanceFreqRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -145,7 +276,7 @@ func (h *RoboPortfolioHandler) UpdateRebalanceFreq(c *gin.Context) {
 		return
 	}
 	userID := c.GetUint("id")
-	err := h.service.UpdateRebalanceFreq(c.Request.Context(), userID, req.Frequency)
+	err = h.service.UpdateRebalanceFreq(c.Request.Context(), userID, portfolioID, req.Frequency)
 	if err != nil {
 		commons.HandleError(c, err)
 		return
@@ -153,9 +284,101 @@ func (h *RoboPortfolioHandler) UpdateRebalanceFreq(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Successfully updated the rebalance frequency"})
 }
 
+func (h *RoboPortfolioHandler) PauseRebalancing(c *gin.Context) {
+	portfolioID, err := parseIDParam(c, "id")
+	if err != nil {
+		commons.HandleError(c, err)
+		return
+	}
+	// the body is optional
+	var req dto.PauseRebalancingRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	var resumeAt *time.Time
+	if req.ResumeAt != "" {
+		parsed, err := time.Parse("2006-01-02", req.ResumeAt)
+		if err != nil {
+			commons.HandleError(c, fmt.Errorf("invalid resume date: %s", req.ResumeAt))
+			return
+		}
+		resumeAt = &parsed
+	}
+	userID := c.GetUint("id")
+	if err := h.service.PauseRebalancing(c.Request.Context(), userID, portfolioID, resumeAt); err != nil {
+		commons.HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Successfully paused automatic rebalancing"})
+}
+
+func (h *RoboPortfolioHandler) ResumeRebalancing(c *gin.Context) {
+	portfolioID, err := parseIDParam(c, "id")
+	if err != nil {
+		commons.HandleError(c, err)
+		return
+	}
+	userID := c.GetUint("id")
+	if err := h.service.ResumeRebalancing(c.Request.Context(), userID, portfolioID); err != nil {
+		commons.HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Successfully resumed automatic rebalancing"})
+}
+
+func (h *RoboPortfolioHandler) UpdateTaxLossHarvesting(c *gin.Context) {
+	portfolioID, err := parseIDParam(c, "id")
+	if err != nil {
+		commons.HandleError(c, err)
+		return
+	}
+	var req dto.UpdateTaxLossHarvestingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	userID := c.GetUint("id")
+	if err := h.service.UpdateTaxLossHarvesting(userID, portfolioID, req.Enabled, req.Threshold); err != nil {
+		commons.HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Successfully updated tax-loss harvesting settings"})
+}
+
+func (h *RoboPortfolioHandler) UpdateDepositStrategy(c *gin.Context) {
+	portfolioID, err := parseIDParam(c, "id")
+	if err != nil {
+		commons.HandleError(c, err)
+		return
+	}
+	var req dto.UpdateDepositStrategyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !commons.DepositStrategies[req.Strategy] {
+		commons.HandleError(c, fmt.Errorf("invalid deposit strategy"))
+		return
+	}
+	userID := c.GetUint("id")
+	if err := h.service.UpdateDepositStrategy(userID, portfolioID, req.Strategy); err != nil {
+		commons.HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Successfully updated the deposit strategy"})
+}
+
 func (h *RoboPortfolioHandler) DeleteRoboPortfolio(c *gin.Context) {
+	portfolioID, err := parseIDParam(c, "id")
+	if err != nil {
+		commons.HandleError(c, err)
+		return
+	}
 	userID := c.GetUint("id")
-	err := h.service.DeleteRoboPortfolio(c.Request.Context(), userID)
+	err = h.service.DeleteRoboPortfolio(c.Request.Context(), userID, portfolioID)
 	if err != nil {
 		commons.HandleError(c, err)
 		return
@@ -163,7 +386,143 @@ func (h *RoboPortfolioHandler) DeleteRoboPortfolio(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Successfully deleted the portfolio"})
 }
 
+func (h *RoboPortfolioHandler) UpdateRoboPortfolioAllocation(c *gin.Context) {
+	portfolioID, err := parseIDParam(c, "id")
+	if err != nil {
+		commons.HandleError(c, err)
+		return
+	}
+	var req dto.UpdateAllocationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	userID := c.GetUint("id")
+	if err := h.profileService.CheckAllocationSuitability(userID, req.Portfolio); err != nil {
+		commons.HandleError(c, err)
+		return
+	}
+	allocations, substitutions, err := h.screeningService.ScreenAllocations(userID, req.Allocations)
+	if err != nil {
+		commons.HandleError(c, err)
+		return
+	}
+	req.Allocations = allocations
+	portfolio, err := h.service.UpdateRoboPortfolioAllocation(userID, portfolioID, req)
+	if err != nil {
+		commons.HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"portfolio": portfolio, "substitutions": substitutions})
+}
+
+func (h *RoboPortfolioHandler) UpdateGlidePath(c *gin.Context) {
+	portfolioID, err := parseIDParam(c, "id")
+	if err != nil {
+		commons.HandleError(c, err)
+		return
+	}
+	var req dto.UpdateGlidePathRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	userID := c.GetUint("id")
+	portfolio, err := h.service.UpdateGlidePath(userID, portfolioID, req)
+	if err != nil {
+		commons.HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"portfolio": portfolio})
+}
+
+func (h *RoboPortfolioHandler) GetGlidePath(c *gin.Context) {
+	portfolioID, err := parseIDParam(c, "id")
+	if err != nil {
+		commons.HandleError(c, err)
+		return
+	}
+	userID := c.GetUint("id")
+	glidePath, err := h.service.GetGlidePath(userID, portfolioID)
+	if err != nil {
+		commons.HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"glidePath": glidePath})
+}
+
+// GetAllocationVersions lists the allocation versions, and diffs two of them when from and to are given
+func (h *RoboPortfolioHandler) GetAllocationVersions(c *gin.Context) {
+	portfolioID, err := parseIDParam(c, "id")
+	if err != nil {
+		commons.HandleError(c, err)
+		return
+	}
+	userID := c.GetUint("id")
+	versions, err := h.service.GetAllocationVersions(userID, portfolioID)
+	if err != nil {
+		commons.HandleError(c, err)
+		return
+	}
+
+	fromQuery, toQuery := c.Query("from"), c.Query("to")
+	if fromQuery == "" && toQuery == "" {
+		c.JSON(http.StatusOK, gin.H{"versions": versions})
+		return
+	}
+	from, fromErr := strconv.Atoi(fromQuery)
+	to, toErr := strconv.Atoi(toQuery)
+	if fromErr != nil || toErr != nil {
+		commons.HandleError(c, fmt.Errorf("from and to must both be version numbers"))
+		return
+	}
+	diff, err := h.service.DiffAllocationVersions(userID, portfolioID, from, to)
+	if err != nil {
+		commons.HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"versions": versions, "diff": diff})
+}
+
+func (h *RoboPortfolioHandler) CloseRoboPortfolio(c *gin.Context) {
+	portfolioID, err := parseIDParam(c, "id")
+	if err != nil {
+		commons.HandleError(c, err)
+		return
+	}
+	// the body is optional
+	var req dto.ClosePortfolioRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	userID := c.GetUint("id")
+	result, err := h.service.CloseRoboPortfolio(c.Request.Context(), userID, portfolioID, req.ManualPortfolioName)
+	if err != nil {
+		commons.HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Successfully closed the portfolio", "result": result})
+}
+
+func (h *RoboPortfolioHandler) GetArchivedRoboPortfolios(c *gin.Context) {
+	userID := c.GetUint("id")
+	portfolios, err := h.service.GetArchivedRoboPortfolios(userID)
+	if err != nil {
+		commons.HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"portfolios": portfolios})
+}
+
 func (h *RoboPortfolioHandler) GetRoboPortfolioTransactions(c *gin.Context) {
+	portfolioID, err := parseIDParam(c, "id")
+	if err != nil {
+		commons.HandleError(c, err)
+		return
+	}
 	userID := c.GetUint("id")
 	limitStr := c.Query("limit")
 
@@ -176,7 +535,7 @@ func (h *RoboPortfolioHandler) GetRoboPortfolioTransactions(c *gin.Context) {
 		}
 		limit = parsedLimit
 	}
-	transactions, err := h.service.GetRoboPortfolioTransactions(userID, limit)
+	transactions, err := h.service.GetRoboPortfolioTransactions(userID, portfolioID, limit)
 	if err != nil {
 		commons.HandleError(c, err)
 		return
@@ -184,9 +543,49 @@ func (h *RoboPortfolioHandler) GetRoboPortfolioTransactions(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"transactions": transactions})
 }
 
+func (h *RoboPortfolioHandler) GetRoboPortfolioRisk(c *gin.Context) {
+	portfolioID, err := parseIDParam(c, "id")
+	if err != nil {
+		commons.HandleError(c, err)
+		return
+	}
+	benchmark, days, err := parseRiskQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	userID := c.GetUint("id")
+	risk, err := h.service.GetRoboPortfolioRisk(userID, portfolioID, benchmark, days)
+	if err != nil {
+		commons.HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"risk": risk})
+}
+
+func (h *RoboPortfolioHandler) GetRoboPortfolioDrift(c *gin.Context) {
+	portfolioID, err := parseIDParam(c, "id")
+	if err != nil {
+		commons.HandleError(c, err)
+		return
+	}
+	userID := c.GetUint("id")
+	drift, err := h.service.GetRoboPortfolioDrift(userID, portfolioID)
+	if err != nil {
+		commons.HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"drift": drift})
+}
+
 func (h *RoboPortfolioHandler) GetRebalanceEvents(c *gin.Context) {
+	portfolioID, err := parseIDParam(c, "id")
+	if err != nil {
+		commons.HandleError(c, err)
+		return
+	}
 	userID := c.GetUint("id")
-	rebalanceDetails, err := h.service.GetRebalanceEvents(c.Request.Context(), userID)
+	rebalanceDetails, err := h.service.GetRebalanceEvents(c.Request.Context(), userID, portfolioID)
 	if err != nil {
 		commons.HandleError(c, err)
 		return
@@ -194,9 +593,34 @@ func (h *RoboPortfolioHandler) GetRebalanceEvents(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"rebalance_details": rebalanceDetails})
 }
 
+func (h *RoboPortfolioHandler) GetRebalanceEvent(c *gin.Context) {
+	portfolioID, err := parseIDParam(c, "id")
+	if err != nil {
+		commons.HandleError(c, err)
+		return
+	}
+	eventID, err := parseIDParam(c, "eventID")
+	if err != nil {
+		commons.HandleError(c, err)
+		return
+	}
+	userID := c.GetUint("id")
+	rebalanceEvent, err := h.service.GetRebalanceEvent(userID, portfolioID, eventID)
+	if err != nil {
+		commons.HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"rebalance_event": rebalanceEvent})
+}
+
 func (h *RoboPortfolioHandler) UpdateLastSeenRebalanceEvent(c *gin.Context) {
+	portfolioID, err := parseIDParam(c, "id")
+	if err != nil {
+		commons.HandleError(c, err)
+		return
+	}
 	userID := c.GetUint("id")
-	err := h.service.UpdateLastSeenRebalanceTime(c.Request.Context(), userID)
+	err = h.service.UpdateLastSeenRebalanceTime(c.Request.Context(), userID, portfolioID)
 	if err != nil {
 		commons.HandleError(c, err)
 		return
@@ -205,8 +629,13 @@ func (h *RoboPortfolioHandler) UpdateLastSeenRebalanceEvent(c *gin.Context) {
 }
 
 func (h *RoboPortfolioHandler) RebalanceRoboPortfolio(c *gin.Context) {
+	portfolioID, err := parseIDParam(c, "id")
+	if err != nil {
+		commons.HandleError(c, err)
+		return
+	}
 	userID := c.GetUint("id")
-	portfolio, err := h.service.GetRoboPortfolioDetails(userID)
+	portfolio, err := h.service.GetRoboPortfolioDetails(userID, portfolioID)
 	if err != nil {
 		commons.HandleError(c, err)
 		return
@@ -220,3 +649,23 @@ func (h *RoboPortfolioHandler) RebalanceRoboPortfolio(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": portfolio})
 
 }
+
+func (h *RoboPortfolioHandler) ExportRoboPortfolioTransactions(c *gin.Context) {
+	portfolioID, err := parseIDParam(c, "id")
+	if err != nil {
+		commons.HandleError(c, err)
+		return
+	}
+	userID := c.GetUint("id")
+	format, from, to, err := parseExportQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	export, err := h.service.ExportRoboPortfolioTransactions(userID, portfolioID, format, from, to)
+	if err != nil {
+		commons.HandleError(c, err)
+		return
+	}
+	streamTransactionExport(c, export)
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/KZY20112001/infinivest-backend/internal/commons"
+	"github.com/KZY20112001/infinivest-backend/internal/dto"
+	"github.com/KZY20112001/infinivest-backend/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+type ScreeningHandler struct {
+	service services.ScreeningService
+}
+
+func NewScreeningHandler(ss services.ScreeningService) *ScreeningHandler {
+	return &ScreeningHandler{service: ss}
+}
+
+func (h *ScreeningHandler) CreateExclusionRule(c *gin.Context) {
+	var req dto.ExclusionRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	userID := c.GetUint("id")
+	rule, err := h.service.CreateExclusionRule(userID, req)
+	if err != nil {
+		commons.HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"rule": rule})
+}
+
+func (h *ScreeningHandler) GetExclusionRules(c *gin.Context) {
+	userID := c.GetUint("id")
+	rules, err := h.service.GetExclusionRules(userID)
+	if err != nil {
+		commons.HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"rules": rules})
+}
+
+func (h *ScreeningHandler) DeleteExclusionRule(c *gin.Context) {
+	ruleID, err := parseIDParam(c, "id")
+	if err != nil {
+		commons.HandleError(c, err)
+		return
+	}
+	userID := c.GetUint("id")
+	if err := h.service.DeleteExclusionRule(userID, ruleID); err != nil {
+		commons.HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Exclusion rule deleted successfully"})
+}
+
+func (h *ScreeningHandler) GetAssetMetadata(c *gin.Context) {
+	metadata, err := h.service.GetAssetMetadata(c.Query("category"))
+	if err != nil {
+		commons.HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"assets": metadata})
+}
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/KZY20112001/infinivest-backend/internal/commons"
+	"github.com/KZY20112001/infinivest-backend/internal/dto"
+	"github.com/KZY20112001/infinivest-backend/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+type TransferHandler struct {
+	service services.TransferService
+}
+
+func NewTransferHandler(ts services.TransferService) *TransferHandler {
+	return &TransferHandler{service: ts}
+}
+
+func (h *TransferHandler) CreateTransfer(c *gin.Context) {
+	var req dto.TransferRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	userID := c.GetUint("id")
+	transfer, err := h.service.CreateTransfer(c.Request.Context(), userID, req)
+	if err != nil {
+		commons.HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"transfer": transfer})
+}
+
+func (h *TransferHandler) GetTransfers(c *gin.Context) {
+	userID := c.GetUint("id")
+	transfers, err := h.service.GetTransfers(userID)
+	if err != nil {
+		commons.HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"transfers": transfers})
+}
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/KZY20112001/infinivest-backend/internal/commons"
+	"github.com/KZY20112001/infinivest-backend/internal/dto"
+	"github.com/KZY20112001/infinivest-backend/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+type WatchlistHandler struct {
+	service services.WatchlistService
+}
+
+func NewWatchlistHandler(ws services.WatchlistService) *WatchlistHandler {
+	return &WatchlistHandler{service: ws}
+}
+
+func (h *WatchlistHandler) CreateWatchlist(c *gin.Context) {
+	var req dto.WatchlistRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	userID := c.GetUint("id")
+	watchlist, err := h.service.CreateWatchlist(userID, req.Name)
+	if err != nil {
+		commons.HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"watchlist": watchlist})
+}
+
+func (h *WatchlistHandler) GetWatchlists(c *gin.Context) {
+	userID := c.GetUint("id")
+	watchlists, err := h.service.GetWatchlists(userID)
+	if err != nil {
+		commons.HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"watchlists": watchlists})
+}
+
+func (h *WatchlistHandler) GetWatchlist(c *gin.Context) {
+	watchlistID, err := parseIDParam(c, "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	userID := c.GetUint("id")
+	watchlist, err := h.service.GetWatchlist(userID, watchlistID)
+	if err != nil {
+		commons.HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"watchlist": watchlist})
+}
+
+func (h *WatchlistHandler) DeleteWatchlist(c *gin.Context) {
+	watchlistID, err := parseIDParam(c, "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	userID := c.GetUint("id")
+	if err := h.service.DeleteWatchlist(userID, watchlistID); err != nil {
+		commons.HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "watchlist deleted"})
+}
+
+func (h *WatchlistHandler) AddSymbol(c *gin.Context) {
+	watchlistID, err := parseIDParam(c, "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var req dto.WatchlistSymbolRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	userID := c.GetUint("id")
+	item, err := h.service.AddSymbol(userID, watchlistID, req.Symbol)
+	if err != nil {
+		commons.HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"item": item})
+}
+
+func (h *WatchlistHandler) RemoveSymbol(c *gin.Context) {
+	watchlistID, err := parseIDParam(c, "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	userID := c.GetUint("id")
+	if err := h.service.RemoveSymbol(userID, watchlistID, c.Param("symbol")); err != nil {
+		commons.HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "symbol removed"})
+}
+
+func (h *WatchlistHandler) CreatePriceAlert(c *gin.Context) {
+	watchlistID, err := parseIDParam(c, "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var req dto.PriceAlertRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	userID := c.GetUint("id")
+	alert, err := h.service.CreatePriceAlert(userID, watchlistID, c.Param("symbol"), req)
+	if err != nil {
+		commons.HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"alert": alert})
+}
+
+func (h *WatchlistHandler) DeletePriceAlert(c *gin.Context) {
+	alertID, err := parseIDParam(c, "alertId")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	userID := c.GetUint("id")
+	if err := h.service.DeletePriceAlert(userID, alertID); err != nil {
+		commons.HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "alert deleted"})
+}
@@ -0,0 +1,154 @@
+package middlewares
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/KZY20112001/infinivest-backend/internal/redis"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	maxIdempotencyKeyLength = 255
+	// how long a key stays claimed without a refresh, so a crashed server does not block retries for long.
+	// The reservation is refreshed while the request runs, however slow it is.
+	idempotencyPendingTTL      = time.Minute
+	idempotencyRefreshInterval = idempotencyPendingTTL / 3
+)
+
+type recordingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *recordingWriter) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *recordingWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// IdempotencyMiddleware makes requests carrying an Idempotency-Key header run at most once per user and key.
+// The first response is stored for ttl and replayed for retries, while reusing the key for a different request
+// is rejected. Requests without the header are handled as usual. It must run after AuthMiddleware.
+func IdempotencyMiddleware(store redis.IdempotencyRedis, ttl time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader("Idempotency-Key")
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key must be at most 255 characters"})
+			c.Abort()
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		hash := sha256.New()
+		hash.Write([]byte(c.Request.Method + " " + c.Request.URL.Path + "\n"))
+		hash.Write(body)
+		fingerprint := hex.EncodeToString(hash.Sum(nil))
+
+		ctx := c.Request.Context()
+		userID := c.GetUint("id")
+		reserved, err := store.Reserve(ctx, userID, key, fingerprint, idempotencyPendingTTL)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check Idempotency-Key"})
+			c.Abort()
+			return
+		}
+		if !reserved {
+			record, err := store.Get(ctx, userID, key)
+			switch {
+			case err != nil:
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check Idempotency-Key"})
+			case record == nil:
+				// the earlier request expired between the two calls
+				c.JSON(http.StatusConflict, gin.H{"error": "Idempotency-Key is being reused, please retry"})
+			case record.Fingerprint != fingerprint:
+				c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Idempotency-Key was already used for a different request"})
+			case record.Status == 0:
+				c.JSON(http.StatusConflict, gin.H{"error": "A request with this Idempotency-Key is still in progress"})
+			default:
+				c.Header("Idempotent-Replayed", "true")
+				c.Data(record.Status, record.ContentType, record.Body)
+			}
+			c.Abort()
+			return
+		}
+
+		// the client may disconnect before the handler finishes, which is when a retry is most likely,
+		// so the outcome is stored even after the request context is cancelled
+		storeCtx := context.WithoutCancel(ctx)
+		stopRefresh := keepIdempotencyKeyReserved(storeCtx, store, userID, key)
+		defer stopRefresh()
+
+		writer := &recordingWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		c.Next()
+		stopRefresh()
+
+		// server errors are not stored so the request can be retried with the same key
+		if c.Writer.Status() >= http.StatusInternalServerError {
+			if err := store.Release(storeCtx, userID, key); err != nil {
+				log.Printf("Failed to release idempotency key %q for user %d: %v\n", key, userID, err)
+			}
+			return
+		}
+		record := &redis.IdempotencyRecord{
+			Fingerprint: fingerprint,
+			Status:      c.Writer.Status(),
+			ContentType: c.Writer.Header().Get("Content-Type"),
+			Body:        writer.body.Bytes(),
+		}
+		if err := store.Save(storeCtx, userID, key, record, ttl); err != nil {
+			log.Printf("Failed to store response for idempotency key %q for user %d: %v\n", key, userID, err)
+		}
+	}
+}
+
+// keepIdempotencyKeyReserved refreshes the pending reservation until the returned function is called
+func keepIdempotencyKeyReserved(ctx context.Context, store redis.IdempotencyRedis, userID uint, key string) func() {
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(idempotencyRefreshInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if err := store.Refresh(ctx, userID, key, idempotencyPendingTTL); err != nil {
+					log.Printf("Failed to refresh idempotency key %q for user %d: %v\n", key, userID, err)
+				}
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(stop)
+			<-done
+		})
+	}
+}
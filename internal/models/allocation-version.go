@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// AllocationVersion is a snapshot of a robo portfolio's target allocation, recorded whenever the targets change
+type AllocationVersion struct {
+	gorm.Model
+	RoboPortfolioID uint `gorm:"not null;index;uniqueIndex:idx_allocation_version"`
+
+	Version     int       `gorm:"uniqueIndex:idx_allocation_version" json:"version"`
+	Reason      string    `json:"reason"` // "initial" or "recommendation" or "user-edit" or "glide-path" or "tax-loss-harvest"
+	EffectiveAt time.Time `json:"effectiveAt"`
+
+	Targets []*AllocationTarget `json:"targets"`
+}
+
+// AllocationTarget is a category target when Symbol is empty, otherwise an asset target. Percentages are of the whole portfolio.
+type AllocationTarget struct {
+	gorm.Model
+	AllocationVersionID uint `gorm:"not null;index"`
+
+	Category   string  `json:"category"`
+	Symbol     string  `json:"symbol"`
+	Name       string  `json:"name"`
+	Percentage float64 `json:"percentage"`
+}
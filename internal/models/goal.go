@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+
+	"github.com/KZY20112001/infinivest-backend/internal/commons/decimal"
+	"gorm.io/gorm"
+)
+
+type Goal struct {
+	gorm.Model
+	UserID              uint            `gorm:"not null;index"`
+	RoboPortfolioID     uint            `gorm:"not null;index" json:"roboPortfolioID"`
+	Name                string          `json:"name"`
+	TargetAmount        decimal.Decimal `json:"targetAmount"`
+	TargetDate          time.Time       `json:"targetDate"`
+	MonthlyContribution decimal.Decimal `json:"monthlyContribution"`
+}
@@ -1,23 +1,48 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"github.com/KZY20112001/infinivest-backend/internal/commons/decimal"
+	"gorm.io/gorm"
+)
 
 type ManualPortfolio struct {
 	gorm.Model
 	UserID       uint                          `gorm:"not null;index:idx_user_name,unique"`
 	Name         string                        `gorm:"index:idx_user_name,unique" json:"name"`
 	Assets       []*ManualPortfolioAsset       `json:"assets"`
-	TotalCash    float64                       `json:"totalCash"`
+	TotalCash    decimal.Decimal               `json:"totalCash"`
+	ReservedCash decimal.Decimal               `json:"reservedCash"` // held for pending buy orders
 	Transactions []*ManualPortfolioTransaction `json:"manualPortfolioTransactions"`
+
+	// target weights per symbol; whatever they leave of 100% is the cash target
+	Targets            []*ManualPortfolioTarget `json:"targets"`
+	RebalanceThreshold float64                  `json:"rebalanceThreshold"`
+
+	// the cash and the amounts invested are held in this currency
+	Currency string `gorm:"default:'USD'" json:"currency"`
+}
+
+type ManualPortfolioTarget struct {
+	gorm.Model
+	ManualPortfolioID uint    `gorm:"not null;index"`
+	Symbol            string  `json:"symbol"`
+	Name              string  `json:"name"`
+	Percentage        float64 `json:"percentage"`
 }
 
 type ManualPortfolioAsset struct {
 	gorm.Model
-	ManualPortfolioID     uint    `gorm:"not null;index"`
-	ManualPortfolioUserID uint    `gorm:"not null;index"`
-	Symbol                string  `json:"symbol"`
-	Name                  string  `json:"name"`
-	SharesOwned           float64 `json:"sharesOwned"`
-	TotalInvested         float64 `json:"totalInvested"`
-	AvgBuyPrice           float64 `json:"avgBuyPrice"`
+	ManualPortfolioID     uint            `gorm:"not null;index"`
+	ManualPortfolioUserID uint            `gorm:"not null;index"`
+	Symbol                string          `json:"symbol"`
+	Name                  string          `json:"name"`
+	SharesOwned           decimal.Decimal `json:"sharesOwned"`
+	TotalInvested         decimal.Decimal `json:"totalInvested"`
+	AvgBuyPrice           decimal.Decimal `json:"avgBuyPrice"`
+	SharesReserved        decimal.Decimal `json:"sharesReserved"` // held for pending sell orders
+
+	// prices and AvgBuyPrice are in the asset's Currency while TotalInvested is in the portfolio currency.
+	// AvgFxRate is the average portfolio currency paid per unit of the asset currency
+	Currency  string          `gorm:"default:'USD'" json:"currency"`
+	AvgFxRate decimal.Decimal `gorm:"default:1" json:"avgFxRate"`
 }
@@ -0,0 +1,53 @@
+package models
+
+import (
+	"time"
+
+	"github.com/KZY20112001/infinivest-backend/internal/commons/decimal"
+	"gorm.io/gorm"
+)
+
+// Order is a trade submitted on a manual portfolio. Market orders fill straight away, conditional orders are
+// filled by the order monitor once their price condition is met. Buy orders reserve cash and sell orders
+// reserve shares while they are pending or partially filled.
+type Order struct {
+	gorm.Model
+	UserID            uint   `gorm:"not null;index"`
+	ManualPortfolioID uint   `gorm:"not null;index"`
+	Symbol            string `json:"symbol"`
+	Name              string `json:"name"`
+
+	Side        string          `json:"side"`        // "buy" or "sell"
+	OrderType   string          `json:"orderType"`   // "market", "limit", "stop", "stop-limit" or "trailing-stop"
+	TimeInForce string          `json:"timeInForce"` // "gtc" or "day", empty for market orders
+	Shares      decimal.Decimal `json:"shares"`
+
+	LimitPrice   *decimal.Decimal `json:"limitPrice"`
+	StopPrice    *decimal.Decimal `json:"stopPrice"` // for trailing stops, the current stop
+	TrailAmount  *decimal.Decimal `json:"trailAmount"`
+	TrailPercent *float64         `json:"trailPercent"`
+	// best price seen since the order was placed: the highest for trailing sells, the lowest for trailing buys
+	ReferencePrice *decimal.Decimal `json:"referencePrice"`
+	StopTriggered  bool             `json:"stopTriggered"` // a triggered stop-limit order behaves like a limit order
+
+	ReservedCash decimal.Decimal `json:"reservedCash"`
+	FxRate       decimal.Decimal `json:"fxRate"` // from the asset currency to the portfolio currency when the cash was reserved
+
+	Status           string          `gorm:"index" json:"status"`    // "pending", "partially-filled", "filled", "cancelled" or "rejected"
+	StatusReason     string          `json:"statusReason,omitempty"` // why the order was cancelled or rejected
+	ExpiresAt        *time.Time      `json:"expiresAt"`
+	FilledShares     decimal.Decimal `json:"filledShares"`
+	AverageFillPrice decimal.Decimal `json:"averageFillPrice"`
+	FilledAt         *time.Time      `json:"filledAt"`
+	Fills            []*OrderFill    `json:"fills"`
+}
+
+// OrderFill is one execution of an order, recorded with the transaction it produced
+type OrderFill struct {
+	gorm.Model
+	OrderID       uint            `gorm:"not null;index"`
+	TransactionID uint            `gorm:"index" json:"transactionId"`
+	Shares        decimal.Decimal `json:"shares"`
+	Price         decimal.Decimal `json:"price"`
+	Amount        decimal.Decimal `json:"amount"`
+}
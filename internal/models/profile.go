@@ -1,18 +1,30 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"time"
+
+	"github.com/KZY20112001/infinivest-backend/internal/commons/decimal"
+	"gorm.io/gorm"
+)
 
 type Profile struct {
 	gorm.Model
 	UserID            uint
 	User              User
-	FirstName         string  `json:"firstName"`
-	LastName          string  `json:"lastName"`
-	ProfileUrl        string  `json:"profileUrl"`
-	ProfileID         string  `json:"profileID"`
-	RiskTolerance     string  `json:"riskTolerance"`
-	InvestmentStyle   string  `json:"investmentStyle"`
-	InvestmentHorizon string  `json:"investmentHorizon"`
-	AnnualIncome      float64 `json:"annualIncome"`
-	ExperienceLevel   string  `json:"experienceLevel"`
+	FirstName         string          `json:"firstName"`
+	LastName          string          `json:"lastName"`
+	ProfileUrl        string          `json:"profileUrl"`
+	ProfileID         string          `json:"profileID"`
+	RiskTolerance     string          `json:"riskTolerance"`
+	InvestmentStyle   string          `json:"investmentStyle"`
+	InvestmentHorizon string          `json:"investmentHorizon"`
+	AnnualIncome      decimal.Decimal `json:"annualIncome"`
+	ExperienceLevel   string          `json:"experienceLevel"`
+	BaseCurrency      string          `gorm:"default:'USD'" json:"baseCurrency"` // valuations and summaries are reported in it
+
+	// set from the risk questionnaire, RiskTolerance then holds the computed risk level
+	RiskQuestionnaireVersion int               `json:"riskQuestionnaireVersion"`
+	RiskScore                float64           `json:"riskScore"`
+	RiskAnswers              map[string]string `gorm:"serializer:json" json:"riskAnswers"`
+	RiskAssessedAt           *time.Time        `json:"riskAssessedAt"`
 }
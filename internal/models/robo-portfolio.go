@@ -1,15 +1,41 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"time"
+
+	"github.com/KZY20112001/infinivest-backend/internal/commons/decimal"
+	"gorm.io/gorm"
+)
 
 type RoboPortfolio struct {
 	gorm.Model
-	UserID          uint                        `gorm:"uniqueIndex;not null"`
+	UserID          uint                        `gorm:"not null;index:idx_robo_user_name,unique,where:deleted_at IS NULL"`
+	Name            string                      `gorm:"index:idx_robo_user_name,unique,where:deleted_at IS NULL" json:"name"`
+	Goal            string                      `json:"goal"` // "retirement" or "house" or "education" or "general"
 	Categories      []*RoboPortfolioCategory    `json:"categories"`
 	RebalanceFreq   *string                     `json:"rebalanceFreq"`
 	RebalanceEvents []*RebalanceEvent           `json:"rebalanceEvents"`
 	Transactions    []*RoboPortfolioTransaction `json:"roboPortfolioTransactions"`
 	IsRebalancing   bool                        `json:"isRebalancing"`
+	Currency        string                      `gorm:"default:'USD'" json:"currency"`
+
+	// automatic rebalancing is suspended while paused, optionally until PausedUntil
+	IsPaused    bool       `json:"isPaused"`
+	PausedUntil *time.Time `json:"pausedUntil"`
+
+	DepositStrategy   string  `gorm:"default:'pro-rata'" json:"depositStrategy"`
+	TaxLossHarvesting bool    `json:"taxLossHarvesting"`
+	HarvestThreshold  float64 `json:"harvestThreshold"` // minimum unrealized loss in percent before a position is harvested
+
+	// the glide path moves category targets from equities to bonds and cash until GlidePathTargetDate
+	GlidePathEnabled     bool       `json:"glidePathEnabled"`
+	GlidePathCurve       string     `json:"glidePathCurve"`
+	GlidePathStartDate   *time.Time `json:"glidePathStartDate"`
+	GlidePathTargetDate  *time.Time `json:"glidePathTargetDate"`
+	GlidePathStartEquity float64    `json:"glidePathStartEquity"` // percent of the portfolio
+	GlidePathStartCash   float64    `json:"glidePathStartCash"`
+	GlidePathEndEquity   float64    `json:"glidePathEndEquity"`
+	GlidePathEndCash     float64    `json:"glidePathEndCash"`
 }
 
 type RoboPortfolioCategory struct {
@@ -17,7 +43,7 @@ type RoboPortfolioCategory struct {
 	RoboPortfolioID uint                  `gorm:"not null"`
 	Name            string                `json:"name"`
 	TotalPercentage float64               `json:"totalPercentage"`
-	TotalAmount     float64               `json:"totalAmount"`
+	TotalAmount     decimal.Decimal       `json:"totalAmount"`
 	Assets          []*RoboPortfolioAsset `json:"assets"`
 }
 
@@ -28,24 +54,62 @@ type RoboPortfolioAsset struct {
 	Symbol     string  `json:"symbol"`
 	Name       string  `json:"name"`
 	Percentage float64 `json:"percentage"`
+	Currency   string  `gorm:"default:'USD'" json:"currency"`
+
+	SharesOwned   decimal.Decimal `json:"sharesOwned"`
+	TotalInvested decimal.Decimal `json:"totalInvested"`
+	AvgBuyPrice   decimal.Decimal `json:"avgBuyPrice"`
+
+	Lots []*RoboPortfolioLot `json:"lots"`
+}
+
+// RoboPortfolioLot is a tax lot opened by a single buy of a robo portfolio asset
+type RoboPortfolioLot struct {
+	gorm.Model
+	RoboPortfolioAssetID uint `gorm:"not null;index"`
 
-	SharesOwned   float64 `json:"sharesOwned"`
-	TotalInvested float64 `json:"totalInvested"`
-	AvgBuyPrice   float64 `json:"avgBuyPrice"`
+	SharesRemaining decimal.Decimal `json:"sharesRemaining"`
+	CostPerShare    decimal.Decimal `json:"costPerShare"`
+	AcquiredAt      time.Time       `json:"acquiredAt"`
 }
 
 type RebalanceEvent struct {
 	gorm.Model
 	RoboPortfolioID uint `gorm:"not null"`
 
-	TotalBuyAmount  float64 `json:"totalBuyAmount"`
-	TotalSellAmount float64 `json:"totalSellAmount"`
-	NetChange       float64 `json:"netChange"`
+	TotalBuyAmount  decimal.Decimal `json:"totalBuyAmount"`
+	TotalSellAmount decimal.Decimal `json:"totalSellAmount"`
+	NetChange       decimal.Decimal `json:"netChange"`
 
 	Success bool    `json:"success"` // was this rebalance completed?
 	Reason  *string `json:"reason"`  // optional error or reason (e.g. "insufficient funds")
 
-	PortfolioValueBefore float64 `json:"portfolioValueBefore"`
-	PortfolioValueAfter  float64 `json:"portfolioValueAfter"`
-	GainOrLoss           float64 `json:"gainOrLoss"`
+	PortfolioValueBefore decimal.Decimal `json:"portfolioValueBefore"`
+	PortfolioValueAfter  decimal.Decimal `json:"portfolioValueAfter"`
+	GainOrLoss           decimal.Decimal `json:"gainOrLoss"`
+	HarvestedLoss        decimal.Decimal `json:"harvestedLoss"`
+	Fees                 decimal.Decimal `json:"fees"`
+
+	Assets       []*RebalanceEventAsset      `json:"assets,omitempty"`
+	Transactions []*RoboPortfolioTransaction `json:"transactions,omitempty"`
+}
+
+// RebalanceEventAsset is the before and after state of one holding in a rebalance. Weights are percentages of
+// the portfolio value, traded amounts are positive for buys and negative for sells. Cash has no symbol.
+type RebalanceEventAsset struct {
+	gorm.Model
+	RebalanceEventID uint `gorm:"not null;index"`
+
+	Category string `json:"category"`
+	Symbol   string `json:"symbol"`
+	Name     string `json:"name"`
+
+	WeightBefore float64 `json:"weightBefore"`
+	TargetWeight float64 `json:"targetWeight"`
+	WeightAfter  float64 `json:"weightAfter"`
+
+	SharesTraded decimal.Decimal `json:"sharesTraded"`
+	AmountTraded decimal.Decimal `json:"amountTraded"`
+	Price        decimal.Decimal `json:"price"`
+	Fee          decimal.Decimal `json:"fee"`
 }
@@ -0,0 +1,22 @@
+package models
+
+import "gorm.io/gorm"
+
+// ExclusionRule removes assets from a user's robo portfolios by symbol, by sector or by a minimum ESG score
+type ExclusionRule struct {
+	gorm.Model
+	UserID      uint    `gorm:"not null;index"`
+	RuleType    string  `json:"ruleType"` // symbol, sector or min-esg
+	Value       string  `json:"value"`
+	MinESGScore float64 `json:"minESGScore"`
+}
+
+type AssetMetadata struct {
+	gorm.Model
+	Symbol   string  `gorm:"uniqueIndex" json:"symbol"`
+	Name     string  `json:"name"`
+	Category string  `gorm:"index" json:"category"`
+	Sector   string  `json:"sector"`
+	ESGScore float64 `json:"esgScore"` // 0-10, higher is better
+	Approved bool    `json:"approved"` // can be used as a substitute for an excluded asset
+}
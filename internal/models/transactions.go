@@ -1,30 +1,46 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"github.com/KZY20112001/infinivest-backend/internal/commons/decimal"
+	"gorm.io/gorm"
+)
 
 type RoboPortfolioTransaction struct {
 	gorm.Model
 	RoboPortfolioID uint
 
-	TransactionType string  `json:"transactionType"` // "buy" or "sell" or "dividend" or "deposit" or "withdrawal" or or "rebalance:sell" or "rebalance:buy"
-	TotalAmount     float64 `json:"totalAmount"`
+	TransactionType string          `json:"transactionType"` // "buy" or "sell" or "dividend" or "deposit" or "withdrawal" or "rebalance:sell" or "rebalance:buy" or "harvest:sell" or "harvest:buy" or "transfer:out" or "transfer:in"
+	TotalAmount     decimal.Decimal `json:"totalAmount"`
 
-	Symbol       *string  `json:"symbol"`
-	Name         *string  `json:"name"`
-	Price        *float64 `json:"price"`
-	SharesAmount *float64 `json:"sharesAmount"`
+	Symbol       *string          `json:"symbol"`
+	Name         *string          `json:"name"`
+	Price        *decimal.Decimal `json:"price"`
+	SharesAmount *decimal.Decimal `json:"sharesAmount"`
+
+	Fee              decimal.Decimal `json:"fee"`
+	RebalanceEventID *uint           `gorm:"index" json:"rebalanceEventId,omitempty"` // set for trades made by a rebalance
+	TransferID       *uint           `gorm:"index" json:"transferId,omitempty"`
 }
 
 type ManualPortfolioTransaction struct {
 	gorm.Model
 	ManualPortfolioUserID uint `gorm:"not null;index"`
-	ManualPortfolioID     uint `gorm:"not null;index"`
+	ManualPortfolioID     uint `gorm:"not null;index;uniqueIndex:idx_manual_import_key"`
+
+	TransactionType string          `json:"transactionType"` // "buy" or "sell" or "dividend" or "deposit" or "withdrawal" or "transfer:out" or "transfer:in"
+	TotalAmount     decimal.Decimal `json:"totalAmount"`
+
+	Symbol       *string          `json:"symbol"`
+	Name         *string          `json:"name"`
+	Price        *decimal.Decimal `json:"price"`
+	SharesAmount *decimal.Decimal `json:"sharesAmount"`
+
+	OrderID    *uint `gorm:"index" json:"orderId,omitempty"` // the order this trade filled
+	TransferID *uint `gorm:"index" json:"transferId,omitempty"`
 
-	TransactionType string  `json:"transactionType"` // "buy" or "sell" or "dividend" or "deposit" or "withdrawal"
-	TotalAmount     float64 `json:"totalAmount"`
+	// TotalAmount is in the portfolio currency and Price in the asset currency, FxRate converts between them
+	FxRate *decimal.Decimal `json:"fxRate,omitempty"`
 
-	Symbol       *string  `json:"symbol"`
-	Name         *string  `json:"name"`
-	Price        *float64 `json:"price"`
-	SharesAmount *float64 `json:"sharesAmount"`
+	Fee       decimal.Decimal `json:"fee"`
+	ImportKey *string         `gorm:"uniqueIndex:idx_manual_import_key" json:"importKey,omitempty"` // identifies a row of an imported statement
 }
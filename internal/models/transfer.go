@@ -0,0 +1,25 @@
+package models
+
+import (
+	"github.com/KZY20112001/infinivest-backend/internal/commons/decimal"
+	"gorm.io/gorm"
+)
+
+// Transfer moves cash, or shares with their cost basis, between two of a user's portfolios. Each side records a
+// transfer:out or transfer:in transaction linked to it.
+type Transfer struct {
+	gorm.Model
+	UserID uint   `gorm:"not null;index"`
+	Kind   string `json:"kind"` // "cash" or "in-kind"
+
+	SourceType      string `json:"sourceType"` // "manual" or "robo"
+	SourceID        uint   `json:"sourceId"`
+	DestinationType string `json:"destinationType"`
+	DestinationID   uint   `json:"destinationId"`
+
+	Amount decimal.Decimal  `json:"amount"` // cash moved, or the cost basis of the shares, in the source currency
+	Symbol *string          `json:"symbol"`
+	Shares *decimal.Decimal `json:"shares"`
+
+	FxRate decimal.Decimal `gorm:"default:1" json:"fxRate"` // from the source to the destination currency
+}
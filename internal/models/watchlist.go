@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"github.com/KZY20112001/infinivest-backend/internal/commons/decimal"
+	"gorm.io/gorm"
+)
+
+type Watchlist struct {
+	gorm.Model
+	UserID uint             `gorm:"not null;index:idx_watchlist_user_name,unique"`
+	Name   string           `gorm:"index:idx_watchlist_user_name,unique" json:"name"`
+	Items  []*WatchlistItem `json:"items"`
+}
+
+type WatchlistItem struct {
+	gorm.Model
+	WatchlistID uint          `gorm:"not null;index:idx_watchlist_symbol,unique"`
+	Symbol      string        `gorm:"index:idx_watchlist_symbol,unique" json:"symbol"`
+	Alerts      []*PriceAlert `json:"alerts"`
+}
+
+// PriceAlert fires when the price crosses Threshold ("above", "below") or moves by at least Threshold percent
+// from the previous close ("percent-move"). It fires again only after the cooldown has passed.
+type PriceAlert struct {
+	gorm.Model
+	WatchlistItemID uint            `gorm:"not null;index"`
+	UserID          uint            `gorm:"not null;index"`
+	Symbol          string          `json:"symbol"`
+	AlertType       string          `json:"alertType"`
+	Threshold       decimal.Decimal `json:"threshold"` // a price for "above" and "below", a percentage for "percent-move"
+	Active          bool            `gorm:"default:true" json:"active"`
+	LastTriggeredAt *time.Time      `json:"lastTriggeredAt"`
+	LastPrice       decimal.Decimal `json:"lastPrice"` // price when the alert last fired
+}
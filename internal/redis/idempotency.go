@@ -0,0 +1,80 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// IdempotencyRecord is the stored outcome of a request made with an Idempotency-Key. Fingerprint identifies the
+// request it was made for; Status is zero while that request is still being handled.
+type IdempotencyRecord struct {
+	Fingerprint string `json:"fingerprint"`
+	Status      int    `json:"status"`
+	ContentType string `json:"contentType"`
+	Body        []byte `json:"body"`
+}
+
+type IdempotencyRedis interface {
+	// Reserve claims the key for a new request, returning false when it is already held by an earlier one
+	Reserve(ctx context.Context, userID uint, key, fingerprint string, ttl time.Duration) (bool, error)
+	Get(ctx context.Context, userID uint, key string) (*IdempotencyRecord, error)
+	// Refresh extends how long the key stays reserved while its request is still running
+	Refresh(ctx context.Context, userID uint, key string, ttl time.Duration) error
+	Save(ctx context.Context, userID uint, key string, record *IdempotencyRecord, ttl time.Duration) error
+	Release(ctx context.Context, userID uint, key string) error
+}
+
+type idempotencyRedis struct {
+	client *redis.Client
+}
+
+func NewIdempotencyRedis(client *redis.Client) *idempotencyRedis {
+	return &idempotencyRedis{client: client}
+}
+
+func idempotencyKey(userID uint, key string) string {
+	return fmt.Sprintf("idempotency:%d:%s", userID, key)
+}
+
+func (r *idempotencyRedis) Reserve(ctx context.Context, userID uint, key, fingerprint string, ttl time.Duration) (bool, error) {
+	value, err := json.Marshal(&IdempotencyRecord{Fingerprint: fingerprint})
+	if err != nil {
+		return false, err
+	}
+	return r.client.SetNX(ctx, idempotencyKey(userID, key), value, ttl).Result()
+}
+
+func (r *idempotencyRedis) Get(ctx context.Context, userID uint, key string) (*IdempotencyRecord, error) {
+	value, err := r.client.Get(ctx, idempotencyKey(userID, key)).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var record IdempotencyRecord
+	if err := json.Unmarshal(value, &record); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+func (r *idempotencyRedis) Refresh(ctx context.Context, userID uint, key string, ttl time.Duration) error {
+	return r.client.Expire(ctx, idempotencyKey(userID, key), ttl).Err()
+}
+
+func (r *idempotencyRedis) Save(ctx context.Context, userID uint, key string, record *IdempotencyRecord, ttl time.Duration) error {
+	value, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return r.client.Set(ctx, idempotencyKey(userID, key), value, ttl).Err()
+}
+
+func (r *idempotencyRedis) Release(ctx context.Context, userID uint, key string) error {
+	return r.client.Del(ctx, idempotencyKey(userID, key)).Err()
+}
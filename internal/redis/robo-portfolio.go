@@ -19,6 +19,9 @@ type RoboPortfolioRedis interface {
 	AcquireLock(ctx context.Context, userID, portfolioID uint, ttl time.Duration) (bool, error)
 	ReleaseLock(ctx context.Context, userID, portfolioID uint) error
 
+	SetDriftCooldown(ctx context.Context, userID, portfolioID uint, ttl time.Duration) error
+	IsInDriftCooldown(ctx context.Context, userID, portfolioID uint) (bool, error)
+
 	SetLastSeen(ctx context.Context, userID, portfolioID uint) error
 	GetLastSeen(ctx context.Context, userID, portfolioID uint) (time.Time, error)
 }
@@ -147,3 +150,18 @@ func (r *roboPortfolioRedis) ReleaseLock(ctx context.Context, userID, portfolioI
 	_, err := r.client.Del(ctx, lockKey).Result()
 	return err
 }
+
+func (r *roboPortfolioRedis) SetDriftCooldown(ctx context.Context, userID, portfolioID uint, ttl time.Duration) error {
+	key := fmt.Sprintf("drift_rebalance_cooldown:%d:%d", userID, portfolioID)
+	_, err := r.client.Set(ctx, key, time.Now().Unix(), ttl).Result()
+	return err
+}
+
+func (r *roboPortfolioRedis) IsInDriftCooldown(ctx context.Context, userID, portfolioID uint) (bool, error) {
+	key := fmt.Sprintf("drift_rebalance_cooldown:%d:%d", userID, portfolioID)
+	exists, err := r.client.Exists(ctx, key).Result()
+	if err != nil {
+		return false, err
+	}
+	return exists > 0, nil
+}
@@ -0,0 +1,110 @@
+package repositories
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/KZY20112001/infinivest-backend/internal/commons"
+	"github.com/KZY20112001/infinivest-backend/internal/commons/decimal"
+)
+
+type FXRateRepository interface {
+	// GetRates returns how many units of each known currency one unit of base buys
+	GetRates(base string) (map[string]decimal.Decimal, error)
+}
+
+type fxRates struct {
+	Base  string                     `json:"base"`
+	Rates map[string]decimal.Decimal `json:"rates"`
+}
+
+// fileFXRateRepository serves fixed rates from a JSON file, for local runs without an FX provider
+type fileFXRateRepository struct {
+	base  string
+	rates map[string]decimal.Decimal
+}
+
+// NewFileFXRateRepository reads {"base": "USD", "rates": {"EUR": 0.92}} from path, or uses the built-in rates
+// when path is empty
+func NewFileFXRateRepository(path string) (*fileFXRateRepository, error) {
+	if path == "" {
+		return &fileFXRateRepository{base: commons.DefaultCurrency, rates: commons.DefaultFXRates}, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fx rates: %w", err)
+	}
+	var file fxRates
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse fx rates: %w", err)
+	}
+	base, err := commons.NormalizeCurrency(file.Base)
+	if err != nil {
+		return nil, err
+	}
+	rates := map[string]decimal.Decimal{base: decimal.One}
+	for currency, rate := range file.Rates {
+		code, err := commons.NormalizeCurrency(currency)
+		if err != nil {
+			return nil, err
+		}
+		if !rate.IsPositive() {
+			return nil, fmt.Errorf("invalid fx rate for %s", code)
+		}
+		rates[code] = rate
+	}
+	return &fileFXRateRepository{base: base, rates: rates}, nil
+}
+
+func (r *fileFXRateRepository) GetRates(base string) (map[string]decimal.Decimal, error) {
+	baseRate, exists := r.rates[base]
+	if !exists {
+		return nil, fmt.Errorf("no fx rate for %s", base)
+	}
+	rates := make(map[string]decimal.Decimal, len(r.rates))
+	for currency, rate := range r.rates {
+		rates[currency] = rate.Div(baseRate)
+	}
+	return rates, nil
+}
+
+// httpFXRateRepository fetches the latest rates from a Frankfurter compatible API
+type httpFXRateRepository struct {
+	client  *http.Client
+	baseURL string
+}
+
+func NewHTTPFXRateRepository(baseURL string) *httpFXRateRepository {
+	return &httpFXRateRepository{
+		client:  &http.Client{Timeout: 10 * time.Second},
+		baseURL: baseURL,
+	}
+}
+
+func (r *httpFXRateRepository) GetRates(base string) (map[string]decimal.Decimal, error) {
+	url := fmt.Sprintf("%s/latest?from=%s", r.baseURL, base)
+	resp, err := r.client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("request failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var res fxRates
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return nil, err
+	}
+	if res.Rates == nil {
+		res.Rates = make(map[string]decimal.Decimal)
+	}
+	res.Rates[base] = decimal.One
+	return res.Rates, nil
+}
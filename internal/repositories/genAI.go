@@ -7,15 +7,19 @@ import (
 	"io"
 	"mime/multipart"
 	"net/http"
+	neturl "net/url"
 	"time"
 
+	"github.com/KZY20112001/infinivest-backend/internal/commons"
+	"github.com/KZY20112001/infinivest-backend/internal/commons/decimal"
 	"github.com/KZY20112001/infinivest-backend/internal/dto"
 )
 
 type GenAIRepository interface {
 	GeneratePortfolioRecommendation(bankStatement *multipart.FileHeader, bankName, toleranceLevel string) (dto.RoboAdvisorRecommendationResponse, error)
 	GenerateAssetAllocation(category string, percentage float64) (dto.Assets, error)
-	GetLatestAssetPrice(symbol string) (float64, error)
+	GetLatestAssetPrice(symbol string) (decimal.Decimal, error)
+	GetAssetPriceHistory(symbol string, days int) ([]dto.PricePoint, error)
 }
 
 type flaskMicroservice struct {
@@ -73,10 +77,13 @@ func (r *flaskMicroservice) GeneratePortfolioRecommendation(bankStatement *multi
 	req.Header.Set("Content-Type", writer.FormDataContentType())
 	resp, err := r.client.Do(req)
 	if err != nil {
-		return dto.RoboAdvisorRecommendationResponse{}, fmt.Errorf("failed to send request: %w", err)
+		return dto.RoboAdvisorRecommendationResponse{}, fmt.Errorf("failed to send request: %w: %v", commons.ErrUnavailable, err)
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return dto.RoboAdvisorRecommendationResponse{}, fmt.Errorf("microservice error: %w: status code %d", commons.ErrUnavailable, resp.StatusCode)
+	}
 	if resp.StatusCode != http.StatusOK {
 		var errorResponse map[string]string
 		if err := json.NewDecoder(resp.Body).Decode(&errorResponse); err == nil {
@@ -120,22 +127,43 @@ func (r *flaskMicroservice) GenerateAssetAllocation(category string, percentage
 	return assets, nil
 }
 
-func (r *flaskMicroservice) GetLatestAssetPrice(symbol string) (float64, error) {
-	url := fmt.Sprintf("%s/assets/latest-price/%s", r.baseURL, symbol)
+func (r *flaskMicroservice) GetLatestAssetPrice(symbol string) (decimal.Decimal, error) {
+	url := fmt.Sprintf("%s/assets/latest-price/%s", r.baseURL, neturl.PathEscape(symbol))
 	resp, err := http.Get(url)
 	if err != nil {
-		return 0, err
+		return decimal.Zero, err
 	}
 
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return 0, fmt.Errorf("request failed with status %d: %s", resp.StatusCode, string(body))
+		return decimal.Zero, fmt.Errorf("request failed with status %d: %s", resp.StatusCode, string(body))
 	}
 
-	var price float64
+	// decoded from the JSON text, so the quoted price is kept exactly
+	var price decimal.Decimal
 	if err := json.NewDecoder(resp.Body).Decode(&price); err != nil {
-		return 0, err
+		return decimal.Zero, err
 	}
 	return price, nil
 }
+
+func (r *flaskMicroservice) GetAssetPriceHistory(symbol string, days int) ([]dto.PricePoint, error) {
+	url := fmt.Sprintf("%s/assets/price-history/%s?days=%d", r.baseURL, neturl.PathEscape(symbol), days)
+	resp, err := r.client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("request failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var history []dto.PricePoint
+	if err := json.NewDecoder(resp.Body).Decode(&history); err != nil {
+		return nil, err
+	}
+	return history, nil
+}
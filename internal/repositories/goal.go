@@ -0,0 +1,71 @@
+package repositories
+
+import (
+	"errors"
+
+	"github.com/KZY20112001/infinivest-backend/internal/commons"
+	"github.com/KZY20112001/infinivest-backend/internal/models"
+	"gorm.io/gorm"
+)
+
+type GoalRepo interface {
+	CreateGoal(goal *models.Goal) error
+	GetGoals(userID uint) ([]*models.Goal, error)
+	GetGoal(userID, goalID uint) (*models.Goal, error)
+	UpdateGoal(goal *models.Goal) error
+	DeleteGoal(goal *models.Goal) error
+}
+
+type postgresGoalRepo struct {
+	db *gorm.DB
+}
+
+func NewPostgresGoalRepo(db *gorm.DB) *postgresGoalRepo {
+	return &postgresGoalRepo{db: db}
+}
+
+func (r *postgresGoalRepo) CreateGoal(goal *models.Goal) error {
+	if goal == nil {
+		return commons.ErrNil
+	}
+	if err := r.db.Create(&goal).Error; err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return gorm.ErrDuplicatedKey
+		}
+		return err
+	}
+	return nil
+}
+
+func (r *postgresGoalRepo) GetGoals(userID uint) ([]*models.Goal, error) {
+	var goals []*models.Goal
+	if err := r.db.Where("user_id = ?", userID).Order("target_date ASC").Find(&goals).Error; err != nil {
+		return nil, err
+	}
+	return goals, nil
+}
+
+func (r *postgresGoalRepo) GetGoal(userID, goalID uint) (*models.Goal, error) {
+	var goal models.Goal
+	if err := r.db.Where("id = ? AND user_id = ?", goalID, userID).First(&goal).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, gorm.ErrRecordNotFound
+		}
+		return nil, err
+	}
+	return &goal, nil
+}
+
+func (r *postgresGoalRepo) UpdateGoal(goal *models.Goal) error {
+	if goal == nil {
+		return commons.ErrNil
+	}
+	return r.db.Save(&goal).Error
+}
+
+func (r *postgresGoalRepo) DeleteGoal(goal *models.Goal) error {
+	if goal == nil {
+		return commons.ErrNil
+	}
+	return r.db.Delete(&goal).Error
+}
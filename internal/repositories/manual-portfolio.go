@@ -3,10 +3,12 @@ package repositories
 import (
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/KZY20112001/infinivest-backend/internal/commons"
 	"github.com/KZY20112001/infinivest-backend/internal/models"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type ManualPortfolioRepo interface {
@@ -15,10 +17,31 @@ type ManualPortfolioRepo interface {
 	CreateManualPortfolio(portfolio *models.ManualPortfolio) error
 	UpdateManualPortfolioName(portfolio *models.ManualPortfolio, newName string) error
 	UpdateManualPortfolio(portfolio *models.ManualPortfolio) error
+	UpdateManualPortfolioTargets(portfolio *models.ManualPortfolio, targets []*models.ManualPortfolioTarget, threshold float64) error
 	DeleteManualPortfolio(portfolio *models.ManualPortfolio) error
 
 	CreateManualPortfolioTransaction(transaction *models.ManualPortfolioTransaction) error
 	GetManualPortfolioTransactions(userID, portfolioID uint, limit int) ([]*models.ManualPortfolioTransaction, error)
+	StreamManualPortfolioTransactions(userID, portfolioID uint, from, to *time.Time, fn func(*models.ManualPortfolioTransaction) error) error
+
+	GetManualPortfolioByID(userID, portfolioID uint) (*models.ManualPortfolio, error)
+	// LockManualPortfolio reads the portfolio and locks it until the surrounding transaction ends
+	LockManualPortfolio(userID, portfolioID uint) (*models.ManualPortfolio, error)
+	CreateOrder(order *models.Order) error
+	UpdateOrder(order *models.Order) error
+	GetOpenOrders() ([]*models.Order, error)
+	GetOrders(userID, portfolioID uint, status string) ([]*models.Order, error)
+	GetOrder(userID, orderID uint) (*models.Order, error)
+	// LockOrder reads the order and locks it until the surrounding transaction ends
+	LockOrder(orderID uint) (*models.Order, error)
+	CreateOrderFill(fill *models.OrderFill) error
+
+	GetManualPortfolioImportKeys(portfolioID uint) ([]string, error)
+	ImportManualPortfolioTransactions(portfolio *models.ManualPortfolio, transactions []*models.ManualPortfolioTransaction) error
+
+	// InTransaction runs fn with a repository whose reads and writes share one database transaction. The
+	// transaction commits when fn returns nil and rolls back otherwise.
+	InTransaction(fn func(repo ManualPortfolioRepo) error) error
 }
 
 type postgresManualPortfolioRepo struct {
@@ -58,7 +81,7 @@ func (r *postgresManualPortfolioRepo) GetManualPortfolios(userID uint) ([]*model
 
 func (r *postgresManualPortfolioRepo) GetManualPortfolio(userID uint, portfolioName string) (*models.ManualPortfolio, error) {
 	var portfolio models.ManualPortfolio
-	if err := r.db.Where("user_id = ? AND name = ?", userID, portfolioName).Preload("Assets").First(&portfolio).Error; err != nil {
+	if err := r.db.Where("user_id = ? AND name = ?", userID, portfolioName).Preload("Assets").Preload("Targets").First(&portfolio).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, gorm.ErrRecordNotFound
 		}
@@ -80,6 +103,31 @@ func (r *postgresManualPortfolioRepo) UpdateManualPortfolioName(portfolio *model
 }
 
 func (r *postgresManualPortfolioRepo) UpdateManualPortfolio(portfolio *models.ManualPortfolio) error {
+	if portfolio == nil {
+		return commons.ErrNil
+	}
+	// a savepoint when called from InTransaction
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		return saveManualPortfolio(tx, portfolio)
+	})
+}
+
+// saveManualPortfolio saves the portfolio and its assets inside the given transaction
+func saveManualPortfolio(tx *gorm.DB, portfolio *models.ManualPortfolio) error {
+	if err := tx.Save(&portfolio).Error; err != nil {
+		return fmt.Errorf("failed to update portfolio: %w", err)
+	}
+
+	for _, asset := range portfolio.Assets {
+		if err := tx.Save(&asset).Error; err != nil {
+			return fmt.Errorf("failed to update asset %s: %w", asset.Symbol, err)
+		}
+	}
+	return nil
+}
+
+// UpdateManualPortfolioTargets replaces the portfolio's targets and rebalance threshold
+func (r *postgresManualPortfolioRepo) UpdateManualPortfolioTargets(portfolio *models.ManualPortfolio, targets []*models.ManualPortfolioTarget, threshold float64) error {
 	if portfolio == nil {
 		return commons.ErrNil
 	}
@@ -91,21 +139,27 @@ func (r *postgresManualPortfolioRepo) UpdateManualPortfolio(portfolio *models.Ma
 		}
 	}()
 
-	if err := tx.Save(&portfolio).Error; err != nil {
+	if err := tx.Unscoped().Where("manual_portfolio_id = ?", portfolio.ID).Delete(&models.ManualPortfolioTarget{}).Error; err != nil {
 		tx.Rollback()
-		return fmt.Errorf("failed to update portfolio: %w", err)
+		return fmt.Errorf("failed to delete targets: %w", err)
 	}
-
-	for _, asset := range portfolio.Assets {
-		if err := tx.Save(&asset).Error; err != nil {
+	for _, target := range targets {
+		target.ManualPortfolioID = portfolio.ID
+		if err := tx.Create(&target).Error; err != nil {
 			tx.Rollback()
-			return fmt.Errorf("failed to update asset %s: %w", asset.Symbol, err)
+			return fmt.Errorf("failed to create target %s: %w", target.Symbol, err)
 		}
 	}
+	if err := tx.Model(&portfolio).Update("rebalance_threshold", threshold).Error; err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to update rebalance threshold: %w", err)
+	}
+
 	if err := tx.Commit().Error; err != nil {
 		tx.Rollback()
 		return fmt.Errorf("failed to commit transaction: %w", err)
 	}
+	portfolio.Targets = targets
 	return nil
 }
 
@@ -125,6 +179,10 @@ func (r *postgresManualPortfolioRepo) DeleteManualPortfolio(portfolio *models.Ma
 			return fmt.Errorf("failed to delete asset %s: %w", asset.Symbol, err)
 		}
 	}
+	if err := tx.Unscoped().Where("manual_portfolio_id = ?", portfolio.ID).Delete(&models.ManualPortfolioTarget{}).Error; err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to delete targets: %w", err)
+	}
 
 	if err := tx.Unscoped().Delete(&portfolio).Error; err != nil {
 		tx.Rollback()
@@ -165,3 +223,159 @@ func (r *postgresManualPortfolioRepo) GetManualPortfolioTransactions(userID, por
 	err := query.Order("manual_portfolio_transactions.created_at DESC").Find(&transactions).Error
 	return transactions, err
 }
+
+// StreamManualPortfolioTransactions calls fn for each transaction in [from, to) oldest first without loading them all
+func (r *postgresManualPortfolioRepo) StreamManualPortfolioTransactions(userID, portfolioID uint, from, to *time.Time, fn func(*models.ManualPortfolioTransaction) error) error {
+	query := r.db.Model(&models.ManualPortfolioTransaction{}).Where("manual_portfolio_user_id = ? AND manual_portfolio_id = ?", userID, portfolioID)
+	if from != nil {
+		query = query.Where("created_at >= ?", *from)
+	}
+	if to != nil {
+		query = query.Where("created_at < ?", *to)
+	}
+	rows, err := query.Order("created_at ASC, id ASC").Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var transaction models.ManualPortfolioTransaction
+		if err := r.db.ScanRows(rows, &transaction); err != nil {
+			return err
+		}
+		if err := fn(&transaction); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (r *postgresManualPortfolioRepo) GetManualPortfolioByID(userID, portfolioID uint) (*models.ManualPortfolio, error) {
+	var portfolio models.ManualPortfolio
+	if err := r.db.Where("user_id = ? AND id = ?", userID, portfolioID).Preload("Assets").First(&portfolio).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, gorm.ErrRecordNotFound
+		}
+		return nil, err
+	}
+	return &portfolio, nil
+}
+
+func (r *postgresManualPortfolioRepo) LockManualPortfolio(userID, portfolioID uint) (*models.ManualPortfolio, error) {
+	return lockManualPortfolio(r.db, userID, portfolioID)
+}
+
+// lockManualPortfolio locks with FOR NO KEY UPDATE, so orders and transactions referencing the portfolio can still
+// be created while it is held
+func lockManualPortfolio(tx *gorm.DB, userID, portfolioID uint) (*models.ManualPortfolio, error) {
+	var portfolio models.ManualPortfolio
+	if err := tx.Clauses(clause.Locking{Strength: "NO KEY UPDATE"}).
+		Where("user_id = ? AND id = ?", userID, portfolioID).
+		Preload("Assets").
+		Preload("Targets").
+		First(&portfolio).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, gorm.ErrRecordNotFound
+		}
+		return nil, err
+	}
+	return &portfolio, nil
+}
+
+func (r *postgresManualPortfolioRepo) CreateOrder(order *models.Order) error {
+	if order == nil {
+		return commons.ErrNil
+	}
+	return r.db.Create(&order).Error
+}
+
+func (r *postgresManualPortfolioRepo) UpdateOrder(order *models.Order) error {
+	if order == nil {
+		return commons.ErrNil
+	}
+	// fills are created on their own
+	return r.db.Omit("Fills").Save(&order).Error
+}
+
+func (r *postgresManualPortfolioRepo) GetOpenOrders() ([]*models.Order, error) {
+	var orders []*models.Order
+	if err := r.db.Where("status IN ?", commons.OpenOrderStatuses).Order("created_at ASC").Find(&orders).Error; err != nil {
+		return nil, err
+	}
+	return orders, nil
+}
+
+func (r *postgresManualPortfolioRepo) GetOrders(userID, portfolioID uint, status string) ([]*models.Order, error) {
+	var orders []*models.Order
+	query := r.db.Where("user_id = ? AND manual_portfolio_id = ?", userID, portfolioID)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if err := query.Preload("Fills").Order("created_at DESC").Find(&orders).Error; err != nil {
+		return nil, err
+	}
+	return orders, nil
+}
+
+func (r *postgresManualPortfolioRepo) GetOrder(userID, orderID uint) (*models.Order, error) {
+	var order models.Order
+	if err := r.db.Where("id = ? AND user_id = ?", orderID, userID).Preload("Fills").First(&order).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, gorm.ErrRecordNotFound
+		}
+		return nil, err
+	}
+	return &order, nil
+}
+
+func (r *postgresManualPortfolioRepo) LockOrder(orderID uint) (*models.Order, error) {
+	var order models.Order
+	if err := r.db.Clauses(clause.Locking{Strength: "NO KEY UPDATE"}).Where("id = ?", orderID).First(&order).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, gorm.ErrRecordNotFound
+		}
+		return nil, err
+	}
+	return &order, nil
+}
+
+func (r *postgresManualPortfolioRepo) CreateOrderFill(fill *models.OrderFill) error {
+	if fill == nil {
+		return commons.ErrNil
+	}
+	return r.db.Create(&fill).Error
+}
+
+func (r *postgresManualPortfolioRepo) GetManualPortfolioImportKeys(portfolioID uint) ([]string, error) {
+	var keys []string
+	err := r.db.Model(&models.ManualPortfolioTransaction{}).
+		Where("manual_portfolio_id = ? AND import_key IS NOT NULL", portfolioID).
+		Pluck("import_key", &keys).Error
+	return keys, err
+}
+
+// ImportManualPortfolioTransactions saves the imported transactions with the rebuilt holdings in one database
+// transaction, a savepoint when called from InTransaction
+func (r *postgresManualPortfolioRepo) ImportManualPortfolioTransactions(portfolio *models.ManualPortfolio, transactions []*models.ManualPortfolioTransaction) error {
+	if portfolio == nil {
+		return commons.ErrNil
+	}
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		for _, transaction := range transactions {
+			if err := tx.Create(&transaction).Error; err != nil {
+				if errors.Is(err, gorm.ErrDuplicatedKey) {
+					return gorm.ErrDuplicatedKey
+				}
+				return fmt.Errorf("failed to create transaction: %w", err)
+			}
+		}
+		return saveManualPortfolio(tx, portfolio)
+	})
+}
+
+func (r *postgresManualPortfolioRepo) InTransaction(fn func(repo ManualPortfolioRepo) error) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		return fn(&postgresManualPortfolioRepo{db: tx})
+	})
+}
@@ -8,21 +8,42 @@ import (
 	"github.com/KZY20112001/infinivest-backend/internal/commons"
 	"github.com/KZY20112001/infinivest-backend/internal/models"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type RoboPortfolioRepo interface {
-	CreateRoboPortfolio(portfolio *models.RoboPortfolio) error
-	GetRoboPortfolioDetails(userID uint) (*models.RoboPortfolio, error)
-	UpdateRebalanceFreq(userID uint, freq string) error
-	UpdateRoboPortfolio(portfolio *models.RoboPortfolio) error
+	CreateRoboPortfolio(portfolio *models.RoboPortfolio, versions ...*models.AllocationVersion) error
+	GetRoboPortfolios(userID uint) ([]*models.RoboPortfolio, error)
+	GetAllRoboPortfolios() ([]*models.RoboPortfolio, error)
+	GetRoboPortfolioDetails(userID, portfolioID uint) (*models.RoboPortfolio, error)
+	UpdateRebalanceFreq(portfolio *models.RoboPortfolio, freq string) error
+	UpdateTaxLossHarvesting(portfolio *models.RoboPortfolio, enabled bool, threshold float64) error
+	UpdateDepositStrategy(portfolio *models.RoboPortfolio, strategy string) error
+	UpdatePauseState(portfolio *models.RoboPortfolio, paused bool, pausedUntil *time.Time) error
+	UpdateGlidePath(portfolio *models.RoboPortfolio) error
+	GetPortfoliosDueForResume(now time.Time) ([]*models.RoboPortfolio, error)
+	// UpdateRoboPortfolio saves the portfolio together with the allocation versions its new targets create
+	UpdateRoboPortfolio(portfolio *models.RoboPortfolio, versions ...*models.AllocationVersion) error
 	DeleteRoboPortfolio(portfolio *models.RoboPortfolio) error
+	CloseRoboPortfolio(portfolio *models.RoboPortfolio, transactions []*models.RoboPortfolioTransaction, transfer *models.Transfer, changes TransferChanges) error
+	GetArchivedRoboPortfolios(userID uint) ([]*models.RoboPortfolio, error)
+	GetArchivedRoboPortfolio(userID, portfolioID uint) (*models.RoboPortfolio, error)
+
+	CreateAllocationVersion(version *models.AllocationVersion) error
+	GetAllocationVersions(portfolioID uint) ([]*models.AllocationVersion, error)
 
 	CreateRoboPortfolioTransaction(transaction *models.RoboPortfolioTransaction) error
-	GetRoboPortfolioTransactions(userID uint, limit int) ([]*models.RoboPortfolioTransaction, error)
+	GetRoboPortfolioTransactions(portfolioID uint, limit int) ([]*models.RoboPortfolioTransaction, error)
+	GetRoboPortfolioTransactionsSince(portfolioID uint, symbol string, transactionTypes []string, since time.Time) ([]*models.RoboPortfolioTransaction, error)
+	StreamRoboPortfolioTransactions(portfolioID uint, from, to *time.Time, fn func(*models.RoboPortfolioTransaction) error) error
 
 	CreateRebalanceEvent(rebalanceEvent *models.RebalanceEvent) error
+	// SaveRebalance saves the rebalanced portfolio, the allocation versions it created, its event and its trades
+	// linked to the event in one transaction
+	SaveRebalance(portfolio *models.RoboPortfolio, rebalanceEvent *models.RebalanceEvent, transactions []*models.RoboPortfolioTransaction, versions ...*models.AllocationVersion) error
 
 	GetRebalanceEvents(portfolioID uint, lastSeen time.Time) ([]*models.RebalanceEvent, error)
+	GetRebalanceEvent(portfolioID, eventID uint) (*models.RebalanceEvent, error)
 	LockRoboPortfolio(portfolio *models.RoboPortfolio) error
 	UnlockRoboPortfolio(portfolio *models.RoboPortfolio) error
 }
@@ -35,26 +56,66 @@ func NewPostgresRoboPortfolioRepo(db *gorm.DB) *postgresRoboPortfolioRepo {
 	return &postgresRoboPortfolioRepo{db: db}
 }
 
-func (r *postgresRoboPortfolioRepo) CreateRoboPortfolio(portfolio *models.RoboPortfolio) error {
+func (r *postgresRoboPortfolioRepo) CreateRoboPortfolio(portfolio *models.RoboPortfolio, versions ...*models.AllocationVersion) error {
 	if portfolio == nil {
 		return commons.ErrNil
 	}
-	if err := r.db.Create(&portfolio).Error; err != nil {
+	tx := r.db.Begin()
+
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err := tx.Create(&portfolio).Error; err != nil {
+		tx.Rollback()
 		if errors.Is(err, gorm.ErrDuplicatedKey) {
 			return gorm.ErrDuplicatedKey
 		}
 		return err
 	}
+	if err := createAllocationVersions(tx, portfolio.ID, versions); err != nil {
+		tx.Rollback()
+		return err
+	}
 
+	if err := tx.Commit().Error; err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
 	return nil
 }
 
-func (r *postgresRoboPortfolioRepo) GetRoboPortfolioDetails(userID uint) (*models.RoboPortfolio, error) {
-	var portfolio models.RoboPortfolio
+func (r *postgresRoboPortfolioRepo) GetRoboPortfolios(userID uint) ([]*models.RoboPortfolio, error) {
+	var portfolios []*models.RoboPortfolio
 	if err := r.db.
 		Where("user_id = ?", userID).
 		Preload("Categories").
 		Preload("Categories.Assets").
+		Order("created_at ASC").
+		Find(&portfolios).Error; err != nil {
+		return nil, err
+	}
+
+	return portfolios, nil
+}
+
+func (r *postgresRoboPortfolioRepo) GetAllRoboPortfolios() ([]*models.RoboPortfolio, error) {
+	var portfolios []*models.RoboPortfolio
+	if err := r.db.Order("id ASC").Find(&portfolios).Error; err != nil {
+		return nil, err
+	}
+	return portfolios, nil
+}
+
+func (r *postgresRoboPortfolioRepo) GetRoboPortfolioDetails(userID, portfolioID uint) (*models.RoboPortfolio, error) {
+	var portfolio models.RoboPortfolio
+	if err := r.db.
+		Where("id = ? AND user_id = ?", portfolioID, userID).
+		Preload("Categories").
+		Preload("Categories.Assets").
+		Preload("Categories.Assets.Lots", "shares_remaining > ?", 0).
 		First(&portfolio).Error; err != nil {
 
 		if errors.Is(err, gorm.ErrRecordNotFound) {
@@ -70,7 +131,25 @@ func (r *postgresRoboPortfolioRepo) GetRoboPortfolioDetails(userID uint) (*model
 	return &portfolio, nil
 }
 
-func (r *postgresRoboPortfolioRepo) UpdateRoboPortfolio(portfolio *models.RoboPortfolio) error {
+// lockRoboPortfolio reads the portfolio with its row locked FOR NO KEY UPDATE until the transaction ends, so
+// transactions referencing it can still be created while it is held
+func lockRoboPortfolio(tx *gorm.DB, userID, portfolioID uint) (*models.RoboPortfolio, error) {
+	var portfolio models.RoboPortfolio
+	if err := tx.Clauses(clause.Locking{Strength: "NO KEY UPDATE"}).
+		Where("id = ? AND user_id = ?", portfolioID, userID).
+		Preload("Categories").
+		Preload("Categories.Assets").
+		Preload("Categories.Assets.Lots", "shares_remaining > ?", 0).
+		First(&portfolio).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, gorm.ErrRecordNotFound
+		}
+		return nil, err
+	}
+	return &portfolio, nil
+}
+
+func (r *postgresRoboPortfolioRepo) UpdateRoboPortfolio(portfolio *models.RoboPortfolio, versions ...*models.AllocationVersion) error {
 	if portfolio == nil {
 		return commons.ErrNil
 	}
@@ -83,37 +162,78 @@ func (r *postgresRoboPortfolioRepo) UpdateRoboPortfolio(portfolio *models.RoboPo
 		}
 	}()
 
-	if err := tx.Save(&portfolio).Error; err != nil {
+	if err := saveRoboPortfolio(tx, portfolio); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := createAllocationVersions(tx, portfolio.ID, versions); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit().Error; err != nil {
 		tx.Rollback()
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// createAllocationVersions numbers the versions after the portfolio's latest one and creates them in order.
+// The unique index on the number makes a concurrent writer fail instead of creating the same version twice.
+func createAllocationVersions(tx *gorm.DB, portfolioID uint, versions []*models.AllocationVersion) error {
+	if len(versions) == 0 {
+		return nil
+	}
+	var latest int
+	if err := tx.Model(&models.AllocationVersion{}).
+		Where("robo_portfolio_id = ?", portfolioID).
+		Select("COALESCE(MAX(version), 0)").
+		Scan(&latest).Error; err != nil {
+		return fmt.Errorf("failed to get latest allocation version: %w", err)
+	}
+	for i, version := range versions {
+		version.RoboPortfolioID = portfolioID
+		version.Version = latest + i + 1
+		if err := tx.Create(&version).Error; err != nil {
+			return fmt.Errorf("failed to create allocation version: %w", err)
+		}
+	}
+	return nil
+}
+
+// saveRoboPortfolio saves the portfolio with its categories, assets and lots inside the given transaction
+func saveRoboPortfolio(tx *gorm.DB, portfolio *models.RoboPortfolio) error {
+	if err := tx.Save(&portfolio).Error; err != nil {
 		return fmt.Errorf("failed to update portfolio: %w", err)
 	}
 
 	for _, category := range portfolio.Categories {
+		category.RoboPortfolioID = portfolio.ID
 		if err := tx.Save(&category).Error; err != nil {
-			tx.Rollback()
 			return fmt.Errorf("failed to update category %s: %w", category.Name, err)
 		}
 
 		for _, asset := range category.Assets {
+			asset.RoboPortfolioCategoryID = category.ID
 			if err := tx.Save(&asset).Error; err != nil {
-				tx.Rollback()
 				return fmt.Errorf("failed to update asset %s: %w", asset.Symbol, err)
 			}
-		}
-	}
 
-	if err := tx.Commit().Error; err != nil {
-		tx.Rollback()
-		return fmt.Errorf("failed to commit transaction: %w", err)
+			for _, lot := range asset.Lots {
+				lot.RoboPortfolioAssetID = asset.ID
+				if err := tx.Save(&lot).Error; err != nil {
+					return fmt.Errorf("failed to update lot for asset %s: %w", asset.Symbol, err)
+				}
+			}
+		}
 	}
-
 	return nil
 }
 
-func (r *postgresRoboPortfolioRepo) UpdateRebalanceFreq(userID uint, freq string) error {
-	portfolio, err := r.GetRoboPortfolioDetails(userID)
-	if err != nil {
-		return err
+func (r *postgresRoboPortfolioRepo) UpdateRebalanceFreq(portfolio *models.RoboPortfolio, freq string) error {
+	if portfolio == nil {
+		return commons.ErrNil
 	}
 	if err := r.db.Model(&portfolio).Update("rebalance_freq", freq).Error; err != nil {
 		if errors.Is(err, gorm.ErrDuplicatedKey) {
@@ -124,6 +244,71 @@ func (r *postgresRoboPortfolioRepo) UpdateRebalanceFreq(userID uint, freq string
 	return nil
 }
 
+func (r *postgresRoboPortfolioRepo) UpdateTaxLossHarvesting(portfolio *models.RoboPortfolio, enabled bool, threshold float64) error {
+	if portfolio == nil {
+		return commons.ErrNil
+	}
+	if err := r.db.Model(&portfolio).Updates(map[string]interface{}{
+		"tax_loss_harvesting": enabled,
+		"harvest_threshold":   threshold,
+	}).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+func (r *postgresRoboPortfolioRepo) UpdateDepositStrategy(portfolio *models.RoboPortfolio, strategy string) error {
+	if portfolio == nil {
+		return commons.ErrNil
+	}
+	if err := r.db.Model(&portfolio).Update("deposit_strategy", strategy).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+func (r *postgresRoboPortfolioRepo) UpdateGlidePath(portfolio *models.RoboPortfolio) error {
+	if portfolio == nil {
+		return commons.ErrNil
+	}
+	if err := r.db.Model(&portfolio).Updates(map[string]interface{}{
+		"glide_path_enabled":      portfolio.GlidePathEnabled,
+		"glide_path_curve":        portfolio.GlidePathCurve,
+		"glide_path_start_date":   portfolio.GlidePathStartDate,
+		"glide_path_target_date":  portfolio.GlidePathTargetDate,
+		"glide_path_start_equity": portfolio.GlidePathStartEquity,
+		"glide_path_start_cash":   portfolio.GlidePathStartCash,
+		"glide_path_end_equity":   portfolio.GlidePathEndEquity,
+		"glide_path_end_cash":     portfolio.GlidePathEndCash,
+	}).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+func (r *postgresRoboPortfolioRepo) UpdatePauseState(portfolio *models.RoboPortfolio, paused bool, pausedUntil *time.Time) error {
+	if portfolio == nil {
+		return commons.ErrNil
+	}
+	if err := r.db.Model(&portfolio).Updates(map[string]interface{}{
+		"is_paused":    paused,
+		"paused_until": pausedUntil,
+	}).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+func (r *postgresRoboPortfolioRepo) GetPortfoliosDueForResume(now time.Time) ([]*models.RoboPortfolio, error) {
+	var portfolios []*models.RoboPortfolio
+	if err := r.db.
+		Where("is_paused = ? AND paused_until IS NOT NULL AND paused_until <= ?", true, now).
+		Find(&portfolios).Error; err != nil {
+		return nil, err
+	}
+	return portfolios, nil
+}
+
 func (r *postgresRoboPortfolioRepo) DeleteRoboPortfolio(portfolio *models.RoboPortfolio) error {
 	tx := r.db.Begin()
 
@@ -135,6 +320,10 @@ func (r *postgresRoboPortfolioRepo) DeleteRoboPortfolio(portfolio *models.RoboPo
 
 	for _, category := range portfolio.Categories {
 		for _, asset := range category.Assets {
+			if err := tx.Unscoped().Where("robo_portfolio_asset_id = ?", asset.ID).Delete(&models.RoboPortfolioLot{}).Error; err != nil {
+				tx.Rollback()
+				return fmt.Errorf("failed to delete lots for asset %s: %w", asset.Symbol, err)
+			}
 			if err := tx.Unscoped().Delete(&asset).Error; err != nil {
 				tx.Rollback()
 				return fmt.Errorf("failed to delete asset %s: %w", asset.Symbol, err)
@@ -149,6 +338,10 @@ func (r *postgresRoboPortfolioRepo) DeleteRoboPortfolio(portfolio *models.RoboPo
 		}
 	}
 
+	if err := deletePortfolioGoals(tx, portfolio.ID); err != nil {
+		tx.Rollback()
+		return err
+	}
 	if err := tx.Unscoped().Delete(&portfolio).Error; err != nil {
 		tx.Rollback()
 		return fmt.Errorf("failed to delete portfolio: %w", err)
@@ -162,6 +355,107 @@ func (r *postgresRoboPortfolioRepo) DeleteRoboPortfolio(portfolio *models.RoboPo
 	return nil
 }
 
+// CloseRoboPortfolio saves the liquidated portfolio with its transactions and archives it in one database
+// transaction. Archiving soft deletes the portfolio, keeping its categories, assets and history. When the proceeds
+// move to another portfolio, the transfer and its changes are saved in the same transaction.
+func (r *postgresRoboPortfolioRepo) CloseRoboPortfolio(portfolio *models.RoboPortfolio, transactions []*models.RoboPortfolioTransaction, transfer *models.Transfer, changes TransferChanges) error {
+	if portfolio == nil {
+		return commons.ErrNil
+	}
+	tx := r.db.Begin()
+
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err := saveRoboPortfolio(tx, portfolio); err != nil {
+		tx.Rollback()
+		return err
+	}
+	for _, transaction := range transactions {
+		if err := tx.Create(&transaction).Error; err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to create transaction: %w", err)
+		}
+	}
+	if transfer != nil {
+		if err := saveTransfer(tx, transfer, changes); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if err := deletePortfolioGoals(tx, portfolio.ID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Delete(&portfolio).Error; err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to archive portfolio: %w", err)
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// deletePortfolioGoals removes the goals tracked against a portfolio that is being deleted or closed,
+// they cannot be projected without it
+func deletePortfolioGoals(tx *gorm.DB, portfolioID uint) error {
+	if err := tx.Where("robo_portfolio_id = ?", portfolioID).Delete(&models.Goal{}).Error; err != nil {
+		return fmt.Errorf("failed to delete goals: %w", err)
+	}
+	return nil
+}
+
+func (r *postgresRoboPortfolioRepo) GetArchivedRoboPortfolios(userID uint) ([]*models.RoboPortfolio, error) {
+	var portfolios []*models.RoboPortfolio
+	if err := r.db.Unscoped().
+		Where("user_id = ? AND deleted_at IS NOT NULL", userID).
+		Preload("Categories").
+		Preload("Categories.Assets").
+		Order("deleted_at DESC").
+		Find(&portfolios).Error; err != nil {
+		return nil, err
+	}
+	return portfolios, nil
+}
+
+func (r *postgresRoboPortfolioRepo) GetArchivedRoboPortfolio(userID, portfolioID uint) (*models.RoboPortfolio, error) {
+	var portfolio models.RoboPortfolio
+	if err := r.db.Unscoped().
+		Where("id = ? AND user_id = ? AND deleted_at IS NOT NULL", portfolioID, userID).
+		First(&portfolio).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, gorm.ErrRecordNotFound
+		}
+		return nil, err
+	}
+	return &portfolio, nil
+}
+
+func (r *postgresRoboPortfolioRepo) CreateAllocationVersion(version *models.AllocationVersion) error {
+	if version == nil {
+		return commons.ErrNil
+	}
+	return r.db.Create(&version).Error
+}
+
+func (r *postgresRoboPortfolioRepo) GetAllocationVersions(portfolioID uint) ([]*models.AllocationVersion, error) {
+	var versions []*models.AllocationVersion
+	if err := r.db.
+		Where("robo_portfolio_id = ?", portfolioID).
+		Preload("Targets").
+		Order("version ASC").
+		Find(&versions).Error; err != nil {
+		return nil, err
+	}
+	return versions, nil
+}
+
 func (r *postgresRoboPortfolioRepo) CreateRoboPortfolioTransaction(transaction *models.RoboPortfolioTransaction) error {
 	if transaction == nil {
 		return commons.ErrNil
@@ -176,10 +470,9 @@ func (r *postgresRoboPortfolioRepo) CreateRoboPortfolioTransaction(transaction *
 	return nil
 }
 
-func (r *postgresRoboPortfolioRepo) GetRoboPortfolioTransactions(userID uint, limit int) ([]*models.RoboPortfolioTransaction, error) {
+func (r *postgresRoboPortfolioRepo) GetRoboPortfolioTransactions(portfolioID uint, limit int) ([]*models.RoboPortfolioTransaction, error) {
 	var transactions []*models.RoboPortfolioTransaction
-	query := r.db.Joins("JOIN robo_portfolios ON robo_portfolio_transactions.robo_portfolio_id = robo_portfolios.id").
-		Where("robo_portfolios.user_id = ?", userID)
+	query := r.db.Where("robo_portfolio_id = ?", portfolioID)
 
 	if limit > 0 {
 		query = query.Limit(limit)
@@ -189,6 +482,43 @@ func (r *postgresRoboPortfolioRepo) GetRoboPortfolioTransactions(userID uint, li
 	return transactions, err
 }
 
+// StreamRoboPortfolioTransactions calls fn for each transaction in [from, to) oldest first without loading them all
+func (r *postgresRoboPortfolioRepo) StreamRoboPortfolioTransactions(portfolioID uint, from, to *time.Time, fn func(*models.RoboPortfolioTransaction) error) error {
+	query := r.db.Model(&models.RoboPortfolioTransaction{}).Where("robo_portfolio_id = ?", portfolioID)
+	if from != nil {
+		query = query.Where("created_at >= ?", *from)
+	}
+	if to != nil {
+		query = query.Where("created_at < ?", *to)
+	}
+	rows, err := query.Order("created_at ASC, id ASC").Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var transaction models.RoboPortfolioTransaction
+		if err := r.db.ScanRows(rows, &transaction); err != nil {
+			return err
+		}
+		if err := fn(&transaction); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (r *postgresRoboPortfolioRepo) GetRoboPortfolioTransactionsSince(portfolioID uint, symbol string, transactionTypes []string, since time.Time) ([]*models.RoboPortfolioTransaction, error) {
+	var transactions []*models.RoboPortfolioTransaction
+	err := r.db.
+		Where("robo_portfolio_id = ? AND symbol = ? AND created_at >= ?", portfolioID, symbol, since).
+		Where("transaction_type IN ?", transactionTypes).
+		Order("created_at DESC").
+		Find(&transactions).Error
+	return transactions, err
+}
+
 func (r *postgresRoboPortfolioRepo) CreateRebalanceEvent(rebalanceEvent *models.RebalanceEvent) error {
 	if rebalanceEvent == nil {
 		return commons.ErrNil
@@ -221,6 +551,60 @@ func (r *postgresRoboPortfolioRepo) GetRebalanceEvents(portfolioID uint, lastSee
 	return rebalanceEvents, nil
 }
 
+func (r *postgresRoboPortfolioRepo) GetRebalanceEvent(portfolioID, eventID uint) (*models.RebalanceEvent, error) {
+	var rebalanceEvent models.RebalanceEvent
+	if err := r.db.
+		Where("id = ? AND robo_portfolio_id = ?", eventID, portfolioID).
+		Preload("Assets").
+		Preload("Transactions").
+		First(&rebalanceEvent).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, gorm.ErrRecordNotFound
+		}
+		return nil, err
+	}
+	return &rebalanceEvent, nil
+}
+
+func (r *postgresRoboPortfolioRepo) SaveRebalance(portfolio *models.RoboPortfolio, rebalanceEvent *models.RebalanceEvent, transactions []*models.RoboPortfolioTransaction, versions ...*models.AllocationVersion) error {
+	if portfolio == nil || rebalanceEvent == nil {
+		return commons.ErrNil
+	}
+	tx := r.db.Begin()
+
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err := saveRoboPortfolio(tx, portfolio); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := createAllocationVersions(tx, portfolio.ID, versions); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Create(&rebalanceEvent).Error; err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to create rebalance event: %w", err)
+	}
+	for _, transaction := range transactions {
+		transaction.RebalanceEventID = &rebalanceEvent.ID
+		if err := tx.Create(&transaction).Error; err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to create transaction: %w", err)
+		}
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
 func (r *postgresRoboPortfolioRepo) LockRoboPortfolio(portfolio *models.RoboPortfolio) error {
 	if portfolio == nil {
 		return commons.ErrNil
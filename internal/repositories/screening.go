@@ -0,0 +1,104 @@
+package repositories
+
+import (
+	"errors"
+
+	"github.com/KZY20112001/infinivest-backend/internal/commons"
+	"github.com/KZY20112001/infinivest-backend/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type ScreeningRepo interface {
+	CreateExclusionRule(rule *models.ExclusionRule) error
+	GetExclusionRules(userID uint) ([]*models.ExclusionRule, error)
+	GetExclusionRule(userID, ruleID uint) (*models.ExclusionRule, error)
+	DeleteExclusionRule(rule *models.ExclusionRule) error
+
+	SeedAssetMetadata(profiles []commons.AssetProfile) error
+	GetAssetMetadata(category string) ([]*models.AssetMetadata, error)
+	GetAssetMetadataBySymbols(symbols []string) ([]*models.AssetMetadata, error)
+}
+
+type postgresScreeningRepo struct {
+	db *gorm.DB
+}
+
+func NewPostgresScreeningRepo(db *gorm.DB) *postgresScreeningRepo {
+	return &postgresScreeningRepo{db: db}
+}
+
+func (r *postgresScreeningRepo) CreateExclusionRule(rule *models.ExclusionRule) error {
+	if rule == nil {
+		return commons.ErrNil
+	}
+	return r.db.Create(&rule).Error
+}
+
+func (r *postgresScreeningRepo) GetExclusionRules(userID uint) ([]*models.ExclusionRule, error) {
+	var rules []*models.ExclusionRule
+	if err := r.db.Where("user_id = ?", userID).Order("created_at ASC").Find(&rules).Error; err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+func (r *postgresScreeningRepo) GetExclusionRule(userID, ruleID uint) (*models.ExclusionRule, error) {
+	var rule models.ExclusionRule
+	if err := r.db.Where("id = ? AND user_id = ?", ruleID, userID).First(&rule).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, gorm.ErrRecordNotFound
+		}
+		return nil, err
+	}
+	return &rule, nil
+}
+
+func (r *postgresScreeningRepo) DeleteExclusionRule(rule *models.ExclusionRule) error {
+	if rule == nil {
+		return commons.ErrNil
+	}
+	return r.db.Delete(&rule).Error
+}
+
+// SeedAssetMetadata inserts the given profiles, leaving metadata that already exists untouched
+func (r *postgresScreeningRepo) SeedAssetMetadata(profiles []commons.AssetProfile) error {
+	if len(profiles) == 0 {
+		return nil
+	}
+	metadata := make([]*models.AssetMetadata, 0, len(profiles))
+	for _, profile := range profiles {
+		metadata = append(metadata, &models.AssetMetadata{
+			Symbol:   profile.Symbol,
+			Name:     profile.Name,
+			Category: profile.Category,
+			Sector:   profile.Sector,
+			ESGScore: profile.ESGScore,
+			Approved: profile.Approved,
+		})
+	}
+	return r.db.Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "symbol"}}, DoNothing: true}).Create(&metadata).Error
+}
+
+func (r *postgresScreeningRepo) GetAssetMetadata(category string) ([]*models.AssetMetadata, error) {
+	var metadata []*models.AssetMetadata
+	query := r.db.Order("category ASC, esg_score DESC")
+	if category != "" {
+		query = query.Where("category = ?", category)
+	}
+	if err := query.Find(&metadata).Error; err != nil {
+		return nil, err
+	}
+	return metadata, nil
+}
+
+func (r *postgresScreeningRepo) GetAssetMetadataBySymbols(symbols []string) ([]*models.AssetMetadata, error) {
+	var metadata []*models.AssetMetadata
+	if len(symbols) == 0 {
+		return metadata, nil
+	}
+	if err := r.db.Where("symbol IN ?", symbols).Find(&metadata).Error; err != nil {
+		return nil, err
+	}
+	return metadata, nil
+}
@@ -0,0 +1,113 @@
+package repositories
+
+import (
+	"fmt"
+
+	"github.com/KZY20112001/infinivest-backend/internal/commons"
+	"github.com/KZY20112001/infinivest-backend/internal/commons/decimal"
+	"github.com/KZY20112001/infinivest-backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// TransferChanges are the portfolios and transactions a transfer touches, saved together with it
+type TransferChanges struct {
+	ManualPortfolios   []*models.ManualPortfolio
+	RoboPortfolios     []*models.RoboPortfolio
+	ManualTransactions []*models.ManualPortfolioTransaction
+	RoboTransactions   []*models.RoboPortfolioTransaction
+	// ManualDeposits is cash added to manual portfolios by ID. Each portfolio is locked and read again inside the
+	// transaction, so the deposit is added to what it holds by then rather than to an earlier read.
+	ManualDeposits map[uint]decimal.Decimal
+}
+
+type TransferRepo interface {
+	CreateTransfer(transfer *models.Transfer, changes TransferChanges) error
+	GetTransfers(userID uint) ([]*models.Transfer, error)
+
+	// LockManualPortfolio and LockRoboPortfolio read a portfolio with its row locked until the transaction ends
+	LockManualPortfolio(userID, portfolioID uint) (*models.ManualPortfolio, error)
+	LockRoboPortfolio(userID, portfolioID uint) (*models.RoboPortfolio, error)
+
+	// InTransaction runs fn with a repository whose reads and writes share one database transaction. The
+	// transaction commits when fn returns nil and rolls back otherwise.
+	InTransaction(fn func(repo TransferRepo) error) error
+}
+
+type postgresTransferRepo struct {
+	db *gorm.DB
+}
+
+func NewPostgresTransferRepo(db *gorm.DB) *postgresTransferRepo {
+	return &postgresTransferRepo{db: db}
+}
+
+// CreateTransfer saves the transfer, both portfolios and the paired transactions in one database transaction
+func (r *postgresTransferRepo) CreateTransfer(transfer *models.Transfer, changes TransferChanges) error {
+	if transfer == nil {
+		return commons.ErrNil
+	}
+	// a savepoint when called from InTransaction
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		return saveTransfer(tx, transfer, changes)
+	})
+}
+
+func saveTransfer(tx *gorm.DB, transfer *models.Transfer, changes TransferChanges) error {
+	if err := tx.Create(&transfer).Error; err != nil {
+		return fmt.Errorf("failed to create transfer: %w", err)
+	}
+	for _, portfolio := range changes.ManualPortfolios {
+		if err := saveManualPortfolio(tx, portfolio); err != nil {
+			return err
+		}
+	}
+	for portfolioID, amount := range changes.ManualDeposits {
+		portfolio, err := lockManualPortfolio(tx, transfer.UserID, portfolioID)
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(&portfolio).Update("total_cash", portfolio.TotalCash.Add(amount)).Error; err != nil {
+			return fmt.Errorf("failed to update portfolio cash: %w", err)
+		}
+	}
+	for _, portfolio := range changes.RoboPortfolios {
+		if err := saveRoboPortfolio(tx, portfolio); err != nil {
+			return err
+		}
+	}
+	for _, transaction := range changes.ManualTransactions {
+		transaction.TransferID = &transfer.ID
+		if err := tx.Create(&transaction).Error; err != nil {
+			return fmt.Errorf("failed to create transaction: %w", err)
+		}
+	}
+	for _, transaction := range changes.RoboTransactions {
+		transaction.TransferID = &transfer.ID
+		if err := tx.Create(&transaction).Error; err != nil {
+			return fmt.Errorf("failed to create transaction: %w", err)
+		}
+	}
+	return nil
+}
+
+func (r *postgresTransferRepo) GetTransfers(userID uint) ([]*models.Transfer, error) {
+	var transfers []*models.Transfer
+	if err := r.db.Where("user_id = ?", userID).Order("created_at DESC").Find(&transfers).Error; err != nil {
+		return nil, err
+	}
+	return transfers, nil
+}
+
+func (r *postgresTransferRepo) LockManualPortfolio(userID, portfolioID uint) (*models.ManualPortfolio, error) {
+	return lockManualPortfolio(r.db, userID, portfolioID)
+}
+
+func (r *postgresTransferRepo) LockRoboPortfolio(userID, portfolioID uint) (*models.RoboPortfolio, error) {
+	return lockRoboPortfolio(r.db, userID, portfolioID)
+}
+
+func (r *postgresTransferRepo) InTransaction(fn func(repo TransferRepo) error) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		return fn(&postgresTransferRepo{db: tx})
+	})
+}
@@ -0,0 +1,167 @@
+package repositories
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/KZY20112001/infinivest-backend/internal/commons"
+	"github.com/KZY20112001/infinivest-backend/internal/models"
+	"gorm.io/gorm"
+)
+
+type WatchlistRepo interface {
+	CreateWatchlist(watchlist *models.Watchlist) error
+	GetWatchlists(userID uint) ([]*models.Watchlist, error)
+	GetWatchlist(userID, watchlistID uint) (*models.Watchlist, error)
+	DeleteWatchlist(watchlist *models.Watchlist) error
+
+	CreateWatchlistItem(item *models.WatchlistItem) error
+	DeleteWatchlistItem(item *models.WatchlistItem) error
+
+	CreatePriceAlert(alert *models.PriceAlert) error
+	GetPriceAlert(userID, alertID uint) (*models.PriceAlert, error)
+	GetActivePriceAlerts() ([]*models.PriceAlert, error)
+	UpdatePriceAlert(alert *models.PriceAlert) error
+	DeletePriceAlert(alert *models.PriceAlert) error
+}
+
+type postgresWatchlistRepo struct {
+	db *gorm.DB
+}
+
+func NewPostgresWatchlistRepo(db *gorm.DB) *postgresWatchlistRepo {
+	return &postgresWatchlistRepo{db: db}
+}
+
+func (r *postgresWatchlistRepo) CreateWatchlist(watchlist *models.Watchlist) error {
+	if watchlist == nil {
+		return commons.ErrNil
+	}
+	if err := r.db.Create(&watchlist).Error; err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return gorm.ErrDuplicatedKey
+		}
+		return err
+	}
+	return nil
+}
+
+func (r *postgresWatchlistRepo) GetWatchlists(userID uint) ([]*models.Watchlist, error) {
+	var watchlists []*models.Watchlist
+	if err := r.db.Preload("Items.Alerts").Where("user_id = ?", userID).Order("name ASC").Find(&watchlists).Error; err != nil {
+		return nil, err
+	}
+	return watchlists, nil
+}
+
+func (r *postgresWatchlistRepo) GetWatchlist(userID, watchlistID uint) (*models.Watchlist, error) {
+	var watchlist models.Watchlist
+	if err := r.db.Preload("Items.Alerts").Where("id = ? AND user_id = ?", watchlistID, userID).First(&watchlist).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, gorm.ErrRecordNotFound
+		}
+		return nil, err
+	}
+	return &watchlist, nil
+}
+
+func (r *postgresWatchlistRepo) DeleteWatchlist(watchlist *models.Watchlist) error {
+	if watchlist == nil {
+		return commons.ErrNil
+	}
+	tx := r.db.Begin()
+
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	for _, item := range watchlist.Items {
+		if err := deleteWatchlistItem(tx, item); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if err := tx.Unscoped().Delete(&watchlist).Error; err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to delete watchlist: %w", err)
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+func (r *postgresWatchlistRepo) CreateWatchlistItem(item *models.WatchlistItem) error {
+	if item == nil {
+		return commons.ErrNil
+	}
+	if err := r.db.Create(&item).Error; err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return gorm.ErrDuplicatedKey
+		}
+		return err
+	}
+	return nil
+}
+
+func (r *postgresWatchlistRepo) DeleteWatchlistItem(item *models.WatchlistItem) error {
+	if item == nil {
+		return commons.ErrNil
+	}
+	return deleteWatchlistItem(r.db, item)
+}
+
+// deleteWatchlistItem permanently removes the item with its alerts so the symbol can be added again
+func deleteWatchlistItem(tx *gorm.DB, item *models.WatchlistItem) error {
+	if err := tx.Unscoped().Where("watchlist_item_id = ?", item.ID).Delete(&models.PriceAlert{}).Error; err != nil {
+		return fmt.Errorf("failed to delete alerts for %s: %w", item.Symbol, err)
+	}
+	if err := tx.Unscoped().Delete(&item).Error; err != nil {
+		return fmt.Errorf("failed to delete %s: %w", item.Symbol, err)
+	}
+	return nil
+}
+
+func (r *postgresWatchlistRepo) CreatePriceAlert(alert *models.PriceAlert) error {
+	if alert == nil {
+		return commons.ErrNil
+	}
+	return r.db.Create(&alert).Error
+}
+
+func (r *postgresWatchlistRepo) GetPriceAlert(userID, alertID uint) (*models.PriceAlert, error) {
+	var alert models.PriceAlert
+	if err := r.db.Where("id = ? AND user_id = ?", alertID, userID).First(&alert).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, gorm.ErrRecordNotFound
+		}
+		return nil, err
+	}
+	return &alert, nil
+}
+
+func (r *postgresWatchlistRepo) GetActivePriceAlerts() ([]*models.PriceAlert, error) {
+	var alerts []*models.PriceAlert
+	if err := r.db.Where("active = ?", true).Order("symbol ASC").Find(&alerts).Error; err != nil {
+		return nil, err
+	}
+	return alerts, nil
+}
+
+func (r *postgresWatchlistRepo) UpdatePriceAlert(alert *models.PriceAlert) error {
+	if alert == nil {
+		return commons.ErrNil
+	}
+	return r.db.Save(&alert).Error
+}
+
+func (r *postgresWatchlistRepo) DeletePriceAlert(alert *models.PriceAlert) error {
+	if alert == nil {
+		return commons.ErrNil
+	}
+	return r.db.Unscoped().Delete(&alert).Error
+}
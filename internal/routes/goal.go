@@ -0,0 +1,21 @@
+package routes
+
+import (
+	"github.com/KZY20112001/infinivest-backend/internal/handlers"
+	"github.com/KZY20112001/infinivest-backend/internal/middlewares"
+	"github.com/gin-gonic/gin"
+)
+
+func RegisterGoalRoutes(r *gin.Engine, h *handlers.GoalHandler) {
+	goalGroup := r.Group("/goals")
+	goalGroup.Use(middlewares.AuthMiddleware())
+	{
+		goalGroup.GET("/", h.GetGoals)
+		goalGroup.GET("/:id", h.GetGoal)
+		goalGroup.GET("/:id/projection", h.GetGoalProjection)
+
+		goalGroup.POST("/", h.CreateGoal)
+		goalGroup.PUT("/:id", h.UpdateGoal)
+		goalGroup.DELETE("/:id", h.DeleteGoal)
+	}
+}
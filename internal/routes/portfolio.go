@@ -6,7 +6,7 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-func RegisterPortfolioRoutes(r *gin.Engine, rh *handlers.RoboPortfolioHandler, mh *handlers.ManualPortfolioHandler, nh *handlers.NotificationHandler) {
+func RegisterPortfolioRoutes(r *gin.Engine, rh *handlers.RoboPortfolioHandler, mh *handlers.ManualPortfolioHandler, nh *handlers.NotificationHandler, th *handlers.TransferHandler, idempotency gin.HandlerFunc) {
 	portfolioGroup := r.Group("/portfolio")
 	portfolioGroup.Use(middlewares.AuthMiddleware())
 	notificationGroup := portfolioGroup.Group("/notifications")
@@ -15,29 +15,56 @@ func RegisterPortfolioRoutes(r *gin.Engine, rh *handlers.RoboPortfolioHandler, m
 		notificationGroup.DELETE("/", nh.ClearNotifications)
 	}
 
+	transferGroup := portfolioGroup.Group("/transfers")
+	{
+		transferGroup.GET("", th.GetTransfers)
+		transferGroup.POST("", idempotency, th.CreateTransfer)
+	}
+
 	roboAdvisorGroup := portfolioGroup.Group("/robo-portfolio")
 	{
-		roboAdvisorGroup.GET("/details", rh.GetRoboPortfolioDetails)
-		roboAdvisorGroup.GET("/summary", rh.GetRoboPortfolioSummary)
+		roboAdvisorGroup.GET("/details", rh.GetRoboPortfolios)
+		roboAdvisorGroup.GET("/summaries", rh.GetRoboPortfoliosSummaries)
+		roboAdvisorGroup.GET("/archived", rh.GetArchivedRoboPortfolios)
+		roboAdvisorGroup.GET("/:id/details", rh.GetRoboPortfolioDetails)
+		roboAdvisorGroup.GET("/:id/summary", rh.GetRoboPortfolioSummary)
+		roboAdvisorGroup.GET("/:id/risk", rh.GetRoboPortfolioRisk)
+		roboAdvisorGroup.GET("/:id/drift", rh.GetRoboPortfolioDrift)
 
 		roboAdvisorGroup.POST("/generate/categories", rh.GenerateRoboAdvisorPortfolio)
 		roboAdvisorGroup.POST("/generate/assets", rh.GenerateAssetAllocation)
-		roboAdvisorGroup.POST("/confirm", rh.ConfirmGeneratedRoboPortfolio)
-		roboAdvisorGroup.POST("/add", rh.AddMoneyToRoboPortfolio)
-		roboAdvisorGroup.POST("/withdraw", rh.WithDrawMoneyFromRoboPortfolio)
-		roboAdvisorGroup.PUT("/rebalance-freq", rh.UpdateRebalanceFreq)
+		roboAdvisorGroup.POST("/confirm", idempotency, rh.ConfirmGeneratedRoboPortfolio)
+		roboAdvisorGroup.POST("/:id/add", idempotency, rh.AddMoneyToRoboPortfolio)
+		roboAdvisorGroup.POST("/:id/add/preview", rh.PreviewDeposit)
+		roboAdvisorGroup.POST("/:id/withdraw", idempotency, rh.WithDrawMoneyFromRoboPortfolio)
+		roboAdvisorGroup.POST("/:id/pause", rh.PauseRebalancing)
+		roboAdvisorGroup.POST("/:id/resume", rh.ResumeRebalancing)
+		roboAdvisorGroup.POST("/:id/close", idempotency, rh.CloseRoboPortfolio)
+		roboAdvisorGroup.PUT("/:id/rebalance-freq", rh.UpdateRebalanceFreq)
+		roboAdvisorGroup.PUT("/:id/tax-loss-harvesting", rh.UpdateTaxLossHarvesting)
+		roboAdvisorGroup.PUT("/:id/deposit-strategy", rh.UpdateDepositStrategy)
 
-		// TODO: Update robo portfolio
-		roboAdvisorGroup.PUT("/update")
+		roboAdvisorGroup.PUT("/:id/update", rh.UpdateRoboPortfolioAllocation)
+		roboAdvisorGroup.GET("/:id/allocations", rh.GetAllocationVersions)
+		roboAdvisorGroup.GET("/:id/glide-path", rh.GetGlidePath)
+		roboAdvisorGroup.PUT("/:id/glide-path", rh.UpdateGlidePath)
 
-		roboAdvisorGroup.DELETE("/", rh.DeleteRoboPortfolio)
+		roboAdvisorGroup.DELETE("/:id", rh.DeleteRoboPortfolio)
 
-		roboAdvisorGroup.GET("/transactions", rh.GetRoboPortfolioTransactions)
-		roboAdvisorGroup.GET("/rebalance/details", rh.GetRebalanceEvents)
-		roboAdvisorGroup.PATCH("/rebalance/seen", rh.UpdateLastSeenRebalanceEvent)
+		roboAdvisorGroup.GET("/:id/transactions", rh.GetRoboPortfolioTransactions)
+		roboAdvisorGroup.GET("/:id/transactions/export", rh.ExportRoboPortfolioTransactions)
+		roboAdvisorGroup.GET("/:id/rebalance/details", rh.GetRebalanceEvents)
+		roboAdvisorGroup.GET("/:id/rebalance/details/:eventID", rh.GetRebalanceEvent)
+		roboAdvisorGroup.PATCH("/:id/rebalance/seen", rh.UpdateLastSeenRebalanceEvent)
 
 		// testing only
-		roboAdvisorGroup.GET("/rebalance", rh.RebalanceRoboPortfolio)
+		roboAdvisorGroup.GET("/:id/rebalance", rh.RebalanceRoboPortfolio)
+	}
+
+	orderGroup := portfolioGroup.Group("/orders")
+	{
+		orderGroup.GET("/:id", mh.GetOrder)
+		orderGroup.DELETE("/:id", mh.CancelOrder)
 	}
 
 	manualGroup := portfolioGroup.Group("/manual-portfolio")
@@ -46,17 +73,25 @@ func RegisterPortfolioRoutes(r *gin.Engine, rh *handlers.RoboPortfolioHandler, m
 		manualGroup.GET("/summaries", mh.GetManualPortfoliosSummaries)
 		manualGroup.GET("/:name", mh.GetManualPortfolio)
 		manualGroup.GET("/:name/value", mh.GetPortfolioValue)
+		manualGroup.GET("/:name/risk", mh.GetManualPortfolioRisk)
+		manualGroup.GET("/:name/drift", mh.GetManualPortfolioDrift)
 
 		manualGroup.POST("/", mh.CreateManualPortfolio)
-		manualGroup.POST("/:name/add", mh.AddMoneyToManualPortfolio)
-		manualGroup.POST("/:name/withdraw", mh.WithDrawMoneyFromManualPortfolio)
+		manualGroup.POST("/:name/add", idempotency, mh.AddMoneyToManualPortfolio)
+		manualGroup.POST("/:name/withdraw", idempotency, mh.WithDrawMoneyFromManualPortfolio)
 
 		manualGroup.PUT("/:name", mh.UpdatePortfolioName)
 		manualGroup.DELETE("/:name", mh.DeleteManualPortfolio)
 
-		manualGroup.PUT("/:name/buy", mh.BuyAssetForManualPortfolio)
-		manualGroup.PUT("/:name/sell", mh.SellAssetForManualPortfolio)
+		manualGroup.PUT("/:name/buy", idempotency, mh.BuyAssetForManualPortfolio)
+		manualGroup.PUT("/:name/sell", idempotency, mh.SellAssetForManualPortfolio)
+		manualGroup.GET("/:name/orders", mh.GetOrders)
+		manualGroup.POST("/:name/orders", idempotency, mh.PlaceOrder)
+		manualGroup.POST("/:name/import", idempotency, mh.ImportTransactions)
+		manualGroup.PUT("/:name/targets", mh.UpdateManualPortfolioTargets)
+		manualGroup.POST("/:name/rebalance", idempotency, mh.RebalanceManualPortfolio)
 
 		manualGroup.GET("/:name/transactions", mh.GetManualPortfolioTransactions)
+		manualGroup.GET("/:name/transactions/export", mh.ExportManualPortfolioTransactions)
 	}
 }
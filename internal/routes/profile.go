@@ -13,5 +13,7 @@ func RegisterProfileRoutes(r *gin.Engine, h *handlers.ProfileHandler) {
 		profileGroup.POST("/", h.CreateProfile)
 		profileGroup.PATCH("/", h.UpdateProfile)
 		profileGroup.GET("/", h.GetProfile)
+		profileGroup.GET("/risk-questionnaire", h.GetRiskQuestionnaire)
+		profileGroup.POST("/risk-questionnaire", h.SubmitRiskQuestionnaire)
 	}
 }
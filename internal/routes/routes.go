@@ -7,19 +7,22 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-func RegisterRoutes(userHandler *handlers.UserHandler, profileHandler *handlers.ProfileHandler, roboPortfolioHandler *handlers.RoboPortfolioHandler, manualPortfolioHandler *handlers.ManualPortfolioHandler, notificationHandler *handlers.NotificationHandler, s3Handler *handlers.S3Handler) *gin.Engine {
+func RegisterRoutes(userHandler *handlers.UserHandler, profileHandler *handlers.ProfileHandler, roboPortfolioHandler *handlers.RoboPortfolioHandler, manualPortfolioHandler *handlers.ManualPortfolioHandler, notificationHandler *handlers.NotificationHandler, s3Handler *handlers.S3Handler, goalHandler *handlers.GoalHandler, screeningHandler *handlers.ScreeningHandler, transferHandler *handlers.TransferHandler, watchlistHandler *handlers.WatchlistHandler, idempotency gin.HandlerFunc) *gin.Engine {
 	r := gin.Default()
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"http://localhost:3000"},
 		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE"},
-		AllowHeaders:     []string{"Origin"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowHeaders:     []string{"Origin", "Idempotency-Key"},
+		ExposeHeaders:    []string{"Content-Length", "Idempotent-Replayed"},
 		AllowCredentials: true,
 	}))
 
 	RegisterUserRoutes(r, userHandler)
 	RegisterProfileRoutes(r, profileHandler)
-	RegisterPortfolioRoutes(r, roboPortfolioHandler, manualPortfolioHandler, notificationHandler)
+	RegisterPortfolioRoutes(r, roboPortfolioHandler, manualPortfolioHandler, notificationHandler, transferHandler, idempotency)
 	RegisterS3Routes(r, s3Handler)
+	RegisterGoalRoutes(r, goalHandler)
+	RegisterScreeningRoutes(r, screeningHandler)
+	RegisterWatchlistRoutes(r, watchlistHandler)
 	return r
 }
@@ -0,0 +1,19 @@
+package routes
+
+import (
+	"github.com/KZY20112001/infinivest-backend/internal/handlers"
+	"github.com/KZY20112001/infinivest-backend/internal/middlewares"
+	"github.com/gin-gonic/gin"
+)
+
+func RegisterScreeningRoutes(r *gin.Engine, h *handlers.ScreeningHandler) {
+	screeningGroup := r.Group("/screening")
+	screeningGroup.Use(middlewares.AuthMiddleware())
+	{
+		screeningGroup.GET("/exclusions", h.GetExclusionRules)
+		screeningGroup.GET("/assets", h.GetAssetMetadata)
+
+		screeningGroup.POST("/exclusions", h.CreateExclusionRule)
+		screeningGroup.DELETE("/exclusions/:id", h.DeleteExclusionRule)
+	}
+}
@@ -0,0 +1,23 @@
+package routes
+
+import (
+	"github.com/KZY20112001/infinivest-backend/internal/handlers"
+	"github.com/KZY20112001/infinivest-backend/internal/middlewares"
+	"github.com/gin-gonic/gin"
+)
+
+func RegisterWatchlistRoutes(r *gin.Engine, h *handlers.WatchlistHandler) {
+	watchlistGroup := r.Group("/watchlists")
+	watchlistGroup.Use(middlewares.AuthMiddleware())
+	{
+		watchlistGroup.GET("/", h.GetWatchlists)
+		watchlistGroup.GET("/:id", h.GetWatchlist)
+
+		watchlistGroup.POST("/", h.CreateWatchlist)
+		watchlistGroup.DELETE("/:id", h.DeleteWatchlist)
+		watchlistGroup.POST("/:id/symbols", h.AddSymbol)
+		watchlistGroup.DELETE("/:id/symbols/:symbol", h.RemoveSymbol)
+		watchlistGroup.POST("/:id/symbols/:symbol/alerts", h.CreatePriceAlert)
+		watchlistGroup.DELETE("/:id/alerts/:alertId", h.DeletePriceAlert)
+	}
+}
@@ -0,0 +1,37 @@
+package scheduler
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/KZY20112001/infinivest-backend/internal/services"
+)
+
+// alertMonitorImpl evaluates watchlist price alerts against the latest prices on an interval
+type alertMonitorImpl struct {
+	ticker  *time.Ticker
+	service services.WatchlistService
+}
+
+func NewAlertMonitorImpl(s services.WatchlistService, interval time.Duration) *alertMonitorImpl {
+	return &alertMonitorImpl{
+		ticker:  time.NewTicker(interval),
+		service: s,
+	}
+}
+
+func (s *alertMonitorImpl) Start(ctx context.Context) {
+	go func() {
+		for {
+			select {
+			case t := <-s.ticker.C:
+				log.Println("Checking price alerts at", t)
+				s.service.ProcessPriceAlerts(ctx)
+			case <-ctx.Done():
+				s.ticker.Stop()
+				return
+			}
+		}
+	}()
+}
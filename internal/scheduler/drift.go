@@ -0,0 +1,112 @@
+package scheduler
+
+import (
+	"context"
+	"log"
+	"math"
+	"time"
+
+	"github.com/KZY20112001/infinivest-backend/internal/dto"
+	"github.com/KZY20112001/infinivest-backend/internal/redis"
+	"github.com/KZY20112001/infinivest-backend/internal/repositories"
+	"github.com/KZY20112001/infinivest-backend/internal/services"
+)
+
+// driftMonitorImpl values every robo portfolio on an interval and rebalances the ones that drifted
+// outside the band, independent of their rebalancing calendar
+type driftMonitorImpl struct {
+	ticker   *time.Ticker
+	service  services.RoboPortfolioService
+	repo     repositories.RoboPortfolioRepo
+	redis    redis.RoboPortfolioRedis
+	band     float64
+	cooldown time.Duration
+}
+
+func NewDriftMonitorImpl(s services.RoboPortfolioService, r repositories.RoboPortfolioRepo, c redis.RoboPortfolioRedis, band float64, cooldown, interval time.Duration) *driftMonitorImpl {
+	return &driftMonitorImpl{
+		ticker:   time.NewTicker(interval),
+		service:  s,
+		repo:     r,
+		redis:    c,
+		band:     band,
+		cooldown: cooldown,
+	}
+}
+
+func (s *driftMonitorImpl) Start(ctx context.Context) {
+	go func() {
+		for {
+			select {
+			case t := <-s.ticker.C:
+				log.Println("Checking portfolio drift at", t)
+				s.checkDrift(ctx)
+			case <-ctx.Done():
+				s.ticker.Stop()
+				return
+			}
+		}
+	}()
+}
+
+func (s *driftMonitorImpl) checkDrift(ctx context.Context) {
+	portfolios, err := s.repo.GetAllRoboPortfolios()
+	if err != nil {
+		log.Println("Failed to get portfolios for drift check:", err)
+		return
+	}
+
+	for _, portfolio := range portfolios {
+		if ctx.Err() != nil {
+			return
+		}
+		if portfolio.IsRebalancing || portfolio.IsPaused {
+			continue
+		}
+		inCooldown, err := s.redis.IsInDriftCooldown(ctx, portfolio.UserID, portfolio.ID)
+		if err != nil {
+			log.Printf("Failed to check drift cooldown for portfolio %d:%d: %v\n", portfolio.UserID, portfolio.ID, err)
+			continue
+		}
+		if inCooldown {
+			continue
+		}
+
+		drift, err := s.service.GetRoboPortfolioDrift(portfolio.UserID, portfolio.ID)
+		if err != nil {
+			log.Printf("Failed to get drift for portfolio %d:%d: %v\n", portfolio.UserID, portfolio.ID, err)
+			continue
+		}
+		// only holdings are traded back by a rebalance, so category drift alone does not trigger one
+		maxDrift := maxAssetDrift(drift)
+		if !drift.TotalValue.IsPositive() || maxDrift <= s.band {
+			continue
+		}
+
+		success, err := s.redis.AcquireLock(ctx, portfolio.UserID, portfolio.ID, 2*time.Minute)
+		if !success || err != nil {
+			log.Printf("Portfolio %d:%d is already locked, skipping\n", portfolio.UserID, portfolio.ID)
+			continue
+		}
+		log.Printf("Portfolio %d:%d drifted %.2f%% from target, rebalancing\n", portfolio.UserID, portfolio.ID, maxDrift)
+		traded, err := s.service.RebalanceDriftedPortfolio(ctx, portfolio.UserID, portfolio.ID, s.band)
+		if err != nil {
+			log.Printf("Failed to rebalance portfolio %d:%d: %v\n", portfolio.UserID, portfolio.ID, err)
+		} else if traded {
+			if err := s.redis.SetDriftCooldown(ctx, portfolio.UserID, portfolio.ID, s.cooldown); err != nil {
+				log.Printf("Failed to set drift cooldown for portfolio %d:%d: %v\n", portfolio.UserID, portfolio.ID, err)
+			}
+		}
+		if err := s.redis.ReleaseLock(ctx, portfolio.UserID, portfolio.ID); err != nil {
+			log.Printf("Failed to release lock for portfolio %d:%d: %v", portfolio.UserID, portfolio.ID, err)
+		}
+	}
+}
+
+func maxAssetDrift(drift dto.PortfolioDriftResponse) float64 {
+	maxDrift := 0.0
+	for _, asset := range drift.Assets {
+		maxDrift = math.Max(maxDrift, math.Abs(asset.Drift))
+	}
+	return maxDrift
+}
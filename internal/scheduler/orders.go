@@ -0,0 +1,37 @@
+package scheduler
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/KZY20112001/infinivest-backend/internal/services"
+)
+
+// orderMonitorImpl checks open manual portfolio orders against the latest prices on an interval
+type orderMonitorImpl struct {
+	ticker  *time.Ticker
+	service services.ManualPortfolioService
+}
+
+func NewOrderMonitorImpl(s services.ManualPortfolioService, interval time.Duration) *orderMonitorImpl {
+	return &orderMonitorImpl{
+		ticker:  time.NewTicker(interval),
+		service: s,
+	}
+}
+
+func (s *orderMonitorImpl) Start(ctx context.Context) {
+	go func() {
+		for {
+			select {
+			case t := <-s.ticker.C:
+				log.Println("Checking open orders at", t)
+				s.service.ProcessOpenOrders(ctx)
+			case <-ctx.Done():
+				s.ticker.Stop()
+				return
+			}
+		}
+	}()
+}
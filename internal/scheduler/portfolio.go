@@ -2,6 +2,7 @@ package scheduler
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"sync"
@@ -11,6 +12,7 @@ import (
 	"github.com/KZY20112001/infinivest-backend/internal/redis"
 	"github.com/KZY20112001/infinivest-backend/internal/repositories"
 	"github.com/KZY20112001/infinivest-backend/internal/services"
+	"gorm.io/gorm"
 )
 
 type PortfolioScheduler interface {
@@ -50,7 +52,25 @@ func (s *portfolioSchedulerImpl) Start(ctx context.Context) {
 	}()
 }
 
+// resumePausedPortfolios resumes the portfolios whose pause has expired, queueing them for rebalancing again
+func (s *portfolioSchedulerImpl) resumePausedPortfolios(ctx context.Context) {
+	portfolios, err := s.repo.GetPortfoliosDueForResume(time.Now())
+	if err != nil {
+		log.Println("Failed to get paused portfolios:", err)
+		return
+	}
+	for _, portfolio := range portfolios {
+		if err := s.service.ResumeRebalancing(ctx, portfolio.UserID, portfolio.ID); err != nil {
+			log.Printf("Failed to resume portfolio %d:%d: %v\n", portfolio.UserID, portfolio.ID, err)
+			continue
+		}
+		log.Printf("Resumed portfolio %d:%d\n", portfolio.UserID, portfolio.ID)
+	}
+}
+
 func (s *portfolioSchedulerImpl) rebalancePortfolios(ctx context.Context) {
+	s.resumePausedPortfolios(ctx)
+
 	isEmpty, err := s.redis.IsEmpty(ctx)
 	if err != nil {
 		log.Println("Failed to check if rebalancing queue is empty:", err)
@@ -97,6 +117,13 @@ func (s *portfolioSchedulerImpl) rebalancePortfolios(ctx context.Context) {
 			}()
 
 			portfolio, err := s.service.RebalancePortfolio(ctx, userID, portfolioID)
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				// deleted or closed since it was queued
+				if err := s.redis.DeletePortfolioFromQueue(ctx, userID, portfolioID); err != nil {
+					errChan <- fmt.Errorf("failed to remove portfolio %d:%d from rebalancing queue: %w", userID, portfolioID, err)
+				}
+				return
+			}
 			if err != nil {
 				errChan <- fmt.Errorf("failed to rebalance portfolio %d:%d: %w", userID, portfolioID, err)
 				return
@@ -107,6 +134,9 @@ func (s *portfolioSchedulerImpl) rebalancePortfolios(ctx context.Context) {
 				errChan <- fmt.Errorf("failed to remove portfolio %d:%d from rebalancing queue: %w", userID, portfolioID, err)
 				return
 			}
+			if portfolio.IsPaused {
+				return
+			}
 			// add the new balance time
 			nextRebalanceTime, err := commons.GetNextRebalanceTime(*portfolio.RebalanceFreq)
 			if err != nil {
@@ -0,0 +1,104 @@
+package services
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/KZY20112001/infinivest-backend/internal/commons"
+	"github.com/KZY20112001/infinivest-backend/internal/commons/decimal"
+	"github.com/KZY20112001/infinivest-backend/internal/dto"
+	"github.com/KZY20112001/infinivest-backend/internal/repositories"
+)
+
+type FXService interface {
+	GetRate(from, to string) (decimal.Decimal, error)
+	Convert(amount decimal.Decimal, from, to string) (decimal.Decimal, error)
+}
+
+// portfolioValuation is a portfolio valued in its own currency. The gains of its assets are split into the price
+// moves in the assets' quote currencies and the exchange rate moves since they were bought.
+type portfolioValuation struct {
+	totalValue    decimal.Decimal
+	totalInvested decimal.Decimal
+	assetGain     decimal.Decimal
+	fxGain        decimal.Decimal
+}
+
+// inBaseCurrency converts the valuation from the portfolio currency into the base currency at the latest rate,
+// rounded to the base currency's minor unit
+func (v portfolioValuation) inBaseCurrency(fx FXService, currency, baseCurrency string) (dto.BaseCurrencyValuation, error) {
+	rate, err := fx.GetRate(currency, baseCurrency)
+	if err != nil {
+		return dto.BaseCurrencyValuation{}, err
+	}
+	return dto.BaseCurrencyValuation{
+		Currency:          currency,
+		BaseCurrency:      baseCurrency,
+		FxRate:            rate,
+		TotalValueBase:    commons.RoundCash(v.totalValue.Mul(rate), baseCurrency),
+		TotalInvestedBase: commons.RoundCash(v.totalInvested.Mul(rate), baseCurrency),
+		AssetGain:         commons.RoundCash(v.assetGain.Mul(rate), baseCurrency),
+		FxGain:            commons.RoundCash(v.fxGain.Mul(rate), baseCurrency),
+	}, nil
+}
+
+type fxRateTable struct {
+	rates     map[string]decimal.Decimal
+	fetchedAt time.Time
+}
+
+type fxServiceImpl struct {
+	repo repositories.FXRateRepository
+	ttl  time.Duration
+
+	mu     sync.Mutex
+	tables map[string]fxRateTable // by base currency
+}
+
+func NewFXService(fr repositories.FXRateRepository, ttl time.Duration) *fxServiceImpl {
+	return &fxServiceImpl{repo: fr, ttl: ttl, tables: make(map[string]fxRateTable)}
+}
+
+// GetRate returns how many units of to one unit of from buys
+func (s *fxServiceImpl) GetRate(from, to string) (decimal.Decimal, error) {
+	if from == to {
+		return decimal.One, nil
+	}
+	rates, err := s.getRates(from)
+	if err != nil {
+		return decimal.Zero, fmt.Errorf("failed to get fx rates for %s: %w", from, err)
+	}
+	rate, exists := rates[to]
+	if !exists || !rate.IsPositive() {
+		return decimal.Zero, fmt.Errorf("no fx rate from %s to %s", from, to)
+	}
+	return rate, nil
+}
+
+// Convert converts amount at the latest rate, rounded to the minor unit of to
+func (s *fxServiceImpl) Convert(amount decimal.Decimal, from, to string) (decimal.Decimal, error) {
+	rate, err := s.GetRate(from, to)
+	if err != nil {
+		return decimal.Zero, err
+	}
+	return commons.RoundCash(amount.Mul(rate), to), nil
+}
+
+func (s *fxServiceImpl) getRates(base string) (map[string]decimal.Decimal, error) {
+	s.mu.Lock()
+	table, exists := s.tables[base]
+	s.mu.Unlock()
+	if exists && time.Since(table.fetchedAt) < s.ttl {
+		return table.rates, nil
+	}
+
+	rates, err := s.repo.GetRates(base)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	s.tables[base] = fxRateTable{rates: rates, fetchedAt: time.Now()}
+	s.mu.Unlock()
+	return rates, nil
+}
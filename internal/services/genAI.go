@@ -1,22 +1,29 @@
 package services
 
 import (
+	"errors"
 	"fmt"
+	"log"
 	"mime/multipart"
 	"sync"
 
+	"github.com/KZY20112001/infinivest-backend/internal/analytics"
+	"github.com/KZY20112001/infinivest-backend/internal/commons"
+	"github.com/KZY20112001/infinivest-backend/internal/commons/decimal"
 	"github.com/KZY20112001/infinivest-backend/internal/dto"
 	"github.com/KZY20112001/infinivest-backend/internal/repositories"
 )
 
 type GenAIService interface {
-	GenerateRoboAdvisorPortfolio(bankStatement *multipart.FileHeader, bankName, toleranceLevel string) (dto.RoboAdvisorRecommendationResponse, error)
+	GenerateRoboAdvisorPortfolio(bankStatement *multipart.FileHeader, bankName, toleranceLevel, engine string, excludedCategories []string) (dto.RoboAdvisorRecommendationResponse, error)
 	GenerateAssetAllocations(req dto.AssetAllocationRequest) (dto.AssetAllocationResponse, error)
-	GetLatestAssetPrice(symbol string) (float64, error)
+	GetLatestAssetPrice(symbol string) (decimal.Decimal, error)
+	GetAssetPriceHistory(symbol string, days int) ([]dto.PricePoint, error)
 }
 
 type genAIServiceImpl struct {
-	repo repositories.GenAIRepository
+	repo        repositories.GenAIRepository
+	assumptions map[string]analytics.CategoryAssumption
 }
 
 type CategoryResult struct {
@@ -25,12 +32,132 @@ type CategoryResult struct {
 	Error    error
 }
 
-func NewGenAIService(gr repositories.GenAIRepository) *genAIServiceImpl {
-	return &genAIServiceImpl{repo: gr}
+func NewGenAIService(gr repositories.GenAIRepository, assumptions map[string]analytics.CategoryAssumption) *genAIServiceImpl {
+	return &genAIServiceImpl{repo: gr, assumptions: assumptions}
 }
 
-func (s *genAIServiceImpl) GenerateRoboAdvisorPortfolio(bankStatement *multipart.FileHeader, bankName, toleranceLevel string) (dto.RoboAdvisorRecommendationResponse, error) {
-	return s.repo.GeneratePortfolioRecommendation(bankStatement, bankName, toleranceLevel)
+// GenerateRoboAdvisorPortfolio recommends category weights. Excluded categories get no weight: the local optimizer
+// leaves them out, while a genAI recommendation moves their weight to the rest of the same asset class, or to cash.
+func (s *genAIServiceImpl) GenerateRoboAdvisorPortfolio(bankStatement *multipart.FileHeader, bankName, toleranceLevel, engine string, excludedCategories []string) (dto.RoboAdvisorRecommendationResponse, error) {
+	if engine == "local" {
+		return s.generateLocalRecommendation(toleranceLevel, excludedCategories)
+	}
+
+	recommendation, err := s.repo.GeneratePortfolioRecommendation(bankStatement, bankName, toleranceLevel)
+	if errors.Is(err, commons.ErrUnavailable) {
+		log.Printf("GenAI microservice unavailable, falling back to the local optimizer: %v", err)
+		return s.generateLocalRecommendation(toleranceLevel, excludedCategories)
+	}
+	if err != nil {
+		return dto.RoboAdvisorRecommendationResponse{}, err
+	}
+	recommendation.Engine = "genai"
+	if len(excludedCategories) > 0 {
+		weights := excludeCategories(recommendationWeights(recommendation.Portfolio), excludedCategories)
+		recommendation.Portfolio = recommendationPortfolio(analytics.ToPercentages(weights))
+		recommendation.ExcludedCategories = excludedCategories
+	}
+	return recommendation, nil
+}
+
+func (s *genAIServiceImpl) generateLocalRecommendation(toleranceLevel string, excludedCategories []string) (dto.RoboAdvisorRecommendationResponse, error) {
+	riskLevel, err := commons.NormalizeRiskLevel(toleranceLevel)
+	if err != nil {
+		return dto.RoboAdvisorRecommendationResponse{}, err
+	}
+	constraints := analytics.RiskLevelConstraints[riskLevel]
+	constraints.Excluded = excludedCategories
+	weights, err := analytics.OptimizeMeanVariance(s.assumptions, constraints)
+	if err != nil {
+		return dto.RoboAdvisorRecommendationResponse{}, err
+	}
+	expectedReturn, volatility := analytics.PortfolioExpectations(weights, s.assumptions)
+
+	recommendation := dto.RoboAdvisorRecommendationResponse{
+		Portfolio: recommendationPortfolio(analytics.ToPercentages(weights)),
+		Reason: fmt.Sprintf(
+			"Mean-variance optimised allocation for a %s risk profile with an expected annual return of %.1f%% and volatility of %.1f%%.",
+			riskLevel, expectedReturn*100, volatility*100,
+		),
+		Engine: "local",
+	}
+	if len(excludedCategories) > 0 {
+		recommendation.ExcludedCategories = excludedCategories
+	}
+	return recommendation, nil
+}
+
+// recommendationWeights returns the recommended categories as fractions summing to 1
+func recommendationWeights(portfolio dto.RoboAdvisorPortfolio) map[string]float64 {
+	weights := map[string]float64{
+		"largeCapBlend":       portfolio.LargeCapBlend,
+		"smallCapBlend":       portfolio.SmallCapBlend,
+		"internationalStocks": portfolio.InternationalStocks,
+		"emergingMarkets":     portfolio.EmergingMarkets,
+		"intermediateBonds":   portfolio.IntermediateBonds,
+		"internationalBonds":  portfolio.InternationalBonds,
+		"cash":                portfolio.Cash,
+	}
+	total := 0.0
+	for _, weight := range weights {
+		total += weight
+	}
+	if total > 0 {
+		for category := range weights {
+			weights[category] /= total
+		}
+	}
+	return weights
+}
+
+func recommendationPortfolio(percentages map[string]float64) dto.RoboAdvisorPortfolio {
+	return dto.RoboAdvisorPortfolio{
+		LargeCapBlend:       percentages["largeCapBlend"],
+		SmallCapBlend:       percentages["smallCapBlend"],
+		InternationalStocks: percentages["internationalStocks"],
+		EmergingMarkets:     percentages["emergingMarkets"],
+		IntermediateBonds:   percentages["intermediateBonds"],
+		InternationalBonds:  percentages["internationalBonds"],
+		Cash:                percentages["cash"],
+	}
+}
+
+// excludeCategories moves the weight of the excluded categories to the other categories of the same asset class
+// in proportion to their weight, or to cash when the class has nothing else
+func excludeCategories(weights map[string]float64, excluded []string) map[string]float64 {
+	res := make(map[string]float64, len(weights))
+	for category, weight := range weights {
+		res[category] = weight
+	}
+	isExcluded := make(map[string]bool, len(excluded))
+	for _, category := range excluded {
+		isExcluded[category] = category != "cash"
+	}
+
+	for _, category := range excluded {
+		weight := res[category]
+		if !isExcluded[category] || weight == 0 {
+			continue
+		}
+		res[category] = 0
+		class := analytics.CategoryClass(category)
+		remaining := 0.0
+		for other, otherWeight := range res {
+			if !isExcluded[other] && analytics.CategoryClass(other) == class {
+				remaining += otherWeight
+			}
+		}
+		if remaining == 0 {
+			res["cash"] += weight
+			continue
+		}
+		for other, otherWeight := range res {
+			if !isExcluded[other] && analytics.CategoryClass(other) == class {
+				res[other] += weight * otherWeight / remaining
+			}
+		}
+	}
+	return res
 }
 
 func (s *genAIServiceImpl) GenerateAssetAllocations(req dto.AssetAllocationRequest) (dto.AssetAllocationResponse, error) {
@@ -77,6 +204,10 @@ func (s *genAIServiceImpl) GenerateAssetAllocations(req dto.AssetAllocationReque
 	return dto.AssetAllocationResponse{Allocations: allocations}, nil
 }
 
-func (s *genAIServiceImpl) GetLatestAssetPrice(symbol string) (float64, error) {
+func (s *genAIServiceImpl) GetLatestAssetPrice(symbol string) (decimal.Decimal, error) {
 	return s.repo.GetLatestAssetPrice(symbol)
 }
+
+func (s *genAIServiceImpl) GetAssetPriceHistory(symbol string, days int) ([]dto.PricePoint, error) {
+	return s.repo.GetAssetPriceHistory(symbol, days)
+}
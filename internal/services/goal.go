@@ -0,0 +1,201 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/KZY20112001/infinivest-backend/internal/analytics"
+	"github.com/KZY20112001/infinivest-backend/internal/commons"
+	"github.com/KZY20112001/infinivest-backend/internal/commons/decimal"
+	"github.com/KZY20112001/infinivest-backend/internal/dto"
+	"github.com/KZY20112001/infinivest-backend/internal/models"
+	"github.com/KZY20112001/infinivest-backend/internal/repositories"
+)
+
+const (
+	goalSimulationTrials = 2000
+	goalConfidence       = 0.8 // probability used when solving for the required contribution
+)
+
+type GoalService interface {
+	CreateGoal(userID uint, req dto.GoalRequest) (*models.Goal, error)
+	GetGoals(userID uint) ([]*models.Goal, error)
+	GetGoal(userID, goalID uint) (*models.Goal, error)
+	UpdateGoal(userID, goalID uint, req dto.GoalRequest) (*models.Goal, error)
+	DeleteGoal(userID, goalID uint) error
+	GetGoalProjection(userID, goalID uint) (dto.GoalProjectionResponse, error)
+}
+
+type goalServiceImpl struct {
+	repo                 repositories.GoalRepo
+	roboPortfolioService RoboPortfolioService
+	profileService       ProfileService
+	assumptions          map[string]analytics.CategoryAssumption
+}
+
+func NewGoalService(gr repositories.GoalRepo, rs RoboPortfolioService, ps ProfileService, assumptions map[string]analytics.CategoryAssumption) *goalServiceImpl {
+	return &goalServiceImpl{repo: gr, roboPortfolioService: rs, profileService: ps, assumptions: assumptions}
+}
+
+func (s *goalServiceImpl) CreateGoal(userID uint, req dto.GoalRequest) (*models.Goal, error) {
+	goal := &models.Goal{UserID: userID}
+	if err := s.applyGoalRequest(goal, req); err != nil {
+		return nil, err
+	}
+	if err := s.repo.CreateGoal(goal); err != nil {
+		return nil, err
+	}
+	return goal, nil
+}
+
+func (s *goalServiceImpl) GetGoals(userID uint) ([]*models.Goal, error) {
+	return s.repo.GetGoals(userID)
+}
+
+func (s *goalServiceImpl) GetGoal(userID, goalID uint) (*models.Goal, error) {
+	return s.repo.GetGoal(userID, goalID)
+}
+
+func (s *goalServiceImpl) UpdateGoal(userID, goalID uint, req dto.GoalRequest) (*models.Goal, error) {
+	goal, err := s.repo.GetGoal(userID, goalID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.applyGoalRequest(goal, req); err != nil {
+		return nil, err
+	}
+	if err := s.repo.UpdateGoal(goal); err != nil {
+		return nil, err
+	}
+	return goal, nil
+}
+
+func (s *goalServiceImpl) DeleteGoal(userID, goalID uint) error {
+	goal, err := s.repo.GetGoal(userID, goalID)
+	if err != nil {
+		return err
+	}
+	return s.repo.DeleteGoal(goal)
+}
+
+func (s *goalServiceImpl) GetGoalProjection(userID, goalID uint) (dto.GoalProjectionResponse, error) {
+	goal, err := s.repo.GetGoal(userID, goalID)
+	if err != nil {
+		return dto.GoalProjectionResponse{}, err
+	}
+	portfolio, err := s.roboPortfolioService.GetRoboPortfolioDetails(userID, goal.RoboPortfolioID)
+	if err != nil {
+		return dto.GoalProjectionResponse{}, err
+	}
+	summary, err := s.roboPortfolioService.GetRoboPortfolioSummary(userID, goal.RoboPortfolioID)
+	if err != nil {
+		return dto.GoalProjectionResponse{}, err
+	}
+
+	weights, err := categoryWeights(portfolio)
+	if err != nil {
+		return dto.GoalProjectionResponse{}, err
+	}
+	months := monthsUntil(goal.TargetDate)
+	if months <= 0 {
+		return dto.GoalProjectionResponse{}, fmt.Errorf("goal %s target date has already passed", goal.Name)
+	}
+
+	// the simulation works on floats, its results are rounded back to cash in the portfolio currency
+	input := analytics.SimulationInput{
+		Weights:             weights,
+		InitialValue:        summary.TotalValue.Float64(),
+		MonthlyContribution: goal.MonthlyContribution.Float64(),
+		Months:              months,
+		TargetAmount:        goal.TargetAmount.Float64(),
+		Trials:              goalSimulationTrials,
+		Seed:                int64(goal.ID),
+	}
+	result := analytics.SimulatePortfolio(input, s.assumptions)
+	expectedReturn, volatility := analytics.PortfolioExpectations(weights, s.assumptions)
+	required := analytics.RequiredMonthlyContribution(input, s.assumptions, goalConfidence)
+
+	return dto.GoalProjectionResponse{
+		GoalID:                      goal.ID,
+		CurrentValue:                summary.TotalValue,
+		TargetAmount:                goal.TargetAmount,
+		Months:                      months,
+		ExpectedReturn:              expectedReturn,
+		Volatility:                  volatility,
+		SuccessProbability:          result.SuccessProbability,
+		FinalPercentiles:            result.FinalPercentiles,
+		Bands:                       result.Bands,
+		MonthlyContribution:         goal.MonthlyContribution,
+		RequiredMonthlyContribution: commons.RoundCash(decimal.NewFromFloat(required), portfolio.Currency),
+		Confidence:                  goalConfidence,
+	}, nil
+}
+
+func (s *goalServiceImpl) applyGoalRequest(goal *models.Goal, req dto.GoalRequest) error {
+	if req.Name == "" {
+		return fmt.Errorf("goal name is required")
+	}
+	if !req.TargetAmount.IsPositive() {
+		return fmt.Errorf("target amount must be positive")
+	}
+	if req.MonthlyContribution.IsNegative() {
+		return fmt.Errorf("monthly contribution cannot be negative")
+	}
+	if _, err := s.roboPortfolioService.GetRoboPortfolioDetails(goal.UserID, req.RoboPortfolioID); err != nil {
+		return err
+	}
+
+	var targetDate time.Time
+	if req.TargetDate != "" {
+		parsed, err := time.Parse("2006-01-02", req.TargetDate)
+		if err != nil {
+			return fmt.Errorf("invalid target date: %s", req.TargetDate)
+		}
+		targetDate = parsed
+	} else {
+		profile, err := s.profileService.GetProfile(goal.UserID)
+		if err != nil {
+			return fmt.Errorf("target date is required when no profile is set up: %w", err)
+		}
+		years, err := commons.ParseInvestmentHorizon(profile.InvestmentHorizon)
+		if err != nil {
+			return err
+		}
+		targetDate = time.Now().AddDate(years, 0, 0)
+	}
+	if !targetDate.After(time.Now()) {
+		return fmt.Errorf("target date must be in the future")
+	}
+
+	goal.Name = req.Name
+	goal.RoboPortfolioID = req.RoboPortfolioID
+	goal.TargetAmount = req.TargetAmount
+	goal.TargetDate = targetDate
+	goal.MonthlyContribution = req.MonthlyContribution
+	return nil
+}
+
+// categoryWeights returns the portfolio's target category weights as fractions summing to 1
+func categoryWeights(portfolio *models.RoboPortfolio) (map[string]float64, error) {
+	weights := make(map[string]float64)
+	total := 0.0
+	for _, category := range portfolio.Categories {
+		if category.TotalPercentage <= 0 {
+			continue
+		}
+		weights[category.Name] = category.TotalPercentage
+		total += category.TotalPercentage
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("portfolio %d has no category allocation", portfolio.ID)
+	}
+	for category := range weights {
+		weights[category] /= total
+	}
+	return weights, nil
+}
+
+func monthsUntil(target time.Time) int {
+	return int(math.Ceil(time.Until(target).Hours() / 24 / 30.4375))
+}
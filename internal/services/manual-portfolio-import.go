@@ -0,0 +1,633 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/KZY20112001/infinivest-backend/internal/commons"
+	"github.com/KZY20112001/infinivest-backend/internal/commons/decimal"
+	"github.com/KZY20112001/infinivest-backend/internal/dto"
+	"github.com/KZY20112001/infinivest-backend/internal/models"
+	"github.com/KZY20112001/infinivest-backend/internal/repositories"
+)
+
+// column mappings for the statement formats of common brokers
+var importPresets = map[string]dto.ImportColumnMapping{
+	"generic": {
+		Date:       "date",
+		Type:       "type",
+		Symbol:     "symbol",
+		Name:       "name",
+		Shares:     "shares",
+		Price:      "price",
+		Amount:     "amount",
+		Fee:        "fee",
+		DateFormat: "2006-01-02",
+	},
+	"schwab": {
+		Date:       "Date",
+		Type:       "Action",
+		Symbol:     "Symbol",
+		Name:       "Description",
+		Shares:     "Quantity",
+		Price:      "Price",
+		Amount:     "Amount",
+		Fee:        "Fees & Comm",
+		DateFormat: "01/02/2006",
+		TypeValues: map[string]string{
+			"buy":                "buy",
+			"sell":               "sell",
+			"reinvest shares":    "buy",
+			"cash dividend":      "dividend",
+			"qualified dividend": "dividend",
+			"reinvest dividend":  "dividend",
+			"moneylink transfer": "cash",
+			"wire funds":         "cash",
+			"journal":            "cash",
+		},
+	},
+	"interactive-brokers": {
+		Date:       "TradeDate",
+		Type:       "Buy/Sell",
+		Symbol:     "Symbol",
+		Name:       "Description",
+		Shares:     "Quantity",
+		Price:      "TradePrice",
+		Amount:     "NetCash",
+		Fee:        "IBCommission",
+		DateFormat: "20060102",
+		TypeValues: map[string]string{
+			"buy":                  "buy",
+			"sell":                 "sell",
+			"deposits/withdrawals": "cash",
+			"dividends":            "dividend",
+		},
+	},
+}
+
+var importTransactionTypes = map[string]bool{
+	"buy":        true,
+	"sell":       true,
+	"deposit":    true,
+	"withdrawal": true,
+	"dividend":   true,
+}
+
+// importedRow is a parsed statement row with the transaction it would create
+type importedRow struct {
+	report      dto.ImportRow
+	name        string
+	transaction *models.ManualPortfolioTransaction
+}
+
+// ImportManualPortfolioTransactions validates a CSV statement against the portfolio's history and, on commit, saves the
+// new rows and rebuilds the holdings by replaying every transaction. Rows already imported are reported as duplicates.
+func (s *manualPortfolioServiceImpl) ImportManualPortfolioTransactions(userID uint, portfolioName string, file *multipart.FileHeader, preset string, mapping *dto.ImportColumnMapping, commit bool) (dto.ImportResult, error) {
+	if preset == "" {
+		preset = "generic"
+	}
+	columns, ok := importPresets[preset]
+	if !ok {
+		return dto.ImportResult{}, fmt.Errorf("invalid import preset: %s", preset)
+	}
+	if mapping != nil {
+		columns = mergeImportMapping(columns, *mapping)
+	}
+
+	portfolio, err := s.repo.GetManualPortfolio(userID, portfolioName)
+	if err != nil {
+		return dto.ImportResult{}, err
+	}
+	src, err := file.Open()
+	if err != nil {
+		return dto.ImportResult{}, err
+	}
+	defer src.Close()
+
+	rows, err := parseImportRows(src, columns, portfolio.Currency)
+	if err != nil {
+		return dto.ImportResult{}, err
+	}
+
+	// statement amounts are in the portfolio currency, trades in other currencies are recorded at today's rate
+	for _, row := range rows {
+		if row.report.Status != "valid" || row.transaction.Symbol == nil {
+			continue
+		}
+		fxRate, err := s.assetFxRate(portfolio, *row.transaction.Symbol)
+		if err != nil {
+			row.report.Status = "error"
+			row.report.Error = err.Error()
+			continue
+		}
+		row.transaction.FxRate = &fxRate
+	}
+
+	result := dto.ImportResult{Preset: preset, Committed: commit}
+	if !commit {
+		replay, err := validateImportRows(s.repo, portfolio, rows)
+		if err != nil {
+			return dto.ImportResult{}, err
+		}
+		result.TotalCash = replay.cash
+	} else {
+		// the portfolio is locked while the rows are checked against its history and saved, so trades, fills and
+		// other imports cannot change it in between and the same statement cannot be imported twice
+		err = s.repo.InTransaction(func(repo repositories.ManualPortfolioRepo) error {
+			portfolio, err := repo.LockManualPortfolio(userID, portfolio.ID)
+			if err != nil {
+				return err
+			}
+			replay, err := validateImportRows(repo, portfolio, rows)
+			if err != nil {
+				return err
+			}
+			result.TotalCash = replay.cash
+
+			var transactions []*models.ManualPortfolioTransaction
+			for _, row := range rows {
+				if row.report.Status == "valid" {
+					row.transaction.ManualPortfolioUserID = userID
+					row.transaction.ManualPortfolioID = portfolio.ID
+					transactions = append(transactions, row.transaction)
+				}
+			}
+			if len(transactions) == 0 {
+				return nil
+			}
+			replay.applyTo(portfolio)
+			return repo.ImportManualPortfolioTransactions(portfolio, transactions)
+		})
+		if err != nil {
+			return dto.ImportResult{}, err
+		}
+	}
+
+	for _, row := range rows {
+		switch row.report.Status {
+		case "valid":
+			result.Valid++
+			if commit {
+				row.report.Status = "imported"
+				result.Imported++
+			}
+		case "duplicate":
+			result.Duplicates++
+		case "error":
+			result.Errors++
+		}
+	}
+
+	result.Rows = make([]dto.ImportRow, 0, len(rows))
+	for _, row := range rows {
+		result.Rows = append(result.Rows, row.report)
+	}
+	return result, nil
+}
+
+// validateImportRows marks the rows that were imported before as duplicates and replays the rest over the
+// portfolio's history, marking the rows that cannot be applied as errors
+func validateImportRows(repo repositories.ManualPortfolioRepo, portfolio *models.ManualPortfolio, rows []*importedRow) (*holdingsReplay, error) {
+	existingKeys, err := repo.GetManualPortfolioImportKeys(portfolio.ID)
+	if err != nil {
+		return nil, err
+	}
+	imported := make(map[string]bool, len(existingKeys))
+	for _, key := range existingKeys {
+		imported[key] = true
+	}
+	for _, row := range rows {
+		if row.report.Status == "valid" && imported[*row.transaction.ImportKey] {
+			row.report.Status = "duplicate"
+		}
+	}
+
+	history, err := repo.GetManualPortfolioTransactions(portfolio.UserID, portfolio.ID, 0)
+	if err != nil {
+		return nil, err
+	}
+	return replayManualTransactions(history, rows, portfolio), nil
+}
+
+func mergeImportMapping(base, override dto.ImportColumnMapping) dto.ImportColumnMapping {
+	for _, field := range []struct{ dst, src *string }{
+		{&base.Date, &override.Date},
+		{&base.Type, &override.Type},
+		{&base.Symbol, &override.Symbol},
+		{&base.Name, &override.Name},
+		{&base.Shares, &override.Shares},
+		{&base.Price, &override.Price},
+		{&base.Amount, &override.Amount},
+		{&base.Fee, &override.Fee},
+		{&base.DateFormat, &override.DateFormat},
+	} {
+		if *field.src != "" {
+			*field.dst = *field.src
+		}
+	}
+	if len(override.TypeValues) > 0 {
+		base.TypeValues = make(map[string]string, len(override.TypeValues))
+		for brokerType, transactionType := range override.TypeValues {
+			base.TypeValues[strings.ToLower(strings.TrimSpace(brokerType))] = transactionType
+		}
+	}
+	return base
+}
+
+// parseImportRows reads the statement from the header row on; lines before it (titles, account details) and rows
+// without a type (totals, notes) are skipped
+func parseImportRows(src io.Reader, columns dto.ImportColumnMapping, currency string) ([]*importedRow, error) {
+	reader := csv.NewReader(src)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	reader.TrimLeadingSpace = true
+
+	var index map[string]int
+	for index == nil {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("CSV header with columns %q and %q not found", columns.Date, columns.Type)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CSV: %w", err)
+		}
+		header := make(map[string]int, len(record))
+		for i, name := range record {
+			header[strings.ToLower(strings.TrimSpace(name))] = i
+		}
+		_, hasDate := header[strings.ToLower(columns.Date)]
+		_, hasType := header[strings.ToLower(columns.Type)]
+		if hasDate && hasType {
+			index = header
+		}
+	}
+
+	var rows []*importedRow
+	occurrences := make(map[string]int)
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CSV: %w", err)
+		}
+		line, _ := reader.FieldPos(0)
+		field := func(column string) string {
+			i, ok := index[strings.ToLower(column)]
+			if column == "" || !ok || i >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[i])
+		}
+		if field(columns.Type) == "" {
+			continue
+		}
+
+		row := parseImportRow(field, columns, currency)
+		row.report.Line = line
+		if row.report.Status == "valid" {
+			// identical rows in one statement are distinct trades, so the key counts them. The numbers are
+			// formatted as floats, as they were before amounts were decimals, so earlier imports are still recognised.
+			identity := fmt.Sprintf("%s|%s|%s|%g|%g|%g|%g", row.report.Date, row.report.Type, row.report.Symbol,
+				row.report.Shares.Float64(), row.report.Price.Float64(), row.report.Amount.Float64(), row.report.Fee.Float64())
+			occurrences[identity]++
+			sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%d", identity, occurrences[identity])))
+			key := hex.EncodeToString(sum[:])
+			row.transaction.ImportKey = &key
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// parseImportRow reads a statement row whose amounts are in the given currency
+func parseImportRow(field func(string) string, columns dto.ImportColumnMapping, currency string) *importedRow {
+	row := &importedRow{report: dto.ImportRow{Status: "error"}}
+	fail := func(format string, args ...any) *importedRow {
+		row.report.Error = fmt.Sprintf(format, args...)
+		return row
+	}
+
+	rawType := strings.ToLower(field(columns.Type))
+	transactionType := rawType
+	if mapped, ok := columns.TypeValues[rawType]; ok {
+		transactionType = mapped
+	}
+	row.report.Type = transactionType
+
+	date, err := parseImportDate(field(columns.Date), columns.DateFormat)
+	if err != nil {
+		return fail("invalid date %q", field(columns.Date))
+	}
+	row.report.Date = date.Format("2006-01-02")
+
+	var shares, price, amount, fee decimal.Decimal
+	for _, value := range []struct {
+		column string
+		dst    *decimal.Decimal
+	}{
+		{columns.Shares, &shares},
+		{columns.Price, &price},
+		{columns.Amount, &amount},
+		{columns.Fee, &fee},
+	} {
+		if *value.dst, err = parseImportNumber(field(value.column)); err != nil {
+			return fail("invalid number %q in column %s", field(value.column), value.column)
+		}
+	}
+	if transactionType == "cash" {
+		transactionType = "deposit"
+		if amount.IsNegative() {
+			transactionType = "withdrawal"
+		}
+		row.report.Type = transactionType
+	}
+	if !importTransactionTypes[transactionType] {
+		return fail("unsupported transaction type %q", rawType)
+	}
+	shares, price = commons.RoundShares(shares.Abs()), commons.RoundPrice(price.Abs())
+	amount, fee = commons.RoundCash(amount.Abs(), currency), commons.RoundCash(fee.Abs(), currency)
+	symbol := strings.ToUpper(field(columns.Symbol))
+	row.name = field(columns.Name)
+
+	transaction := &models.ManualPortfolioTransaction{TransactionType: transactionType, Fee: fee}
+	transaction.CreatedAt = date
+	switch transactionType {
+	case "buy", "sell":
+		if symbol == "" {
+			return fail("symbol is required for a %s", transactionType)
+		}
+		if !shares.IsPositive() {
+			return fail("shares must be positive")
+		}
+		if !price.IsPositive() && amount.IsPositive() {
+			price = commons.RoundPrice(amount.Div(shares))
+		}
+		if !price.IsPositive() {
+			return fail("price or amount is required for a %s", transactionType)
+		}
+		amount = commons.RoundCash(shares.Mul(price), currency).Add(fee)
+		if transactionType == "sell" {
+			amount = commons.RoundCash(shares.Mul(price), currency).Sub(fee)
+		}
+		name := row.name
+		if name == "" {
+			name = symbol
+		}
+		transaction.Symbol = &symbol
+		transaction.Name = &name
+		transaction.Price = &price
+		transaction.SharesAmount = &shares
+	default:
+		if !amount.IsPositive() {
+			return fail("amount must be positive")
+		}
+		shares, price, symbol = decimal.Zero, decimal.Zero, ""
+	}
+	transaction.TotalAmount = amount
+
+	row.report.Symbol = symbol
+	row.report.Shares = shares
+	row.report.Price = price
+	row.report.Amount = amount
+	row.report.Fee = fee
+	row.report.Status = "valid"
+	row.transaction = transaction
+	return row
+}
+
+// parseImportDate ignores anything after the date, such as a time or Schwab's "as of" suffix
+func parseImportDate(value, layout string) (time.Time, error) {
+	if fields := strings.FieldsFunc(value, func(r rune) bool { return r == ' ' || r == ';' }); len(fields) > 0 {
+		value = fields[0]
+	}
+	var err error
+	for _, candidate := range []string{layout, "2006-01-02", "01/02/2006", "20060102"} {
+		if candidate == "" {
+			continue
+		}
+		var date time.Time
+		if date, err = time.Parse(candidate, value); err == nil {
+			return date, nil
+		}
+	}
+	return time.Time{}, err
+}
+
+// parseImportNumber accepts currency symbols, thousands separators and accounting style negatives
+func parseImportNumber(value string) (decimal.Decimal, error) {
+	value = strings.NewReplacer("$", "", ",", "", " ", "").Replace(value)
+	if value == "" {
+		return decimal.Zero, nil
+	}
+	negative := strings.HasPrefix(value, "(") && strings.HasSuffix(value, ")")
+	number, err := decimal.Parse(strings.Trim(value, "()"))
+	if negative {
+		number = number.Neg()
+	}
+	return number, err
+}
+
+type replayPosition struct {
+	name     string
+	shares   decimal.Decimal
+	invested decimal.Decimal // in the portfolio currency
+	cost     decimal.Decimal // in the asset currency
+}
+
+// holdingsReplay is the cash and positions of a portfolio rebuilt from its transactions
+type holdingsReplay struct {
+	currency  string
+	cash      decimal.Decimal
+	positions map[string]*replayPosition
+	applied   []*importedRow // imported rows applied, in date order
+}
+
+// replayManualTransactions replays the portfolio history together with the valid imported rows in date order.
+// Imported rows that would overdraw cash or sell shares that are not held are marked as errors and left out, as
+// are rows that would leave less cash or shares than the portfolio's open orders reserve.
+func replayManualTransactions(history []*models.ManualPortfolioTransaction, rows []*importedRow, portfolio *models.ManualPortfolio) *holdingsReplay {
+	for {
+		replay := replayImportedRows(history, rows, portfolio.Currency)
+		row, reason := replay.overReservedRow(portfolio)
+		if row == nil {
+			return replay
+		}
+		row.report.Status = "error"
+		row.report.Error = reason
+	}
+}
+
+func replayImportedRows(history []*models.ManualPortfolioTransaction, rows []*importedRow, currency string) *holdingsReplay {
+	type replayEntry struct {
+		transaction *models.ManualPortfolioTransaction
+		row         *importedRow
+	}
+	var entries []replayEntry
+	for _, transaction := range history {
+		entries = append(entries, replayEntry{transaction: transaction})
+	}
+	for _, row := range rows {
+		if row.report.Status == "valid" {
+			entries = append(entries, replayEntry{transaction: row.transaction, row: row})
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].transaction.CreatedAt.Before(entries[j].transaction.CreatedAt)
+	})
+
+	replay := &holdingsReplay{currency: currency, positions: make(map[string]*replayPosition)}
+	for _, entry := range entries {
+		if entry.row == nil {
+			// recorded transactions have already happened, so they are applied even if the history is incomplete
+			replay.apply(entry.transaction, "", false)
+			continue
+		}
+		if err := replay.apply(entry.transaction, entry.row.name, true); err != nil {
+			entry.row.report.Status = "error"
+			entry.row.report.Error = err.Error()
+			continue
+		}
+		replay.applied = append(replay.applied, entry.row)
+	}
+	return replay
+}
+
+// overReservedRow returns the latest applied row that takes cash, or sells shares, the open orders have reserved
+// when the replay ends with less than they reserve. Reservations are judged at the end of the replay, since a
+// back-dated row can be covered by what the history adds after it.
+func (r *holdingsReplay) overReservedRow(portfolio *models.ManualPortfolio) (*importedRow, string) {
+	if r.cash.LessThan(portfolio.ReservedCash) {
+		for i := len(r.applied) - 1; i >= 0; i-- {
+			if transactionType := r.applied[i].transaction.TransactionType; transactionType == "buy" || transactionType == "withdrawal" {
+				return r.applied[i], fmt.Sprintf("open orders reserve %s of the cash", commons.FormatCash(portfolio.ReservedCash, r.currency))
+			}
+		}
+	}
+	for _, asset := range portfolio.Assets {
+		held := decimal.Zero
+		if position, ok := r.positions[asset.Symbol]; ok {
+			held = position.shares
+		}
+		if !held.LessThan(asset.SharesReserved) {
+			continue
+		}
+		for i := len(r.applied) - 1; i >= 0; i-- {
+			if transaction := r.applied[i].transaction; transaction.TransactionType == "sell" && *transaction.Symbol == asset.Symbol {
+				return r.applied[i], fmt.Sprintf("open orders reserve %s shares of %s", asset.SharesReserved, asset.Symbol)
+			}
+		}
+	}
+	return nil, ""
+}
+
+func (r *holdingsReplay) apply(transaction *models.ManualPortfolioTransaction, name string, strict bool) error {
+	amount := transaction.TotalAmount
+	if transaction.Symbol == nil || transaction.SharesAmount == nil {
+		switch transaction.TransactionType {
+		case "deposit", "dividend", "transfer:in":
+			r.cash = r.cash.Add(amount)
+		case "withdrawal", "transfer:out":
+			if strict && amount.GreaterThan(r.cash) {
+				return fmt.Errorf("insufficient cash: %s available", commons.FormatCash(r.cash, r.currency))
+			}
+			r.cash = r.cash.Sub(amount)
+		}
+		return nil
+	}
+
+	symbol, shares := *transaction.Symbol, *transaction.SharesAmount
+	position, ok := r.positions[symbol]
+	if !ok {
+		if name == "" && transaction.Name != nil {
+			name = *transaction.Name
+		}
+		position = &replayPosition{name: name}
+		r.positions[symbol] = position
+	}
+	switch transaction.TransactionType {
+	case "buy", "transfer:in":
+		if transaction.TransactionType == "buy" {
+			if strict && amount.GreaterThan(r.cash) {
+				return fmt.Errorf("insufficient cash: %s available", commons.FormatCash(r.cash, r.currency))
+			}
+			r.cash = r.cash.Sub(amount)
+		}
+		position.shares = position.shares.Add(shares)
+		position.invested = position.invested.Add(amount)
+		position.cost = position.cost.Add(amount.Div(transactionFxRate(transaction)))
+	case "sell", "transfer:out":
+		if strict && shares.GreaterThan(position.shares) {
+			return fmt.Errorf("insufficient shares of %s: %s held", symbol, position.shares)
+		}
+		shares = decimal.Min(shares, position.shares)
+		if position.shares.IsPositive() {
+			soldInvested := commons.RoundCash(position.invested.Mul(shares).Div(position.shares), r.currency)
+			position.invested = position.invested.Sub(soldInvested)
+			position.cost = position.cost.Sub(position.cost.Mul(shares).Div(position.shares))
+		}
+		position.shares = position.shares.Sub(shares)
+		if !position.shares.IsPositive() {
+			position.shares, position.invested, position.cost = decimal.Zero, decimal.Zero, decimal.Zero
+		}
+		if transaction.TransactionType == "sell" {
+			r.cash = r.cash.Add(amount)
+		}
+	}
+	return nil
+}
+
+// applyTo replaces the portfolio's cash and holdings with the replayed ones, keeping existing asset rows
+func (r *holdingsReplay) applyTo(portfolio *models.ManualPortfolio) {
+	portfolio.TotalCash = r.cash
+	for _, asset := range portfolio.Assets {
+		if _, ok := r.positions[asset.Symbol]; !ok {
+			asset.SharesOwned, asset.TotalInvested, asset.AvgBuyPrice = decimal.Zero, decimal.Zero, decimal.Zero
+		}
+	}
+	symbols := make([]string, 0, len(r.positions))
+	for symbol := range r.positions {
+		symbols = append(symbols, symbol)
+	}
+	sort.Strings(symbols)
+	for _, symbol := range symbols {
+		position := r.positions[symbol]
+		asset := findManualAsset(portfolio, symbol)
+		if asset == nil {
+			asset = &models.ManualPortfolioAsset{
+				ManualPortfolioID:     portfolio.ID,
+				ManualPortfolioUserID: portfolio.UserID,
+				Symbol:                symbol,
+				Name:                  position.name,
+				Currency:              commons.SymbolCurrency(symbol),
+			}
+			portfolio.Assets = append(portfolio.Assets, asset)
+		}
+		asset.SharesOwned = position.shares
+		asset.TotalInvested = position.invested
+		asset.AvgBuyPrice, asset.AvgFxRate = decimal.Zero, decimal.One
+		if position.shares.IsPositive() {
+			asset.AvgBuyPrice = commons.RoundPrice(position.cost.Div(position.shares))
+		}
+		if position.cost.IsPositive() {
+			asset.AvgFxRate = position.invested.Div(position.cost)
+		}
+	}
+}
+
+// transactionFxRate is the rate from the asset currency to the portfolio currency the trade was made at
+func transactionFxRate(transaction *models.ManualPortfolioTransaction) decimal.Decimal {
+	if transaction.FxRate == nil || !transaction.FxRate.IsPositive() {
+		return decimal.One // recorded before trades had a rate
+	}
+	return *transaction.FxRate
+}
@@ -0,0 +1,316 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KZY20112001/infinivest-backend/internal/commons/decimal"
+	"github.com/KZY20112001/infinivest-backend/internal/models"
+)
+
+func TestParseImportRows(t *testing.T) {
+	type wantRow struct {
+		status string
+		date   string
+		kind   string
+		symbol string
+		shares string
+		price  string
+		amount string
+	}
+
+	tests := []struct {
+		name   string
+		preset string
+		csv    string
+		want   []wantRow
+	}{
+		{
+			name:   "generic",
+			preset: "generic",
+			csv: `Account statement
+date,type,symbol,name,shares,price,amount,fee
+2024-01-02,deposit,,,,,"$1,000.00",
+2024-01-03,buy,vti,Vanguard,2,100,,1
+2024-01-04,sell,VTI,,1,,120,0.5
+2024-01-05,dividend,,,,,(5),
+2024-01-06 10:30,withdrawal,,,,,20,
+,,,,,,,
+Total,,,,,,1095,`,
+			want: []wantRow{
+				{status: "valid", date: "2024-01-02", kind: "deposit", amount: "1000"},
+				{status: "valid", date: "2024-01-03", kind: "buy", symbol: "VTI", shares: "2", price: "100", amount: "201"},
+				{status: "valid", date: "2024-01-04", kind: "sell", symbol: "VTI", shares: "1", price: "120", amount: "119.5"},
+				{status: "valid", date: "2024-01-05", kind: "dividend", amount: "5"},
+				{status: "valid", date: "2024-01-06", kind: "withdrawal", amount: "20"},
+			},
+		},
+		{
+			name:   "invalid rows",
+			preset: "generic",
+			csv: `date,type,symbol,name,shares,price,amount,fee
+2024-13-01,buy,VTI,,1,1,,
+2024-01-02,split,VTI,,2,,,
+2024-01-03,buy,,,1,1,,
+2024-01-04,buy,VTI,,0,1,,
+2024-01-05,sell,VTI,,1,,,
+2024-01-06,deposit,,,,,1/2,
+2024-01-07,deposit,,,,,0,`,
+			want: []wantRow{
+				{status: "error", kind: "buy"},
+				{status: "error", date: "2024-01-02", kind: "split"},
+				{status: "error", date: "2024-01-03", kind: "buy"},
+				{status: "error", date: "2024-01-04", kind: "buy"},
+				{status: "error", date: "2024-01-05", kind: "sell"},
+				{status: "error", date: "2024-01-06", kind: "deposit"},
+				{status: "error", date: "2024-01-07", kind: "deposit"},
+			},
+		},
+		{
+			name:   "schwab",
+			preset: "schwab",
+			csv: `"Transactions for account XXXX-1234"
+"Date","Action","Symbol","Description","Quantity","Price","Fees & Comm","Amount"
+"01/15/2024 as of 01/12/2024","Journal","","","","","","-$50.00"
+"01/16/2024","Reinvest Shares","VTI","VANGUARD TOTAL","0.5","$210.00","","-$105.00"
+"01/17/2024","MoneyLink Transfer","","","","","","$500.00"`,
+			want: []wantRow{
+				{status: "valid", date: "2024-01-15", kind: "withdrawal", amount: "50"},
+				{status: "valid", date: "2024-01-16", kind: "buy", symbol: "VTI", shares: "0.5", price: "210", amount: "105"},
+				{status: "valid", date: "2024-01-17", kind: "deposit", amount: "500"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, err := parseImportRows(strings.NewReader(tt.csv), importPresets[tt.preset], "USD")
+			if err != nil {
+				t.Fatalf("parseImportRows() error = %v", err)
+			}
+			if len(rows) != len(tt.want) {
+				t.Fatalf("got %d rows, want %d", len(rows), len(tt.want))
+			}
+			for i, row := range rows {
+				want, report := tt.want[i], row.report
+				if report.Status != want.status || report.Type != want.kind {
+					t.Errorf("row %d is %s %s (%s), want %s %s", i, report.Status, report.Type, report.Error, want.status, want.kind)
+				}
+				if want.status == "error" {
+					if report.Error == "" {
+						t.Errorf("row %d has no error message", i)
+					}
+					if want.date != "" && report.Date != want.date {
+						t.Errorf("row %d date = %s, want %s", i, report.Date, want.date)
+					}
+					continue
+				}
+				if report.Date != want.date || report.Symbol != want.symbol || report.Amount.String() != want.amount {
+					t.Errorf("row %d = %s %s %s, want %s %s %s", i, report.Date, report.Symbol, report.Amount, want.date, want.symbol, want.amount)
+				}
+				if want.shares != "" && (report.Shares.String() != want.shares || report.Price.String() != want.price) {
+					t.Errorf("row %d = %s at %s, want %s at %s", i, report.Shares, report.Price, want.shares, want.price)
+				}
+				if row.transaction == nil || row.transaction.ImportKey == nil {
+					t.Errorf("valid row %d has no import key", i)
+				}
+			}
+		})
+	}
+}
+
+func TestParseImportRowsMissingHeader(t *testing.T) {
+	if _, err := parseImportRows(strings.NewReader("a,b,c\n1,2,3\n"), importPresets["generic"], "USD"); err == nil {
+		t.Errorf("parseImportRows() error = nil, want a missing header error")
+	}
+}
+
+func TestParseImportRowsImportKeys(t *testing.T) {
+	statement := `date,type,symbol,name,shares,price,amount,fee
+2024-01-03,buy,VTI,,2,100,,
+2024-01-03,buy,VTI,,2,100,,
+2024-01-03,buy,VTI,,2,100.00,,`
+	first, err := parseImportRows(strings.NewReader(statement), importPresets["generic"], "USD")
+	if err != nil {
+		t.Fatalf("parseImportRows() error = %v", err)
+	}
+	again, err := parseImportRows(strings.NewReader(statement), importPresets["generic"], "USD")
+	if err != nil {
+		t.Fatalf("parseImportRows() error = %v", err)
+	}
+
+	seen := make(map[string]bool)
+	for i, row := range first {
+		key := *row.transaction.ImportKey
+		if seen[key] {
+			t.Errorf("row %d repeats an import key: identical trades in one statement must stay distinct", i)
+		}
+		seen[key] = true
+		if *again[i].transaction.ImportKey != key {
+			t.Errorf("row %d has a different import key on a second import", i)
+		}
+	}
+}
+
+func importTransaction(kind, date string, symbol string, shares, amount string) *models.ManualPortfolioTransaction {
+	transaction := &models.ManualPortfolioTransaction{TransactionType: kind, TotalAmount: decimal.MustParse(amount)}
+	transaction.CreatedAt, _ = time.Parse("2006-01-02", date)
+	if symbol != "" {
+		sharesAmount := decimal.MustParse(shares)
+		transaction.Symbol = &symbol
+		transaction.SharesAmount = &sharesAmount
+	}
+	return transaction
+}
+
+func TestReplayManualTransactions(t *testing.T) {
+	importRow := func(transaction *models.ManualPortfolioTransaction) *importedRow {
+		row := &importedRow{transaction: transaction}
+		row.report.Status = "valid"
+		return row
+	}
+
+	tests := []struct {
+		name           string
+		history        []*models.ManualPortfolioTransaction
+		rows           []*importedRow
+		wantCash       string
+		wantShares     string
+		wantInvested   string
+		reservedCash   string
+		reservedShares string
+		wantStatuses   []string
+	}{
+		{
+			name:         "imported buy funded by recorded deposit",
+			history:      []*models.ManualPortfolioTransaction{importTransaction("deposit", "2024-01-01", "", "", "1000")},
+			rows:         []*importedRow{importRow(importTransaction("buy", "2024-01-02", "VTI", "2", "201"))},
+			wantCash:     "799",
+			wantShares:   "2",
+			wantInvested: "201",
+			wantStatuses: []string{"valid"},
+		},
+		{
+			name: "rows are replayed in date order",
+			rows: []*importedRow{
+				importRow(importTransaction("buy", "2024-01-02", "VTI", "4", "400")),
+				importRow(importTransaction("deposit", "2024-01-01", "", "", "500")),
+				importRow(importTransaction("sell", "2024-01-03", "VTI", "1", "120")),
+			},
+			wantCash:     "220",
+			wantShares:   "3",
+			wantInvested: "300",
+			wantStatuses: []string{"valid", "valid", "valid"},
+		},
+		{
+			name:         "imported buy overdrawing cash is rejected",
+			history:      []*models.ManualPortfolioTransaction{importTransaction("deposit", "2024-01-01", "", "", "100")},
+			rows:         []*importedRow{importRow(importTransaction("buy", "2024-01-02", "VTI", "2", "201"))},
+			wantCash:     "100",
+			wantShares:   "0",
+			wantInvested: "0",
+			wantStatuses: []string{"error"},
+		},
+		{
+			name:    "imported sell of shares not held is rejected",
+			history: []*models.ManualPortfolioTransaction{importTransaction("deposit", "2024-01-01", "", "", "1000"), importTransaction("buy", "2024-01-02", "VTI", "1", "100")},
+			rows: []*importedRow{
+				importRow(importTransaction("sell", "2024-01-03", "VTI", "2", "240")),
+				importRow(importTransaction("withdrawal", "2024-01-04", "", "", "2000")),
+			},
+			wantCash:     "900",
+			wantShares:   "1",
+			wantInvested: "100",
+			wantStatuses: []string{"error", "error"},
+		},
+		{
+			name:    "withdrawal into cash reserved by open orders is rejected",
+			history: []*models.ManualPortfolioTransaction{importTransaction("deposit", "2024-01-01", "", "", "1000")},
+			rows: []*importedRow{
+				importRow(importTransaction("withdrawal", "2024-01-02", "", "", "300")),
+				importRow(importTransaction("withdrawal", "2024-01-03", "", "", "300")),
+			},
+			reservedCash: "500",
+			wantCash:     "700",
+			wantShares:   "0",
+			wantInvested: "0",
+			wantStatuses: []string{"valid", "error"},
+		},
+		{
+			name: "back-dated withdrawal covered by a later deposit",
+			history: []*models.ManualPortfolioTransaction{
+				importTransaction("deposit", "2024-01-01", "", "", "1000"),
+				importTransaction("deposit", "2024-01-05", "", "", "1000"),
+			},
+			rows:         []*importedRow{importRow(importTransaction("withdrawal", "2024-01-02", "", "", "600"))},
+			reservedCash: "500",
+			wantCash:     "1400",
+			wantShares:   "0",
+			wantInvested: "0",
+			wantStatuses: []string{"valid"},
+		},
+		{
+			name: "back-dated withdrawal before a recorded buy is rejected",
+			history: []*models.ManualPortfolioTransaction{
+				importTransaction("deposit", "2024-01-01", "", "", "1000"),
+				importTransaction("buy", "2024-01-03", "VTI", "3", "300"),
+			},
+			rows:         []*importedRow{importRow(importTransaction("withdrawal", "2024-01-02", "", "", "300"))},
+			reservedCash: "500",
+			wantCash:     "700",
+			wantShares:   "3",
+			wantInvested: "300",
+			wantStatuses: []string{"error"},
+		},
+		{
+			name: "sell of shares reserved by open orders is rejected",
+			history: []*models.ManualPortfolioTransaction{
+				importTransaction("deposit", "2024-01-01", "", "", "1000"),
+				importTransaction("buy", "2024-01-02", "VTI", "3", "300"),
+			},
+			rows:           []*importedRow{importRow(importTransaction("sell", "2024-01-03", "VTI", "2", "240"))},
+			reservedShares: "2",
+			wantCash:       "700",
+			wantShares:     "3",
+			wantInvested:   "300",
+			wantStatuses:   []string{"error"},
+		},
+		{
+			name: "recorded history is applied even when incomplete",
+			history: []*models.ManualPortfolioTransaction{
+				importTransaction("transfer:in", "2024-01-01", "VTI", "1", "100"),
+				importTransaction("sell", "2024-01-02", "VTI", "3", "130"),
+			},
+			wantCash:     "130",
+			wantShares:   "0",
+			wantInvested: "0",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			portfolio := &models.ManualPortfolio{Currency: "USD", ReservedCash: decimal.Zero}
+			if tt.reservedCash != "" {
+				portfolio.ReservedCash = decimal.MustParse(tt.reservedCash)
+			}
+			if tt.reservedShares != "" {
+				portfolio.Assets = []*models.ManualPortfolioAsset{{Symbol: "VTI", SharesReserved: decimal.MustParse(tt.reservedShares)}}
+			}
+			replay := replayManualTransactions(tt.history, tt.rows, portfolio)
+			if replay.cash.String() != tt.wantCash {
+				t.Errorf("cash = %s, want %s", replay.cash, tt.wantCash)
+			}
+			shares, invested := decimal.Zero, decimal.Zero
+			if position, ok := replay.positions["VTI"]; ok {
+				shares, invested = position.shares, position.invested
+			}
+			if shares.String() != tt.wantShares || invested.String() != tt.wantInvested {
+				t.Errorf("VTI = %s shares, %s invested, want %s, %s", shares, invested, tt.wantShares, tt.wantInvested)
+			}
+			for i, row := range tt.rows {
+				if row.report.Status != tt.wantStatuses[i] {
+					t.Errorf("row %d status = %s (%s), want %s", i, row.report.Status, row.report.Error, tt.wantStatuses[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,555 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/KZY20112001/infinivest-backend/internal/commons"
+	"github.com/KZY20112001/infinivest-backend/internal/commons/decimal"
+	"github.com/KZY20112001/infinivest-backend/internal/dto"
+	"github.com/KZY20112001/infinivest-backend/internal/models"
+	"github.com/KZY20112001/infinivest-backend/internal/repositories"
+)
+
+func (s *manualPortfolioServiceImpl) PlaceOrder(userID uint, portfolioName string, req dto.PlaceOrderRequest) (*models.Order, error) {
+	portfolio, err := s.repo.GetManualPortfolio(userID, portfolioName)
+	if err != nil {
+		return nil, err
+	}
+	if req.TimeInForce == "" {
+		req.TimeInForce = "gtc"
+	}
+	if err := validateOrderRequest(req); err != nil {
+		return nil, err
+	}
+	price, err := s.genAiService.GetLatestAssetPrice(req.Symbol)
+	if err != nil {
+		return nil, err
+	}
+	fxRate, err := s.assetFxRate(portfolio, req.Symbol)
+	if err != nil {
+		return nil, err
+	}
+
+	order := &models.Order{
+		UserID:            userID,
+		ManualPortfolioID: portfolio.ID,
+		Symbol:            req.Symbol,
+		Name:              req.Name,
+		Side:              req.Side,
+		OrderType:         req.OrderType,
+		TimeInForce:       req.TimeInForce,
+		Shares:            commons.RoundShares(req.SharesAmount),
+		LimitPrice:        req.LimitPrice,
+		StopPrice:         req.StopPrice,
+		TrailAmount:       req.TrailAmount,
+		TrailPercent:      req.TrailPercent,
+		FxRate:            fxRate,
+		Status:            "pending",
+	}
+	if req.OrderType == "trailing-stop" {
+		order.ReferencePrice = &price
+		stop := trailingStopPrice(order, price)
+		order.StopPrice = &stop
+	}
+	if req.TimeInForce == "day" {
+		now := time.Now()
+		endOfDay := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, now.Location())
+		order.ExpiresAt = &endOfDay
+	}
+
+	// reserve what the order needs so it cannot be spent or sold elsewhere while it is open. The free cash and
+	// shares are checked on the locked portfolio, since fills and other orders may have used them since it was read.
+	var rejection string
+	err = s.repo.InTransaction(func(repo repositories.ManualPortfolioRepo) error {
+		portfolio, err := repo.LockManualPortfolio(userID, portfolio.ID)
+		if err != nil {
+			return err
+		}
+		if order.Side == "buy" {
+			required := commons.RoundCash(order.Shares.Mul(orderReservePrice(order)), portfolio.Currency)
+			if required.GreaterThan(portfolio.TotalCash.Sub(portfolio.ReservedCash)) {
+				rejection = fmt.Sprintf("insufficient funds to reserve %s for the order", required)
+				return nil
+			}
+		} else {
+			asset := findManualAsset(portfolio, order.Symbol)
+			if asset == nil {
+				rejection = "asset not found in portfolio"
+				return nil
+			}
+			if asset.SharesOwned.Sub(asset.SharesReserved).LessThan(order.Shares) {
+				rejection = "insufficient shares to sell"
+				return nil
+			}
+			order.Name = asset.Name
+		}
+		reserveOrder(portfolio, order)
+
+		if err := repo.UpdateManualPortfolio(portfolio); err != nil {
+			return err
+		}
+		return repo.CreateOrder(order)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if rejection != "" {
+		return nil, s.rejectOrder(order, rejection)
+	}
+	return order, nil
+}
+
+func (s *manualPortfolioServiceImpl) GetOrders(userID uint, portfolioName, status string) ([]*models.Order, error) {
+	portfolio, err := s.repo.GetManualPortfolio(userID, portfolioName)
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.GetOrders(userID, portfolio.ID, status)
+}
+
+func (s *manualPortfolioServiceImpl) GetOrder(userID, orderID uint) (*models.Order, error) {
+	return s.repo.GetOrder(userID, orderID)
+}
+
+func (s *manualPortfolioServiceImpl) CancelOrder(ctx context.Context, userID, orderID uint) (*models.Order, error) {
+	order, err := s.repo.GetOrder(userID, orderID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.closeOrder(ctx, order, "cancelled", "cancelled by user"); err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+// ProcessOpenOrders cancels day orders that are past their end of day and fills the orders whose
+// condition is met by the latest price
+func (s *manualPortfolioServiceImpl) ProcessOpenOrders(ctx context.Context) {
+	orders, err := s.repo.GetOpenOrders()
+	if err != nil {
+		log.Println("Failed to get open orders:", err)
+		return
+	}
+	prices := make(map[string]decimal.Decimal)
+	for _, order := range orders {
+		if ctx.Err() != nil {
+			return
+		}
+		if order.ExpiresAt != nil && time.Now().After(*order.ExpiresAt) {
+			if err := s.closeOrder(ctx, order, "cancelled", "expired at the end of the day"); err != nil {
+				log.Printf("Failed to expire order %d: %v\n", order.ID, err)
+			}
+			continue
+		}
+
+		price, exists := prices[order.Symbol]
+		if !exists {
+			if price, err = s.genAiService.GetLatestAssetPrice(order.Symbol); err != nil {
+				log.Printf("Failed to get price of %s for order %d: %v\n", order.Symbol, order.ID, err)
+				continue
+			}
+			prices[order.Symbol] = price
+		}
+
+		fill, changed := evaluateOrder(order, price)
+		if fill {
+			if err := s.fillOrder(ctx, order.ID, price); err != nil {
+				log.Printf("Failed to fill order %d: %v\n", order.ID, err)
+			}
+		} else if changed {
+			if err := s.updateOrderTrigger(order); err != nil {
+				log.Printf("Failed to update order %d: %v\n", order.ID, err)
+			}
+		}
+	}
+}
+
+// fillOrder fills as much of a triggered order as the portfolio can cover. A buy that cannot be paid in full
+// buys what the free cash allows and the rest of the order is cancelled, since nothing is left to reserve for it;
+// one that cannot buy anything is rejected. The order and its portfolio are locked and the order is read again, so one that was cancelled since the
+// open orders were loaded is left alone.
+func (s *manualPortfolioServiceImpl) fillOrder(ctx context.Context, orderID uint, price decimal.Decimal) error {
+	var order *models.Order
+	var portfolio *models.ManualPortfolio
+	var message string
+	err := s.repo.InTransaction(func(repo repositories.ManualPortfolioRepo) error {
+		var err error
+		if order, err = repo.LockOrder(orderID); err != nil {
+			return err
+		}
+		if !slices.Contains(commons.OpenOrderStatuses, order.Status) {
+			return nil
+		}
+		if portfolio, err = repo.LockManualPortfolio(order.UserID, order.ManualPortfolioID); err != nil {
+			return err
+		}
+		fxRate, err := s.assetFxRate(portfolio, order.Symbol)
+		if err != nil {
+			return err
+		}
+		releaseOrderReservation(portfolio, order)
+
+		shares := order.Shares.Sub(order.FilledShares)
+		if order.Side == "buy" {
+			if cost := price.Mul(fxRate); cost.IsPositive() {
+				affordable := commons.RoundShares(portfolio.TotalCash.Sub(portfolio.ReservedCash).Div(cost))
+				shares = decimal.Min(shares, affordable)
+			}
+		} else if asset := findManualAsset(portfolio, order.Symbol); asset != nil {
+			shares = decimal.Min(shares, asset.SharesOwned.Sub(asset.SharesReserved))
+		} else {
+			shares = decimal.Zero
+		}
+
+		reason := "insufficient shares to sell"
+		if order.Side == "buy" {
+			reason = fmt.Sprintf("insufficient funds to buy at %s", price)
+		}
+		if !shares.IsPositive() {
+			status := "rejected"
+			if order.FilledShares.IsPositive() {
+				status = "cancelled" // left partially filled before the rest was cancelled straight away
+			}
+			message = orderClosedMessage(portfolio, order, status, reason)
+			return finishOrder(repo, portfolio, order, status, reason)
+		}
+
+		remaining := order.Shares.Sub(order.FilledShares)
+		if err := executeFill(repo, portfolio, order, shares, price, fxRate); err != nil {
+			return err
+		}
+		message = fmt.Sprintf("Your %s %s order for %s in %s filled %s of %s shares at %s",
+			order.OrderType, order.Side, order.Symbol, portfolio.Name, order.FilledShares, order.Shares, price)
+		if shares.LessThan(remaining) {
+			unfilled := order.Shares.Sub(order.FilledShares)
+			releaseOrderReservation(portfolio, order)
+			if err := finishOrder(repo, portfolio, order, "cancelled", reason); err != nil {
+				return err
+			}
+			message = fmt.Sprintf("%s, the remaining %s shares were cancelled: %s", message, unfilled, reason)
+		}
+		return nil
+	})
+	if err != nil || message == "" {
+		return err
+	}
+	s.notifyOrder(ctx, order, message)
+	return nil
+}
+
+// updateOrderTrigger saves a moved trailing stop or a triggered stop-limit, unless the order was closed since
+// it was loaded
+func (s *manualPortfolioServiceImpl) updateOrderTrigger(order *models.Order) error {
+	return s.repo.InTransaction(func(repo repositories.ManualPortfolioRepo) error {
+		locked, err := repo.LockOrder(order.ID)
+		if err != nil {
+			return err
+		}
+		if !slices.Contains(commons.OpenOrderStatuses, locked.Status) {
+			return nil
+		}
+		locked.ReferencePrice = order.ReferencePrice
+		locked.StopPrice = order.StopPrice
+		locked.StopTriggered = order.StopTriggered
+		return repo.UpdateOrder(locked)
+	})
+}
+
+// executeFill trades the shares at the price, records the transaction and the fill and updates the order.
+// The order's reservation must already be released; what remains unfilled is reserved again. Callers run it
+// inside InTransaction so the portfolio, the order, the transaction and the fill are saved together.
+func executeFill(repo repositories.ManualPortfolioRepo, portfolio *models.ManualPortfolio, order *models.Order, shares, price, fxRate decimal.Decimal) error {
+	name := order.Name
+	var cash decimal.Decimal
+	if order.Side == "buy" {
+		cash = commons.RoundCash(price.Mul(shares).Mul(fxRate), portfolio.Currency)
+		buyManualAsset(portfolio, order.Name, order.Symbol, shares, price, fxRate)
+	} else {
+		asset := findManualAsset(portfolio, order.Symbol)
+		cash = sellManualAsset(portfolio, asset, shares, price, fxRate)
+		name = asset.Name
+	}
+
+	amount := commons.RoundCash(shares.Mul(price), manualAssetCurrency(portfolio, order.Symbol))
+	filled := order.FilledShares.Add(shares)
+	order.AverageFillPrice = commons.RoundPrice(order.AverageFillPrice.Mul(order.FilledShares).Add(shares.Mul(price)).Div(filled))
+	order.FilledShares = filled
+	order.FxRate = fxRate
+	if !order.Shares.GreaterThan(order.FilledShares) {
+		now := time.Now()
+		order.Status = "filled"
+		order.FilledAt = &now
+	} else {
+		order.Status = "partially-filled"
+		reserveOrder(portfolio, order)
+	}
+
+	if err := repo.UpdateManualPortfolio(portfolio); err != nil {
+		return err
+	}
+	if order.ID == 0 {
+		if err := repo.CreateOrder(order); err != nil {
+			return err
+		}
+	} else if err := repo.UpdateOrder(order); err != nil {
+		return err
+	}
+
+	transaction := &models.ManualPortfolioTransaction{
+		ManualPortfolioUserID: order.UserID,
+		ManualPortfolioID:     portfolio.ID,
+		TransactionType:       order.Side,
+		TotalAmount:           cash,
+
+		Symbol:       &order.Symbol,
+		Name:         &name,
+		Price:        &price,
+		SharesAmount: &shares,
+		OrderID:      &order.ID,
+		FxRate:       &fxRate,
+	}
+	if err := repo.CreateManualPortfolioTransaction(transaction); err != nil {
+		return err
+	}
+	fill := &models.OrderFill{
+		OrderID:       order.ID,
+		TransactionID: transaction.ID,
+		Shares:        shares,
+		Price:         price,
+		Amount:        amount,
+	}
+	if err := repo.CreateOrderFill(fill); err != nil {
+		return err
+	}
+	order.Fills = append(order.Fills, fill)
+	return nil
+}
+
+// rejectOrder records an order that could not be accepted and returns the reason as an error
+func (s *manualPortfolioServiceImpl) rejectOrder(order *models.Order, reason string) error {
+	order.Status = "rejected"
+	order.StatusReason = reason
+	if err := s.repo.CreateOrder(order); err != nil {
+		return err
+	}
+	return errors.New(reason)
+}
+
+// closeOrder ends an open order without filling the rest and returns its reservation to the portfolio. The order
+// is locked and read again, so it cannot be closed twice or filled at the same time.
+func (s *manualPortfolioServiceImpl) closeOrder(ctx context.Context, order *models.Order, status, reason string) error {
+	var portfolio *models.ManualPortfolio
+	err := s.repo.InTransaction(func(repo repositories.ManualPortfolioRepo) error {
+		locked, err := repo.LockOrder(order.ID)
+		if err != nil {
+			return err
+		}
+		if !slices.Contains(commons.OpenOrderStatuses, locked.Status) {
+			return fmt.Errorf("order %d is %s and can no longer be cancelled", locked.ID, locked.Status)
+		}
+		if portfolio, err = repo.LockManualPortfolio(locked.UserID, locked.ManualPortfolioID); err != nil {
+			return err
+		}
+		releaseOrderReservation(portfolio, locked)
+		if err := finishOrder(repo, portfolio, locked, status, reason); err != nil {
+			return err
+		}
+		locked.Fills = order.Fills
+		*order = *locked
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	s.notifyOrder(ctx, order, orderClosedMessage(portfolio, order, status, reason))
+	return nil
+}
+
+// finishOrder saves an order whose reservation was released in its final status
+func finishOrder(repo repositories.ManualPortfolioRepo, portfolio *models.ManualPortfolio, order *models.Order, status, reason string) error {
+	if err := repo.UpdateManualPortfolio(portfolio); err != nil {
+		return err
+	}
+	order.Status = status
+	order.StatusReason = reason
+	return repo.UpdateOrder(order)
+}
+
+func orderClosedMessage(portfolio *models.ManualPortfolio, order *models.Order, status, reason string) string {
+	return fmt.Sprintf("Your %s %s order for %s in %s was %s: %s", order.OrderType, order.Side, order.Symbol, portfolio.Name, status, reason)
+}
+
+// notifyOrder is called once the order change is committed
+func (s *manualPortfolioServiceImpl) notifyOrder(ctx context.Context, order *models.Order, message string) {
+	if err := s.notificationService.AddNotification(ctx, order.UserID, "order", message); err != nil {
+		log.Printf("Error adding order notification for user %d: %v\n", order.UserID, err)
+	}
+}
+
+func newMarketOrder(portfolio *models.ManualPortfolio, side, name, symbol string, shares decimal.Decimal) *models.Order {
+	return &models.Order{
+		UserID:            portfolio.UserID,
+		ManualPortfolioID: portfolio.ID,
+		Symbol:            symbol,
+		Name:              name,
+		Side:              side,
+		OrderType:         "market",
+		Shares:            shares,
+		Status:            "pending",
+	}
+}
+
+func validateOrderRequest(req dto.PlaceOrderRequest) error {
+	if req.Symbol == "" {
+		return fmt.Errorf("symbol is required")
+	}
+	if !commons.RoundShares(req.SharesAmount).IsPositive() {
+		return fmt.Errorf("shares amount must be positive")
+	}
+	if !commons.OrderSides[req.Side] {
+		return fmt.Errorf("invalid order side: %s", req.Side)
+	}
+	if !commons.OrderTypes[req.OrderType] {
+		return fmt.Errorf("invalid order type: %s", req.OrderType)
+	}
+	if !commons.OrderTimesInForce[req.TimeInForce] {
+		return fmt.Errorf("invalid time in force: %s", req.TimeInForce)
+	}
+	positive := func(value *decimal.Decimal) bool { return value != nil && value.IsPositive() }
+	positivePercent := func(value *float64) bool { return value != nil && *value > 0 }
+
+	switch req.OrderType {
+	case "limit":
+		if !positive(req.LimitPrice) {
+			return fmt.Errorf("limit orders need a positive limit price")
+		}
+	case "stop":
+		if !positive(req.StopPrice) {
+			return fmt.Errorf("stop orders need a positive stop price")
+		}
+	case "stop-limit":
+		if !positive(req.StopPrice) || !positive(req.LimitPrice) {
+			return fmt.Errorf("stop-limit orders need positive stop and limit prices")
+		}
+	case "trailing-stop":
+		if positive(req.TrailAmount) == positivePercent(req.TrailPercent) {
+			return fmt.Errorf("trailing-stop orders need either a trail amount or a trail percent")
+		}
+		if positivePercent(req.TrailPercent) && *req.TrailPercent >= 100 {
+			return fmt.Errorf("trail percent must be below 100")
+		}
+	}
+	return nil
+}
+
+// evaluateOrder checks the order against the latest price. It reports whether the order should fill now and
+// whether its trailing stop or stop-limit trigger changed and needs to be saved.
+func evaluateOrder(order *models.Order, price decimal.Decimal) (bool, bool) {
+	buy := order.Side == "buy"
+	stopReached := func(stop decimal.Decimal) bool {
+		if buy {
+			return price.GreaterThanOrEqual(stop)
+		}
+		return price.LessThanOrEqual(stop)
+	}
+	limitReached := func(limit decimal.Decimal) bool {
+		if buy {
+			return price.LessThanOrEqual(limit)
+		}
+		return price.GreaterThanOrEqual(limit)
+	}
+
+	switch order.OrderType {
+	case "limit":
+		return limitReached(*order.LimitPrice), false
+	case "stop":
+		return stopReached(*order.StopPrice), false
+	case "stop-limit":
+		changed := false
+		if !order.StopTriggered && stopReached(*order.StopPrice) {
+			order.StopTriggered = true
+			changed = true
+		}
+		return order.StopTriggered && limitReached(*order.LimitPrice), changed
+	case "trailing-stop":
+		changed := false
+		if order.ReferencePrice == nil || (buy && price.LessThan(*order.ReferencePrice)) || (!buy && price.GreaterThan(*order.ReferencePrice)) {
+			order.ReferencePrice = &price
+			stop := trailingStopPrice(order, price)
+			order.StopPrice = &stop
+			changed = true
+		}
+		return stopReached(*order.StopPrice), changed
+	}
+	return false, false
+}
+
+// trailingStopPrice trails the reference price: below it for sells, above it for buys
+func trailingStopPrice(order *models.Order, reference decimal.Decimal) decimal.Decimal {
+	trail := decimal.Zero
+	if order.TrailAmount != nil {
+		trail = *order.TrailAmount
+	} else if order.TrailPercent != nil {
+		trail = reference.MulFloat(*order.TrailPercent / 100)
+	}
+	if order.Side == "buy" {
+		return commons.RoundPrice(reference.Add(trail))
+	}
+	return commons.RoundPrice(decimal.Max(reference.Sub(trail), decimal.Zero))
+}
+
+// orderReservePrice is the highest price per share a buy order is expected to pay, in the portfolio currency
+func orderReservePrice(order *models.Order) decimal.Decimal {
+	fxRate := order.FxRate
+	if !fxRate.IsPositive() {
+		fxRate = decimal.One // placed before orders recorded a rate
+	}
+	switch order.OrderType {
+	case "market":
+		return decimal.Zero // market orders fill straight away
+	case "limit", "stop-limit":
+		return order.LimitPrice.Mul(fxRate)
+	default:
+		return order.StopPrice.MulFloat(1 + commons.StopOrderReserveBuffer).Mul(fxRate)
+	}
+}
+
+// reserveOrder holds cash or shares for the unfilled part of the order. Buys reserve at most the free cash.
+func reserveOrder(portfolio *models.ManualPortfolio, order *models.Order) {
+	remaining := order.Shares.Sub(order.FilledShares)
+	if order.Side == "buy" {
+		required := commons.RoundCash(remaining.Mul(orderReservePrice(order)), portfolio.Currency)
+		free := decimal.Max(portfolio.TotalCash.Sub(portfolio.ReservedCash), decimal.Zero)
+		order.ReservedCash = decimal.Min(required, free)
+		portfolio.ReservedCash = portfolio.ReservedCash.Add(order.ReservedCash)
+		return
+	}
+	if asset := findManualAsset(portfolio, order.Symbol); asset != nil {
+		asset.SharesReserved = asset.SharesReserved.Add(remaining)
+	}
+}
+
+func releaseOrderReservation(portfolio *models.ManualPortfolio, order *models.Order) {
+	if order.Side == "buy" {
+		portfolio.ReservedCash = decimal.Max(portfolio.ReservedCash.Sub(order.ReservedCash), decimal.Zero)
+		order.ReservedCash = decimal.Zero
+		return
+	}
+	if asset := findManualAsset(portfolio, order.Symbol); asset != nil {
+		asset.SharesReserved = decimal.Max(asset.SharesReserved.Sub(order.Shares.Sub(order.FilledShares)), decimal.Zero)
+	}
+}
+
+func findManualAsset(portfolio *models.ManualPortfolio, symbol string) *models.ManualPortfolioAsset {
+	for _, asset := range portfolio.Assets {
+		if asset.Symbol == symbol {
+			return asset
+		}
+	}
+	return nil
+}
@@ -0,0 +1,208 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/KZY20112001/infinivest-backend/internal/commons/decimal"
+	"github.com/KZY20112001/infinivest-backend/internal/models"
+)
+
+func decimalPtr(value string) *decimal.Decimal {
+	d := decimal.MustParse(value)
+	return &d
+}
+
+func TestEvaluateOrder(t *testing.T) {
+	tenPercent := 10.0
+
+	tests := []struct {
+		name          string
+		order         models.Order
+		price         string
+		wantFill      bool
+		wantChanged   bool
+		wantStop      string
+		wantTriggered bool
+	}{
+		{name: "buy limit at a lower price", order: models.Order{Side: "buy", OrderType: "limit", LimitPrice: decimalPtr("100")}, price: "99", wantFill: true},
+		{name: "buy limit above the limit", order: models.Order{Side: "buy", OrderType: "limit", LimitPrice: decimalPtr("100")}, price: "101"},
+		{name: "sell limit at the limit", order: models.Order{Side: "sell", OrderType: "limit", LimitPrice: decimalPtr("100")}, price: "100", wantFill: true},
+		{name: "buy stop above the stop", order: models.Order{Side: "buy", OrderType: "stop", StopPrice: decimalPtr("100")}, price: "101", wantFill: true, wantStop: "100"},
+		{name: "sell stop above the stop", order: models.Order{Side: "sell", OrderType: "stop", StopPrice: decimalPtr("100")}, price: "101", wantStop: "100"},
+		{
+			name:  "stop-limit not yet triggered",
+			order: models.Order{Side: "sell", OrderType: "stop-limit", StopPrice: decimalPtr("95"), LimitPrice: decimalPtr("94")},
+			price: "96", wantStop: "95",
+		},
+		{
+			name:  "stop-limit triggers and fills",
+			order: models.Order{Side: "sell", OrderType: "stop-limit", StopPrice: decimalPtr("95"), LimitPrice: decimalPtr("94")},
+			price: "95", wantFill: true, wantChanged: true, wantStop: "95", wantTriggered: true,
+		},
+		{
+			name:  "stop-limit triggers past the limit",
+			order: models.Order{Side: "buy", OrderType: "stop-limit", StopPrice: decimalPtr("105"), LimitPrice: decimalPtr("106")},
+			price: "107", wantChanged: true, wantStop: "105", wantTriggered: true,
+		},
+		{
+			name:  "triggered stop-limit fills back within the limit",
+			order: models.Order{Side: "buy", OrderType: "stop-limit", StopPrice: decimalPtr("105"), LimitPrice: decimalPtr("106"), StopTriggered: true},
+			price: "104", wantFill: true, wantStop: "105", wantTriggered: true,
+		},
+		{
+			name:  "trailing stop sets its first reference",
+			order: models.Order{Side: "sell", OrderType: "trailing-stop", TrailAmount: decimalPtr("5")},
+			price: "100", wantChanged: true, wantStop: "95",
+		},
+		{
+			name:  "trailing sell follows a new high",
+			order: models.Order{Side: "sell", OrderType: "trailing-stop", TrailAmount: decimalPtr("5"), ReferencePrice: decimalPtr("100"), StopPrice: decimalPtr("95")},
+			price: "110", wantChanged: true, wantStop: "105",
+		},
+		{
+			name:  "trailing sell holds its stop on a dip",
+			order: models.Order{Side: "sell", OrderType: "trailing-stop", TrailAmount: decimalPtr("5"), ReferencePrice: decimalPtr("100"), StopPrice: decimalPtr("95")},
+			price: "96", wantStop: "95",
+		},
+		{
+			name:  "trailing sell fills at its stop",
+			order: models.Order{Side: "sell", OrderType: "trailing-stop", TrailAmount: decimalPtr("5"), ReferencePrice: decimalPtr("100"), StopPrice: decimalPtr("95")},
+			price: "95", wantFill: true, wantStop: "95",
+		},
+		{
+			name:  "trailing buy follows a new low by percent",
+			order: models.Order{Side: "buy", OrderType: "trailing-stop", TrailPercent: &tenPercent, ReferencePrice: decimalPtr("100"), StopPrice: decimalPtr("110")},
+			price: "90", wantChanged: true, wantStop: "99",
+		},
+		{name: "market orders are not evaluated", order: models.Order{Side: "buy", OrderType: "market"}, price: "100"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order := tt.order
+			fill, changed := evaluateOrder(&order, decimal.MustParse(tt.price))
+			if fill != tt.wantFill || changed != tt.wantChanged {
+				t.Errorf("evaluateOrder() = %v, %v, want %v, %v", fill, changed, tt.wantFill, tt.wantChanged)
+			}
+			if tt.wantStop != "" && (order.StopPrice == nil || order.StopPrice.String() != tt.wantStop) {
+				t.Errorf("StopPrice = %v, want %s", order.StopPrice, tt.wantStop)
+			}
+			if order.StopTriggered != tt.wantTriggered {
+				t.Errorf("StopTriggered = %v, want %v", order.StopTriggered, tt.wantTriggered)
+			}
+		})
+	}
+}
+
+func TestTrailingStopPrice(t *testing.T) {
+	twoAndAHalfPercent := 2.5
+
+	tests := []struct {
+		name      string
+		order     models.Order
+		reference string
+		want      string
+	}{
+		{name: "sell by amount", order: models.Order{Side: "sell", TrailAmount: decimalPtr("5")}, reference: "100", want: "95"},
+		{name: "buy by amount", order: models.Order{Side: "buy", TrailAmount: decimalPtr("5")}, reference: "100", want: "105"},
+		{name: "sell by percent rounds the price", order: models.Order{Side: "sell", TrailPercent: &twoAndAHalfPercent}, reference: "33.3333", want: "32.5"},
+		{name: "buy by percent", order: models.Order{Side: "buy", TrailPercent: &twoAndAHalfPercent}, reference: "40", want: "41"},
+		{name: "sell stop never goes below zero", order: models.Order{Side: "sell", TrailAmount: decimalPtr("5")}, reference: "3", want: "0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := trailingStopPrice(&tt.order, decimal.MustParse(tt.reference)); got.String() != tt.want {
+				t.Errorf("trailingStopPrice() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReserveOrder(t *testing.T) {
+	tests := []struct {
+		name                 string
+		order                models.Order
+		totalCash            string
+		reservedCash         string
+		wantOrderReserved    string
+		wantPortfolioReserve string
+		wantSharesReserved   string
+	}{
+		{
+			name:      "buy limit reserves at the limit",
+			order:     models.Order{Side: "buy", OrderType: "limit", Symbol: "VTI", Shares: decimal.MustParse("10"), LimitPrice: decimalPtr("20")},
+			totalCash: "1000", reservedCash: "0", wantOrderReserved: "200", wantPortfolioReserve: "200", wantSharesReserved: "2",
+		},
+		{
+			name:      "buy stop reserves with a buffer",
+			order:     models.Order{Side: "buy", OrderType: "stop", Symbol: "VTI", Shares: decimal.MustParse("10"), StopPrice: decimalPtr("20")},
+			totalCash: "1000", reservedCash: "0", wantOrderReserved: "210", wantPortfolioReserve: "210", wantSharesReserved: "2",
+		},
+		{
+			name: "partially filled buy reserves the rest",
+			order: models.Order{Side: "buy", OrderType: "limit", Symbol: "VTI", Shares: decimal.MustParse("10"),
+				FilledShares: decimal.MustParse("4"), LimitPrice: decimalPtr("20")},
+			totalCash: "1000", reservedCash: "0", wantOrderReserved: "120", wantPortfolioReserve: "120", wantSharesReserved: "2",
+		},
+		{
+			name: "foreign buy reserves in the portfolio currency",
+			order: models.Order{Side: "buy", OrderType: "stop-limit", Symbol: "VOD.L", Shares: decimal.MustParse("10"),
+				StopPrice: decimalPtr("19"), LimitPrice: decimalPtr("20"), FxRate: decimal.MustParse("1.5")},
+			totalCash: "1000", reservedCash: "0", wantOrderReserved: "300", wantPortfolioReserve: "300", wantSharesReserved: "2",
+		},
+		{
+			name:      "buy reserves at most the free cash",
+			order:     models.Order{Side: "buy", OrderType: "limit", Symbol: "VTI", Shares: decimal.MustParse("10"), LimitPrice: decimalPtr("20")},
+			totalCash: "1000", reservedCash: "900", wantOrderReserved: "100", wantPortfolioReserve: "1000", wantSharesReserved: "2",
+		},
+		{
+			name:      "market buy reserves nothing",
+			order:     models.Order{Side: "buy", OrderType: "market", Symbol: "VTI", Shares: decimal.MustParse("10")},
+			totalCash: "1000", reservedCash: "0", wantOrderReserved: "0", wantPortfolioReserve: "0", wantSharesReserved: "2",
+		},
+		{
+			name:      "sell reserves the unfilled shares",
+			order:     models.Order{Side: "sell", OrderType: "limit", Symbol: "VTI", Shares: decimal.MustParse("10"), FilledShares: decimal.MustParse("3"), LimitPrice: decimalPtr("20")},
+			totalCash: "1000", reservedCash: "0", wantOrderReserved: "0", wantPortfolioReserve: "0", wantSharesReserved: "9",
+		},
+		{
+			name:      "sell of a symbol not held reserves nothing",
+			order:     models.Order{Side: "sell", OrderType: "limit", Symbol: "BND", Shares: decimal.MustParse("10"), LimitPrice: decimalPtr("20")},
+			totalCash: "1000", reservedCash: "0", wantOrderReserved: "0", wantPortfolioReserve: "0", wantSharesReserved: "2",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			asset := &models.ManualPortfolioAsset{Symbol: "VTI", SharesOwned: decimal.MustParse("20"), SharesReserved: decimal.MustParse("2")}
+			portfolio := &models.ManualPortfolio{
+				Currency:     "USD",
+				TotalCash:    decimal.MustParse(tt.totalCash),
+				ReservedCash: decimal.MustParse(tt.reservedCash),
+				Assets:       []*models.ManualPortfolioAsset{asset},
+			}
+			order := tt.order
+
+			reserveOrder(portfolio, &order)
+			if order.ReservedCash.String() != tt.wantOrderReserved {
+				t.Errorf("order ReservedCash = %s, want %s", order.ReservedCash, tt.wantOrderReserved)
+			}
+			if portfolio.ReservedCash.String() != tt.wantPortfolioReserve {
+				t.Errorf("portfolio ReservedCash = %s, want %s", portfolio.ReservedCash, tt.wantPortfolioReserve)
+			}
+			if asset.SharesReserved.String() != tt.wantSharesReserved {
+				t.Errorf("SharesReserved = %s, want %s", asset.SharesReserved, tt.wantSharesReserved)
+			}
+
+			// releasing hands back exactly what was reserved
+			releaseOrderReservation(portfolio, &order)
+			if !order.ReservedCash.IsZero() {
+				t.Errorf("order ReservedCash after release = %s, want 0", order.ReservedCash)
+			}
+			if portfolio.ReservedCash.String() != tt.reservedCash {
+				t.Errorf("portfolio ReservedCash after release = %s, want %s", portfolio.ReservedCash, tt.reservedCash)
+			}
+			if asset.SharesReserved.String() != "2" {
+				t.Errorf("SharesReserved after release = %s, want 2", asset.SharesReserved)
+			}
+		})
+	}
+}
@@ -0,0 +1,299 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/KZY20112001/infinivest-backend/internal/commons"
+	"github.com/KZY20112001/infinivest-backend/internal/commons/decimal"
+	"github.com/KZY20112001/infinivest-backend/internal/dto"
+	"github.com/KZY20112001/infinivest-backend/internal/models"
+	"github.com/KZY20112001/infinivest-backend/internal/repositories"
+)
+
+// target percentages may add up to more than 100 by this much from rounding
+const targetPercentageTolerance = 1e-9
+
+// manualHolding is a symbol that is held or targeted, valued at the latest price in the portfolio currency
+type manualHolding struct {
+	symbol    string
+	name      string
+	available decimal.Decimal // shares not reserved for sell orders
+	price     decimal.Decimal // in the asset currency
+	fxRate    decimal.Decimal // from the asset currency to the portfolio currency
+	value     decimal.Decimal
+	target    float64 // percent of the portfolio
+}
+
+func (s *manualPortfolioServiceImpl) UpdateManualPortfolioTargets(userID uint, portfolioName string, req dto.ManualTargetsRequest) (*models.ManualPortfolio, error) {
+	portfolio, err := s.repo.GetManualPortfolio(userID, portfolioName)
+	if err != nil {
+		return nil, err
+	}
+	threshold := req.Threshold
+	if threshold < 0 || threshold >= 100 {
+		return nil, fmt.Errorf("rebalance threshold must be between 0 and 100 percent")
+	}
+	if threshold == 0 {
+		threshold = commons.DefaultManualRebalanceThreshold
+	}
+
+	total := 0.0
+	seen := make(map[string]bool)
+	targets := make([]*models.ManualPortfolioTarget, 0, len(req.Targets))
+	for _, target := range req.Targets {
+		symbol := strings.ToUpper(strings.TrimSpace(target.Symbol))
+		if symbol == "" {
+			return nil, fmt.Errorf("target symbol is required")
+		}
+		if seen[symbol] {
+			return nil, fmt.Errorf("duplicate target for %s", symbol)
+		}
+		seen[symbol] = true
+		if target.Percentage <= 0 {
+			return nil, fmt.Errorf("target percentage for %s must be positive", symbol)
+		}
+		total += target.Percentage
+
+		name := target.Name
+		if asset := findManualAsset(portfolio, symbol); asset != nil {
+			name = asset.Name
+		} else if _, err := s.genAiService.GetLatestAssetPrice(symbol); err != nil {
+			return nil, fmt.Errorf("failed to get price for %s: %w", symbol, err)
+		}
+		if name == "" {
+			name = symbol
+		}
+		targets = append(targets, &models.ManualPortfolioTarget{Symbol: symbol, Name: name, Percentage: target.Percentage})
+	}
+	if total > 100+targetPercentageTolerance {
+		return nil, fmt.Errorf("target percentages add up to %.2f%%, more than 100%%", total)
+	}
+
+	if err := s.repo.UpdateManualPortfolioTargets(portfolio, targets, threshold); err != nil {
+		return nil, err
+	}
+	portfolio.RebalanceThreshold = threshold
+	return portfolio, nil
+}
+
+func (s *manualPortfolioServiceImpl) GetManualPortfolioDrift(userID uint, portfolioName string) (dto.PortfolioDriftResponse, error) {
+	portfolio, err := s.repo.GetManualPortfolio(userID, portfolioName)
+	if err != nil {
+		return dto.PortfolioDriftResponse{}, err
+	}
+	holdings, totalValue, err := s.getManualHoldings(portfolio)
+	if err != nil {
+		return dto.PortfolioDriftResponse{}, err
+	}
+	res := dto.PortfolioDriftResponse{TotalValue: totalValue}
+	if !totalValue.IsPositive() {
+		return res, nil
+	}
+
+	for _, holding := range holdings {
+		current := percentOf(holding.value, totalValue)
+		res.Assets = append(res.Assets, dto.HoldingDrift{
+			Symbol:            holding.symbol,
+			TargetPercentage:  holding.target,
+			CurrentPercentage: current,
+			Drift:             current - holding.target,
+		})
+		res.MaxDrift = math.Max(res.MaxDrift, math.Abs(current-holding.target))
+	}
+	cashTarget := manualCashTarget(portfolio)
+	cashCurrent := percentOf(portfolio.TotalCash, totalValue)
+	res.Categories = append(res.Categories, dto.HoldingDrift{
+		Category:          "cash",
+		TargetPercentage:  cashTarget,
+		CurrentPercentage: cashCurrent,
+		Drift:             cashCurrent - cashTarget,
+	})
+	res.MaxDrift = math.Max(res.MaxDrift, math.Abs(cashCurrent-cashTarget))
+	return res, nil
+}
+
+// RebalanceManualPortfolio trades the holdings outside the threshold back to their targets with the same rule as
+// the robo rebalancer. Sells come first; buys are scaled down when the cash cannot cover them. Held symbols
+// without a target are sold. Without execute the trades are only returned.
+func (s *manualPortfolioServiceImpl) RebalanceManualPortfolio(userID uint, portfolioName string, execute bool) (dto.ManualRebalanceResponse, error) {
+	portfolio, err := s.repo.GetManualPortfolio(userID, portfolioName)
+	if err != nil {
+		return dto.ManualRebalanceResponse{}, err
+	}
+	if len(portfolio.Targets) == 0 {
+		return dto.ManualRebalanceResponse{}, fmt.Errorf("portfolio %s has no target allocation", portfolio.Name)
+	}
+	threshold := portfolio.RebalanceThreshold
+	if threshold <= 0 {
+		threshold = commons.DefaultManualRebalanceThreshold
+	}
+	holdings, totalValue, err := s.getManualHoldings(portfolio)
+	if err != nil {
+		return dto.ManualRebalanceResponse{}, err
+	}
+	res := dto.ManualRebalanceResponse{Threshold: threshold, TotalValue: totalValue, CashBefore: portfolio.TotalCash}
+	if !totalValue.IsPositive() {
+		res.CashAfter = portfolio.TotalCash
+		return res, nil
+	}
+
+	var sells, buys []dto.ManualRebalanceTrade
+	sellTotal, buyTotal := decimal.Zero, decimal.Zero
+	for _, holding := range holdings {
+		targetValue := commons.RoundCash(totalValue.MulFloat(holding.target/100), portfolio.Currency)
+		if withinRebalanceThreshold(holding.value, targetValue, threshold) {
+			continue
+		}
+		trade := dto.ManualRebalanceTrade{
+			Symbol:            holding.symbol,
+			Name:              holding.name,
+			Price:             holding.price,
+			Currency:          manualAssetCurrency(portfolio, holding.symbol),
+			FxRate:            holding.fxRate,
+			CurrentPercentage: percentOf(holding.value, totalValue),
+			TargetPercentage:  holding.target,
+		}
+		unitCost := holding.price.Mul(holding.fxRate)
+		if holding.value.GreaterThan(targetValue) {
+			trade.Side = "sell"
+			trade.Shares = decimal.Min(commons.RoundShares(holding.value.Sub(targetValue).Div(unitCost)), holding.available)
+			trade.Amount = commons.RoundCash(trade.Shares.Mul(unitCost), portfolio.Currency)
+			if trade.Shares.IsPositive() {
+				sells = append(sells, trade)
+				sellTotal = sellTotal.Add(trade.Amount)
+			}
+		} else {
+			trade.Side = "buy"
+			trade.Amount = targetValue.Sub(holding.value)
+			buys = append(buys, trade)
+			buyTotal = buyTotal.Add(trade.Amount)
+		}
+	}
+	// buys are scaled down to the cash available after the sells, and sized to whole units of share precision so
+	// they never cost more than planned
+	cash := decimal.Max(portfolio.TotalCash.Sub(portfolio.ReservedCash).Add(sellTotal), decimal.Zero)
+	planned := buyTotal
+	buyTotal = decimal.Zero
+	for i := range buys {
+		if planned.GreaterThan(cash) {
+			buys[i].Amount = buys[i].Amount.Mul(cash).Div(planned)
+		}
+		buys[i].Shares, buys[i].Amount = sizeBuy(buys[i].Amount, buys[i].Price.Mul(buys[i].FxRate), portfolio.Currency)
+		buyTotal = buyTotal.Add(buys[i].Amount)
+	}
+	res.Trades = append(sells, buys...)
+
+	if execute {
+		// all trades commit together, so a failed trade leaves the portfolio as it was
+		err := s.repo.InTransaction(func(repo repositories.ManualPortfolioRepo) error {
+			locked, err := repo.LockManualPortfolio(userID, portfolio.ID)
+			if err != nil {
+				return err
+			}
+			for i := range res.Trades {
+				trade := &res.Trades[i]
+				if !trade.Shares.IsPositive() {
+					continue
+				}
+				if trade.Side == "buy" {
+					// earlier trades may have filled for less than planned
+					if available := locked.TotalCash.Sub(locked.ReservedCash); trade.Amount.GreaterThan(available) {
+						trade.Shares, trade.Amount = sizeBuy(decimal.Max(available, decimal.Zero), trade.Price.Mul(trade.FxRate), locked.Currency)
+						if !trade.Shares.IsPositive() {
+							continue
+						}
+					}
+				} else if asset := findManualAsset(locked, trade.Symbol); asset == nil || asset.SharesOwned.Sub(asset.SharesReserved).LessThan(trade.Shares) {
+					return fmt.Errorf("insufficient shares of %s to sell", trade.Symbol)
+				}
+				order := newMarketOrder(locked, trade.Side, trade.Name, trade.Symbol, trade.Shares)
+				if err := executeFill(repo, locked, order, trade.Shares, trade.Price, trade.FxRate); err != nil {
+					return fmt.Errorf("failed to %s %s: %w", trade.Side, trade.Symbol, err)
+				}
+			}
+			portfolio = locked
+			return nil
+		})
+		if err != nil {
+			return dto.ManualRebalanceResponse{}, fmt.Errorf("rebalance was not executed: %w", err)
+		}
+		res.Executed = true
+	}
+	res.CashAfter = portfolio.TotalCash
+	if !execute {
+		res.CashAfter = portfolio.TotalCash.Add(sellTotal).Sub(buyTotal)
+	}
+	return res, nil
+}
+
+// getManualHoldings values every held or targeted symbol and returns them sorted by symbol with the portfolio value
+func (s *manualPortfolioServiceImpl) getManualHoldings(portfolio *models.ManualPortfolio) ([]*manualHolding, decimal.Decimal, error) {
+	bySymbol := make(map[string]*manualHolding)
+	for _, asset := range portfolio.Assets {
+		if !asset.SharesOwned.IsPositive() {
+			continue
+		}
+		bySymbol[asset.Symbol] = &manualHolding{symbol: asset.Symbol, name: asset.Name, available: asset.SharesOwned.Sub(asset.SharesReserved)}
+	}
+	for _, target := range portfolio.Targets {
+		holding, ok := bySymbol[target.Symbol]
+		if !ok {
+			holding = &manualHolding{symbol: target.Symbol, name: target.Name}
+			bySymbol[target.Symbol] = holding
+		}
+		holding.target = target.Percentage
+	}
+
+	totalValue := portfolio.TotalCash
+	holdings := make([]*manualHolding, 0, len(bySymbol))
+	for _, holding := range bySymbol {
+		price, err := s.genAiService.GetLatestAssetPrice(holding.symbol)
+		if err != nil {
+			return nil, decimal.Zero, fmt.Errorf("failed to get price for %s: %w", holding.symbol, err)
+		}
+		if !price.IsPositive() {
+			return nil, decimal.Zero, fmt.Errorf("no price available for %s", holding.symbol)
+		}
+		fxRate, err := s.assetFxRate(portfolio, holding.symbol)
+		if err != nil {
+			return nil, decimal.Zero, err
+		}
+		holding.price = price
+		holding.fxRate = fxRate
+		if asset := findManualAsset(portfolio, holding.symbol); asset != nil {
+			holding.value = commons.RoundCash(asset.SharesOwned.Mul(price).Mul(fxRate), portfolio.Currency)
+		}
+		totalValue = totalValue.Add(holding.value)
+		holdings = append(holdings, holding)
+	}
+	sort.Slice(holdings, func(i, j int) bool {
+		return holdings[i].symbol < holdings[j].symbol
+	})
+	return holdings, totalValue, nil
+}
+
+// sizeBuy returns the shares the amount buys at the unit cost in the portfolio currency and what they cost
+func sizeBuy(amount, unitCost decimal.Decimal, currency string) (decimal.Decimal, decimal.Decimal) {
+	if !unitCost.IsPositive() {
+		return decimal.Zero, decimal.Zero
+	}
+	shares := commons.RoundShares(amount.Div(unitCost))
+	cost := commons.RoundCash(shares.Mul(unitCost), currency)
+	if cost.GreaterThan(amount) {
+		// rounding the cost up to the minor unit took it past the amount, size for one unit less
+		shares = commons.RoundShares(decimal.Max(amount.Sub(commons.MinorUnit(currency)), decimal.Zero).Div(unitCost))
+		cost = commons.RoundCash(shares.Mul(unitCost), currency)
+	}
+	return shares, cost
+}
+
+func manualCashTarget(portfolio *models.ManualPortfolio) float64 {
+	target := 100.0
+	for _, t := range portfolio.Targets {
+		target -= t.Percentage
+	}
+	return math.Max(target, 0)
+}
@@ -1,9 +1,15 @@
 package services
 
 import (
+	"context"
 	"fmt"
+	"log"
+	"mime/multipart"
 	"sync"
+	"time"
 
+	"github.com/KZY20112001/infinivest-backend/internal/commons"
+	"github.com/KZY20112001/infinivest-backend/internal/commons/decimal"
 	"github.com/KZY20112001/infinivest-backend/internal/dto"
 	"github.com/KZY20112001/infinivest-backend/internal/models"
 	"github.com/KZY20112001/infinivest-backend/internal/repositories"
@@ -14,28 +20,45 @@ type ManualPortfolioService interface {
 	GetManualPortfoliosSummaries(userID uint) ([]dto.ManualPortfolioSummaryResponse, error)
 
 	GetManualPortfolio(userID uint, portfolioName string) (*models.ManualPortfolio, error)
-	GetPorfolioValue(userID uint, portfolioName string) (float64, float64, error)
+	GetPorfolioValue(userID uint, portfolioName string) (decimal.Decimal, decimal.Decimal, error)
 
-	CreateManualPortfolio(userID uint, portfolioName string) error
+	CreateManualPortfolio(userID uint, portfolioName, currency string) error
 	UpdatePortfolioName(userID uint, portfolioName, newName string) error
 
-	AddMoneyToManualPortfolio(userID uint, portfolioName string, amount float64) error
-	WithdrawMoneyFromManualPortfolio(userID uint, portfolioName string, amount float64) (float64, error)
+	AddMoneyToManualPortfolio(userID uint, portfolioName string, amount decimal.Decimal) error
+	WithdrawMoneyFromManualPortfolio(userID uint, portfolioName string, amount decimal.Decimal) (decimal.Decimal, error)
 
-	BuyAssetForManualPortfolio(userID uint, portfolioName, name, symbol string, shares float64) error
-	SellAssetForManualPortfolio(userID uint, portfolioName, symbol string, shares float64) error
+	BuyAssetForManualPortfolio(userID uint, portfolioName, name, symbol string, shares decimal.Decimal) error
+	SellAssetForManualPortfolio(userID uint, portfolioName, symbol string, shares decimal.Decimal) error
 
 	DeleteManualPortfolio(userID uint, portfolioName string) error
 	GetManualPortfolioTransactions(userID uint, portfolioName string, limit int) ([]*models.ManualPortfolioTransaction, error)
+	ExportManualPortfolioTransactions(userID uint, portfolioName, format string, from, to *time.Time) (*TransactionExport, error)
+	GetManualPortfolioRisk(userID uint, portfolioName, benchmark string, days int) (dto.PortfolioRiskResponse, error)
+
+	PlaceOrder(userID uint, portfolioName string, req dto.PlaceOrderRequest) (*models.Order, error)
+	GetOrders(userID uint, portfolioName, status string) ([]*models.Order, error)
+	GetOrder(userID, orderID uint) (*models.Order, error)
+	CancelOrder(ctx context.Context, userID, orderID uint) (*models.Order, error)
+	ProcessOpenOrders(ctx context.Context)
+
+	UpdateManualPortfolioTargets(userID uint, portfolioName string, req dto.ManualTargetsRequest) (*models.ManualPortfolio, error)
+	GetManualPortfolioDrift(userID uint, portfolioName string) (dto.PortfolioDriftResponse, error)
+	RebalanceManualPortfolio(userID uint, portfolioName string, execute bool) (dto.ManualRebalanceResponse, error)
+
+	ImportManualPortfolioTransactions(userID uint, portfolioName string, file *multipart.FileHeader, preset string, mapping *dto.ImportColumnMapping, commit bool) (dto.ImportResult, error)
 }
 
 type manualPortfolioServiceImpl struct {
-	repo         repositories.ManualPortfolioRepo
-	genAiService GenAIService
+	repo                repositories.ManualPortfolioRepo
+	genAiService        GenAIService
+	notificationService NotificationService
+	profileService      ProfileService
+	fxService           FXService
 }
 
-func NewManualPortfolioService(pr repositories.ManualPortfolioRepo, gs GenAIService) *manualPortfolioServiceImpl {
-	return &manualPortfolioServiceImpl{repo: pr, genAiService: gs}
+func NewManualPortfolioService(pr repositories.ManualPortfolioRepo, gs GenAIService, ns NotificationService, ps ProfileService, fs FXService) *manualPortfolioServiceImpl {
+	return &manualPortfolioServiceImpl{repo: pr, genAiService: gs, notificationService: ns, profileService: ps, fxService: fs}
 }
 
 func (s *manualPortfolioServiceImpl) GetManualPortfoliosDetails(userID uint) ([]*models.ManualPortfolio, error) {
@@ -51,51 +74,74 @@ func (s *manualPortfolioServiceImpl) GetManualPortfoliosSummaries(userID uint) (
 	if err != nil {
 		return nil, err
 	}
+	baseCurrency, err := s.profileService.GetBaseCurrency(userID)
+	if err != nil {
+		return nil, err
+	}
+	// each goroutine writes its own index, so the summaries keep the order of the portfolios
 	var wg sync.WaitGroup
-	summaries := make(chan dto.ManualPortfolioSummaryResponse, len(portfolios))
-	for _, portfolio := range portfolios {
+	res := make([]dto.ManualPortfolioSummaryResponse, len(portfolios))
+	for i, portfolio := range portfolios {
 		wg.Add(1)
-		go func(portfolio *models.ManualPortfolio) {
+		go func(i int, portfolio *models.ManualPortfolio) {
 			defer wg.Done()
-			totalValue, totalInvested, err := s.GetPorfolioValue(portfolio.UserID, portfolio.Name)
+			valuation := s.valuePortfolio(portfolio)
+			res[i] = dto.ManualPortfolioSummaryResponse{
+				Name:          portfolio.Name,
+				TotalValue:    valuation.totalValue,
+				TotalInvested: valuation.totalInvested,
+			}
+			baseValuation, err := valuation.inBaseCurrency(s.fxService, portfolio.Currency, baseCurrency)
 			if err != nil {
+				log.Printf("Failed to convert portfolio %d:%d into %s: %v\n", portfolio.UserID, portfolio.ID, baseCurrency, err)
+				res[i].Error = err.Error()
 				return
 			}
-			summaries <- dto.ManualPortfolioSummaryResponse{
-				Name:          portfolio.Name,
-				TotalValue:    totalValue,
-				TotalInvested: totalInvested,
-			}
-		}(portfolio)
+			res[i].BaseCurrencyValuation = baseValuation
+		}(i, portfolio)
 	}
 	wg.Wait()
-	close(summaries)
-	var res []dto.ManualPortfolioSummaryResponse
-	for summary := range summaries {
-		res = append(res, summary)
-	}
 	return res, nil
 }
 
-func (s *manualPortfolioServiceImpl) CreateManualPortfolio(userID uint, portfolioName string) error {
+func (s *manualPortfolioServiceImpl) CreateManualPortfolio(userID uint, portfolioName, currency string) error {
+	if currency == "" {
+		baseCurrency, err := s.profileService.GetBaseCurrency(userID)
+		if err != nil {
+			return err
+		}
+		currency = baseCurrency
+	}
+	currency, err := commons.NormalizeCurrency(currency)
+	if err != nil {
+		return err
+	}
+	if _, err := s.fxService.GetRate(commons.DefaultCurrency, currency); err != nil {
+		return err
+	}
 	portfolio := &models.ManualPortfolio{
 		UserID:    userID,
 		Name:      portfolioName,
 		Assets:    []*models.ManualPortfolioAsset{},
-		TotalCash: 0,
+		TotalCash: decimal.Zero,
+		Currency:  currency,
 	}
 
 	return s.repo.CreateManualPortfolio(portfolio)
 }
 
-func (s *manualPortfolioServiceImpl) GetPorfolioValue(userID uint, portfolioName string) (float64, float64, error) {
+func (s *manualPortfolioServiceImpl) GetPorfolioValue(userID uint, portfolioName string) (decimal.Decimal, decimal.Decimal, error) {
 	portfolio, err := s.repo.GetManualPortfolio(userID, portfolioName)
 	if err != nil {
-		return 0, 0, err
+		return decimal.Zero, decimal.Zero, err
 	}
+	valuation := s.valuePortfolio(portfolio)
+	return valuation.totalValue, valuation.totalInvested, nil
+}
 
-	totalValue := portfolio.TotalCash
-	totalInvested := portfolio.TotalCash
+// valuePortfolio values the portfolio in its currency, leaving out assets without a price or exchange rate
+func (s *manualPortfolioServiceImpl) valuePortfolio(portfolio *models.ManualPortfolio) portfolioValuation {
+	valuation := portfolioValuation{totalValue: portfolio.TotalCash, totalInvested: portfolio.TotalCash}
 
 	var wg sync.WaitGroup
 	var mu sync.Mutex
@@ -107,15 +153,26 @@ func (s *manualPortfolioServiceImpl) GetPorfolioValue(userID uint, portfolioName
 			if err != nil {
 				return
 			}
+			fxRate, err := s.assetFxRate(portfolio, asset.Symbol)
+			if err != nil {
+				return
+			}
+			marketValue := asset.SharesOwned.Mul(latestValue)
+			costBasis := asset.SharesOwned.Mul(asset.AvgBuyPrice)
 			mu.Lock()
-			totalValue += asset.SharesOwned * latestValue
-			totalInvested += asset.TotalInvested
+			valuation.totalValue = valuation.totalValue.Add(marketValue.Mul(fxRate))
+			valuation.totalInvested = valuation.totalInvested.Add(asset.TotalInvested)
+			valuation.assetGain = valuation.assetGain.Add(marketValue.Sub(costBasis).Mul(fxRate))
+			valuation.fxGain = valuation.fxGain.Add(costBasis.Mul(fxRate.Sub(asset.AvgFxRate)))
 			mu.Unlock()
 		}(asset)
 
 	}
 	wg.Wait()
-	return totalValue, totalInvested, nil
+	valuation.totalValue = commons.RoundCash(valuation.totalValue, portfolio.Currency)
+	valuation.assetGain = commons.RoundCash(valuation.assetGain, portfolio.Currency)
+	valuation.fxGain = commons.RoundCash(valuation.fxGain, portfolio.Currency)
+	return valuation
 }
 
 func (s *manualPortfolioServiceImpl) UpdatePortfolioName(userID uint, portfolioName, newName string) error {
@@ -126,13 +183,14 @@ func (s *manualPortfolioServiceImpl) UpdatePortfolioName(userID uint, portfolioN
 	return s.repo.UpdateManualPortfolioName(portfolio, newName)
 }
 
-func (s *manualPortfolioServiceImpl) AddMoneyToManualPortfolio(userID uint, portfolioName string, amount float64) error {
+func (s *manualPortfolioServiceImpl) AddMoneyToManualPortfolio(userID uint, portfolioName string, amount decimal.Decimal) error {
 	portfolio, err := s.repo.GetManualPortfolio(userID, portfolioName)
 	if err != nil {
 		return err
 	}
 
-	portfolio.TotalCash += amount
+	amount = commons.RoundCash(amount, portfolio.Currency)
+	portfolio.TotalCash = portfolio.TotalCash.Add(amount)
 
 	err = s.repo.UpdateManualPortfolio(portfolio)
 	if err != nil {
@@ -152,37 +210,39 @@ func (s *manualPortfolioServiceImpl) AddMoneyToManualPortfolio(userID uint, port
 
 	return nil
 }
-func (s *manualPortfolioServiceImpl) WithdrawMoneyFromManualPortfolio(userID uint, portfolioName string, amount float64) (float64, error) {
+func (s *manualPortfolioServiceImpl) WithdrawMoneyFromManualPortfolio(userID uint, portfolioName string, amount decimal.Decimal) (decimal.Decimal, error) {
 	portfolio, err := s.repo.GetManualPortfolio(userID, portfolioName)
 	if err != nil {
-		return 0, nil
+		return decimal.Zero, nil
 	}
+	amount = commons.RoundCash(amount, portfolio.Currency)
 	originalAmount := amount
-	if portfolio.TotalCash < amount {
-		amount -= portfolio.TotalCash
-		portfolio.TotalCash = 0
+	// cash reserved for pending buy orders cannot be withdrawn
+	if available := portfolio.TotalCash.Sub(portfolio.ReservedCash); available.LessThan(amount) {
+		amount = amount.Sub(available)
+		portfolio.TotalCash = portfolio.TotalCash.Sub(available)
 	} else {
-		portfolio.TotalCash -= amount
-		amount = 0
+		portfolio.TotalCash = portfolio.TotalCash.Sub(amount)
+		amount = decimal.Zero
 	}
 	if err := s.repo.UpdateManualPortfolio(portfolio); err != nil {
-		return 0, err
+		return decimal.Zero, err
 	}
 
 	err = s.repo.CreateManualPortfolioTransaction(&models.ManualPortfolioTransaction{
 		ManualPortfolioUserID: userID,
 		ManualPortfolioID:     portfolio.ID,
 		TransactionType:       "withdrawal",
-		TotalAmount:           originalAmount - amount,
+		TotalAmount:           originalAmount.Sub(amount),
 	})
 
 	if err != nil {
-		return 0, err
+		return decimal.Zero, err
 	}
-	return originalAmount - amount, nil
+	return originalAmount.Sub(amount), nil
 }
 
-func (s *manualPortfolioServiceImpl) BuyAssetForManualPortfolio(userID uint, portfolioName, name, symbol string, shares float64) error {
+func (s *manualPortfolioServiceImpl) BuyAssetForManualPortfolio(userID uint, portfolioName, name, symbol string, shares decimal.Decimal) error {
 	portfolio, err := s.repo.GetManualPortfolio(userID, portfolioName)
 	if err != nil {
 		return err
@@ -192,110 +252,76 @@ func (s *manualPortfolioServiceImpl) BuyAssetForManualPortfolio(userID uint, por
 	if err != nil {
 		return err
 	}
-
-	totalCost := latestValue * shares
-	if totalCost > portfolio.TotalCash {
-		return fmt.Errorf("insufficient funds to buy %f shares of %s", shares, symbol)
-	}
-
-	found := false
-	var curAsset *models.ManualPortfolioAsset
-	for _, asset := range portfolio.Assets {
-		if asset.Symbol == symbol {
-			found = true
-			curAsset = asset
-			break
-		}
-	}
-	if !found {
-		curAsset = &models.ManualPortfolioAsset{
-			Symbol:        symbol,
-			Name:          name,
-			SharesOwned:   shares,
-			TotalInvested: totalCost,
-			AvgBuyPrice:   latestValue,
-		}
-		portfolio.Assets = append(portfolio.Assets, curAsset)
-	} else {
-		curAsset.SharesOwned += shares
-		curAsset.TotalInvested += totalCost
-		curAsset.AvgBuyPrice = curAsset.TotalInvested / curAsset.SharesOwned
-	}
-	portfolio.TotalCash -= totalCost
-
-	err = s.repo.UpdateManualPortfolio(portfolio)
+	fxRate, err := s.assetFxRate(portfolio, symbol)
 	if err != nil {
 		return err
 	}
 
-	err = s.repo.CreateManualPortfolioTransaction(&models.ManualPortfolioTransaction{
-		ManualPortfolioUserID: userID,
-		ManualPortfolioID:     portfolio.ID,
-		TransactionType:       "buy",
-		TotalAmount:           totalCost,
-
-		Symbol:       &symbol,
-		Name:         &name,
-		Price:        &latestValue,
-		SharesAmount: &shares,
+	shares = commons.RoundShares(shares)
+	order := newMarketOrder(portfolio, "buy", name, symbol, shares)
+	totalCost := commons.RoundCash(latestValue.Mul(shares).Mul(fxRate), portfolio.Currency)
+	var rejection string
+	err = s.repo.InTransaction(func(repo repositories.ManualPortfolioRepo) error {
+		portfolio, err := repo.LockManualPortfolio(userID, portfolio.ID)
+		if err != nil {
+			return err
+		}
+		if totalCost.GreaterThan(portfolio.TotalCash.Sub(portfolio.ReservedCash)) {
+			rejection = fmt.Sprintf("insufficient funds to buy %s shares of %s", shares, symbol)
+			return nil
+		}
+		return executeFill(repo, portfolio, order, shares, latestValue, fxRate)
 	})
-
 	if err != nil {
 		return err
 	}
+	if rejection != "" {
+		return s.rejectOrder(order, rejection)
+	}
 	return nil
 }
 
-func (s *manualPortfolioServiceImpl) SellAssetForManualPortfolio(userID uint, portfolioName, symbol string, shares float64) error {
+func (s *manualPortfolioServiceImpl) SellAssetForManualPortfolio(userID uint, portfolioName, symbol string, shares decimal.Decimal) error {
 	portfolio, err := s.repo.GetManualPortfolio(userID, portfolioName)
 	if err != nil {
 		return err
 	}
-	found := false
-	var curAsset *models.ManualPortfolioAsset
-	for _, asset := range portfolio.Assets {
-		if asset.Symbol == symbol {
-			found = true
-			curAsset = asset
-			break
-		}
-	}
-	if !found {
+	curAsset := findManualAsset(portfolio, symbol)
+	if curAsset == nil {
 		return fmt.Errorf("asset not found in portfolio")
 	}
-
-	if curAsset.SharesOwned < shares {
-		return fmt.Errorf("insufficient shares to sell")
+	shares = commons.RoundShares(shares)
+	order := newMarketOrder(portfolio, "sell", curAsset.Name, symbol, shares)
+	if curAsset.SharesOwned.Sub(curAsset.SharesReserved).LessThan(shares) {
+		return s.rejectOrder(order, "insufficient shares to sell")
 	}
 	latestValue, err := s.genAiService.GetLatestAssetPrice(symbol)
 	if err != nil {
 		return err
 	}
-	totalCost := latestValue * shares
-	portfolio.TotalCash += totalCost
-	curAsset.SharesOwned -= shares
-
-	err = s.repo.UpdateManualPortfolio(portfolio)
+	fxRate, err := s.assetFxRate(portfolio, symbol)
 	if err != nil {
 		return err
 	}
-
-	err = s.repo.CreateManualPortfolioTransaction(&models.ManualPortfolioTransaction{
-		ManualPortfolioUserID: userID,
-		ManualPortfolioID:     portfolio.ID,
-		TransactionType:       "sell",
-		TotalAmount:           totalCost,
-
-		Symbol:       &symbol,
-		Name:         &curAsset.Name,
-		Price:        &latestValue,
-		SharesAmount: &shares,
+	var rejection string
+	err = s.repo.InTransaction(func(repo repositories.ManualPortfolioRepo) error {
+		portfolio, err := repo.LockManualPortfolio(userID, portfolio.ID)
+		if err != nil {
+			return err
+		}
+		// the shares may have been sold or reserved while the price was fetched
+		if asset := findManualAsset(portfolio, symbol); asset == nil || asset.SharesOwned.Sub(asset.SharesReserved).LessThan(shares) {
+			rejection = "insufficient shares to sell"
+			return nil
+		}
+		return executeFill(repo, portfolio, order, shares, latestValue, fxRate)
 	})
-
 	if err != nil {
 		return err
 	}
-
+	if rejection != "" {
+		return s.rejectOrder(order, rejection)
+	}
 	return nil
 }
 
@@ -308,7 +334,7 @@ func (s *manualPortfolioServiceImpl) DeleteManualPortfolio(userID uint, portfoli
 	if err != nil {
 		return err
 	}
-	if totalValue > 0 {
+	if totalValue.IsPositive() {
 		return fmt.Errorf("%s portfolio has assets and liquid cash. Sell all assets and withdraw the money before deleting the portfolio", portfolioName)
 	}
 	return s.repo.DeleteManualPortfolio(portfolio)
@@ -321,3 +347,87 @@ func (s *manualPortfolioServiceImpl) GetManualPortfolioTransactions(userID uint,
 	}
 	return s.repo.GetManualPortfolioTransactions(userID, portfolio.ID, limit)
 }
+
+func (s *manualPortfolioServiceImpl) ExportManualPortfolioTransactions(userID uint, portfolioName, format string, from, to *time.Time) (*TransactionExport, error) {
+	portfolio, err := s.repo.GetManualPortfolio(userID, portfolioName)
+	if err != nil {
+		return nil, err
+	}
+	account := fmt.Sprintf("manual-%d", portfolio.ID)
+	return newTransactionExport(format, account, portfolio.Currency, from, to, func(fn func(exportTransaction) error) error {
+		return s.repo.StreamManualPortfolioTransactions(userID, portfolio.ID, from, to, func(t *models.ManualPortfolioTransaction) error {
+			return fn(newManualExportTransaction(t))
+		})
+	})
+}
+
+func (s *manualPortfolioServiceImpl) GetManualPortfolioRisk(userID uint, portfolioName, benchmark string, days int) (dto.PortfolioRiskResponse, error) {
+	portfolio, err := s.repo.GetManualPortfolio(userID, portfolioName)
+	if err != nil {
+		return dto.PortfolioRiskResponse{}, err
+	}
+	holdings := make(map[string]decimal.Decimal)
+	fxRates := make(map[string]decimal.Decimal)
+	for _, asset := range portfolio.Assets {
+		holdings[asset.Symbol] = holdings[asset.Symbol].Add(asset.SharesOwned)
+		if _, exists := fxRates[asset.Symbol]; exists || !asset.SharesOwned.IsPositive() {
+			continue
+		}
+		if fxRates[asset.Symbol], err = s.assetFxRate(portfolio, asset.Symbol); err != nil {
+			return dto.PortfolioRiskResponse{}, err
+		}
+	}
+	return computeHoldingsRisk(s.genAiService, holdings, fxRates, portfolio.TotalCash, portfolio.Currency, benchmark, days)
+}
+
+// assetFxRate returns the rate converting the symbol's quote currency into the portfolio currency
+func (s *manualPortfolioServiceImpl) assetFxRate(portfolio *models.ManualPortfolio, symbol string) (decimal.Decimal, error) {
+	return s.fxService.GetRate(manualAssetCurrency(portfolio, symbol), portfolio.Currency)
+}
+
+// manualAssetCurrency is the currency the symbol is quoted in, as recorded on the holding when there is one
+func manualAssetCurrency(portfolio *models.ManualPortfolio, symbol string) string {
+	if asset := findManualAsset(portfolio, symbol); asset != nil && asset.Currency != "" {
+		return asset.Currency
+	}
+	return commons.SymbolCurrency(symbol)
+}
+
+// buyManualAsset adds the shares to the portfolio at the given price and pays for them from its cash, converted
+// from the asset currency with fxRate
+func buyManualAsset(portfolio *models.ManualPortfolio, name, symbol string, shares, price, fxRate decimal.Decimal) *models.ManualPortfolioAsset {
+	asset := findManualAsset(portfolio, symbol)
+	if asset == nil {
+		asset = &models.ManualPortfolioAsset{Symbol: symbol, Name: name, Currency: commons.SymbolCurrency(symbol)}
+		portfolio.Assets = append(portfolio.Assets, asset)
+	}
+	cash := addManualShares(asset, portfolio.Currency, shares, price.Mul(shares), fxRate)
+	portfolio.TotalCash = portfolio.TotalCash.Sub(cash)
+	return asset
+}
+
+// addManualShares adds shares that cost the given amount in the asset currency, acquired at fxRate, and returns
+// what they cost in the portfolio currency
+func addManualShares(asset *models.ManualPortfolioAsset, currency string, shares, cost, fxRate decimal.Decimal) decimal.Decimal {
+	costBasis := asset.AvgBuyPrice.Mul(asset.SharesOwned)
+	if total := costBasis.Add(cost); total.IsPositive() {
+		asset.AvgFxRate = asset.AvgFxRate.Mul(costBasis).Add(fxRate.Mul(cost)).Div(total)
+	} else {
+		asset.AvgFxRate = fxRate
+	}
+	cash := commons.RoundCash(cost.Mul(fxRate), currency)
+	asset.SharesOwned = asset.SharesOwned.Add(shares)
+	asset.TotalInvested = asset.TotalInvested.Add(cash)
+	if asset.SharesOwned.IsPositive() {
+		asset.AvgBuyPrice = commons.RoundPrice(costBasis.Add(cost).Div(asset.SharesOwned))
+	}
+	return cash
+}
+
+// sellManualAsset removes the shares and returns the proceeds credited to the portfolio cash
+func sellManualAsset(portfolio *models.ManualPortfolio, asset *models.ManualPortfolioAsset, shares, price, fxRate decimal.Decimal) decimal.Decimal {
+	proceeds := commons.RoundCash(price.Mul(shares).Mul(fxRate), portfolio.Currency)
+	portfolio.TotalCash = portfolio.TotalCash.Add(proceeds)
+	asset.SharesOwned = asset.SharesOwned.Sub(shares)
+	return proceeds
+}
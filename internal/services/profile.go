@@ -1,15 +1,32 @@
 package services
 
 import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/KZY20112001/infinivest-backend/internal/analytics"
+	"github.com/KZY20112001/infinivest-backend/internal/commons"
 	"github.com/KZY20112001/infinivest-backend/internal/dto"
 	"github.com/KZY20112001/infinivest-backend/internal/models"
 	"github.com/KZY20112001/infinivest-backend/internal/repositories"
+	"gorm.io/gorm"
 )
 
+// equity percentages may exceed the risk level's maximum by this much due to rounding
+const suitabilityTolerance = 0.5
+
 type ProfileService interface {
 	CreateProfile(userID uint, dto dto.ProfileRequest) error
 	UpdateProfile(userID uint, dto dto.ProfileRequest) error
 	GetProfile(userID uint) (*models.Profile, error)
+	GetBaseCurrency(userID uint) (string, error)
+
+	GetRiskQuestionnaire(version int) (commons.RiskQuestionnaire, error)
+	SubmitRiskQuestionnaire(userID uint, req dto.RiskQuestionnaireRequest) (dto.RiskAssessmentResponse, error)
+	ResolveRiskLevel(userID uint, requested string) (string, error)
+	CheckAllocationSuitability(userID uint, categories map[string]float64) error
 }
 
 type profileServiceImpl struct {
@@ -26,6 +43,10 @@ func (ps *profileServiceImpl) CreateProfile(userID uint, dto dto.ProfileRequest)
 	if err != nil {
 		return err
 	}
+	baseCurrency, err := commons.NormalizeCurrency(dto.BaseCurrency)
+	if err != nil {
+		return err
+	}
 	profile := models.Profile{
 		UserID:            userID,
 		User:              *user,
@@ -38,6 +59,7 @@ func (ps *profileServiceImpl) CreateProfile(userID uint, dto dto.ProfileRequest)
 		InvestmentHorizon: dto.InvestmentHorizon,
 		AnnualIncome:      dto.AnnualIncome,
 		ExperienceLevel:   dto.ExperienceLevel,
+		BaseCurrency:      baseCurrency,
 	}
 	return ps.repo.CreateProfile(&profile)
 }
@@ -51,14 +73,123 @@ func (ps *profileServiceImpl) UpdateProfile(userID uint, dto dto.ProfileRequest)
 	profile.LastName = dto.LastName
 	profile.ProfileUrl = dto.ProfileUrl
 	profile.ProfileID = dto.ProfileID
-	profile.RiskTolerance = dto.RiskTolerance
+	// the risk tolerance is computed once the questionnaire has been answered
+	if profile.RiskQuestionnaireVersion == 0 {
+		profile.RiskTolerance = dto.RiskTolerance
+	}
 	profile.InvestmentStyle = dto.InvestmentStyle
 	profile.InvestmentHorizon = dto.InvestmentHorizon
 	profile.AnnualIncome = dto.AnnualIncome
 	profile.ExperienceLevel = dto.ExperienceLevel
+	if dto.BaseCurrency != "" {
+		if profile.BaseCurrency, err = commons.NormalizeCurrency(dto.BaseCurrency); err != nil {
+			return err
+		}
+	}
 	return ps.repo.UpdateProfile(profile)
 }
 
 func (ps *profileServiceImpl) GetProfile(userID uint) (*models.Profile, error) {
 	return ps.repo.GetProfile(userID)
 }
+
+// GetBaseCurrency returns the currency the user's valuations are reported in, the default one without a profile
+func (ps *profileServiceImpl) GetBaseCurrency(userID uint) (string, error) {
+	profile, err := ps.repo.GetProfile(userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return commons.DefaultCurrency, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if profile.BaseCurrency == "" {
+		return commons.DefaultCurrency, nil
+	}
+	return profile.BaseCurrency, nil
+}
+
+func (ps *profileServiceImpl) GetRiskQuestionnaire(version int) (commons.RiskQuestionnaire, error) {
+	if version == 0 {
+		version = commons.CurrentRiskQuestionnaireVersion
+	}
+	questionnaire, exists := commons.RiskQuestionnaires[version]
+	if !exists {
+		return commons.RiskQuestionnaire{}, fmt.Errorf("invalid questionnaire version: %d", version)
+	}
+	return questionnaire, nil
+}
+
+func (ps *profileServiceImpl) SubmitRiskQuestionnaire(userID uint, req dto.RiskQuestionnaireRequest) (dto.RiskAssessmentResponse, error) {
+	profile, err := ps.repo.GetProfile(userID)
+	if err != nil {
+		return dto.RiskAssessmentResponse{}, err
+	}
+	if req.Version != commons.CurrentRiskQuestionnaireVersion {
+		return dto.RiskAssessmentResponse{}, fmt.Errorf("questionnaire version %d is outdated, the current version is %d", req.Version, commons.CurrentRiskQuestionnaireVersion)
+	}
+	score, riskLevel, err := commons.ScoreRiskQuestionnaire(req.Version, req.Answers)
+	if err != nil {
+		return dto.RiskAssessmentResponse{}, err
+	}
+
+	now := time.Now()
+	profile.RiskQuestionnaireVersion = req.Version
+	profile.RiskScore = score
+	profile.RiskAnswers = req.Answers
+	profile.RiskAssessedAt = &now
+	profile.RiskTolerance = riskLevel
+	if err := ps.repo.UpdateProfile(profile); err != nil {
+		return dto.RiskAssessmentResponse{}, err
+	}
+	return dto.RiskAssessmentResponse{Version: req.Version, Score: score, RiskLevel: riskLevel}, nil
+}
+
+// ResolveRiskLevel returns the risk level computed from the user's questionnaire. A requested level may only
+// be used when it is no more aggressive than the computed one.
+func (ps *profileServiceImpl) ResolveRiskLevel(userID uint, requested string) (string, error) {
+	riskLevel, err := ps.assessedRiskLevel(userID)
+	if err != nil {
+		return "", err
+	}
+	if requested == "" {
+		return riskLevel, nil
+	}
+	requestedLevel, err := commons.NormalizeRiskLevel(requested)
+	if err != nil {
+		return "", err
+	}
+	if slices.Index(commons.RiskLevels, requestedLevel) > slices.Index(commons.RiskLevels, riskLevel) {
+		return "", fmt.Errorf("a %s portfolio is not suitable for a %s risk profile", requestedLevel, riskLevel)
+	}
+	return requestedLevel, nil
+}
+
+// CheckAllocationSuitability rejects category targets that hold more equities than the user's risk level allows
+func (ps *profileServiceImpl) CheckAllocationSuitability(userID uint, categories map[string]float64) error {
+	riskLevel, err := ps.assessedRiskLevel(userID)
+	if err != nil {
+		return err
+	}
+	equity := 0.0
+	for category, percentage := range categories {
+		if analytics.CategoryClass(category) == "equity" {
+			equity += percentage
+		}
+	}
+	maxEquity := analytics.RiskLevelConstraints[riskLevel].MaxEquity * 100
+	if equity > maxEquity+suitabilityTolerance {
+		return fmt.Errorf("%.1f%% in equities is not suitable for a %s risk profile, the maximum is %.1f%%", equity, riskLevel, maxEquity)
+	}
+	return nil
+}
+
+func (ps *profileServiceImpl) assessedRiskLevel(userID uint) (string, error) {
+	profile, err := ps.repo.GetProfile(userID)
+	if err != nil {
+		return "", fmt.Errorf("complete your profile and risk questionnaire first: %w", err)
+	}
+	if profile.RiskQuestionnaireVersion == 0 {
+		return "", fmt.Errorf("complete the risk questionnaire first")
+	}
+	return commons.NormalizeRiskLevel(profile.RiskTolerance)
+}
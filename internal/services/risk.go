@@ -0,0 +1,127 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/KZY20112001/infinivest-backend/internal/analytics"
+	"github.com/KZY20112001/infinivest-backend/internal/commons"
+	"github.com/KZY20112001/infinivest-backend/internal/commons/decimal"
+	"github.com/KZY20112001/infinivest-backend/internal/dto"
+)
+
+const (
+	DefaultRiskBenchmark    = "SPY"
+	DefaultRiskLookbackDays = 252
+	MaxRiskLookbackDays     = 5 * 252
+)
+
+// computeHoldingsRisk values the current holdings over their price history and derives risk metrics
+// from the resulting daily value series. Closes are converted into the portfolio currency with fxRates, the
+// current rate from each symbol's quote currency; symbols without a rate are quoted in the portfolio currency.
+// Amounts are rounded to the portfolio currency.
+func computeHoldingsRisk(genAIService GenAIService, holdings, fxRates map[string]decimal.Decimal, cash decimal.Decimal, currency, benchmark string, days int) (dto.PortfolioRiskResponse, error) {
+	symbols := []string{benchmark}
+	for symbol, shares := range holdings {
+		if shares.IsPositive() && symbol != benchmark {
+			symbols = append(symbols, symbol)
+		}
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	histories := make(map[string]map[string]float64)
+	for _, symbol := range symbols {
+		wg.Add(1)
+		go func(symbol string) {
+			defer wg.Done()
+			history, err := genAIService.GetAssetPriceHistory(symbol, days)
+			if err != nil || len(history) == 0 {
+				return
+			}
+			closes := make(map[string]float64, len(history))
+			for _, point := range history {
+				closes[point.Date] = point.Close
+			}
+			mu.Lock()
+			histories[symbol] = closes
+			mu.Unlock()
+		}(symbol)
+	}
+	wg.Wait()
+
+	benchmarkCloses, exists := histories[benchmark]
+	if !exists {
+		return dto.PortfolioRiskResponse{}, fmt.Errorf("failed to get price history for benchmark %s", benchmark)
+	}
+
+	var unpriced []string
+	for symbol, shares := range holdings {
+		if _, exists := histories[symbol]; shares.IsPositive() && !exists {
+			unpriced = append(unpriced, symbol)
+		}
+	}
+
+	// only use dates on which every priced holding and the benchmark traded
+	var dates []string
+	for date := range benchmarkCloses {
+		tradedByAll := true
+		for symbol := range holdings {
+			if closes, exists := histories[symbol]; exists {
+				if _, traded := closes[date]; !traded {
+					tradedByAll = false
+					break
+				}
+			}
+		}
+		if tradedByAll {
+			dates = append(dates, date)
+		}
+	}
+	sort.Strings(dates)
+	if len(dates) < 3 {
+		return dto.PortfolioRiskResponse{}, fmt.Errorf("not enough price history to compute risk metrics")
+	}
+
+	fxRate := func(symbol string) decimal.Decimal {
+		if rate, exists := fxRates[symbol]; exists {
+			return rate
+		}
+		return decimal.One
+	}
+
+	// the return series only feeds the statistics, so it is kept in floats. The benchmark only feeds returns,
+	// so it stays in its own currency.
+	values := make([]float64, len(dates))
+	benchmarkValues := make([]float64, len(dates))
+	for i, date := range dates {
+		values[i] = cash.Float64()
+		for symbol, shares := range holdings {
+			if closes, exists := histories[symbol]; exists {
+				values[i] += shares.Float64() * closes[date] * fxRate(symbol).Float64()
+			}
+		}
+		benchmarkValues[i] = benchmarkCloses[date]
+	}
+
+	metrics := analytics.ComputeRiskMetrics(analytics.DailyReturns(values), analytics.DailyReturns(benchmarkValues), analytics.DefaultRiskFreeRate)
+	totalValue := cash
+	lastDate := dates[len(dates)-1]
+	for symbol, shares := range holdings {
+		if closes, exists := histories[symbol]; exists {
+			totalValue = totalValue.Add(shares.Mul(decimal.NewFromFloat(closes[lastDate])).Mul(fxRate(symbol)))
+		}
+	}
+	totalValue = commons.RoundCash(totalValue, currency)
+	return dto.PortfolioRiskResponse{
+		RiskMetrics:             metrics,
+		Benchmark:               benchmark,
+		TotalValue:              totalValue,
+		ValueAtRiskAmount:       commons.RoundCash(totalValue.MulFloat(metrics.ValueAtRisk), currency),
+		ExpectedShortfallAmount: commons.RoundCash(totalValue.MulFloat(metrics.ConditionalValueAtRisk), currency),
+		HistoryStart:            dates[0],
+		HistoryEnd:              dates[len(dates)-1],
+		UnpricedSymbols:         unpriced,
+	}, nil
+}
@@ -0,0 +1,88 @@
+package services
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/KZY20112001/infinivest-backend/internal/commons/decimal"
+	"github.com/KZY20112001/infinivest-backend/internal/dto"
+)
+
+// priceHistoryStub serves fixed price histories; every other GenAIService method is left unimplemented
+type priceHistoryStub struct {
+	GenAIService
+	histories map[string][]dto.PricePoint
+}
+
+func (s priceHistoryStub) GetAssetPriceHistory(symbol string, days int) ([]dto.PricePoint, error) {
+	history, exists := s.histories[symbol]
+	if !exists {
+		return nil, fmt.Errorf("no history for %s", symbol)
+	}
+	return history, nil
+}
+
+func closes(values ...float64) []dto.PricePoint {
+	points := make([]dto.PricePoint, len(values))
+	for i, value := range values {
+		points[i] = dto.PricePoint{Date: fmt.Sprintf("2024-01-%02d", i+2), Close: value}
+	}
+	return points
+}
+
+func TestComputeHoldingsRisk(t *testing.T) {
+	genAIService := priceHistoryStub{histories: map[string][]dto.PricePoint{
+		"SPY":   closes(100, 101, 99, 102),
+		"VTI":   closes(50, 51, 49, 52),
+		"VOD.L": closes(1, 1.1, 1.2, 1.3),
+	}}
+
+	tests := []struct {
+		name         string
+		holdings     map[string]decimal.Decimal
+		fxRates      map[string]decimal.Decimal
+		wantTotal    string
+		wantUnpriced int
+	}{
+		{
+			name:      "holdings in the portfolio currency",
+			holdings:  map[string]decimal.Decimal{"VTI": decimal.MustParse("10")},
+			wantTotal: "620",
+		},
+		{
+			name:      "foreign holdings are converted",
+			holdings:  map[string]decimal.Decimal{"VTI": decimal.MustParse("10")},
+			fxRates:   map[string]decimal.Decimal{"VTI": decimal.MustParse("0.9")},
+			wantTotal: "568",
+		},
+		{
+			name:      "each holding at its own rate",
+			holdings:  map[string]decimal.Decimal{"VTI": decimal.MustParse("10"), "VOD.L": decimal.MustParse("100")},
+			fxRates:   map[string]decimal.Decimal{"VTI": decimal.MustParse("0.9"), "VOD.L": decimal.MustParse("1.15")},
+			wantTotal: "717.5",
+		},
+		{
+			name:         "holdings without history are left out",
+			holdings:     map[string]decimal.Decimal{"VTI": decimal.MustParse("10"), "XYZ": decimal.MustParse("5")},
+			wantTotal:    "620",
+			wantUnpriced: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			risk, err := computeHoldingsRisk(genAIService, tt.holdings, tt.fxRates, decimal.MustParse("100"), "EUR", "SPY", 4)
+			if err != nil {
+				t.Fatalf("computeHoldingsRisk() error = %v", err)
+			}
+			if risk.TotalValue.String() != tt.wantTotal {
+				t.Errorf("TotalValue = %s, want %s", risk.TotalValue, tt.wantTotal)
+			}
+			if len(risk.UnpricedSymbols) != tt.wantUnpriced {
+				t.Errorf("UnpricedSymbols = %v, want %d", risk.UnpricedSymbols, tt.wantUnpriced)
+			}
+			if want := risk.TotalValue.MulFloat(risk.ValueAtRisk).Round(2); !risk.ValueAtRiskAmount.Equal(want) {
+				t.Errorf("ValueAtRiskAmount = %s, want %s", risk.ValueAtRiskAmount, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,241 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/KZY20112001/infinivest-backend/internal/commons"
+	"github.com/KZY20112001/infinivest-backend/internal/dto"
+	"github.com/KZY20112001/infinivest-backend/internal/models"
+)
+
+// allocation percentages may be off by this much from the expected totals due to rounding
+const allocationTolerance = 0.5
+
+func (s *roboPortfolioServiceImpl) UpdateRoboPortfolioAllocation(userID, portfolioID uint, req dto.UpdateAllocationRequest) (*models.RoboPortfolio, error) {
+	portfolio, err := s.repo.GetRoboPortfolioDetails(userID, portfolioID)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateAllocation(req.Portfolio, req.Allocations); err != nil {
+		return nil, err
+	}
+	if err := validateAssetCurrencies(req.Allocations, portfolio.Currency); err != nil {
+		return nil, err
+	}
+	if err := s.ensureAllocationHistory(portfolio); err != nil {
+		return nil, err
+	}
+	applyAllocation(portfolio, req.Portfolio, req.Allocations)
+	version, err := newAllocationVersion(portfolio, "user-edit", time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.UpdateRoboPortfolio(portfolio, version); err != nil {
+		return nil, err
+	}
+	return portfolio, nil
+}
+
+func (s *roboPortfolioServiceImpl) GetAllocationVersions(userID, portfolioID uint) ([]*models.AllocationVersion, error) {
+	portfolio, err := s.repo.GetRoboPortfolioDetails(userID, portfolioID)
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.GetAllocationVersions(portfolio.ID)
+}
+
+func (s *roboPortfolioServiceImpl) DiffAllocationVersions(userID, portfolioID uint, fromVersion, toVersion int) (dto.AllocationDiff, error) {
+	versions, err := s.GetAllocationVersions(userID, portfolioID)
+	if err != nil {
+		return dto.AllocationDiff{}, err
+	}
+	var from, to *models.AllocationVersion
+	for _, version := range versions {
+		if version.Version == fromVersion {
+			from = version
+		}
+		if version.Version == toVersion {
+			to = version
+		}
+	}
+	if from == nil || to == nil {
+		return dto.AllocationDiff{}, fmt.Errorf("allocation versions %d and %d must both exist", fromVersion, toVersion)
+	}
+
+	type targetKey struct{ category, symbol string }
+	changes := make(map[targetKey]*dto.AllocationChange)
+	change := func(target *models.AllocationTarget) *dto.AllocationChange {
+		key := targetKey{target.Category, target.Symbol}
+		if _, exists := changes[key]; !exists {
+			changes[key] = &dto.AllocationChange{Category: target.Category, Symbol: target.Symbol, Name: target.Name}
+		}
+		return changes[key]
+	}
+	for _, target := range from.Targets {
+		change(target).FromPercentage = target.Percentage
+	}
+	for _, target := range to.Targets {
+		change(target).ToPercentage = target.Percentage
+	}
+
+	diff := dto.AllocationDiff{FromVersion: fromVersion, ToVersion: toVersion, Changes: []dto.AllocationChange{}}
+	for _, c := range changes {
+		c.Change = c.ToPercentage - c.FromPercentage
+		if math.Abs(c.Change) > 1e-9 {
+			diff.Changes = append(diff.Changes, *c)
+		}
+	}
+	sort.Slice(diff.Changes, func(i, j int) bool {
+		if diff.Changes[i].Category != diff.Changes[j].Category {
+			return diff.Changes[i].Category < diff.Changes[j].Category
+		}
+		return diff.Changes[i].Symbol < diff.Changes[j].Symbol
+	})
+	return diff, nil
+}
+
+// ensureAllocationHistory records the current targets as the initial version for portfolios created before
+// versions existed. It must be called before the targets are changed.
+func (s *roboPortfolioServiceImpl) ensureAllocationHistory(portfolio *models.RoboPortfolio) error {
+	versions, err := s.repo.GetAllocationVersions(portfolio.ID)
+	if err != nil {
+		return err
+	}
+	if len(versions) > 0 {
+		return nil
+	}
+	version, err := newAllocationVersion(portfolio, "initial", portfolio.CreatedAt)
+	if err != nil {
+		return err
+	}
+	version.Version = 1
+	return s.repo.CreateAllocationVersion(version)
+}
+
+// newAllocationVersion snapshots the portfolio's current targets. The repository numbers the version when it
+// saves it together with the portfolio.
+func newAllocationVersion(portfolio *models.RoboPortfolio, reason string, effectiveAt time.Time) (*models.AllocationVersion, error) {
+	if !commons.AllocationChangeReasons[reason] {
+		return nil, fmt.Errorf("invalid allocation change reason: %s", reason)
+	}
+	version := &models.AllocationVersion{
+		RoboPortfolioID: portfolio.ID,
+		Reason:          reason,
+		EffectiveAt:     effectiveAt,
+	}
+	for _, category := range portfolio.Categories {
+		version.Targets = append(version.Targets, &models.AllocationTarget{
+			Category:   category.Name,
+			Percentage: category.TotalPercentage,
+		})
+		for _, asset := range category.Assets {
+			version.Targets = append(version.Targets, &models.AllocationTarget{
+				Category:   category.Name,
+				Symbol:     asset.Symbol,
+				Name:       asset.Name,
+				Percentage: asset.Percentage,
+			})
+		}
+	}
+	return version, nil
+}
+
+func validateAllocation(categories map[string]float64, allocations map[string]dto.Assets) error {
+	total := 0.0
+	for category, percentage := range categories {
+		if percentage < 0 {
+			return fmt.Errorf("category %s has a negative percentage", category)
+		}
+		total += percentage
+	}
+	if math.Abs(total-100) > allocationTolerance {
+		return fmt.Errorf("category percentages must add up to 100, got %.2f", total)
+	}
+	for category, assets := range allocations {
+		if category == "cash" {
+			return fmt.Errorf("cash cannot hold assets")
+		}
+		percentage, exists := categories[category]
+		if !exists {
+			return fmt.Errorf("assets given for unknown category %s", category)
+		}
+		assetTotal := 0.0
+		for _, asset := range assets.Assets {
+			if asset.Symbol == "" || asset.Percentage < 0 {
+				return fmt.Errorf("invalid asset in category %s", category)
+			}
+			assetTotal += asset.Percentage
+		}
+		if math.Abs(assetTotal-percentage) > allocationTolerance {
+			return fmt.Errorf("assets in category %s must add up to %.2f, got %.2f", category, percentage, assetTotal)
+		}
+	}
+	for category, percentage := range categories {
+		if _, exists := allocations[category]; !exists && category != "cash" && percentage > 0 {
+			return fmt.Errorf("category %s has no assets", category)
+		}
+	}
+	return nil
+}
+
+// validateAssetCurrencies rejects assets quoted in another currency than the portfolio, since robo portfolios value
+// and rebalance every holding in the portfolio currency
+func validateAssetCurrencies(allocations map[string]dto.Assets, currency string) error {
+	for _, assets := range allocations {
+		for _, asset := range assets.Assets {
+			if assetCurrency := commons.SymbolCurrency(asset.Symbol); assetCurrency != currency {
+				return fmt.Errorf("%s is quoted in %s, robo portfolios can only hold assets quoted in %s", asset.Symbol, assetCurrency, currency)
+			}
+		}
+	}
+	return nil
+}
+
+// applyAllocation sets new targets on the portfolio. Holdings are kept: assets that are dropped get a target of 0
+// so the next rebalance sells them, and new assets start without shares so the next rebalance buys them.
+func applyAllocation(portfolio *models.RoboPortfolio, categories map[string]float64, allocations map[string]dto.Assets) {
+	existing := make(map[string]*models.RoboPortfolioCategory)
+	for _, category := range portfolio.Categories {
+		existing[category.Name] = category
+		category.TotalPercentage = categories[category.Name]
+		for _, asset := range category.Assets {
+			asset.Percentage = 0
+		}
+	}
+
+	for name, percentage := range categories {
+		category, exists := existing[name]
+		if !exists {
+			category = &models.RoboPortfolioCategory{
+				RoboPortfolioID: portfolio.ID,
+				Name:            name,
+				TotalPercentage: percentage,
+				Assets:          []*models.RoboPortfolioAsset{},
+			}
+			portfolio.Categories = append(portfolio.Categories, category)
+		}
+
+		for _, target := range allocations[name].Assets {
+			var asset *models.RoboPortfolioAsset
+			for _, candidate := range category.Assets {
+				if candidate.Symbol == target.Symbol {
+					asset = candidate
+					break
+				}
+			}
+			if asset == nil {
+				asset = &models.RoboPortfolioAsset{
+					RoboPortfolioCategoryID: category.ID,
+					Name:                    target.Name,
+					Symbol:                  target.Symbol,
+					Currency:                commons.SymbolCurrency(target.Symbol),
+				}
+				category.Assets = append(category.Assets, asset)
+			}
+			asset.Percentage = target.Percentage
+		}
+	}
+}
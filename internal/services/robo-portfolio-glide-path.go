@@ -0,0 +1,269 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"github.com/KZY20112001/infinivest-backend/internal/analytics"
+	"github.com/KZY20112001/infinivest-backend/internal/commons"
+	"github.com/KZY20112001/infinivest-backend/internal/dto"
+	"github.com/KZY20112001/infinivest-backend/internal/models"
+)
+
+func (s *roboPortfolioServiceImpl) UpdateGlidePath(userID, portfolioID uint, req dto.UpdateGlidePathRequest) (*models.RoboPortfolio, error) {
+	portfolio, err := s.repo.GetRoboPortfolioDetails(userID, portfolioID)
+	if err != nil {
+		return nil, err
+	}
+	if !req.Enabled {
+		portfolio.GlidePathEnabled = false
+		if err := s.repo.UpdateGlidePath(portfolio); err != nil {
+			return nil, err
+		}
+		return portfolio, nil
+	}
+
+	if req.Curve == "" {
+		req.Curve = "linear"
+	}
+	if !commons.GlidePathCurves[req.Curve] {
+		return nil, fmt.Errorf("invalid glide path curve: %s", req.Curve)
+	}
+
+	var targetDate time.Time
+	if req.TargetDate != "" {
+		parsed, err := time.Parse("2006-01-02", req.TargetDate)
+		if err != nil {
+			return nil, fmt.Errorf("invalid target date: %s", req.TargetDate)
+		}
+		targetDate = parsed
+	} else {
+		profile, err := s.profileService.GetProfile(userID)
+		if err != nil {
+			return nil, fmt.Errorf("target date is required when no profile is set up: %w", err)
+		}
+		years, err := commons.ParseInvestmentHorizon(profile.InvestmentHorizon)
+		if err != nil {
+			return nil, err
+		}
+		targetDate = time.Now().AddDate(years, 0, 0)
+	}
+	if !targetDate.After(time.Now()) {
+		return nil, fmt.Errorf("target date must be in the future")
+	}
+
+	endEquity, endCash := commons.DefaultGlidePathEndEquity, commons.DefaultGlidePathEndCash
+	if req.EndEquityPercentage != nil {
+		endEquity = *req.EndEquityPercentage
+	}
+	if req.EndCashPercentage != nil {
+		endCash = *req.EndCashPercentage
+	}
+	if endEquity < 0 || endCash < 0 || endEquity+endCash > 100 {
+		return nil, fmt.Errorf("end equity and cash percentages must be positive and add up to at most 100")
+	}
+
+	if !hasCategory(portfolio, "cash") {
+		return nil, fmt.Errorf("a glide path needs a cash category")
+	}
+	startEquity, _, startCash := glidePathWeights(portfolio)
+	if endEquity > startEquity {
+		return nil, fmt.Errorf("end equity percentage cannot be above the current %.2f%%", startEquity)
+	}
+	if endEquity+endCash < 100 && !hasInvestableCategory(portfolio, "bond") {
+		return nil, fmt.Errorf("a glide path needs a bond category with assets to move into")
+	}
+	if endEquity > 0 && !hasInvestableCategory(portfolio, "equity") {
+		return nil, fmt.Errorf("a glide path needs an equity category with assets")
+	}
+
+	now := time.Now()
+	portfolio.GlidePathEnabled = true
+	portfolio.GlidePathCurve = req.Curve
+	portfolio.GlidePathStartDate = &now
+	portfolio.GlidePathTargetDate = &targetDate
+	portfolio.GlidePathStartEquity = startEquity
+	portfolio.GlidePathStartCash = startCash
+	portfolio.GlidePathEndEquity = endEquity
+	portfolio.GlidePathEndCash = endCash
+	if err := s.repo.UpdateGlidePath(portfolio); err != nil {
+		return nil, err
+	}
+	return portfolio, nil
+}
+
+func (s *roboPortfolioServiceImpl) GetGlidePath(userID, portfolioID uint) (dto.GlidePathResponse, error) {
+	portfolio, err := s.repo.GetRoboPortfolioDetails(userID, portfolioID)
+	if err != nil {
+		return dto.GlidePathResponse{}, err
+	}
+	equity, bonds, cash := glidePathWeights(portfolio)
+	response := dto.GlidePathResponse{
+		Enabled:    portfolio.GlidePathEnabled,
+		Curve:      portfolio.GlidePathCurve,
+		StartDate:  portfolio.GlidePathStartDate,
+		TargetDate: portfolio.GlidePathTargetDate,
+		Current:    dto.GlidePathPoint{Date: time.Now(), EquityPercentage: equity, BondPercentage: bonds, CashPercentage: cash},
+		Schedule:   []dto.GlidePathPoint{},
+	}
+	if !portfolio.GlidePathEnabled || portfolio.GlidePathStartDate == nil || portfolio.GlidePathTargetDate == nil {
+		return response, nil
+	}
+
+	// one point per year from now until the target date
+	for date := time.Now(); date.Before(*portfolio.GlidePathTargetDate); date = date.AddDate(1, 0, 0) {
+		response.Schedule = append(response.Schedule, glidePathPoint(portfolio, date))
+	}
+	response.Schedule = append(response.Schedule, glidePathPoint(portfolio, *portfolio.GlidePathTargetDate))
+	return response, nil
+}
+
+// applyGlidePath moves the category targets to where the glide path should be now. Equity categories are scaled
+// together, as are bond categories, so the mix within each group and within each category is kept.
+// When the targets changed it returns their allocation version, which the caller saves together with them.
+func (s *roboPortfolioServiceImpl) applyGlidePath(portfolio *models.RoboPortfolio) (*models.AllocationVersion, error) {
+	if !portfolio.GlidePathEnabled || portfolio.GlidePathStartDate == nil || portfolio.GlidePathTargetDate == nil {
+		return nil, nil
+	}
+	target := glidePathPoint(portfolio, time.Now())
+	equity, _, cash := glidePathWeights(portfolio)
+	if math.Abs(target.EquityPercentage-equity) < commons.GlidePathStep && math.Abs(target.CashPercentage-cash) < commons.GlidePathStep {
+		return nil, nil
+	}
+
+	if !hasCategory(portfolio, "cash") {
+		return nil, fmt.Errorf("portfolio %d has no cash category to hold %.2f%% of the portfolio", portfolio.ID, target.CashPercentage)
+	}
+
+	if err := s.ensureAllocationHistory(portfolio); err != nil {
+		return nil, err
+	}
+	if err := scaleCategoryGroup(portfolio, "equity", target.EquityPercentage); err != nil {
+		return nil, err
+	}
+	if err := scaleCategoryGroup(portfolio, "bond", target.BondPercentage); err != nil {
+		return nil, err
+	}
+	for _, category := range portfolio.Categories {
+		if category.Name == "cash" {
+			category.TotalPercentage = target.CashPercentage
+		}
+	}
+	return newAllocationVersion(portfolio, "glide-path", time.Now())
+}
+
+// notifyGlidePath tells the user where the glide path moved the targets, once they are saved
+func (s *roboPortfolioServiceImpl) notifyGlidePath(ctx context.Context, portfolio *models.RoboPortfolio) {
+	equity, bonds, cash := glidePathWeights(portfolio)
+	message := fmt.Sprintf("Glide path for portfolio %s moved targets to %.1f%% equities, %.1f%% bonds and %.1f%% cash",
+		portfolio.Name, equity, bonds, cash)
+	if err := s.notificationService.AddNotification(ctx, portfolio.UserID, "glide-path", message); err != nil {
+		log.Printf("Error adding glide path notification for user %d: %v\n", portfolio.UserID, err)
+	}
+}
+
+func glidePathPoint(portfolio *models.RoboPortfolio, date time.Time) dto.GlidePathPoint {
+	progress := glidePathProgress(portfolio.GlidePathCurve, *portfolio.GlidePathStartDate, *portfolio.GlidePathTargetDate, date)
+	equity := portfolio.GlidePathStartEquity + (portfolio.GlidePathEndEquity-portfolio.GlidePathStartEquity)*progress
+	cash := portfolio.GlidePathStartCash + (portfolio.GlidePathEndCash-portfolio.GlidePathStartCash)*progress
+	return dto.GlidePathPoint{
+		Date:             date,
+		EquityPercentage: equity,
+		BondPercentage:   math.Max(100-equity-cash, 0),
+		CashPercentage:   cash,
+	}
+}
+
+// glidePathProgress returns how far along the curve the glide path is, from 0 at the start to 1 at the target date
+func glidePathProgress(curve string, start, target, date time.Time) float64 {
+	total := target.Sub(start)
+	if total <= 0 {
+		return 1
+	}
+	progress := math.Min(math.Max(float64(date.Sub(start))/float64(total), 0), 1)
+	switch curve {
+	case "early":
+		return 1 - (1-progress)*(1-progress)
+	case "late":
+		return progress * progress
+	default:
+		return progress
+	}
+}
+
+// glidePathWeights returns the current equity, bond and cash targets in percent
+func glidePathWeights(portfolio *models.RoboPortfolio) (float64, float64, float64) {
+	equity, bonds, cash := 0.0, 0.0, 0.0
+	for _, category := range portfolio.Categories {
+		switch analytics.CategoryClass(category.Name) {
+		case "cash":
+			cash += category.TotalPercentage
+		case "equity":
+			equity += category.TotalPercentage
+		case "bond":
+			bonds += category.TotalPercentage
+		}
+	}
+	return equity, bonds, cash
+}
+
+func hasCategory(portfolio *models.RoboPortfolio, name string) bool {
+	for _, category := range portfolio.Categories {
+		if category.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func hasInvestableCategory(portfolio *models.RoboPortfolio, class string) bool {
+	for _, category := range portfolio.Categories {
+		if analytics.CategoryClass(category.Name) == class && len(category.Assets) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// scaleCategoryGroup sets the combined target of the categories of one class, keeping their relative weights.
+// Categories without assets are left out; when none of the rest has a target the total is split evenly.
+func scaleCategoryGroup(portfolio *models.RoboPortfolio, class string, total float64) error {
+	var categories []*models.RoboPortfolioCategory
+	current := 0.0
+	for _, category := range portfolio.Categories {
+		if analytics.CategoryClass(category.Name) == class && len(category.Assets) > 0 {
+			categories = append(categories, category)
+			current += category.TotalPercentage
+		}
+	}
+	if len(categories) == 0 {
+		if total > 0 {
+			return fmt.Errorf("no categories with assets to hold %.2f%% of the portfolio", total)
+		}
+		return nil
+	}
+
+	for _, category := range categories {
+		share := 1 / float64(len(categories))
+		if current > 0 {
+			share = category.TotalPercentage / current
+		}
+		scaleCategory(category, total*share)
+	}
+	return nil
+}
+
+func scaleCategory(category *models.RoboPortfolioCategory, percentage float64) {
+	previous := category.TotalPercentage
+	category.TotalPercentage = percentage
+	for _, asset := range category.Assets {
+		if previous > 0 {
+			asset.Percentage = asset.Percentage * percentage / previous
+		} else {
+			asset.Percentage = percentage / float64(len(category.Assets))
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package services
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/KZY20112001/infinivest-backend/internal/models"
+)
+
+func TestGlidePathProgress(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	target := start.AddDate(10, 0, 0)
+	halfway := start.Add(target.Sub(start) / 2)
+
+	tests := []struct {
+		name   string
+		curve  string
+		target time.Time
+		date   time.Time
+		want   float64
+	}{
+		{name: "linear at the start", curve: "linear", target: target, date: start, want: 0},
+		{name: "linear halfway", curve: "linear", target: target, date: halfway, want: 0.5},
+		{name: "linear at the target", curve: "linear", target: target, date: target, want: 1},
+		{name: "early halfway", curve: "early", target: target, date: halfway, want: 0.75},
+		{name: "late halfway", curve: "late", target: target, date: halfway, want: 0.25},
+		{name: "unknown curve is linear", curve: "", target: target, date: halfway, want: 0.5},
+		{name: "before the start", curve: "linear", target: target, date: start.AddDate(-1, 0, 0), want: 0},
+		{name: "after the target", curve: "early", target: target, date: target.AddDate(1, 0, 0), want: 1},
+		{name: "target not after the start", curve: "linear", target: start, date: start, want: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := glidePathProgress(tt.curve, start, tt.target, tt.date); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("glidePathProgress() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGlidePathPoint(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	target := start.AddDate(10, 0, 0)
+	portfolio := &models.RoboPortfolio{
+		GlidePathCurve:       "linear",
+		GlidePathStartDate:   &start,
+		GlidePathTargetDate:  &target,
+		GlidePathStartEquity: 80,
+		GlidePathStartCash:   5,
+		GlidePathEndEquity:   30,
+		GlidePathEndCash:     15,
+	}
+
+	tests := []struct {
+		name                string
+		date                time.Time
+		equity, bonds, cash float64
+	}{
+		{name: "start", date: start, equity: 80, bonds: 15, cash: 5},
+		{name: "halfway", date: start.Add(target.Sub(start) / 2), equity: 55, bonds: 35, cash: 10},
+		{name: "target", date: target, equity: 30, bonds: 55, cash: 15},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			point := glidePathPoint(portfolio, tt.date)
+			if math.Abs(point.EquityPercentage-tt.equity) > 1e-9 ||
+				math.Abs(point.BondPercentage-tt.bonds) > 1e-9 ||
+				math.Abs(point.CashPercentage-tt.cash) > 1e-9 {
+				t.Errorf("glidePathPoint() = %.2f/%.2f/%.2f, want %.2f/%.2f/%.2f", point.EquityPercentage, point.BondPercentage,
+					point.CashPercentage, tt.equity, tt.bonds, tt.cash)
+			}
+		})
+	}
+}
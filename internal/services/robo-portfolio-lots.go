@@ -0,0 +1,114 @@
+package services
+
+import (
+	"sort"
+	"time"
+
+	"github.com/KZY20112001/infinivest-backend/internal/commons"
+	"github.com/KZY20112001/infinivest-backend/internal/commons/decimal"
+	"github.com/KZY20112001/infinivest-backend/internal/models"
+)
+
+// ensureLots backfills a single lot at the average buy price for shares bought before lots were tracked
+func ensureLots(asset *models.RoboPortfolioAsset) {
+	tracked := decimal.Zero
+	for _, lot := range asset.Lots {
+		tracked = tracked.Add(lot.SharesRemaining)
+	}
+	if untracked := asset.SharesOwned.Sub(tracked); untracked.IsPositive() {
+		backfilled := &models.RoboPortfolioLot{
+			RoboPortfolioAssetID: asset.ID,
+			SharesRemaining:      untracked,
+			CostPerShare:         asset.AvgBuyPrice,
+			AcquiredAt:           asset.CreatedAt,
+		}
+		asset.Lots = append([]*models.RoboPortfolioLot{backfilled}, asset.Lots...)
+	}
+}
+
+// lotsCostBasis returns the cost basis of the open lots of an asset
+func lotsCostBasis(asset *models.RoboPortfolioAsset) decimal.Decimal {
+	ensureLots(asset)
+	costBasis := decimal.Zero
+	for _, lot := range asset.Lots {
+		costBasis = costBasis.Add(lot.SharesRemaining.Mul(lot.CostPerShare))
+	}
+	return commons.RoundCash(costBasis, asset.Currency)
+}
+
+// buyShares adds the shares to the asset, opens a new lot for them and returns what they cost
+func buyShares(asset *models.RoboPortfolioAsset, shares, price decimal.Decimal) decimal.Decimal {
+	ensureLots(asset)
+	cost := commons.RoundCash(shares.Mul(price), asset.Currency)
+	asset.SharesOwned = asset.SharesOwned.Add(shares)
+	asset.TotalInvested = asset.TotalInvested.Add(cost)
+	if asset.SharesOwned.IsPositive() {
+		asset.AvgBuyPrice = commons.RoundPrice(asset.TotalInvested.Div(asset.SharesOwned))
+	}
+	asset.Lots = append(asset.Lots, &models.RoboPortfolioLot{
+		RoboPortfolioAssetID: asset.ID,
+		SharesRemaining:      shares,
+		CostPerShare:         price,
+		AcquiredAt:           time.Now(),
+	})
+	return cost
+}
+
+// lotOrder reports whether lot a should be sold before lot b
+type lotOrder func(a, b *models.RoboPortfolioLot) bool
+
+func oldestLotsFirst(a, b *models.RoboPortfolioLot) bool {
+	return a.AcquiredAt.Before(b.AcquiredAt)
+}
+
+func highestCostLotsFirst(a, b *models.RoboPortfolioLot) bool {
+	return a.CostPerShare.GreaterThan(b.CostPerShare)
+}
+
+// sellShares removes the shares from the oldest lots first and returns the cost basis of the shares sold
+func sellShares(asset *models.RoboPortfolioAsset, shares decimal.Decimal) decimal.Decimal {
+	return sellSharesInOrder(asset, shares, oldestLotsFirst)
+}
+
+// estimateCostBasis returns the cost basis sellSharesInOrder would realise without changing the asset
+func estimateCostBasis(asset *models.RoboPortfolioAsset, shares decimal.Decimal, order lotOrder) decimal.Decimal {
+	ensureLots(asset)
+	clone := *asset
+	clone.Lots = make([]*models.RoboPortfolioLot, len(asset.Lots))
+	for i, lot := range asset.Lots {
+		lotCopy := *lot
+		clone.Lots[i] = &lotCopy
+	}
+	return sellSharesInOrder(&clone, shares, order)
+}
+
+func sellSharesInOrder(asset *models.RoboPortfolioAsset, shares decimal.Decimal, order lotOrder) decimal.Decimal {
+	ensureLots(asset)
+	shares = decimal.Min(shares, asset.SharesOwned)
+	sort.SliceStable(asset.Lots, func(i, j int) bool {
+		return order(asset.Lots[i], asset.Lots[j])
+	})
+
+	costBasis := decimal.Zero
+	remaining := shares
+	for _, lot := range asset.Lots {
+		if !remaining.IsPositive() {
+			break
+		}
+		sold := decimal.Min(remaining, lot.SharesRemaining)
+		lot.SharesRemaining = lot.SharesRemaining.Sub(sold)
+		remaining = remaining.Sub(sold)
+		costBasis = costBasis.Add(sold.Mul(lot.CostPerShare))
+	}
+	costBasis = commons.RoundCash(costBasis, asset.Currency)
+
+	asset.SharesOwned = asset.SharesOwned.Sub(shares)
+	asset.TotalInvested = decimal.Max(asset.TotalInvested.Sub(costBasis), decimal.Zero)
+	if !asset.SharesOwned.IsPositive() {
+		asset.SharesOwned = decimal.Zero
+		asset.TotalInvested = decimal.Zero
+	} else {
+		asset.AvgBuyPrice = commons.RoundPrice(asset.TotalInvested.Div(asset.SharesOwned))
+	}
+	return costBasis
+}
@@ -0,0 +1,122 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/KZY20112001/infinivest-backend/internal/commons/decimal"
+	"github.com/KZY20112001/infinivest-backend/internal/models"
+)
+
+// lotsAsset holds 5 shares bought at 10 in 2020 and 5 at 20 in 2021, plus any shares bought before lots were tracked
+func lotsAsset(untracked string) *models.RoboPortfolioAsset {
+	shares := decimal.MustParse("10").Add(decimal.MustParse(untracked))
+	asset := &models.RoboPortfolioAsset{
+		Currency:      "USD",
+		SharesOwned:   shares,
+		AvgBuyPrice:   decimal.MustParse("8"),
+		TotalInvested: decimal.MustParse("150").Add(decimal.MustParse(untracked).Mul(decimal.MustParse("8"))),
+		Lots: []*models.RoboPortfolioLot{
+			{SharesRemaining: decimal.MustParse("5"), CostPerShare: decimal.MustParse("20"), AcquiredAt: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)},
+			{SharesRemaining: decimal.MustParse("5"), CostPerShare: decimal.MustParse("10"), AcquiredAt: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)},
+		},
+	}
+	asset.CreatedAt = time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	return asset
+}
+
+func TestSellSharesInOrder(t *testing.T) {
+	tests := []struct {
+		name          string
+		untracked     string
+		shares        string
+		order         lotOrder
+		wantCostBasis string
+		wantShares    string
+		wantInvested  string
+		wantAvgPrice  string
+	}{
+		{name: "oldest lots first", untracked: "0", shares: "7", order: oldestLotsFirst, wantCostBasis: "90", wantShares: "3", wantInvested: "60", wantAvgPrice: "20"},
+		{name: "highest cost lots first", untracked: "0", shares: "7", order: highestCostLotsFirst, wantCostBasis: "120", wantShares: "3", wantInvested: "30", wantAvgPrice: "10"},
+		{name: "fractional shares", untracked: "0", shares: "0.333", order: oldestLotsFirst, wantCostBasis: "3.33", wantShares: "9.667", wantInvested: "146.67", wantAvgPrice: "15.1722"},
+		{name: "more than owned sells everything", untracked: "0", shares: "12", order: oldestLotsFirst, wantCostBasis: "150", wantShares: "0", wantInvested: "0", wantAvgPrice: "8"},
+		{name: "untracked shares are backfilled", untracked: "2", shares: "3", order: oldestLotsFirst, wantCostBasis: "26", wantShares: "9", wantInvested: "140", wantAvgPrice: "15.5556"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			asset := lotsAsset(tt.untracked)
+			costBasis := sellSharesInOrder(asset, decimal.MustParse(tt.shares), tt.order)
+			if costBasis.String() != tt.wantCostBasis {
+				t.Errorf("cost basis = %s, want %s", costBasis, tt.wantCostBasis)
+			}
+			if asset.SharesOwned.String() != tt.wantShares {
+				t.Errorf("SharesOwned = %s, want %s", asset.SharesOwned, tt.wantShares)
+			}
+			if asset.TotalInvested.String() != tt.wantInvested {
+				t.Errorf("TotalInvested = %s, want %s", asset.TotalInvested, tt.wantInvested)
+			}
+			if asset.AvgBuyPrice.String() != tt.wantAvgPrice {
+				t.Errorf("AvgBuyPrice = %s, want %s", asset.AvgBuyPrice, tt.wantAvgPrice)
+			}
+			remaining := decimal.Zero
+			for _, lot := range asset.Lots {
+				if lot.SharesRemaining.IsNegative() {
+					t.Errorf("lot at %s has %s shares", lot.CostPerShare, lot.SharesRemaining)
+				}
+				remaining = remaining.Add(lot.SharesRemaining)
+			}
+			if !remaining.Equal(asset.SharesOwned) {
+				t.Errorf("lots hold %s shares, want %s", remaining, asset.SharesOwned)
+			}
+		})
+	}
+}
+
+func TestEstimateCostBasisLeavesAssetUnchanged(t *testing.T) {
+	asset := lotsAsset("0")
+	if got := estimateCostBasis(asset, decimal.MustParse("7"), highestCostLotsFirst); got.String() != "120" {
+		t.Errorf("estimateCostBasis() = %s, want 120", got)
+	}
+	if asset.SharesOwned.String() != "10" || asset.TotalInvested.String() != "150" {
+		t.Errorf("asset changed to %s shares and %s invested", asset.SharesOwned, asset.TotalInvested)
+	}
+	for _, lot := range asset.Lots {
+		if lot.SharesRemaining.String() != "5" {
+			t.Errorf("lot at %s has %s shares, want 5", lot.CostPerShare, lot.SharesRemaining)
+		}
+	}
+}
+
+func TestBuyShares(t *testing.T) {
+	tests := []struct {
+		name         string
+		untracked    string
+		shares       string
+		price        string
+		wantCost     string
+		wantLots     int
+		wantAvgPrice string
+	}{
+		{name: "whole shares", untracked: "0", shares: "5", price: "30", wantCost: "150", wantLots: 3, wantAvgPrice: "20"},
+		{name: "cost rounds to cents", untracked: "0", shares: "2.5", price: "12.345", wantCost: "30.86", wantLots: 3, wantAvgPrice: "14.4688"},
+		{name: "untracked shares are backfilled first", untracked: "2", shares: "1", price: "10", wantCost: "10", wantLots: 4, wantAvgPrice: "13.5385"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			asset := lotsAsset(tt.untracked)
+			cost := buyShares(asset, decimal.MustParse(tt.shares), decimal.MustParse(tt.price))
+			if cost.String() != tt.wantCost {
+				t.Errorf("cost = %s, want %s", cost, tt.wantCost)
+			}
+			if len(asset.Lots) != tt.wantLots {
+				t.Errorf("got %d lots, want %d", len(asset.Lots), tt.wantLots)
+			}
+			if asset.AvgBuyPrice.String() != tt.wantAvgPrice {
+				t.Errorf("AvgBuyPrice = %s, want %s", asset.AvgBuyPrice, tt.wantAvgPrice)
+			}
+			if got := lotsCostBasis(asset); !got.Equal(asset.TotalInvested) {
+				t.Errorf("lots cost basis = %s, want %s", got, asset.TotalInvested)
+			}
+		})
+	}
+}
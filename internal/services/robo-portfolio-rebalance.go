@@ -0,0 +1,144 @@
+package services
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/KZY20112001/infinivest-backend/internal/commons"
+	"github.com/KZY20112001/infinivest-backend/internal/commons/decimal"
+	"github.com/KZY20112001/infinivest-backend/internal/models"
+)
+
+// rebalanceTrades collects the transactions made by a single rebalance and charges the fee on each.
+// The rebalance saves them together with its event, a nil *rebalanceTrades means trades are saved as they are made.
+type rebalanceTrades struct {
+	mu           sync.Mutex
+	feeRate      float64
+	currency     string // fees are rounded to its minor unit
+	fees         decimal.Decimal
+	transactions []*models.RoboPortfolioTransaction
+}
+
+// add sets the fee on the transaction and queues it to be saved with the rebalance
+func (t *rebalanceTrades) add(transaction *models.RoboPortfolioTransaction) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	transaction.Fee = commons.RoundCash(transaction.TotalAmount.MulFloat(t.feeRate), t.currency)
+	t.fees = t.fees.Add(transaction.Fee)
+	t.transactions = append(t.transactions, transaction)
+}
+
+// recordTrade queues a trade made by a rebalance, or saves one made outside a rebalance straight away
+func (s *roboPortfolioServiceImpl) recordTrade(trades *rebalanceTrades, transaction *models.RoboPortfolioTransaction) error {
+	if trades == nil {
+		return s.repo.CreateRoboPortfolioTransaction(transaction)
+	}
+	trades.add(transaction)
+	return nil
+}
+
+// withinRebalanceThreshold reports whether a holding is close enough to its target to be left alone;
+// threshold is the allowed deviation in percent of the target value
+func withinRebalanceThreshold(curValue, targetValue decimal.Decimal, threshold float64) bool {
+	return curValue.Sub(targetValue).Abs().LessThanOrEqual(targetValue.MulFloat(threshold/100)) || (curValue.IsZero() && targetValue.IsZero())
+}
+
+// withinDriftBand reports whether a holding's weight is at most band percentage points away from its target weight
+func withinDriftBand(curValue, targetValue, totalValue decimal.Decimal, band float64) bool {
+	if !totalValue.IsPositive() {
+		return true
+	}
+	return percentOf(curValue.Sub(targetValue).Abs(), totalValue) <= band
+}
+
+// percentOf returns value as a percentage of total, which must be positive
+func percentOf(value, total decimal.Decimal) float64 {
+	return value.Div(total).Float64() * 100
+}
+
+type holdingSnapshot struct {
+	category string
+	name     string
+	weight   float64
+	target   float64
+}
+
+// snapshotWeights returns each holding's share of the portfolio keyed by symbol, with cash under "",
+// together with the portfolio value at the given prices
+func snapshotWeights(portfolio *models.RoboPortfolio, latestAssetPrices map[string]decimal.Decimal) (map[string]holdingSnapshot, decimal.Decimal) {
+	values := make(map[string]decimal.Decimal)
+	snapshot := make(map[string]holdingSnapshot)
+	totalValue := decimal.Zero
+	for _, category := range portfolio.Categories {
+		if category.Name == "cash" {
+			values[""] = values[""].Add(category.TotalAmount)
+			totalValue = totalValue.Add(category.TotalAmount)
+			snapshot[""] = holdingSnapshot{category: category.Name, target: category.TotalPercentage}
+			continue
+		}
+		for _, asset := range category.Assets {
+			value := commons.RoundCash(asset.SharesOwned.Mul(latestAssetPrices[asset.Symbol]), portfolio.Currency)
+			values[asset.Symbol] = values[asset.Symbol].Add(value)
+			totalValue = totalValue.Add(value)
+			snapshot[asset.Symbol] = holdingSnapshot{category: category.Name, name: asset.Name, target: asset.Percentage}
+		}
+	}
+	if totalValue.IsPositive() {
+		for symbol, holding := range snapshot {
+			holding.weight = percentOf(values[symbol], totalValue)
+			snapshot[symbol] = holding
+		}
+	}
+	return snapshot, totalValue
+}
+
+// rebalanceEventAssets builds the per-holding rows of a rebalance event from the snapshots and trades
+func rebalanceEventAssets(before, after map[string]holdingSnapshot, latestAssetPrices map[string]decimal.Decimal, trades *rebalanceTrades) []*models.RebalanceEventAsset {
+	rows := make(map[string]*models.RebalanceEventAsset)
+	row := func(symbol string) *models.RebalanceEventAsset {
+		if existing, exists := rows[symbol]; exists {
+			return existing
+		}
+		res := &models.RebalanceEventAsset{Symbol: symbol, Price: latestAssetPrices[symbol]}
+		rows[symbol] = res
+		return res
+	}
+
+	for symbol, holding := range before {
+		r := row(symbol)
+		r.Category, r.Name, r.WeightBefore = holding.category, holding.name, holding.weight
+	}
+	// holdings that were swapped out no longer have a target
+	for symbol, holding := range after {
+		r := row(symbol)
+		r.Category, r.Name, r.WeightAfter, r.TargetWeight = holding.category, holding.name, holding.weight, holding.target
+	}
+	for _, transaction := range trades.transactions {
+		if transaction.Symbol == nil || transaction.SharesAmount == nil {
+			continue
+		}
+		r := row(*transaction.Symbol)
+		shares, amount := *transaction.SharesAmount, transaction.TotalAmount
+		if transaction.TransactionType == "sell" || transaction.TransactionType == "harvest:sell" {
+			shares, amount = shares.Neg(), amount.Neg()
+		}
+		r.SharesTraded = r.SharesTraded.Add(shares)
+		r.AmountTraded = r.AmountTraded.Add(amount)
+		r.Fee = r.Fee.Add(transaction.Fee)
+		if transaction.Price != nil {
+			r.Price = *transaction.Price
+		}
+	}
+
+	res := make([]*models.RebalanceEventAsset, 0, len(rows))
+	for _, r := range rows {
+		res = append(res, r)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Category != res[j].Category {
+			return res[i].Category < res[j].Category
+		}
+		return res[i].Symbol < res[j].Symbol
+	})
+	return res
+}
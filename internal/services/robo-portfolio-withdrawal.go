@@ -0,0 +1,297 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/KZY20112001/infinivest-backend/internal/commons"
+	"github.com/KZY20112001/infinivest-backend/internal/commons/decimal"
+	"github.com/KZY20112001/infinivest-backend/internal/dto"
+	"github.com/KZY20112001/infinivest-backend/internal/models"
+)
+
+// withdrawals are considered complete when they are short by less than a cent
+var withdrawalTolerance = decimal.MustParse("0.005")
+
+// portfolioHolding is a single asset, or the cash category when asset is nil, valued at the latest price
+type portfolioHolding struct {
+	category *models.RoboPortfolioCategory
+	asset    *models.RoboPortfolioAsset
+	price    decimal.Decimal
+	value    decimal.Decimal
+	target   float64 // percent of the portfolio
+}
+
+type withdrawalPlan struct {
+	result   dto.WithdrawalResult
+	holdings []*portfolioHolding
+	amounts  []decimal.Decimal // amount taken from each holding
+	shares   []decimal.Decimal // shares sold of each asset
+	order    lotOrder
+}
+
+func (s *roboPortfolioServiceImpl) getPortfolioHoldings(portfolio *models.RoboPortfolio) ([]*portfolioHolding, decimal.Decimal, error) {
+	latestAssetPrices := make(map[string]decimal.Decimal)
+	totalValue, _, err := s.getPortfolioValue(portfolio, latestAssetPrices)
+	if err != nil {
+		return nil, decimal.Zero, err
+	}
+	var holdings []*portfolioHolding
+	for _, category := range portfolio.Categories {
+		if category.Name == "cash" {
+			holdings = append(holdings, &portfolioHolding{category: category, value: category.TotalAmount, target: category.TotalPercentage})
+			continue
+		}
+		for _, asset := range category.Assets {
+			price := latestAssetPrices[asset.Symbol]
+			holdings = append(holdings, &portfolioHolding{
+				category: category,
+				asset:    asset,
+				price:    price,
+				value:    commons.RoundCash(asset.SharesOwned.Mul(price), portfolio.Currency),
+				target:   asset.Percentage,
+			})
+		}
+	}
+	return holdings, totalValue, nil
+}
+
+// planWithdrawal decides what to sell for a withdrawal without changing the portfolio.
+// "pro-rata" and "min-gains" spend cash first; "pro-rata" then sells by target percentage, "min-gains" sells
+// the lots with the highest cost relative to the current price. "overweight-first" takes from the holdings that
+// would be above target after the withdrawal, cash included.
+func (s *roboPortfolioServiceImpl) planWithdrawal(portfolio *models.RoboPortfolio, amount decimal.Decimal, strategy string) (*withdrawalPlan, error) {
+	if !commons.WithdrawalStrategies[strategy] {
+		return nil, fmt.Errorf("invalid withdrawal strategy: %s", strategy)
+	}
+	holdings, totalValue, err := s.getPortfolioHoldings(portfolio)
+	if err != nil {
+		return nil, err
+	}
+
+	amount = commons.RoundCash(amount, portfolio.Currency)
+	plan := &withdrawalPlan{
+		holdings: holdings,
+		amounts:  make([]decimal.Decimal, len(holdings)),
+		shares:   make([]decimal.Decimal, len(holdings)),
+		order:    oldestLotsFirst,
+	}
+	remaining := decimal.Min(amount, totalValue)
+	available := func(i int) decimal.Decimal {
+		return holdings[i].value.Sub(plan.amounts[i])
+	}
+
+	switch strategy {
+	case "overweight-first":
+		totalAfter := totalValue.Sub(remaining)
+		excess := make([]decimal.Decimal, len(holdings))
+		totalExcess := decimal.Zero
+		for i, holding := range holdings {
+			excess[i] = decimal.Max(holding.value.Sub(totalAfter.MulFloat(holding.target/100)), decimal.Zero)
+			totalExcess = totalExcess.Add(excess[i])
+		}
+		if totalExcess.IsPositive() {
+			taken := decimal.Min(remaining, totalExcess)
+			for i := range holdings {
+				plan.amounts[i] = taken.Mul(excess[i]).Div(totalExcess)
+			}
+			remaining = remaining.Sub(taken)
+		}
+		remaining = splitProRata(holdings, plan.amounts, remaining, func(holding *portfolioHolding) bool { return true })
+
+	case "min-gains":
+		plan.order = highestCostLotsFirst
+		remaining = takeCash(holdings, plan.amounts, remaining)
+
+		type lotCandidate struct {
+			index int
+			lot   *models.RoboPortfolioLot
+			ratio decimal.Decimal
+		}
+		var candidates []lotCandidate
+		for i, holding := range holdings {
+			if holding.asset == nil || !holding.price.IsPositive() {
+				continue
+			}
+			ensureLots(holding.asset)
+			for _, lot := range holding.asset.Lots {
+				if lot.SharesRemaining.IsPositive() {
+					candidates = append(candidates, lotCandidate{index: i, lot: lot, ratio: lot.CostPerShare.Div(holding.price)})
+				}
+			}
+		}
+		// lots whose cost is highest relative to the price realise the smallest gain per dollar sold
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return candidates[i].ratio.GreaterThan(candidates[j].ratio)
+		})
+		for _, candidate := range candidates {
+			if remaining.LessThanOrEqual(withdrawalTolerance) {
+				break
+			}
+			lotValue := candidate.lot.SharesRemaining.Mul(holdings[candidate.index].price)
+			taken := decimal.Min(remaining, lotValue, available(candidate.index))
+			plan.amounts[candidate.index] = plan.amounts[candidate.index].Add(taken)
+			remaining = remaining.Sub(taken)
+		}
+
+	default:
+		remaining = takeCash(holdings, plan.amounts, remaining)
+		remaining = splitProRata(holdings, plan.amounts, remaining, func(holding *portfolioHolding) bool { return holding.asset != nil })
+	}
+
+	// the sales below are sized in whole units of share precision, so the shortfall is judged before rounding them
+	shortfall := amount.Sub(decimal.Min(amount, totalValue)).Add(remaining)
+	result := dto.WithdrawalResult{Strategy: strategy, RequestedAmount: amount, Partial: shortfall.GreaterThan(withdrawalTolerance)}
+	for i, holding := range holdings {
+		if !plan.amounts[i].IsPositive() {
+			plan.amounts[i] = decimal.Zero
+			continue
+		}
+		if holding.asset == nil {
+			plan.amounts[i] = commons.RoundCash(plan.amounts[i], portfolio.Currency)
+			result.WithdrawnAmount = result.WithdrawnAmount.Add(plan.amounts[i])
+			result.CashUsed = result.CashUsed.Add(plan.amounts[i])
+			continue
+		}
+		shares := decimal.Min(commons.RoundShares(plan.amounts[i].Div(holding.price)), holding.asset.SharesOwned)
+		// a holding taken to within the tolerance is sold out rather than left with a fraction of a share
+		if holding.value.Sub(plan.amounts[i]).LessThanOrEqual(withdrawalTolerance) {
+			shares = holding.asset.SharesOwned
+		}
+		taken := commons.RoundCash(shares.Mul(holding.price), portfolio.Currency)
+		plan.shares[i], plan.amounts[i] = shares, taken
+		if !shares.IsPositive() {
+			continue
+		}
+		result.WithdrawnAmount = result.WithdrawnAmount.Add(taken)
+		costBasis := estimateCostBasis(holding.asset, shares, plan.order)
+		result.Sales = append(result.Sales, dto.WithdrawalSale{
+			Category:     holding.category.Name,
+			Symbol:       holding.asset.Symbol,
+			Name:         holding.asset.Name,
+			Shares:       shares,
+			Price:        holding.price,
+			Amount:       taken,
+			CostBasis:    costBasis,
+			RealizedGain: taken.Sub(costBasis),
+		})
+		result.RealizedGain = result.RealizedGain.Add(taken.Sub(costBasis))
+	}
+
+	totalAfter := totalValue.Sub(result.WithdrawnAmount)
+	for i, holding := range holdings {
+		current := 0.0
+		if totalAfter.IsPositive() {
+			current = percentOf(holding.value.Sub(plan.amounts[i]), totalAfter)
+		}
+		drift := dto.HoldingDrift{
+			Category:          holding.category.Name,
+			TargetPercentage:  holding.target,
+			CurrentPercentage: current,
+			Drift:             current - holding.target,
+		}
+		if holding.asset != nil {
+			drift.Symbol = holding.asset.Symbol
+		}
+		result.Drift = append(result.Drift, drift)
+	}
+	plan.result = result
+	return plan, nil
+}
+
+// executeWithdrawal sells what the plan decided, records the sell and withdrawal transactions and saves the portfolio
+func (s *roboPortfolioServiceImpl) executeWithdrawal(portfolio *models.RoboPortfolio, plan *withdrawalPlan) error {
+	result := &plan.result
+	result.RealizedGain = decimal.Zero
+	for i, holding := range plan.holdings {
+		taken := plan.amounts[i]
+		if !taken.IsPositive() {
+			continue
+		}
+		holding.category.TotalAmount = decimal.Max(holding.category.TotalAmount.Sub(taken), decimal.Zero)
+		if holding.asset == nil {
+			continue
+		}
+
+		price, shares := holding.price, plan.shares[i]
+		costBasis := sellSharesInOrder(holding.asset, shares, plan.order)
+		result.RealizedGain = result.RealizedGain.Add(taken.Sub(costBasis))
+		for j := range result.Sales {
+			if result.Sales[j].Symbol == holding.asset.Symbol {
+				result.Sales[j].CostBasis = costBasis
+				result.Sales[j].RealizedGain = taken.Sub(costBasis)
+			}
+		}
+
+		transaction := &models.RoboPortfolioTransaction{
+			RoboPortfolioID: portfolio.ID,
+			TransactionType: "sell",
+			TotalAmount:     taken,
+			Symbol:          &holding.asset.Symbol,
+			Name:            &holding.asset.Name,
+			Price:           &price,
+			SharesAmount:    &shares,
+		}
+		if err := s.repo.CreateRoboPortfolioTransaction(transaction); err != nil {
+			return fmt.Errorf("failed to create transaction for asset %s: %w", holding.asset.Symbol, err)
+		}
+	}
+
+	if err := s.repo.UpdateRoboPortfolio(portfolio); err != nil {
+		return err
+	}
+	if err := s.repo.CreateRoboPortfolioTransaction(&models.RoboPortfolioTransaction{
+		RoboPortfolioID: portfolio.ID,
+		TransactionType: "withdrawal",
+		TotalAmount:     result.WithdrawnAmount,
+	}); err != nil {
+		return err
+	}
+	result.Executed = true
+	return nil
+}
+
+// takeCash spends the cash holding first and returns what is left to withdraw
+func takeCash(holdings []*portfolioHolding, amounts []decimal.Decimal, remaining decimal.Decimal) decimal.Decimal {
+	for i, holding := range holdings {
+		if holding.asset == nil {
+			taken := decimal.Min(remaining, holding.value.Sub(amounts[i]))
+			amounts[i] = amounts[i].Add(taken)
+			remaining = remaining.Sub(taken)
+		}
+	}
+	return remaining
+}
+
+// splitProRata spreads the remaining amount over the eligible holdings by target percentage. Holdings that run
+// out have their share redistributed over the rest. It returns the amount that could not be covered.
+func splitProRata(holdings []*portfolioHolding, amounts []decimal.Decimal, remaining decimal.Decimal, eligible func(*portfolioHolding) bool) decimal.Decimal {
+	for round := 0; round < len(holdings) && remaining.GreaterThan(withdrawalTolerance); round++ {
+		totalWeight, totalAvailable := 0.0, decimal.Zero
+		for i, holding := range holdings {
+			if eligible(holding) && holding.value.Sub(amounts[i]).IsPositive() {
+				totalWeight += holding.target
+				totalAvailable = totalAvailable.Add(holding.value.Sub(amounts[i]))
+			}
+		}
+		if !totalAvailable.IsPositive() {
+			break
+		}
+		toSplit := remaining
+		for i, holding := range holdings {
+			available := holding.value.Sub(amounts[i])
+			if !eligible(holding) || !available.IsPositive() {
+				continue
+			}
+			// fall back to splitting by value when no eligible holding has a target
+			share := toSplit.Mul(available).Div(totalAvailable)
+			if totalWeight > 0 {
+				share = toSplit.MulFloat(holding.target / totalWeight)
+			}
+			taken := decimal.Min(share, available)
+			amounts[i] = amounts[i].Add(taken)
+			remaining = remaining.Sub(taken)
+		}
+	}
+	return decimal.Max(remaining, decimal.Zero)
+}
@@ -0,0 +1,186 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/KZY20112001/infinivest-backend/internal/commons/decimal"
+	"github.com/KZY20112001/infinivest-backend/internal/models"
+)
+
+// latestPriceStub serves fixed latest prices; every other GenAIService method is left unimplemented
+type latestPriceStub struct {
+	GenAIService
+	prices map[string]decimal.Decimal
+}
+
+func (s latestPriceStub) GetLatestAssetPrice(symbol string) (decimal.Decimal, error) {
+	price, exists := s.prices[symbol]
+	if !exists {
+		return decimal.Zero, fmt.Errorf("no price for %s", symbol)
+	}
+	return price, nil
+}
+
+// withdrawalPortfolio is worth 1000: 100 cash (10%), 10 VTI at 50 (50%) and 40 BND at 10 (40%)
+func withdrawalPortfolio() *models.RoboPortfolio {
+	return &models.RoboPortfolio{
+		Currency: "USD",
+		Categories: []*models.RoboPortfolioCategory{
+			{Name: "cash", TotalAmount: decimal.MustParse("100"), TotalPercentage: 10},
+			{Name: "largeCapBlend", Assets: []*models.RoboPortfolioAsset{{
+				Symbol: "VTI", Currency: "USD", Percentage: 50,
+				SharesOwned: decimal.MustParse("10"), TotalInvested: decimal.MustParse("500"), AvgBuyPrice: decimal.MustParse("50"),
+				Lots: []*models.RoboPortfolioLot{
+					{SharesRemaining: decimal.MustParse("5"), CostPerShare: decimal.MustParse("40"), AcquiredAt: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)},
+					{SharesRemaining: decimal.MustParse("5"), CostPerShare: decimal.MustParse("60"), AcquiredAt: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)},
+				},
+			}}},
+			{Name: "intermediateBonds", Assets: []*models.RoboPortfolioAsset{{
+				Symbol: "BND", Currency: "USD", Percentage: 40,
+				SharesOwned: decimal.MustParse("40"), TotalInvested: decimal.MustParse("320"), AvgBuyPrice: decimal.MustParse("8"),
+				Lots: []*models.RoboPortfolioLot{
+					{SharesRemaining: decimal.MustParse("40"), CostPerShare: decimal.MustParse("8"), AcquiredAt: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)},
+				},
+			}}},
+		},
+	}
+}
+
+func TestPlanWithdrawal(t *testing.T) {
+	s := &roboPortfolioServiceImpl{genAIService: latestPriceStub{prices: map[string]decimal.Decimal{
+		"VTI": decimal.MustParse("50"),
+		"BND": decimal.MustParse("10"),
+	}}}
+
+	tests := []struct {
+		name          string
+		amount        string
+		strategy      string
+		wantErr       bool
+		wantWithdrawn string
+		wantCashUsed  string
+		wantGain      string
+		wantPartial   bool
+		wantShares    map[string]string
+		wantNoDrift   bool
+	}{
+		{
+			name: "pro-rata spends cash then sells by target", amount: "300", strategy: "pro-rata",
+			wantWithdrawn: "300", wantCashUsed: "100", wantGain: "40",
+			wantShares: map[string]string{"VTI": "2.222222", "BND": "8.888888"},
+		},
+		{
+			name: "min-gains sells the highest cost lot", amount: "300", strategy: "min-gains",
+			wantWithdrawn: "300", wantCashUsed: "100", wantGain: "-40",
+			wantShares: map[string]string{"VTI": "4"},
+		},
+		{
+			name: "overweight-first lands on target", amount: "300", strategy: "overweight-first",
+			wantWithdrawn: "300", wantCashUsed: "30", wantGain: "54",
+			wantShares: map[string]string{"VTI": "3", "BND": "12"}, wantNoDrift: true,
+		},
+		{
+			name: "cash covers a small withdrawal", amount: "50.004", strategy: "pro-rata",
+			wantWithdrawn: "50", wantCashUsed: "50", wantGain: "0",
+			wantShares: map[string]string{},
+		},
+		{
+			name: "more than the portfolio is worth", amount: "1500", strategy: "pro-rata",
+			wantWithdrawn: "1000", wantCashUsed: "100", wantGain: "80", wantPartial: true,
+			wantShares: map[string]string{"VTI": "10", "BND": "40"},
+		},
+		{name: "unknown strategy", amount: "100", strategy: "largest-first", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			portfolio := withdrawalPortfolio()
+			plan, err := s.planWithdrawal(portfolio, decimal.MustParse(tt.amount), tt.strategy)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("planWithdrawal() error = nil, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("planWithdrawal() error = %v", err)
+			}
+
+			result := plan.result
+			if result.WithdrawnAmount.String() != tt.wantWithdrawn {
+				t.Errorf("WithdrawnAmount = %s, want %s", result.WithdrawnAmount, tt.wantWithdrawn)
+			}
+			if result.CashUsed.String() != tt.wantCashUsed {
+				t.Errorf("CashUsed = %s, want %s", result.CashUsed, tt.wantCashUsed)
+			}
+			if result.RealizedGain.String() != tt.wantGain {
+				t.Errorf("RealizedGain = %s, want %s", result.RealizedGain, tt.wantGain)
+			}
+			if result.Partial != tt.wantPartial {
+				t.Errorf("Partial = %v, want %v", result.Partial, tt.wantPartial)
+			}
+			if len(result.Sales) != len(tt.wantShares) {
+				t.Errorf("got %d sales, want %d", len(result.Sales), len(tt.wantShares))
+			}
+			for _, sale := range result.Sales {
+				if sale.Shares.String() != tt.wantShares[sale.Symbol] {
+					t.Errorf("sold %s %s, want %s", sale.Shares, sale.Symbol, tt.wantShares[sale.Symbol])
+				}
+			}
+			if tt.wantNoDrift {
+				for _, drift := range result.Drift {
+					if math.Abs(drift.Drift) > 0.01 {
+						t.Errorf("%s %s drifts %v from target", drift.Category, drift.Symbol, drift.Drift)
+					}
+				}
+			}
+
+			// planning leaves the portfolio untouched
+			for _, category := range withdrawalPortfolio().Categories {
+				for _, planned := range portfolio.Categories {
+					for i, asset := range planned.Assets {
+						if category.Name == planned.Name && !asset.SharesOwned.Equal(category.Assets[i].SharesOwned) {
+							t.Errorf("%s holds %s shares after planning, want %s", asset.Symbol, asset.SharesOwned, category.Assets[i].SharesOwned)
+						}
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestSplitProRata(t *testing.T) {
+	tests := []struct {
+		name          string
+		values        []string
+		targets       []float64
+		remaining     string
+		wantAmounts   []string
+		wantRemaining string
+	}{
+		{name: "by target", values: []string{"500", "500"}, targets: []float64{75, 25}, remaining: "100", wantAmounts: []string{"75", "25"}, wantRemaining: "0"},
+		{name: "exhausted holding is redistributed", values: []string{"10", "500"}, targets: []float64{50, 50}, remaining: "100", wantAmounts: []string{"10", "90"}, wantRemaining: "0"},
+		{name: "no targets splits by value", values: []string{"300", "100"}, targets: []float64{0, 0}, remaining: "100", wantAmounts: []string{"75", "25"}, wantRemaining: "0"},
+		{name: "not enough to cover", values: []string{"30", "20"}, targets: []float64{50, 50}, remaining: "100", wantAmounts: []string{"30", "20"}, wantRemaining: "50"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			holdings := make([]*portfolioHolding, len(tt.values))
+			amounts := make([]decimal.Decimal, len(tt.values))
+			for i := range tt.values {
+				holdings[i] = &portfolioHolding{value: decimal.MustParse(tt.values[i]), target: tt.targets[i], asset: &models.RoboPortfolioAsset{}}
+			}
+			remaining := splitProRata(holdings, amounts, decimal.MustParse(tt.remaining), func(*portfolioHolding) bool { return true })
+			if remaining.String() != tt.wantRemaining {
+				t.Errorf("remaining = %s, want %s", remaining, tt.wantRemaining)
+			}
+			for i, amount := range amounts {
+				if amount.String() != tt.wantAmounts[i] {
+					t.Errorf("amounts[%d] = %s, want %s", i, amount, tt.wantAmounts[i])
+				}
+			}
+		})
+	}
+}
@@ -2,58 +2,101 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"math"
 	"sync"
+	"time"
 
 	"github.com/KZY20112001/infinivest-backend/internal/commons"
+	"github.com/KZY20112001/infinivest-backend/internal/commons/decimal"
 	"github.com/KZY20112001/infinivest-backend/internal/commons/email"
 	"github.com/KZY20112001/infinivest-backend/internal/dto"
 	"github.com/KZY20112001/infinivest-backend/internal/models"
 	"github.com/KZY20112001/infinivest-backend/internal/redis"
 	"github.com/KZY20112001/infinivest-backend/internal/repositories"
+	"gorm.io/gorm"
 )
 
 type RoboPortfolioService interface {
-	ConfirmGeneratedRoboPortfolio(req dto.ConfirmPortfolioRequest, userID uint) error
-	GetRoboPortfolioDetails(userID uint) (*models.RoboPortfolio, error)
-	GetRoboPortfolioSummary(userID uint) (dto.RoboPortfolioSummaryResponse, error)
-	AddMoneyToRoboPortfolio(ctx context.Context, userID uint, amount float64) (*models.RoboPortfolio, error)
-	WithDrawMoneyFromRoboPortfolio(ctx context.Context, userID uint, amount float64) (float64, error)
-	UpdateRebalanceFreq(ctx context.Context, userID uint, freq string) error
+	ConfirmGeneratedRoboPortfolio(req dto.ConfirmPortfolioRequest, userID uint) (*models.RoboPortfolio, error)
+	GetRoboPortfolios(userID uint) ([]*models.RoboPortfolio, error)
+	GetRoboPortfoliosSummaries(userID uint) ([]dto.RoboPortfolioSummaryResponse, error)
+	GetRoboPortfolioDetails(userID, portfolioID uint) (*models.RoboPortfolio, error)
+	GetRoboPortfolioSummary(userID, portfolioID uint) (dto.RoboPortfolioSummaryResponse, error)
+	AddMoneyToRoboPortfolio(ctx context.Context, userID, portfolioID uint, amount decimal.Decimal) (*models.RoboPortfolio, error)
+	PreviewDeposit(userID, portfolioID uint, amount decimal.Decimal) (dto.DepositPlan, error)
+	WithDrawMoneyFromRoboPortfolio(ctx context.Context, userID, portfolioID uint, req dto.WithdrawMoneyRequest) (dto.WithdrawalResult, error)
+	UpdateRebalanceFreq(ctx context.Context, userID, portfolioID uint, freq string) error
+	PauseRebalancing(ctx context.Context, userID, portfolioID uint, resumeAt *time.Time) error
+	ResumeRebalancing(ctx context.Context, userID, portfolioID uint) error
+	UpdateTaxLossHarvesting(userID, portfolioID uint, enabled bool, threshold float64) error
+	UpdateDepositStrategy(userID, portfolioID uint, strategy string) error
 	RebalancePortfolio(ctx context.Context, userID, portfolioID uint) (*models.RoboPortfolio, error)
-	DeleteRoboPortfolio(ctx context.Context, userID uint) error
-
-	GetRoboPortfolioTransactions(userID uint, limit int) ([]*models.RoboPortfolioTransaction, error)
-
-	GetRebalanceEvents(ctx context.Context, userID uint) ([]*models.RebalanceEvent, error)
-	UpdateLastSeenRebalanceTime(ctx context.Context, userID uint) error
+	RebalanceDriftedPortfolio(ctx context.Context, userID, portfolioID uint, band float64) (bool, error)
+	DeleteRoboPortfolio(ctx context.Context, userID, portfolioID uint) error
+	CloseRoboPortfolio(ctx context.Context, userID, portfolioID uint, manualPortfolioName string) (dto.ClosePortfolioResult, error)
+	GetArchivedRoboPortfolios(userID uint) ([]*models.RoboPortfolio, error)
+
+	GetRoboPortfolioTransactions(userID, portfolioID uint, limit int) ([]*models.RoboPortfolioTransaction, error)
+	ExportRoboPortfolioTransactions(userID, portfolioID uint, format string, from, to *time.Time) (*TransactionExport, error)
+	GetRoboPortfolioRisk(userID, portfolioID uint, benchmark string, days int) (dto.PortfolioRiskResponse, error)
+	GetRoboPortfolioDrift(userID, portfolioID uint) (dto.PortfolioDriftResponse, error)
+
+	UpdateRoboPortfolioAllocation(userID, portfolioID uint, req dto.UpdateAllocationRequest) (*models.RoboPortfolio, error)
+	UpdateGlidePath(userID, portfolioID uint, req dto.UpdateGlidePathRequest) (*models.RoboPortfolio, error)
+	GetGlidePath(userID, portfolioID uint) (dto.GlidePathResponse, error)
+	GetAllocationVersions(userID, portfolioID uint) ([]*models.AllocationVersion, error)
+	DiffAllocationVersions(userID, portfolioID uint, fromVersion, toVersion int) (dto.AllocationDiff, error)
+
+	GetRebalanceEvents(ctx context.Context, userID, portfolioID uint) ([]*models.RebalanceEvent, error)
+	GetRebalanceEvent(userID, portfolioID, eventID uint) (*models.RebalanceEvent, error)
+	UpdateLastSeenRebalanceTime(ctx context.Context, userID, portfolioID uint) error
 }
 
 type roboPortfolioServiceImpl struct {
-	repo                repositories.RoboPortfolioRepo
-	redis               redis.RoboPortfolioRedis
-	genAIService        GenAIService
-	notificationService NotificationService
-	userService         UserService
+	repo                   repositories.RoboPortfolioRepo
+	redis                  redis.RoboPortfolioRedis
+	genAIService           GenAIService
+	notificationService    NotificationService
+	userService            UserService
+	profileService         ProfileService
+	manualPortfolioService ManualPortfolioService
+	fxService              FXService
+	screeningService       ScreeningService
+	rebalanceFeeRate       float64
 }
 
-func NewRoboPortfolioService(pr repositories.RoboPortfolioRepo, pc redis.RoboPortfolioRedis, gs GenAIService, ns NotificationService, us UserService) *roboPortfolioServiceImpl {
-	return &roboPortfolioServiceImpl{repo: pr, redis: pc, genAIService: gs, notificationService: ns, userService: us}
+func NewRoboPortfolioService(pr repositories.RoboPortfolioRepo, pc redis.RoboPortfolioRedis, gs GenAIService, ns NotificationService, us UserService, ps ProfileService, ms ManualPortfolioService, fs FXService, ss ScreeningService, rebalanceFeeRate float64) *roboPortfolioServiceImpl {
+	return &roboPortfolioServiceImpl{repo: pr, redis: pc, genAIService: gs, notificationService: ns, userService: us, profileService: ps, manualPortfolioService: ms, fxService: fs, screeningService: ss, rebalanceFeeRate: rebalanceFeeRate}
 }
 
-func (s *roboPortfolioServiceImpl) ConfirmGeneratedRoboPortfolio(req dto.ConfirmPortfolioRequest, userID uint) error {
-	_, err := s.repo.GetRoboPortfolioDetails(userID)
-	if err == nil {
-		return fmt.Errorf("roboportfolio already exists for user %d", userID)
+func (s *roboPortfolioServiceImpl) ConfirmGeneratedRoboPortfolio(req dto.ConfirmPortfolioRequest, userID uint) (*models.RoboPortfolio, error) {
+	existingPortfolios, err := s.repo.GetRoboPortfolios(userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, existing := range existingPortfolios {
+		if existing.Name == req.Name {
+			return nil, fmt.Errorf("robo portfolio %s already exists for user %d", req.Name, userID)
+		}
 	}
 
 	portfolio := models.RoboPortfolio{
 		UserID:        userID,
+		Name:          req.Name,
+		Goal:          req.Goal,
 		Categories:    []*models.RoboPortfolioCategory{},
 		RebalanceFreq: &req.Frequency,
 		IsRebalancing: false,
+		Currency:      commons.DefaultCurrency,
+
+		DepositStrategy:  req.DepositStrategy,
+		HarvestThreshold: commons.DefaultHarvestThreshold,
+	}
+	if err := validateAssetCurrencies(req.Allocations, portfolio.Currency); err != nil {
+		return nil, err
 	}
 
 	// manually append cash category (no assets)
@@ -61,7 +104,7 @@ func (s *roboPortfolioServiceImpl) ConfirmGeneratedRoboPortfolio(req dto.Confirm
 		RoboPortfolioID: portfolio.ID,
 		Name:            "cash",
 		TotalPercentage: req.Portfolio["cash"],
-		TotalAmount:     0,
+		TotalAmount:     decimal.Zero,
 		Assets:          []*models.RoboPortfolioAsset{},
 	}
 	portfolio.Categories = append(portfolio.Categories, cashCategory)
@@ -71,7 +114,7 @@ func (s *roboPortfolioServiceImpl) ConfirmGeneratedRoboPortfolio(req dto.Confirm
 			RoboPortfolioID: portfolio.ID,
 			Name:            categoryName,
 			TotalPercentage: req.Portfolio[categoryName],
-			TotalAmount:     0,
+			TotalAmount:     decimal.Zero,
 			Assets:          []*models.RoboPortfolioAsset{},
 		}
 
@@ -81,48 +124,114 @@ func (s *roboPortfolioServiceImpl) ConfirmGeneratedRoboPortfolio(req dto.Confirm
 				Name:                    asset.Name,
 				Symbol:                  asset.Symbol,
 				Percentage:              asset.Percentage,
-				SharesOwned:             0,
-				TotalInvested:           0,
-				AvgBuyPrice:             0,
+				Currency:                commons.SymbolCurrency(asset.Symbol),
+				SharesOwned:             decimal.Zero,
+				TotalInvested:           decimal.Zero,
+				AvgBuyPrice:             decimal.Zero,
 			})
 		}
 
 		portfolio.Categories = append(portfolio.Categories, category)
 	}
-	return s.repo.CreateRoboPortfolio(&portfolio)
+	version, err := newAllocationVersion(&portfolio, "recommendation", time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.CreateRoboPortfolio(&portfolio, version); err != nil {
+		return nil, err
+	}
+	return &portfolio, nil
 }
 
-func (s *roboPortfolioServiceImpl) GetRoboPortfolioDetails(userID uint) (*models.RoboPortfolio, error) {
-	return s.repo.GetRoboPortfolioDetails(userID)
+func (s *roboPortfolioServiceImpl) GetRoboPortfolios(userID uint) ([]*models.RoboPortfolio, error) {
+	return s.repo.GetRoboPortfolios(userID)
 }
 
-func (s *roboPortfolioServiceImpl) GetRoboPortfolioSummary(userID uint) (dto.RoboPortfolioSummaryResponse, error) {
-	portfolio, err := s.repo.GetRoboPortfolioDetails(userID)
+func (s *roboPortfolioServiceImpl) GetRoboPortfoliosSummaries(userID uint) ([]dto.RoboPortfolioSummaryResponse, error) {
+	portfolios, err := s.repo.GetRoboPortfolios(userID)
+	if err != nil {
+		return nil, err
+	}
+	// each goroutine writes its own index, so the summaries keep the order of the portfolios
+	var wg sync.WaitGroup
+	res := make([]dto.RoboPortfolioSummaryResponse, len(portfolios))
+	for i, portfolio := range portfolios {
+		wg.Add(1)
+		go func(i int, portfolio *models.RoboPortfolio) {
+			defer wg.Done()
+			summary, err := s.buildPortfolioSummary(portfolio)
+			if err != nil {
+				log.Printf("Failed to build summary for portfolio %d:%d: %v\n", portfolio.UserID, portfolio.ID, err)
+				summary = dto.RoboPortfolioSummaryResponse{
+					ID:       portfolio.ID,
+					Name:     portfolio.Name,
+					Goal:     portfolio.Goal,
+					IsPaused: portfolio.IsPaused,
+					Error:    err.Error(),
+				}
+				if portfolio.RebalanceFreq != nil {
+					summary.RebalanceFreq = *portfolio.RebalanceFreq
+				}
+			}
+			res[i] = summary
+		}(i, portfolio)
+	}
+	wg.Wait()
+	return res, nil
+}
+
+func (s *roboPortfolioServiceImpl) GetRoboPortfolioDetails(userID, portfolioID uint) (*models.RoboPortfolio, error) {
+	return s.repo.GetRoboPortfolioDetails(userID, portfolioID)
+}
+
+func (s *roboPortfolioServiceImpl) GetRoboPortfolioSummary(userID, portfolioID uint) (dto.RoboPortfolioSummaryResponse, error) {
+	portfolio, err := s.repo.GetRoboPortfolioDetails(userID, portfolioID)
+	if err != nil {
+		return dto.RoboPortfolioSummaryResponse{}, err
+	}
+	return s.buildPortfolioSummary(portfolio)
+}
+
+func (s *roboPortfolioServiceImpl) buildPortfolioSummary(portfolio *models.RoboPortfolio) (dto.RoboPortfolioSummaryResponse, error) {
+	totalValue, totalInvested, err := s.getPortfolioValue(portfolio, make(map[string]decimal.Decimal))
+	if err != nil {
+		return dto.RoboPortfolioSummaryResponse{}, err
+	}
+	baseCurrency, err := s.profileService.GetBaseCurrency(portfolio.UserID)
 	if err != nil {
 		return dto.RoboPortfolioSummaryResponse{}, err
 	}
-	totalValue, totalInvested, err := s.getPortfolioValue(portfolio, make(map[string]float64))
+	// robo portfolios only hold funds quoted in their own currency, so all of the gain comes from the assets
+	valuation := portfolioValuation{totalValue: totalValue, totalInvested: totalInvested, assetGain: totalValue.Sub(totalInvested)}
+	baseValuation, err := valuation.inBaseCurrency(s.fxService, portfolio.Currency, baseCurrency)
 	if err != nil {
 		return dto.RoboPortfolioSummaryResponse{}, err
 	}
 	return dto.RoboPortfolioSummaryResponse{
-		RebalanceFreq: *portfolio.RebalanceFreq,
-		TotalValue:    totalValue,
-		TotalInvested: totalInvested}, nil
+		ID:                    portfolio.ID,
+		Name:                  portfolio.Name,
+		Goal:                  portfolio.Goal,
+		RebalanceFreq:         *portfolio.RebalanceFreq,
+		TotalValue:            totalValue,
+		TotalInvested:         totalInvested,
+		IsPaused:              portfolio.IsPaused,
+		PausedUntil:           portfolio.PausedUntil,
+		BaseCurrencyValuation: baseValuation}, nil
 }
 
-func (s *roboPortfolioServiceImpl) AddMoneyToRoboPortfolio(ctx context.Context, userID uint, amount float64) (*models.RoboPortfolio, error) {
-	portfolio, err := s.repo.GetRoboPortfolioDetails(userID)
+func (s *roboPortfolioServiceImpl) AddMoneyToRoboPortfolio(ctx context.Context, userID, portfolioID uint, amount decimal.Decimal) (*models.RoboPortfolio, error) {
+	portfolio, err := s.repo.GetRoboPortfolioDetails(userID, portfolioID)
 	if err != nil {
 		return nil, err
 	}
+	amount = commons.RoundCash(amount, portfolio.Currency)
 
 	// lock the portfolio to prevent concurrent updates
 	if err := s.repo.LockRoboPortfolio(portfolio); err != nil {
 		return nil, err
 	}
 
-	if err := s.addMoneyToPortfolio(portfolio, amount); err != nil {
+	if err := s.addMoneyToPortfolio(portfolio, amount, portfolio.DepositStrategy, nil); err != nil {
 		return nil, err
 	}
 
@@ -139,6 +248,11 @@ func (s *roboPortfolioServiceImpl) AddMoneyToRoboPortfolio(ctx context.Context,
 		return nil, err
 	}
 
+	// paused portfolios are queued again when they are resumed
+	if portfolio.IsPaused {
+		return portfolio, nil
+	}
+
 	// check if current portfolio is in queue
 	if _, err := s.redis.GetNextRebalanceTime(ctx, userID, portfolio.ID); err == nil {
 		return portfolio, nil
@@ -157,191 +271,351 @@ func (s *roboPortfolioServiceImpl) AddMoneyToRoboPortfolio(ctx context.Context,
 	return portfolio, nil
 }
 
-func (s *roboPortfolioServiceImpl) WithDrawMoneyFromRoboPortfolio(ctx context.Context, userID uint, amount float64) (float64, error) {
-	portfolio, err := s.repo.GetRoboPortfolioDetails(userID)
+func (s *roboPortfolioServiceImpl) PreviewDeposit(userID, portfolioID uint, amount decimal.Decimal) (dto.DepositPlan, error) {
+	portfolio, err := s.repo.GetRoboPortfolioDetails(userID, portfolioID)
+	if err != nil {
+		return dto.DepositPlan{}, err
+	}
+	return s.planDeposit(portfolio, amount, portfolio.DepositStrategy)
+}
+
+func (s *roboPortfolioServiceImpl) WithDrawMoneyFromRoboPortfolio(ctx context.Context, userID, portfolioID uint, req dto.WithdrawMoneyRequest) (dto.WithdrawalResult, error) {
+	if !req.Amount.IsPositive() {
+		return dto.WithdrawalResult{}, fmt.Errorf("amount must be positive")
+	}
+	if req.Strategy == "" {
+		req.Strategy = "pro-rata"
+	}
+	portfolio, err := s.repo.GetRoboPortfolioDetails(userID, portfolioID)
 	if err != nil {
-		return 0, err
+		return dto.WithdrawalResult{}, err
 	}
 
 	// lock the portfolio to prevent concurrent updates
 	if err := s.repo.LockRoboPortfolio(portfolio); err != nil {
-		return 0, err
+		return dto.WithdrawalResult{}, err
 	}
-
-	var cashCategory *models.RoboPortfolioCategory
-
-	for _, category := range portfolio.Categories {
-		if category.Name == "cash" {
-			cashCategory = category
-			break
-		}
-	}
-	if amount <= cashCategory.TotalAmount {
-		cashCategory.TotalAmount -= amount
-		if err := s.repo.UpdateRoboPortfolio(portfolio); err != nil {
-			return 0, err
-		}
-
-		// unlock the portfolio after adding to queue
+	defer func() {
 		if err := s.repo.UnlockRoboPortfolio(portfolio); err != nil {
-			return 0, err
+			log.Println("Failed to unlock portfolio:", err)
 		}
+	}()
 
-		err = s.repo.CreateRoboPortfolioTransaction(&models.RoboPortfolioTransaction{
-			RoboPortfolioID: portfolio.ID,
-			TransactionType: "withdrawal",
-			TotalAmount:     amount,
-		})
-
-		if err != nil {
-			return 0, err
-		}
-		return amount, nil
+	plan, err := s.planWithdrawal(portfolio, req.Amount, req.Strategy)
+	if err != nil {
+		return dto.WithdrawalResult{}, err
 	}
+	// nothing is sold unless the caller accepts receiving less than requested
+	if plan.result.Partial && !req.AllowPartial {
+		return plan.result, commons.ErrPartialFill
+	}
+	if err := s.executeWithdrawal(portfolio, plan); err != nil {
+		return dto.WithdrawalResult{}, err
+	}
+	return plan.result, nil
+}
 
-	// sell assets to cover the remaining amount
-	leftToWithdraw := amount
-	withdrawn := 0.0
-	withdrawn += cashCategory.TotalAmount
-	amount -= cashCategory.TotalAmount
-	cashCategory.TotalAmount = 0
-	var wg sync.WaitGroup
-	var mu sync.Mutex
-	for _, category := range portfolio.Categories {
-		if category.Name == "cash" || category.TotalPercentage == 0 {
-			continue
-		}
-
-		errChan := make(chan error, len(category.Assets))
-		for _, asset := range category.Assets {
-			wg.Add(1)
-			go func(asset *models.RoboPortfolioAsset) {
-				defer wg.Done()
-				latestPrice, err := s.genAIService.GetLatestAssetPrice(asset.Symbol)
-				if err != nil {
-					errChan <- fmt.Errorf("failed to get latest price for asset %s: %w", asset.Symbol, err)
-					return
-				}
-				amountToSell := amount * asset.Percentage / 100
-				numOfShares := amountToSell / latestPrice
-				if numOfShares > asset.SharesOwned {
-					numOfShares = asset.SharesOwned
-				}
-				curAmount := numOfShares * latestPrice
-				mu.Lock()
-				category.TotalAmount -= curAmount
-				if category.TotalAmount < 0 {
-					category.TotalAmount = 0
-				}
-				leftToWithdraw -= curAmount
-				withdrawn += curAmount
-				mu.Unlock()
-				asset.SharesOwned -= numOfShares
-				asset.TotalInvested -= curAmount
-				if asset.TotalInvested < 0 {
-					asset.TotalInvested = 0
-				}
-				if asset.SharesOwned > 0 {
-					asset.AvgBuyPrice = asset.TotalInvested / asset.SharesOwned
-				}
-			}(asset)
-		}
-		wg.Wait()
-		close(errChan)
-		for err := range errChan {
-			log.Println(err)
-		}
+func (s *roboPortfolioServiceImpl) UpdateRebalanceFreq(ctx context.Context, userID, portfolioID uint, freq string) error {
+	portfolio, err := s.repo.GetRoboPortfolioDetails(userID, portfolioID)
+	if err != nil {
+		return err
 	}
 
-	if err := s.repo.UpdateRoboPortfolio(portfolio); err != nil {
-		return 0, err
+	if portfolio.RebalanceFreq != nil && *portfolio.RebalanceFreq == freq {
+		return nil
+	}
+	if _, err := s.RebalancePortfolio(ctx, userID, portfolio.ID); err != nil {
+		return err
 	}
 
-	// unlock the portfolio after adding to queue
-	if err := s.repo.UnlockRoboPortfolio(portfolio); err != nil {
-		return 0, err
+	if err := s.redis.DeletePortfolioFromQueue(ctx, userID, portfolio.ID); err != nil {
+		return err
 	}
 
-	err = s.repo.CreateRoboPortfolioTransaction(&models.RoboPortfolioTransaction{
-		RoboPortfolioID: portfolio.ID,
-		TransactionType: "withdrawal",
-		TotalAmount:     withdrawn,
-	})
+	if err := s.repo.UpdateRebalanceFreq(portfolio, freq); err != nil {
+		return err
+	}
+	if portfolio.IsPaused {
+		return nil
+	}
 
+	nextRebalanceTime, err := commons.GetNextRebalanceTime(freq)
 	if err != nil {
-		return 0, err
+		return err
 	}
-
-	return withdrawn, nil
+	return s.redis.AddPortfolioToRebalancingQueue(ctx, userID, portfolio.ID, nextRebalanceTime)
 }
 
-func (s *roboPortfolioServiceImpl) UpdateRebalanceFreq(ctx context.Context, userID uint, freq string) error {
-	portfolio, err := s.repo.GetRoboPortfolioDetails(userID)
+func (s *roboPortfolioServiceImpl) PauseRebalancing(ctx context.Context, userID, portfolioID uint, resumeAt *time.Time) error {
+	portfolio, err := s.repo.GetRoboPortfolioDetails(userID, portfolioID)
 	if err != nil {
 		return err
 	}
-
-	if portfolio.RebalanceFreq != nil && *portfolio.RebalanceFreq == freq {
-		return nil
+	if resumeAt != nil && !resumeAt.After(time.Now()) {
+		return fmt.Errorf("resume date must be in the future")
 	}
-	if _, err := s.RebalancePortfolio(ctx, userID, portfolio.ID); err != nil {
+	if err := s.redis.DeletePortfolioFromQueue(ctx, userID, portfolio.ID); err != nil {
 		return err
 	}
+	return s.repo.UpdatePauseState(portfolio, true, resumeAt)
+}
 
-	if err := s.redis.DeletePortfolioFromQueue(ctx, userID, portfolio.ID); err != nil {
+func (s *roboPortfolioServiceImpl) ResumeRebalancing(ctx context.Context, userID, portfolioID uint) error {
+	portfolio, err := s.repo.GetRoboPortfolioDetails(userID, portfolioID)
+	if err != nil {
+		return err
+	}
+	if !portfolio.IsPaused {
+		return fmt.Errorf("portfolio %s is not paused", portfolio.Name)
+	}
+	nextRebalanceTime, err := commons.GetNextRebalanceTime(*portfolio.RebalanceFreq)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.UpdatePauseState(portfolio, false, nil); err != nil {
 		return err
 	}
+	return s.redis.AddPortfolioToRebalancingQueue(ctx, userID, portfolio.ID, nextRebalanceTime)
+}
 
-	if err := s.repo.UpdateRebalanceFreq(userID, freq); err != nil {
+func (s *roboPortfolioServiceImpl) UpdateTaxLossHarvesting(userID, portfolioID uint, enabled bool, threshold float64) error {
+	portfolio, err := s.repo.GetRoboPortfolioDetails(userID, portfolioID)
+	if err != nil {
 		return err
 	}
+	if threshold < 0 || threshold >= 100 {
+		return fmt.Errorf("harvest threshold must be between 0 and 100 percent")
+	}
+	if threshold == 0 {
+		threshold = commons.DefaultHarvestThreshold
+	}
+	return s.repo.UpdateTaxLossHarvesting(portfolio, enabled, threshold)
+}
 
-	nextRebalanceTime, err := commons.GetNextRebalanceTime(freq)
+func (s *roboPortfolioServiceImpl) UpdateDepositStrategy(userID, portfolioID uint, strategy string) error {
+	portfolio, err := s.repo.GetRoboPortfolioDetails(userID, portfolioID)
 	if err != nil {
 		return err
 	}
-	return s.redis.AddPortfolioToRebalancingQueue(ctx, userID, portfolio.ID, nextRebalanceTime)
+	return s.repo.UpdateDepositStrategy(portfolio, strategy)
 }
 
-func (s *roboPortfolioServiceImpl) DeleteRoboPortfolio(ctx context.Context, userID uint) error {
-	portfolio, err := s.repo.GetRoboPortfolioDetails(userID)
+func (s *roboPortfolioServiceImpl) DeleteRoboPortfolio(ctx context.Context, userID, portfolioID uint) error {
+	portfolio, err := s.repo.GetRoboPortfolioDetails(userID, portfolioID)
 	if err != nil {
 		return err
 	}
 
-	// totalValue, _, err := s.getPortfolioValue(portfolio, make(map[string]float64))
-	// if err != nil {
-	// 	return err
-	// }
-	// if totalValue > 0 {
-	// 	return fmt.Errorf("portfolio %d for user %d has a total value of %.2f. Please withdraw all funds before deleting", portfolio.ID, userID, totalValue)
-	// }
+	totalValue, _, err := s.getPortfolioValue(portfolio, make(map[string]decimal.Decimal))
+	if err != nil {
+		return err
+	}
+	if totalValue.IsPositive() {
+		return fmt.Errorf("portfolio %d for user %d has a total value of %s. Please close the portfolio to liquidate it instead", portfolio.ID, userID, commons.FormatCash(totalValue, portfolio.Currency))
+	}
 	if err := s.redis.DeletePortfolioFromQueue(ctx, userID, portfolio.ID); err != nil {
 		return err
 	}
 	return s.repo.DeleteRoboPortfolio(portfolio)
 }
 
+// CloseRoboPortfolio sells every holding, withdraws the proceeds, optionally into a manual portfolio, and archives
+// the portfolio so its history stays queryable
+func (s *roboPortfolioServiceImpl) CloseRoboPortfolio(ctx context.Context, userID, portfolioID uint, manualPortfolioName string) (dto.ClosePortfolioResult, error) {
+	portfolio, err := s.repo.GetRoboPortfolioDetails(userID, portfolioID)
+	if err != nil {
+		return dto.ClosePortfolioResult{}, err
+	}
+	var destination *models.ManualPortfolio
+	if manualPortfolioName != "" {
+		if destination, err = s.manualPortfolioService.GetManualPortfolio(userID, manualPortfolioName); err != nil {
+			return dto.ClosePortfolioResult{}, err
+		}
+	}
+
+	// keep the scheduler away while the portfolio is liquidated
+	success, err := s.redis.AcquireLock(ctx, userID, portfolio.ID, 2*time.Minute)
+	if err != nil {
+		return dto.ClosePortfolioResult{}, err
+	}
+	if !success {
+		return dto.ClosePortfolioResult{}, fmt.Errorf("portfolio %s is being rebalanced, please try again later", portfolio.Name)
+	}
+	defer func() {
+		if err := s.redis.ReleaseLock(ctx, userID, portfolio.ID); err != nil {
+			log.Printf("Failed to release lock for portfolio %d:%d: %v\n", userID, portfolio.ID, err)
+		}
+	}()
+
+	holdings, _, err := s.getPortfolioHoldings(portfolio)
+	if err != nil {
+		return dto.ClosePortfolioResult{}, err
+	}
+	result := dto.ClosePortfolioResult{ManualPortfolioName: manualPortfolioName}
+	var transactions []*models.RoboPortfolioTransaction
+	for _, holding := range holdings {
+		if holding.asset == nil {
+			result.CashAmount = result.CashAmount.Add(holding.value)
+			holding.category.TotalAmount = decimal.Zero
+			continue
+		}
+		if !holding.asset.SharesOwned.IsPositive() {
+			continue
+		}
+		price, shares := holding.price, holding.asset.SharesOwned
+		amount := holding.value
+		costBasis := sellShares(holding.asset, shares)
+		holding.category.TotalAmount = decimal.Zero
+		result.Sales = append(result.Sales, dto.WithdrawalSale{
+			Category:     holding.category.Name,
+			Symbol:       holding.asset.Symbol,
+			Name:         holding.asset.Name,
+			Shares:       shares,
+			Price:        price,
+			Amount:       amount,
+			CostBasis:    costBasis,
+			RealizedGain: amount.Sub(costBasis),
+		})
+		result.ProceedsAmount = result.ProceedsAmount.Add(amount)
+		result.RealizedGain = result.RealizedGain.Add(amount.Sub(costBasis))
+
+		transactions = append(transactions, &models.RoboPortfolioTransaction{
+			RoboPortfolioID: portfolio.ID,
+			TransactionType: "sell",
+			TotalAmount:     amount,
+			Symbol:          &holding.asset.Symbol,
+			Name:            &holding.asset.Name,
+			Price:           &price,
+			SharesAmount:    &shares,
+		})
+	}
+	result.WithdrawnAmount = result.CashAmount.Add(result.ProceedsAmount)
+
+	// the proceeds either leave the app or move to the manual portfolio as a cash transfer, saved together with the
+	// sales so a failure leaves both portfolios untouched
+	var transfer *models.Transfer
+	changes := repositories.TransferChanges{}
+	if destination != nil && result.WithdrawnAmount.IsPositive() {
+		fxRate, err := s.fxService.GetRate(portfolio.Currency, destination.Currency)
+		if err != nil {
+			return dto.ClosePortfolioResult{}, err
+		}
+		result.DepositedAmount = commons.RoundCash(result.WithdrawnAmount.Mul(fxRate), destination.Currency)
+		transfer = &models.Transfer{
+			UserID:          userID,
+			Kind:            "cash",
+			SourceType:      "robo",
+			SourceID:        portfolio.ID,
+			DestinationType: "manual",
+			DestinationID:   destination.ID,
+			Amount:          result.WithdrawnAmount,
+			FxRate:          fxRate,
+		}
+		// only the proceeds are added, the destination may trade while the portfolio is liquidated
+		changes.ManualDeposits = map[uint]decimal.Decimal{destination.ID: result.DepositedAmount}
+		changes.RoboTransactions = []*models.RoboPortfolioTransaction{{
+			RoboPortfolioID: portfolio.ID,
+			TransactionType: "transfer:out",
+			TotalAmount:     result.WithdrawnAmount,
+		}}
+		changes.ManualTransactions = []*models.ManualPortfolioTransaction{{
+			ManualPortfolioUserID: userID,
+			ManualPortfolioID:     destination.ID,
+			TransactionType:       "transfer:in",
+			TotalAmount:           result.DepositedAmount,
+		}}
+	} else {
+		transactions = append(transactions, &models.RoboPortfolioTransaction{
+			RoboPortfolioID: portfolio.ID,
+			TransactionType: "withdrawal",
+			TotalAmount:     result.WithdrawnAmount,
+		})
+	}
+	if err := s.repo.CloseRoboPortfolio(portfolio, transactions, transfer, changes); err != nil {
+		return dto.ClosePortfolioResult{}, err
+	}
+
+	if err := s.redis.DeletePortfolioFromQueue(ctx, userID, portfolio.ID); err != nil {
+		// the scheduler drops portfolios it can no longer find, so the closed portfolio is not rebalanced
+		log.Printf("Failed to remove closed portfolio %d:%d from the rebalancing queue: %v\n", userID, portfolio.ID, err)
+	}
+	return result, nil
+}
+
+func (s *roboPortfolioServiceImpl) GetArchivedRoboPortfolios(userID uint) ([]*models.RoboPortfolio, error) {
+	return s.repo.GetArchivedRoboPortfolios(userID)
+}
+
 func (s *roboPortfolioServiceImpl) RebalancePortfolio(ctx context.Context, userID, portfolioID uint) (*models.RoboPortfolio, error) {
+	portfolio, _, err := s.rebalancePortfolio(ctx, userID, portfolioID, 0)
+	return portfolio, err
+}
+
+// RebalanceDriftedPortfolio trades the holdings whose weight is more than band percentage points away from
+// their target, the same measure the drift report uses. It reports whether anything was traded; when nothing
+// was, no rebalance event is recorded and the user is not notified.
+func (s *roboPortfolioServiceImpl) RebalanceDriftedPortfolio(ctx context.Context, userID, portfolioID uint, band float64) (bool, error) {
+	if band <= 0 {
+		return false, fmt.Errorf("drift band must be positive")
+	}
+	_, traded, err := s.rebalancePortfolio(ctx, userID, portfolioID, band)
+	return traded, err
+}
+
+// rebalancePortfolio trades the portfolio back to its targets. A positive driftBand selects the holdings to
+// trade by their drift in percentage points instead of the relative threshold of the rebalancing frequency.
+func (s *roboPortfolioServiceImpl) rebalancePortfolio(ctx context.Context, userID, portfolioID uint, driftBand float64) (*models.RoboPortfolio, bool, error) {
 	log.Println("Rebalancing portfolio", portfolioID, "for user", userID)
-	portfolio, err := s.repo.GetRoboPortfolioDetails(userID)
+	portfolio, err := s.repo.GetRoboPortfolioDetails(userID, portfolioID)
 	if err != nil {
-		return nil, fmt.Errorf("portfolio %d for user %d returns error: %w", userID, portfolioID, err)
+		return nil, false, fmt.Errorf("portfolio %d for user %d returns error: %w", portfolioID, userID, err)
 	}
 	// lock the portfolio to prevent concurrent updates
 	if err := s.repo.LockRoboPortfolio(portfolio); err != nil {
-		return nil, err
+		return nil, false, err
 	}
 	threshold, exists := commons.RebalancingThresholds[*portfolio.RebalanceFreq]
 	if !exists {
-		return nil, fmt.Errorf("invalid rebalance frequency: %s", *portfolio.RebalanceFreq)
+		return nil, false, fmt.Errorf("invalid rebalance frequency: %s", *portfolio.RebalanceFreq)
+	}
+	isWithinTarget := func(curValue, targetValue, totalValue decimal.Decimal) bool {
+		if driftBand > 0 {
+			return withinDriftBand(curValue, targetValue, totalValue, driftBand)
+		}
+		return withinRebalanceThreshold(curValue, targetValue, threshold)
+	}
+
+	// move the targets along the glide path before trading towards them
+	// allocation versions for targets moved during the rebalance are saved together with the portfolio
+	var versions []*models.AllocationVersion
+	glidePathVersion, err := s.applyGlidePath(portfolio)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to apply glide path: %w", err)
+	}
+	if glidePathVersion != nil {
+		versions = append(versions, glidePathVersion)
 	}
 
 	//get total portfolio value
-	latestAssetPrices := make(map[string]float64)
+	latestAssetPrices := make(map[string]decimal.Decimal)
 	totalValue, _, err := s.getPortfolioValue(portfolio, latestAssetPrices)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get portfolio value: %w", err)
+		return nil, false, fmt.Errorf("failed to get portfolio value: %w", err)
+	}
+
+	weightsBefore, _ := snapshotWeights(portfolio, latestAssetPrices)
+	trades := &rebalanceTrades{feeRate: s.rebalanceFeeRate, currency: portfolio.Currency}
+
+	harvestedLoss := decimal.Zero
+	if portfolio.TaxLossHarvesting {
+		var harvestVersion *models.AllocationVersion
+		harvestedLoss, harvestVersion, err = s.harvestTaxLosses(portfolio, latestAssetPrices, trades)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to harvest tax losses: %w", err)
+		}
+		if harvestVersion != nil {
+			versions = append(versions, harvestVersion)
+		}
 	}
 
 	overPerformingAssets := []*models.RoboPortfolioAsset{}
@@ -354,13 +628,11 @@ func (s *roboPortfolioServiceImpl) RebalancePortfolio(ctx context.Context, userI
 			continue
 		}
 		for _, asset := range category.Assets {
-			latestPrice := latestAssetPrices[asset.Symbol]
-			curValue := latestPrice * asset.SharesOwned
-			targetValue := totalValue * asset.Percentage / 100
-			if (math.Abs(curValue-targetValue) <= targetValue*threshold/100) || (asset.SharesOwned == 0) {
+			curValue, targetValue := assetValues(portfolio, asset, latestAssetPrices[asset.Symbol], totalValue)
+			if isWithinTarget(curValue, targetValue, totalValue) {
 				log.Println("Asset", asset.Symbol, "is within threshold")
 				continue
-			} else if curValue > targetValue { // overperforming asset, sell shares
+			} else if curValue.GreaterThan(targetValue) { // overperforming asset, sell shares
 				overPerformingAssets = append(overPerformingAssets, asset)
 			} else { // underperforming asset, buy shares
 				underPerformingAssets = append(underPerformingAssets, asset)
@@ -370,29 +642,40 @@ func (s *roboPortfolioServiceImpl) RebalancePortfolio(ctx context.Context, userI
 	}
 
 	totalCash := &cashCategory.TotalAmount
-	totalSellAmount, err := s.sellOverPerformingAssets(portfolioID, overPerformingAssets, latestAssetPrices, totalValue, totalCash)
+	totalSellAmount, err := s.sellOverPerformingAssets(portfolio, overPerformingAssets, latestAssetPrices, totalValue, totalCash, trades)
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 
 	var failReason string = ""
-	totalBuyAmount, err := s.buyUnderPerformingAssets(portfolioID, underPerformingAssets, latestAssetPrices, totalValue, totalCash, &failReason)
+	totalBuyAmount, err := s.buyUnderPerformingAssets(portfolio, underPerformingAssets, latestAssetPrices, totalValue, totalCash, &failReason, trades)
 	if err != nil {
-		return nil, err
+		return nil, false, err
+	}
+
+	if driftBand > 0 && len(trades.transactions) == 0 {
+		// prices moved back inside the band or there was no cash to buy with, so there is nothing to report.
+		// Targets moved by the glide path are left unsaved, the next rebalance moves them again.
+		log.Printf("Portfolio %d for user %d needed no trades\n", portfolioID, userID)
+		if err := s.repo.UnlockRoboPortfolio(portfolio); err != nil {
+			return nil, false, err
+		}
+		return portfolio, false, nil
 	}
 
 	// balance the cash
-	targetCash := math.Floor(totalValue * cashCategory.TotalPercentage / 100)
+	targetCash := commons.RoundCash(totalValue.MulFloat(cashCategory.TotalPercentage/100), portfolio.Currency)
+	expectedCash, availableCash := commons.FormatCash(targetCash, portfolio.Currency), commons.FormatCash(*totalCash, portfolio.Currency)
 
-	if *totalCash < targetCash {
+	if totalCash.LessThan(targetCash) {
 		cashCategory.TotalAmount = *totalCash
 
 		// not enough cash, send a notification to the user
-		failReason = "Cash is under-allocated. Expected: " + fmt.Sprintf("%.2f", targetCash) + ", Available: " + fmt.Sprintf("%.2f", *totalCash)
+		failReason = "Cash is under-allocated. Expected: " + expectedCash + ", Available: " + availableCash
 		if err := s.notificationService.AddNotification(ctx, userID, "rebalance", failReason); err != nil {
 			log.Println("Failed to add notification:", err)
 		}
-		log.Printf("Warning: Cash is under-allocated. Expected: %.2f, Available: %.2f\n", targetCash, *totalCash)
+		log.Printf("Warning: Cash is under-allocated. Expected: %s, Available: %s\n", expectedCash, availableCash)
 		user, err := s.userService.GetUser(userID)
 		if err != nil {
 			log.Printf("Failed to get profile for user %d: %v\n", userID, err)
@@ -400,28 +683,35 @@ func (s *roboPortfolioServiceImpl) RebalancePortfolio(ctx context.Context, userI
 			subject := "Alert from InfiniVest"
 			body := fmt.Sprintf(`
 			<p>Dear User,</p>
-			<p>We encountered an issue during the rebalancing process of your robo-portfolio due to insufficient available cash.</p>
-			<p><strong>Expected Cash:</strong> $%.2f<br>
-			<strong>Available Cash:</strong> $%.2f</p>
+			<p>We encountered an issue during the rebalancing process of your robo-portfolio <strong>%s</strong> due to insufficient available cash.</p>
+			<p><strong>Expected Cash:</strong> %s %s<br>
+			<strong>Available Cash:</strong> %s %s</p>
 			<p>Please top up your robo-portfolio to ensure optimal performance.</p>
 			<p>If you have any questions, feel free to reach out to our support team.</p>
 			<p>Best regards,<br>
 			The InfiniVest Team</p>
-		`, targetCash, *totalCash)
+		`, portfolio.Name, expectedCash, portfolio.Currency, availableCash, portfolio.Currency)
 			if err := email.SendEmail(user.Email, subject, body); err != nil {
 				log.Println("Failed to send email:", err)
 			}
 		}
-	} else if *totalCash > targetCash {
+	} else if totalCash.GreaterThan(targetCash) {
 		// too much cash: add the extra back into the portfolio
-		excessCash := *totalCash - targetCash
-		log.Printf("Excess cash detected: %.2f. Redistributing...\n", excessCash)
-		if err := s.addMoneyToPortfolio(portfolio, excessCash); err != nil {
-			return nil, err
+		excessCash := totalCash.Sub(targetCash)
+		log.Printf("Excess cash detected: %s. Redistributing...\n", excessCash)
+		if err := s.addMoneyToPortfolio(portfolio, excessCash, "pro-rata", trades); err != nil {
+			return nil, false, err
 		}
 		*totalCash = targetCash
 	}
 
+	// fees are settled from cash once all trades are done
+	if trades.fees.GreaterThan(cashCategory.TotalAmount) {
+		log.Printf("Warning: fees of %s exceed available cash %s in portfolio %d\n", trades.fees, cashCategory.TotalAmount, portfolio.ID)
+	}
+	cashCategory.TotalAmount = decimal.Max(cashCategory.TotalAmount.Sub(trades.fees), decimal.Zero)
+	weightsAfter, valueAfter := snapshotWeights(portfolio, latestAssetPrices)
+
 	var reason *string = nil
 	if failReason != "" {
 		reason = &failReason
@@ -429,30 +719,29 @@ func (s *roboPortfolioServiceImpl) RebalancePortfolio(ctx context.Context, userI
 	rebalanceEvent := &models.RebalanceEvent{
 		RoboPortfolioID:      portfolio.ID,
 		PortfolioValueBefore: totalValue,
-		PortfolioValueAfter:  totalValue,
+		PortfolioValueAfter:  valueAfter,
 		TotalBuyAmount:       totalBuyAmount,
 		TotalSellAmount:      totalSellAmount,
-		NetChange:            0,
+		NetChange:            valueAfter.Sub(totalValue),
 		Success:              failReason == "",
 		Reason:               reason,
+		HarvestedLoss:        harvestedLoss,
+		Fees:                 trades.fees,
+		Assets:               rebalanceEventAssets(weightsBefore, weightsAfter, latestAssetPrices, trades),
 	}
-	if err := s.repo.UpdateRoboPortfolio(portfolio); err != nil {
-		return nil, err
-	}
-
-	if err := s.repo.CreateRebalanceEvent(rebalanceEvent); err != nil {
-		return nil, err
+	if err := s.repo.SaveRebalance(portfolio, rebalanceEvent, trades.transactions, versions...); err != nil {
+		return nil, false, err
 	}
 
 	log.Println("Rebalanced portfolio:", portfolioID, "for user", userID)
 	if err := s.repo.UnlockRoboPortfolio(portfolio); err != nil {
-		return nil, err
+		return nil, false, err
 	}
 
 	// add to notification queue
-	var message string = "Portfolio rebalanced successfully!"
+	var message string = fmt.Sprintf("Portfolio %s rebalanced successfully!", portfolio.Name)
 	if failReason != "" {
-		message = "Portfolio rebalanced with issues!"
+		message = fmt.Sprintf("Portfolio %s rebalanced with issues!", portfolio.Name)
 		if err := s.notificationService.AddNotification(ctx, userID, "rebalance", failReason); err != nil {
 			log.Println("Failed to add notification:", err)
 		}
@@ -462,102 +751,300 @@ func (s *roboPortfolioServiceImpl) RebalancePortfolio(ctx context.Context, userI
 		log.Println("Failed to add notification:", err)
 
 	}
-	return portfolio, nil
+	if glidePathVersion != nil {
+		s.notifyGlidePath(ctx, portfolio)
+	}
+	if harvestedLoss.IsPositive() {
+		message = fmt.Sprintf("Harvested %s %s of losses in portfolio %s", commons.FormatCash(harvestedLoss, portfolio.Currency), portfolio.Currency, portfolio.Name)
+		if err := s.notificationService.AddNotification(ctx, userID, "rebalance", message); err != nil {
+			log.Println("Failed to add notification:", err)
+		}
+	}
+	return portfolio, true, nil
 }
 
-func (s *roboPortfolioServiceImpl) GetRoboPortfolioTransactions(userID uint, limit int) ([]*models.RoboPortfolioTransaction, error) {
-	return s.repo.GetRoboPortfolioTransactions(userID, limit)
+func (s *roboPortfolioServiceImpl) GetRoboPortfolioTransactions(userID, portfolioID uint, limit int) ([]*models.RoboPortfolioTransaction, error) {
+	// transactions of archived portfolios stay available
+	portfolio, err := s.repo.GetRoboPortfolioDetails(userID, portfolioID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		portfolio, err = s.repo.GetArchivedRoboPortfolio(userID, portfolioID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.GetRoboPortfolioTransactions(portfolio.ID, limit)
+}
+
+func (s *roboPortfolioServiceImpl) ExportRoboPortfolioTransactions(userID, portfolioID uint, format string, from, to *time.Time) (*TransactionExport, error) {
+	portfolio, err := s.repo.GetRoboPortfolioDetails(userID, portfolioID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		portfolio, err = s.repo.GetArchivedRoboPortfolio(userID, portfolioID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	account := fmt.Sprintf("robo-%d", portfolio.ID)
+	return newTransactionExport(format, account, portfolio.Currency, from, to, func(fn func(exportTransaction) error) error {
+		return s.repo.StreamRoboPortfolioTransactions(portfolio.ID, from, to, func(t *models.RoboPortfolioTransaction) error {
+			return fn(newRoboExportTransaction(t))
+		})
+	})
+}
+
+func (s *roboPortfolioServiceImpl) GetRoboPortfolioRisk(userID, portfolioID uint, benchmark string, days int) (dto.PortfolioRiskResponse, error) {
+	portfolio, err := s.repo.GetRoboPortfolioDetails(userID, portfolioID)
+	if err != nil {
+		return dto.PortfolioRiskResponse{}, err
+	}
+	holdings := make(map[string]decimal.Decimal)
+	cash := decimal.Zero
+	for _, category := range portfolio.Categories {
+		if category.Name == "cash" {
+			cash = cash.Add(category.TotalAmount)
+			continue
+		}
+		for _, asset := range category.Assets {
+			holdings[asset.Symbol] = holdings[asset.Symbol].Add(asset.SharesOwned)
+		}
+	}
+	// robo portfolios only hold funds quoted in their own currency
+	return computeHoldingsRisk(s.genAIService, holdings, nil, cash, portfolio.Currency, benchmark, days)
+}
+
+func (s *roboPortfolioServiceImpl) GetRoboPortfolioDrift(userID, portfolioID uint) (dto.PortfolioDriftResponse, error) {
+	portfolio, err := s.repo.GetRoboPortfolioDetails(userID, portfolioID)
+	if err != nil {
+		return dto.PortfolioDriftResponse{}, err
+	}
+	holdings, totalValue, err := s.getPortfolioHoldings(portfolio)
+	if err != nil {
+		return dto.PortfolioDriftResponse{}, err
+	}
+	res := dto.PortfolioDriftResponse{TotalValue: totalValue}
+	if !totalValue.IsPositive() {
+		return res, nil
+	}
+
+	categoryValues := make(map[string]decimal.Decimal)
+	for _, holding := range holdings {
+		categoryValues[holding.category.Name] = categoryValues[holding.category.Name].Add(holding.value)
+		if holding.asset == nil {
+			continue
+		}
+		current := percentOf(holding.value, totalValue)
+		res.Assets = append(res.Assets, dto.HoldingDrift{
+			Category:          holding.category.Name,
+			Symbol:            holding.asset.Symbol,
+			TargetPercentage:  holding.target,
+			CurrentPercentage: current,
+			Drift:             current - holding.target,
+		})
+		res.MaxDrift = math.Max(res.MaxDrift, math.Abs(current-holding.target))
+	}
+	for _, category := range portfolio.Categories {
+		current := percentOf(categoryValues[category.Name], totalValue)
+		res.Categories = append(res.Categories, dto.HoldingDrift{
+			Category:          category.Name,
+			TargetPercentage:  category.TotalPercentage,
+			CurrentPercentage: current,
+			Drift:             current - category.TotalPercentage,
+		})
+		res.MaxDrift = math.Max(res.MaxDrift, math.Abs(current-category.TotalPercentage))
+	}
+	return res, nil
 }
 
-func (s *roboPortfolioServiceImpl) GetRebalanceEvents(ctx context.Context, userID uint) ([]*models.RebalanceEvent, error) {
-	portfolio, err := s.repo.GetRoboPortfolioDetails(userID)
+func (s *roboPortfolioServiceImpl) GetRebalanceEvents(ctx context.Context, userID, portfolioID uint) ([]*models.RebalanceEvent, error) {
+	portfolio, err := s.repo.GetRoboPortfolioDetails(userID, portfolioID)
 	if err != nil {
-		return nil, fmt.Errorf("portfolio not found for user %d", userID)
+		return nil, fmt.Errorf("portfolio %d not found for user %d", portfolioID, userID)
 	}
 	lastSeen, err := s.redis.GetLastSeen(ctx, userID, portfolio.ID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get last seen time for portfolio %d for user %d: %w", portfolio.ID, userID, err)
 	}
-	return s.repo.GetRebalanceEvents(userID, lastSeen)
+	return s.repo.GetRebalanceEvents(portfolio.ID, lastSeen)
+}
+
+func (s *roboPortfolioServiceImpl) GetRebalanceEvent(userID, portfolioID, eventID uint) (*models.RebalanceEvent, error) {
+	portfolio, err := s.repo.GetRoboPortfolioDetails(userID, portfolioID)
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.GetRebalanceEvent(portfolio.ID, eventID)
 }
 
-func (s *roboPortfolioServiceImpl) UpdateLastSeenRebalanceTime(ctx context.Context, userID uint) error {
-	portfolio, err := s.repo.GetRoboPortfolioDetails(userID)
+func (s *roboPortfolioServiceImpl) UpdateLastSeenRebalanceTime(ctx context.Context, userID, portfolioID uint) error {
+	portfolio, err := s.repo.GetRoboPortfolioDetails(userID, portfolioID)
 	if err != nil {
-		return fmt.Errorf("portfolio not found for user %d", userID)
+		return fmt.Errorf("portfolio %d not found for user %d", portfolioID, userID)
 	}
 	return s.redis.SetLastSeen(ctx, userID, portfolio.ID)
 }
 
-func (s *roboPortfolioServiceImpl) addMoneyToPortfolio(portfolio *models.RoboPortfolio, amount float64) error {
-	var wg sync.WaitGroup
+func (s *roboPortfolioServiceImpl) addMoneyToPortfolio(portfolio *models.RoboPortfolio, amount decimal.Decimal, strategy string, trades *rebalanceTrades) error {
+	plan, err := s.planDeposit(portfolio, amount, strategy)
+	if err != nil {
+		return err
+	}
+	return s.executeDeposit(portfolio, plan, trades)
+}
+
+// planDeposit decides how a deposit is split across the portfolio's holdings without buying anything.
+// "pro-rata" splits by target percentage. "underweight-first" fills each holding's shortfall against its
+// target at the current portfolio value, in proportion to the shortfalls, and splits any remainder pro-rata.
+func (s *roboPortfolioServiceImpl) planDeposit(portfolio *models.RoboPortfolio, amount decimal.Decimal, strategy string) (dto.DepositPlan, error) {
+	if strategy == "" {
+		strategy = "pro-rata"
+	}
+	if !commons.DepositStrategies[strategy] {
+		return dto.DepositPlan{}, fmt.Errorf("invalid deposit strategy: %s", strategy)
+	}
+	latestAssetPrices := make(map[string]decimal.Decimal)
+	totalValue, _, err := s.getPortfolioValue(portfolio, latestAssetPrices)
+	if err != nil {
+		return dto.DepositPlan{}, err
+	}
+	amount = commons.RoundCash(amount, portfolio.Currency)
+
+	var allocations []dto.DepositAllocation
+	var targetPercentages []float64
 	for _, category := range portfolio.Categories {
-		categoryTotal := amount * category.TotalPercentage / 100
-		category.TotalAmount += categoryTotal
-		if category.Name == "cash" || category.TotalPercentage == 0 {
+		if category.Name == "cash" {
+			allocations = append(allocations, dto.DepositAllocation{
+				Category:     category.Name,
+				CurrentValue: category.TotalAmount,
+				TargetValue:  commons.RoundCash(totalValue.MulFloat(category.TotalPercentage/100), portfolio.Currency),
+			})
+			targetPercentages = append(targetPercentages, category.TotalPercentage)
+			continue
+		}
+		if category.TotalPercentage == 0 {
 			continue
 		}
-		errCh := make(chan error, len(category.Assets))
 		for _, asset := range category.Assets {
-			wg.Add(1)
-			go func(asset *models.RoboPortfolioAsset, assetAmount float64) {
-				defer wg.Done()
+			latestPrice := latestAssetPrices[asset.Symbol]
+			curValue, targetValue := assetValues(portfolio, asset, latestPrice, totalValue)
+			allocations = append(allocations, dto.DepositAllocation{
+				Category:     category.Name,
+				Symbol:       asset.Symbol,
+				Name:         asset.Name,
+				CurrentValue: curValue,
+				TargetValue:  targetValue,
+				Price:        latestPrice,
+			})
+			targetPercentages = append(targetPercentages, asset.Percentage)
+		}
+	}
 
-				latestPrice, err := s.genAIService.GetLatestAssetPrice(asset.Symbol)
-				if err != nil {
-					errCh <- fmt.Errorf("failed to get latest price for asset %s: %w", asset.Symbol, err)
-					return
-				}
+	remaining := amount
+	if strategy == "underweight-first" {
+		totalShortfall := decimal.Zero
+		for _, allocation := range allocations {
+			totalShortfall = totalShortfall.Add(decimal.Max(allocation.TargetValue.Sub(allocation.CurrentValue), decimal.Zero))
+		}
+		if totalShortfall.IsPositive() {
+			funded := decimal.Min(amount, totalShortfall)
+			for i, allocation := range allocations {
+				shortfall := decimal.Max(allocation.TargetValue.Sub(allocation.CurrentValue), decimal.Zero)
+				allocations[i].Amount = funded.Mul(shortfall).Div(totalShortfall)
+			}
+			remaining = remaining.Sub(funded)
+		}
+	}
+	if remaining.IsPositive() {
+		for i := range allocations {
+			allocations[i].Amount = allocations[i].Amount.Add(remaining.MulFloat(targetPercentages[i] / 100))
+		}
+	}
 
-				sharesToBuy := assetAmount / latestPrice
-				asset.SharesOwned += sharesToBuy
-				asset.TotalInvested += assetAmount
-				if asset.SharesOwned > 0 {
-					asset.AvgBuyPrice = asset.TotalInvested / asset.SharesOwned
-				}
-				fmt.Print("current portfolio: ")
-				transaction := &models.RoboPortfolioTransaction{
-					RoboPortfolioID: portfolio.ID,
-					TransactionType: "buy",
-					TotalAmount:     assetAmount,
-					Symbol:          &asset.Symbol,
-					Name:            &asset.Name,
-					Price:           &latestPrice,
-					SharesAmount:    &sharesToBuy,
-				}
-				if err := s.repo.CreateRoboPortfolioTransaction(transaction); err != nil {
-					errCh <- fmt.Errorf("failed to create transaction for asset %s: %w", asset.Symbol, err)
-				}
-			}(asset, amount*asset.Percentage/100)
+	// each holding gets a whole amount of cash and the rounding difference goes to cash, so the allocations add up
+	// to the deposit
+	allocated, cashIndex := decimal.Zero, -1
+	for i, allocation := range allocations {
+		allocations[i].Amount = commons.RoundCash(allocation.Amount, portfolio.Currency)
+		allocated = allocated.Add(allocations[i].Amount)
+		if allocation.Symbol == "" {
+			cashIndex = i
 		}
+	}
+	if cashIndex >= 0 {
+		allocations[cashIndex].Amount = decimal.Max(allocations[cashIndex].Amount.Add(amount.Sub(allocated)), decimal.Zero)
+	}
+	for i, allocation := range allocations {
+		if allocation.Symbol != "" && allocation.Price.IsPositive() {
+			allocations[i].Shares = commons.RoundShares(allocation.Amount.Div(allocation.Price))
+		}
+	}
+	return dto.DepositPlan{
+		Strategy:     strategy,
+		Amount:       amount,
+		CurrentValue: totalValue,
+		Allocations:  allocations,
+	}, nil
+}
 
-		wg.Wait()
-		close(errCh)
-		for err := range errCh {
-			return err
+func (s *roboPortfolioServiceImpl) executeDeposit(portfolio *models.RoboPortfolio, plan dto.DepositPlan, trades *rebalanceTrades) error {
+	categories := make(map[string]*models.RoboPortfolioCategory)
+	assets := make(map[string]*models.RoboPortfolioAsset)
+	for _, category := range portfolio.Categories {
+		categories[category.Name] = category
+		for _, asset := range category.Assets {
+			assets[asset.Symbol] = asset
 		}
 	}
 
-	// save the updated portfolio
-	if err := s.repo.UpdateRoboPortfolio(portfolio); err != nil {
-		return err
+	for _, allocation := range plan.Allocations {
+		if !allocation.Amount.IsPositive() {
+			continue
+		}
+		if allocation.Symbol == "" {
+			categories[allocation.Category].TotalAmount = categories[allocation.Category].TotalAmount.Add(allocation.Amount)
+			continue
+		}
+
+		asset := assets[allocation.Symbol]
+		price, shares := allocation.Price, allocation.Shares
+		cost := buyShares(asset, shares, price)
+		categories[allocation.Category].TotalAmount = categories[allocation.Category].TotalAmount.Add(cost)
+		// what the whole units of share precision leave over stays in cash
+		if cash, exists := categories["cash"]; exists {
+			cash.TotalAmount = cash.TotalAmount.Add(allocation.Amount.Sub(cost))
+		}
+		transaction := &models.RoboPortfolioTransaction{
+			RoboPortfolioID: portfolio.ID,
+			TransactionType: "buy",
+			TotalAmount:     cost,
+			Symbol:          &asset.Symbol,
+			Name:            &asset.Name,
+			Price:           &price,
+			SharesAmount:    &shares,
+		}
+		if err := s.recordTrade(trades, transaction); err != nil {
+			return fmt.Errorf("failed to create transaction for asset %s: %w", asset.Symbol, err)
+		}
 	}
-	return nil
+
+	// a rebalance saves the portfolio together with its trades
+	if trades != nil {
+		return nil
+	}
+	return s.repo.UpdateRoboPortfolio(portfolio)
 }
 
-func (s *roboPortfolioServiceImpl) getPortfolioValue(portfolio *models.RoboPortfolio, latestAssetPrices map[string]float64) (float64, float64, error) {
+func (s *roboPortfolioServiceImpl) getPortfolioValue(portfolio *models.RoboPortfolio, latestAssetPrices map[string]decimal.Decimal) (decimal.Decimal, decimal.Decimal, error) {
 	var mu sync.Mutex
 
-	totalValue := 0.0
-	totalInvested := 0.0
+	totalValue := decimal.Zero
+	totalInvested := decimal.Zero
 	for _, category := range portfolio.Categories {
 		if category.Name == "cash" {
-			totalValue += category.TotalAmount
-			totalInvested += category.TotalAmount
+			totalValue = totalValue.Add(category.TotalAmount)
+			totalInvested = totalInvested.Add(category.TotalAmount)
 			continue
 		}
-		categoryValue := 0.0
-		categoryInvested := 0.0
+		categoryValue := decimal.Zero
+		categoryInvested := decimal.Zero
 		var wg sync.WaitGroup
 		errCh := make(chan error, len(category.Assets))
 		for _, asset := range category.Assets {
@@ -571,11 +1058,11 @@ func (s *roboPortfolioServiceImpl) getPortfolioValue(portfolio *models.RoboPortf
 					return
 				}
 
-				assetValue := asset.SharesOwned * latestPrice
+				assetValue := commons.RoundCash(asset.SharesOwned.Mul(latestPrice), portfolio.Currency)
 				mu.Lock()
 				latestAssetPrices[asset.Symbol] = latestPrice
-				categoryValue += assetValue
-				categoryInvested += asset.TotalInvested
+				categoryValue = categoryValue.Add(assetValue)
+				categoryInvested = categoryInvested.Add(asset.TotalInvested)
 				mu.Unlock()
 			}(asset)
 		}
@@ -583,18 +1070,25 @@ func (s *roboPortfolioServiceImpl) getPortfolioValue(portfolio *models.RoboPortf
 		wg.Wait()
 		close(errCh)
 		for err := range errCh {
-			return 0, 0, err
+			return decimal.Zero, decimal.Zero, err
 		}
 		category.TotalAmount = categoryValue
-		totalValue += categoryValue
-		totalInvested += categoryInvested
+		totalValue = totalValue.Add(categoryValue)
+		totalInvested = totalInvested.Add(categoryInvested)
 	}
 
 	return totalValue, totalInvested, nil
 }
 
-func (s *roboPortfolioServiceImpl) sellOverPerformingAssets(portfolioID uint, portfolioCategories []*models.RoboPortfolioAsset, latestAssetPricess map[string]float64, totalValue float64, totalCash *float64) (float64, error) {
-	totalSellAmount := 0.0
+// assetValues returns the asset's value at the latest price and its target value within the portfolio
+func assetValues(portfolio *models.RoboPortfolio, asset *models.RoboPortfolioAsset, latestPrice, totalValue decimal.Decimal) (decimal.Decimal, decimal.Decimal) {
+	curValue := commons.RoundCash(asset.SharesOwned.Mul(latestPrice), portfolio.Currency)
+	targetValue := commons.RoundCash(totalValue.MulFloat(asset.Percentage/100), portfolio.Currency)
+	return curValue, targetValue
+}
+
+func (s *roboPortfolioServiceImpl) sellOverPerformingAssets(portfolio *models.RoboPortfolio, portfolioCategories []*models.RoboPortfolioAsset, latestAssetPricess map[string]decimal.Decimal, totalValue decimal.Decimal, totalCash *decimal.Decimal, trades *rebalanceTrades) (decimal.Decimal, error) {
+	totalSellAmount := decimal.Zero
 	var mu sync.Mutex
 	var wg sync.WaitGroup
 	errCh := make(chan error, len(portfolioCategories))
@@ -605,32 +1099,26 @@ func (s *roboPortfolioServiceImpl) sellOverPerformingAssets(portfolioID uint, po
 			defer wg.Done()
 
 			latestPrice, exists := latestAssetPricess[asset.Symbol]
-			if !exists {
+			if !exists || !latestPrice.IsPositive() {
 				errCh <- fmt.Errorf("latest price for asset %s not found", asset.Symbol)
 				return
 			}
 
-			curValue := latestPrice * asset.SharesOwned
-			targetValue := totalValue * asset.Percentage / 100
-			amountToSell := curValue - targetValue
-
-			sharesToSell := amountToSell / latestPrice
-			asset.SharesOwned -= sharesToSell
-			asset.TotalInvested -= amountToSell
-			if asset.TotalInvested < 0 {
-				asset.TotalInvested = 0
-			}
-			if asset.SharesOwned > 0 {
-				asset.AvgBuyPrice = asset.TotalInvested / asset.SharesOwned
+			curValue, targetValue := assetValues(portfolio, asset, latestPrice, totalValue)
+			sharesToSell := decimal.Min(commons.RoundShares(curValue.Sub(targetValue).Div(latestPrice)), asset.SharesOwned)
+			if !sharesToSell.IsPositive() {
+				return
 			}
+			amountToSell := commons.RoundCash(sharesToSell.Mul(latestPrice), portfolio.Currency)
+			sellShares(asset, sharesToSell)
 
 			mu.Lock()
-			totalSellAmount += amountToSell
-			*totalCash += amountToSell
+			totalSellAmount = totalSellAmount.Add(amountToSell)
+			*totalCash = totalCash.Add(amountToSell)
 			mu.Unlock()
 
 			transaction := &models.RoboPortfolioTransaction{
-				RoboPortfolioID: portfolioID,
+				RoboPortfolioID: portfolio.ID,
 				TransactionType: "sell",
 				TotalAmount:     amountToSell,
 				Symbol:          &asset.Symbol,
@@ -638,7 +1126,7 @@ func (s *roboPortfolioServiceImpl) sellOverPerformingAssets(portfolioID uint, po
 				Price:           &latestPrice,
 				SharesAmount:    &sharesToSell,
 			}
-			if err := s.repo.CreateRoboPortfolioTransaction(transaction); err != nil {
+			if err := s.recordTrade(trades, transaction); err != nil {
 				errCh <- fmt.Errorf("failed to create transaction for asset %s: %w", asset.Symbol, err)
 			}
 		}(asset)
@@ -646,13 +1134,13 @@ func (s *roboPortfolioServiceImpl) sellOverPerformingAssets(portfolioID uint, po
 	wg.Wait()
 	close(errCh)
 	for err := range errCh {
-		return 0, err
+		return decimal.Zero, err
 	}
 	return totalSellAmount, nil
 }
 
-func (s *roboPortfolioServiceImpl) buyUnderPerformingAssets(portfolioID uint, portfolioCategories []*models.RoboPortfolioAsset, latestAssetPricess map[string]float64, totalValue float64, totalCash *float64, failReason *string) (float64, error) {
-	totalBuyAmount := 0.0
+func (s *roboPortfolioServiceImpl) buyUnderPerformingAssets(portfolio *models.RoboPortfolio, portfolioCategories []*models.RoboPortfolioAsset, latestAssetPricess map[string]decimal.Decimal, totalValue decimal.Decimal, totalCash *decimal.Decimal, failReason *string, trades *rebalanceTrades) (decimal.Decimal, error) {
+	totalBuyAmount := decimal.Zero
 	var mu sync.Mutex
 	var once sync.Once
 	var wg sync.WaitGroup
@@ -664,48 +1152,43 @@ func (s *roboPortfolioServiceImpl) buyUnderPerformingAssets(portfolioID uint, po
 			defer wg.Done()
 
 			latestPrice, exists := latestAssetPricess[asset.Symbol]
-			if !exists {
+			if !exists || !latestPrice.IsPositive() {
 				errCh <- fmt.Errorf("latest price for asset %s not found", asset.Symbol)
 				return
 			}
 
-			curValue := latestPrice * asset.SharesOwned
-			targetValue := totalValue * asset.Percentage / 100
-			amountToBuy := targetValue - curValue
+			curValue, targetValue := assetValues(portfolio, asset, latestPrice, totalValue)
+			amountToBuy := targetValue.Sub(curValue)
 
+			// shares are sized down to whole units of share precision, so the cost never exceeds the amount
 			mu.Lock()
-			if amountToBuy > *totalCash {
+			if amountToBuy.GreaterThan(*totalCash) {
 				once.Do(func() {
 					*failReason = "There is not enough funds when rebalancing assets"
 
 				})
 				amountToBuy = *totalCash
 			}
-			*totalCash -= amountToBuy
-			totalBuyAmount += amountToBuy
-			mu.Unlock()
-
-			if amountToBuy == 0 {
+			sharesToBuy := commons.RoundShares(amountToBuy.Div(latestPrice))
+			if !sharesToBuy.IsPositive() {
+				mu.Unlock()
 				return
 			}
-			sharesToBuy := amountToBuy / latestPrice
-			asset.SharesOwned += sharesToBuy
-			asset.TotalInvested += amountToBuy
-			if asset.SharesOwned > 0 {
-				asset.AvgBuyPrice = asset.TotalInvested / asset.SharesOwned
-			}
+			cost := buyShares(asset, sharesToBuy, latestPrice)
+			*totalCash = totalCash.Sub(cost)
+			totalBuyAmount = totalBuyAmount.Add(cost)
+			mu.Unlock()
 
 			transaction := &models.RoboPortfolioTransaction{
-				RoboPortfolioID: portfolioID,
+				RoboPortfolioID: portfolio.ID,
 				TransactionType: "buy",
-				TotalAmount:     amountToBuy,
+				TotalAmount:     cost,
 				Symbol:          &asset.Symbol,
 				Name:            &asset.Name,
 				Price:           &latestPrice,
 				SharesAmount:    &sharesToBuy,
 			}
-
-			if err := s.repo.CreateRoboPortfolioTransaction(transaction); err != nil {
+			if err := s.recordTrade(trades, transaction); err != nil {
 				errCh <- fmt.Errorf("failed to create transaction for asset %s: %w", asset.Symbol, err)
 			}
 		}(asset)
@@ -714,7 +1197,7 @@ func (s *roboPortfolioServiceImpl) buyUnderPerformingAssets(portfolioID uint, po
 	wg.Wait()
 	close(errCh)
 	for err := range errCh {
-		return 0, err
+		return decimal.Zero, err
 	}
 	return totalBuyAmount, nil
 }
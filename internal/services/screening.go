@@ -0,0 +1,252 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/KZY20112001/infinivest-backend/internal/analytics"
+	"github.com/KZY20112001/infinivest-backend/internal/commons"
+	"github.com/KZY20112001/infinivest-backend/internal/dto"
+	"github.com/KZY20112001/infinivest-backend/internal/models"
+	"github.com/KZY20112001/infinivest-backend/internal/repositories"
+)
+
+type ScreeningService interface {
+	CreateExclusionRule(userID uint, req dto.ExclusionRuleRequest) (*models.ExclusionRule, error)
+	GetExclusionRules(userID uint) ([]*models.ExclusionRule, error)
+	DeleteExclusionRule(userID, ruleID uint) error
+	GetAssetMetadata(category string) ([]*models.AssetMetadata, error)
+	ScreenAllocations(userID uint, allocations map[string]dto.Assets) (map[string]dto.Assets, []dto.ScreeningSubstitution, error)
+	ExcludedCategories(userID uint) ([]string, error)
+	ExcludedSymbols(userID uint, symbols []string) (map[string]string, error)
+}
+
+type screeningServiceImpl struct {
+	repo repositories.ScreeningRepo
+}
+
+func NewScreeningService(sr repositories.ScreeningRepo) *screeningServiceImpl {
+	return &screeningServiceImpl{repo: sr}
+}
+
+func (s *screeningServiceImpl) CreateExclusionRule(userID uint, req dto.ExclusionRuleRequest) (*models.ExclusionRule, error) {
+	if !commons.ExclusionRuleTypes[req.Type] {
+		return nil, fmt.Errorf("invalid exclusion rule type: %s", req.Type)
+	}
+	rule := &models.ExclusionRule{UserID: userID, RuleType: req.Type}
+	switch req.Type {
+	case "symbol":
+		rule.Value = strings.ToUpper(strings.TrimSpace(req.Value))
+	case "sector":
+		rule.Value = strings.ToLower(strings.TrimSpace(req.Value))
+	case "min-esg":
+		if req.MinESGScore <= 0 || req.MinESGScore > 10 {
+			return nil, fmt.Errorf("minimum ESG score must be between 0 and 10")
+		}
+		rule.MinESGScore = req.MinESGScore
+	}
+	if req.Type != "min-esg" && rule.Value == "" {
+		return nil, fmt.Errorf("exclusion rule value is required")
+	}
+	if err := s.repo.CreateExclusionRule(rule); err != nil {
+		return nil, err
+	}
+	return rule, nil
+}
+
+func (s *screeningServiceImpl) GetExclusionRules(userID uint) ([]*models.ExclusionRule, error) {
+	return s.repo.GetExclusionRules(userID)
+}
+
+func (s *screeningServiceImpl) DeleteExclusionRule(userID, ruleID uint) error {
+	rule, err := s.repo.GetExclusionRule(userID, ruleID)
+	if err != nil {
+		return err
+	}
+	return s.repo.DeleteExclusionRule(rule)
+}
+
+func (s *screeningServiceImpl) GetAssetMetadata(category string) ([]*models.AssetMetadata, error) {
+	return s.repo.GetAssetMetadata(category)
+}
+
+// ScreenAllocations replaces every asset excluded by the user's rules with the approved asset from the same
+// category that has the best ESG score, keeping its percentage. Categories without an eligible substitute fail.
+func (s *screeningServiceImpl) ScreenAllocations(userID uint, allocations map[string]dto.Assets) (map[string]dto.Assets, []dto.ScreeningSubstitution, error) {
+	rules, err := s.repo.GetExclusionRules(userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	substitutions := []dto.ScreeningSubstitution{}
+	if len(rules) == 0 {
+		return allocations, substitutions, nil
+	}
+
+	var symbols []string
+	for _, assets := range allocations {
+		for _, asset := range assets.Assets {
+			symbols = append(symbols, asset.Symbol)
+		}
+	}
+	known, err := s.repo.GetAssetMetadataBySymbols(symbols)
+	if err != nil {
+		return nil, nil, err
+	}
+	metadata := make(map[string]*models.AssetMetadata, len(known))
+	for _, m := range known {
+		metadata[m.Symbol] = m
+	}
+
+	categories := make([]string, 0, len(allocations))
+	for category := range allocations {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+
+	screened := make(map[string]dto.Assets, len(allocations))
+	for _, category := range categories {
+		assets := allocations[category]
+		var candidates []*models.AssetMetadata
+		kept := dto.Assets{Assets: []dto.Asset{}, Reason: assets.Reason}
+		index := make(map[string]int)
+		add := func(asset dto.Asset) {
+			if i, exists := index[asset.Symbol]; exists {
+				kept.Assets[i].Percentage += asset.Percentage
+				return
+			}
+			index[asset.Symbol] = len(kept.Assets)
+			kept.Assets = append(kept.Assets, asset)
+		}
+
+		for _, asset := range assets.Assets {
+			reason := exclusionReason(asset.Symbol, metadata[asset.Symbol], rules)
+			if reason == "" {
+				add(asset)
+				continue
+			}
+			if candidates == nil {
+				if candidates, err = s.repo.GetAssetMetadata(category); err != nil {
+					return nil, nil, err
+				}
+			}
+			substitute := pickSubstitute(candidates, rules, assets.Assets)
+			if substitute == nil {
+				return nil, nil, fmt.Errorf("%s is excluded (%s) and there is no approved substitute in %s", asset.Symbol, reason, category)
+			}
+			add(dto.Asset{Name: substitute.Name, Symbol: substitute.Symbol, Percentage: asset.Percentage})
+			substitutions = append(substitutions, dto.ScreeningSubstitution{
+				Category:         category,
+				Symbol:           asset.Symbol,
+				Name:             asset.Name,
+				SubstituteSymbol: substitute.Symbol,
+				SubstituteName:   substitute.Name,
+				Reason:           reason,
+			})
+		}
+		screened[category] = kept
+	}
+	return screened, substitutions, nil
+}
+
+// ExcludedCategories returns the robo categories in which the user's rules leave no approved asset to invest in.
+// Cash is never excluded.
+func (s *screeningServiceImpl) ExcludedCategories(userID uint) ([]string, error) {
+	rules, err := s.repo.GetExclusionRules(userID)
+	if err != nil {
+		return nil, err
+	}
+	excluded := []string{}
+	if len(rules) == 0 {
+		return excluded, nil
+	}
+	metadata, err := s.repo.GetAssetMetadata("")
+	if err != nil {
+		return nil, err
+	}
+	eligible := make(map[string]bool)
+	for _, m := range metadata {
+		if m.Approved && exclusionReason(m.Symbol, m, rules) == "" {
+			eligible[m.Category] = true
+		}
+	}
+	for _, category := range analytics.RoboCategories {
+		if category != "cash" && !eligible[category] {
+			excluded = append(excluded, category)
+		}
+	}
+	return excluded, nil
+}
+
+// ExcludedSymbols returns why the user's rules exclude each of the given symbols; allowed symbols are left out
+func (s *screeningServiceImpl) ExcludedSymbols(userID uint, symbols []string) (map[string]string, error) {
+	rules, err := s.repo.GetExclusionRules(userID)
+	if err != nil {
+		return nil, err
+	}
+	excluded := make(map[string]string)
+	if len(rules) == 0 || len(symbols) == 0 {
+		return excluded, nil
+	}
+	known, err := s.repo.GetAssetMetadataBySymbols(symbols)
+	if err != nil {
+		return nil, err
+	}
+	metadata := make(map[string]*models.AssetMetadata, len(known))
+	for _, m := range known {
+		metadata[m.Symbol] = m
+	}
+	for _, symbol := range symbols {
+		if reason := exclusionReason(symbol, metadata[symbol], rules); reason != "" {
+			excluded[symbol] = reason
+		}
+	}
+	return excluded, nil
+}
+
+// exclusionReason explains why the rules exclude the asset, or returns "" when it is allowed.
+// Assets without metadata cannot pass a minimum ESG score.
+func exclusionReason(symbol string, metadata *models.AssetMetadata, rules []*models.ExclusionRule) string {
+	for _, rule := range rules {
+		switch rule.RuleType {
+		case "symbol":
+			if strings.EqualFold(rule.Value, symbol) {
+				return "excluded symbol"
+			}
+		case "sector":
+			if metadata != nil && strings.EqualFold(rule.Value, metadata.Sector) {
+				return fmt.Sprintf("excluded sector %s", metadata.Sector)
+			}
+		case "min-esg":
+			if metadata == nil {
+				return "no ESG score"
+			}
+			if metadata.ESGScore < rule.MinESGScore {
+				return fmt.Sprintf("ESG score %.1f is below %.1f", metadata.ESGScore, rule.MinESGScore)
+			}
+		}
+	}
+	return ""
+}
+
+// pickSubstitute prefers approved assets the category does not hold yet, falling back to one it already holds.
+// The candidates are ordered by ESG score.
+func pickSubstitute(candidates []*models.AssetMetadata, rules []*models.ExclusionRule, current []dto.Asset) *models.AssetMetadata {
+	held := make(map[string]bool, len(current))
+	for _, asset := range current {
+		held[asset.Symbol] = true
+	}
+	var fallback *models.AssetMetadata
+	for _, candidate := range candidates {
+		if !candidate.Approved || exclusionReason(candidate.Symbol, candidate, rules) != "" {
+			continue
+		}
+		if !held[candidate.Symbol] {
+			return candidate
+		}
+		if fallback == nil {
+			fallback = candidate
+		}
+	}
+	return fallback
+}
@@ -0,0 +1,163 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/KZY20112001/infinivest-backend/internal/commons"
+	"github.com/KZY20112001/infinivest-backend/internal/commons/decimal"
+	"github.com/KZY20112001/infinivest-backend/internal/models"
+)
+
+// harvestTaxLosses replaces positions that are down more than the portfolio's harvest threshold with a substitute
+// from the same category, keeping the allocation intact, and returns the realised loss. When a position was
+// replaced it also returns the new allocation version, which the caller saves together with the portfolio.
+func (s *roboPortfolioServiceImpl) harvestTaxLosses(portfolio *models.RoboPortfolio, latestAssetPrices map[string]decimal.Decimal, trades *rebalanceTrades) (decimal.Decimal, *models.AllocationVersion, error) {
+	threshold := portfolio.HarvestThreshold
+	if threshold <= 0 {
+		threshold = commons.DefaultHarvestThreshold
+	}
+	windowStart := time.Now().Add(-commons.WashSaleWindow)
+
+	held := make(map[string]bool)
+	for _, category := range portfolio.Categories {
+		for _, asset := range category.Assets {
+			held[asset.Symbol] = true
+		}
+	}
+
+	harvestedLoss := decimal.Zero
+	swapped := false
+	for _, category := range portfolio.Categories {
+		if category.Name == "cash" {
+			continue
+		}
+		for _, asset := range category.Assets {
+			latestPrice, exists := latestAssetPrices[asset.Symbol]
+			if !exists || !asset.SharesOwned.IsPositive() {
+				continue
+			}
+			costBasis := lotsCostBasis(asset)
+			proceeds := commons.RoundCash(asset.SharesOwned.Mul(latestPrice), portfolio.Currency)
+			if !costBasis.IsPositive() || percentOf(costBasis.Sub(proceeds), costBasis) < threshold {
+				continue
+			}
+
+			// a buy of the same security inside the wash-sale window would disallow the loss
+			recentBuys, err := s.repo.GetRoboPortfolioTransactionsSince(portfolio.ID, asset.Symbol, []string{"buy", "harvest:buy"}, windowStart)
+			if err != nil {
+				return decimal.Zero, nil, err
+			}
+			if len(recentBuys) > 0 {
+				log.Printf("Skipping harvest of %s in portfolio %d: bought within the wash-sale window\n", asset.Symbol, portfolio.ID)
+				continue
+			}
+
+			substitute, substitutePrice, err := s.findHarvestSubstitute(portfolio, asset.Symbol, held, windowStart)
+			if err != nil {
+				return decimal.Zero, nil, err
+			}
+			if substitute == nil {
+				log.Printf("Skipping harvest of %s in portfolio %d: no eligible substitute\n", asset.Symbol, portfolio.ID)
+				continue
+			}
+			if !swapped {
+				if err := s.ensureAllocationHistory(portfolio); err != nil {
+					return decimal.Zero, nil, err
+				}
+				swapped = true
+			}
+
+			soldSymbol, soldName := asset.Symbol, asset.Name
+			sharesSold := asset.SharesOwned
+			loss := sellShares(asset, sharesSold).Sub(proceeds)
+			sellTransaction := &models.RoboPortfolioTransaction{
+				RoboPortfolioID: portfolio.ID,
+				TransactionType: "harvest:sell",
+				TotalAmount:     proceeds,
+				Symbol:          &soldSymbol,
+				Name:            &soldName,
+				Price:           &latestPrice,
+				SharesAmount:    &sharesSold,
+			}
+			if err := s.recordTrade(trades, sellTransaction); err != nil {
+				return decimal.Zero, nil, fmt.Errorf("failed to create transaction for asset %s: %w", soldSymbol, err)
+			}
+
+			asset.Symbol, asset.Name = substitute.Symbol, substitute.Name
+			sharesBought := commons.RoundShares(proceeds.Div(substitutePrice))
+			cost := buyShares(asset, sharesBought, substitutePrice)
+			// what the whole units of share precision leave over stays in cash
+			if cash := roboCashCategory(portfolio); cash != nil {
+				cash.TotalAmount = cash.TotalAmount.Add(proceeds.Sub(cost))
+			}
+			buyTransaction := &models.RoboPortfolioTransaction{
+				RoboPortfolioID: portfolio.ID,
+				TransactionType: "harvest:buy",
+				TotalAmount:     cost,
+				Symbol:          &substitute.Symbol,
+				Name:            &substitute.Name,
+				Price:           &substitutePrice,
+				SharesAmount:    &sharesBought,
+			}
+			if err := s.recordTrade(trades, buyTransaction); err != nil {
+				return decimal.Zero, nil, fmt.Errorf("failed to create transaction for asset %s: %w", substitute.Symbol, err)
+			}
+
+			latestAssetPrices[asset.Symbol] = substitutePrice
+			held[soldSymbol] = false
+			held[substitute.Symbol] = true
+			harvestedLoss = harvestedLoss.Add(loss)
+			log.Printf("Harvested %s of losses by swapping %s for %s in portfolio %d\n", loss, soldSymbol, substitute.Symbol, portfolio.ID)
+		}
+	}
+	if !swapped {
+		return harvestedLoss, nil, nil
+	}
+	// the substitutes replace the harvested symbols in the target allocation
+	version, err := newAllocationVersion(portfolio, "tax-loss-harvest", time.Now())
+	if err != nil {
+		return decimal.Zero, nil, err
+	}
+	return harvestedLoss, version, nil
+}
+
+// findHarvestSubstitute returns the first configured substitute that is not already held, is not excluded by the
+// user's screening rules and has not been sold at a loss inside the wash-sale window, together with its latest price.
+func (s *roboPortfolioServiceImpl) findHarvestSubstitute(portfolio *models.RoboPortfolio, symbol string, held map[string]bool, windowStart time.Time) (*commons.SubstituteAsset, decimal.Decimal, error) {
+	candidates := commons.TaxLossHarvestingSubstitutes[symbol]
+	symbols := make([]string, 0, len(candidates))
+	for _, candidate := range candidates {
+		symbols = append(symbols, candidate.Symbol)
+	}
+	excluded, err := s.screeningService.ExcludedSymbols(portfolio.UserID, symbols)
+	if err != nil {
+		return nil, decimal.Zero, err
+	}
+
+	for _, candidate := range candidates {
+		if held[candidate.Symbol] {
+			continue
+		}
+		if reason, isExcluded := excluded[candidate.Symbol]; isExcluded {
+			log.Printf("Skipping substitute %s for portfolio %d: %s\n", candidate.Symbol, portfolio.ID, reason)
+			continue
+		}
+		recentHarvests, err := s.repo.GetRoboPortfolioTransactionsSince(portfolio.ID, candidate.Symbol, []string{"harvest:sell"}, windowStart)
+		if err != nil {
+			return nil, decimal.Zero, err
+		}
+		if len(recentHarvests) > 0 {
+			continue
+		}
+		price, err := s.genAIService.GetLatestAssetPrice(candidate.Symbol)
+		if err != nil || !price.IsPositive() {
+			log.Printf("Failed to get latest price for substitute %s: %v\n", candidate.Symbol, err)
+			continue
+		}
+		substitute := candidate
+		return &substitute, price, nil
+	}
+	return nil, decimal.Zero, nil
+}
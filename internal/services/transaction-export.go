@@ -0,0 +1,319 @@
+package services
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/KZY20112001/infinivest-backend/internal/commons/decimal"
+	"github.com/KZY20112001/infinivest-backend/internal/models"
+)
+
+var exportContentTypes = map[string]string{
+	"csv": "text/csv",
+	"ofx": "application/x-ofx",
+	"qif": "application/qif",
+}
+
+// TransactionExport is a transaction history ready to be streamed in one of the export formats
+type TransactionExport struct {
+	ContentType string
+	Filename    string
+	WriteTo     func(w io.Writer) error
+}
+
+// exportTransaction is a portfolio transaction in the common shape of the export formats. Amount is the signed
+// change in cash, Symbol is empty for cash movements and Shares is negative when shares leave the portfolio.
+type exportTransaction struct {
+	ID     uint
+	Date   time.Time
+	Type   string
+	Symbol string
+	Name   string
+	Shares decimal.Decimal
+	Price  decimal.Decimal
+	Amount decimal.Decimal
+	Fee    decimal.Decimal
+}
+
+// transactionStream calls fn for each transaction in date order
+type transactionStream func(fn func(exportTransaction) error) error
+
+type transactionWriter interface {
+	begin() error
+	write(t exportTransaction) error
+	end() error
+}
+
+// newTransactionExport exports the transactions of an account whose cash is held in currency
+func newTransactionExport(format, account, currency string, from, to *time.Time, stream transactionStream) (*TransactionExport, error) {
+	contentType, ok := exportContentTypes[format]
+	if !ok {
+		return nil, fmt.Errorf("invalid export format: %s", format)
+	}
+	return &TransactionExport{
+		ContentType: contentType,
+		Filename:    fmt.Sprintf("%s-transactions.%s", account, format),
+		WriteTo: func(w io.Writer) error {
+			buffered := bufio.NewWriter(w)
+			var writer transactionWriter
+			switch format {
+			case "csv":
+				writer = &csvTransactionWriter{w: csv.NewWriter(buffered)}
+			case "ofx":
+				writer = &ofxTransactionWriter{w: buffered, account: account, currency: currency, from: from, to: to, securities: make(map[string]string)}
+			case "qif":
+				writer = &qifTransactionWriter{w: buffered}
+			}
+			if err := writer.begin(); err != nil {
+				return err
+			}
+			if err := stream(writer.write); err != nil {
+				return err
+			}
+			if err := writer.end(); err != nil {
+				return err
+			}
+			return buffered.Flush()
+		},
+	}, nil
+}
+
+func newManualExportTransaction(t *models.ManualPortfolioTransaction) exportTransaction {
+	return newExportTransaction(t.ID, t.CreatedAt, t.TransactionType, t.Symbol, t.Name, t.SharesAmount, t.Price, t.TotalAmount, t.Fee)
+}
+
+func newRoboExportTransaction(t *models.RoboPortfolioTransaction) exportTransaction {
+	return newExportTransaction(t.ID, t.CreatedAt, t.TransactionType, t.Symbol, t.Name, t.SharesAmount, t.Price, t.TotalAmount, t.Fee)
+}
+
+func newExportTransaction(id uint, date time.Time, transactionType string, symbol, name *string, shares, price *decimal.Decimal, amount, fee decimal.Decimal) exportTransaction {
+	t := exportTransaction{ID: id, Date: date, Type: transactionType, Fee: fee}
+	if symbol != nil && shares != nil {
+		t.Symbol = *symbol
+		t.Shares = *shares
+		t.Name = *symbol
+		if name != nil {
+			t.Name = *name
+		}
+		if price != nil {
+			t.Price = *price
+		}
+	}
+
+	// the amount of an in-kind transfer is the cost basis of the shares, no cash moves
+	outflow := false
+	switch transactionType {
+	case "buy", "rebalance:buy", "harvest:buy", "withdrawal":
+		outflow = true
+	case "transfer:in":
+		if t.Symbol != "" {
+			amount = decimal.Zero
+		}
+	case "transfer:out":
+		outflow = true
+		if t.Symbol != "" {
+			amount = decimal.Zero
+			t.Shares = t.Shares.Neg()
+		}
+	}
+	if strings.HasSuffix(transactionType, "sell") {
+		t.Shares = t.Shares.Neg()
+	}
+	t.Amount = amount
+	if outflow {
+		t.Amount = amount.Neg()
+	}
+	return t
+}
+
+// isExportBuy reports whether the transaction buys shares with cash
+func isExportBuy(t exportTransaction) bool {
+	return t.Symbol != "" && t.Shares.IsPositive() && !t.Amount.IsZero()
+}
+
+func isExportSell(t exportTransaction) bool {
+	return t.Symbol != "" && t.Shares.IsNegative() && !t.Amount.IsZero()
+}
+
+func formatExportNumber(value decimal.Decimal) string {
+	return value.String()
+}
+
+// formatExportAmount formats cash with two decimals, the statements are all in a single currency
+func formatExportAmount(value decimal.Decimal) string {
+	return value.StringFixed(2)
+}
+
+type csvTransactionWriter struct {
+	w *csv.Writer
+}
+
+func (cw *csvTransactionWriter) begin() error {
+	return cw.w.Write([]string{"Date", "Type", "Symbol", "Name", "Shares", "Price", "Amount", "Fee", "ID"})
+}
+
+func (cw *csvTransactionWriter) write(t exportTransaction) error {
+	return cw.w.Write([]string{
+		t.Date.Format("2006-01-02"),
+		t.Type,
+		t.Symbol,
+		t.Name,
+		formatExportNumber(t.Shares),
+		formatExportNumber(t.Price),
+		formatExportAmount(t.Amount),
+		formatExportAmount(t.Fee),
+		strconv.FormatUint(uint64(t.ID), 10),
+	})
+}
+
+func (cw *csvTransactionWriter) end() error {
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+// ofxTransactionWriter writes an OFX 1.02 investment statement; the securities are listed after the transactions
+type ofxTransactionWriter struct {
+	w          io.Writer
+	account    string
+	currency   string
+	from, to   *time.Time
+	securities map[string]string
+}
+
+const ofxDateFormat = "20060102150405"
+
+func (ow *ofxTransactionWriter) begin() error {
+	now := time.Now().UTC()
+	start := time.Unix(0, 0).UTC()
+	if ow.from != nil {
+		start = *ow.from
+	}
+	end := now
+	if ow.to != nil {
+		end = *ow.to
+	}
+	_, err := fmt.Fprintf(ow.w, "OFXHEADER:100\r\nDATA:OFXSGML\r\nVERSION:102\r\nSECURITY:NONE\r\nENCODING:USASCII\r\nCHARSET:1252\r\nCOMPRESSION:NONE\r\nOLDFILEUID:NONE\r\nNEWFILEUID:NONE\r\n\r\n"+
+		"<OFX>\r\n<SIGNONMSGSRSV1><SONRS><STATUS><CODE>0<SEVERITY>INFO</STATUS><DTSERVER>%s<LANGUAGE>ENG</SONRS></SIGNONMSGSRSV1>\r\n"+
+		"<INVSTMTMSGSRSV1><INVSTMTTRNRS><TRNUID>0<STATUS><CODE>0<SEVERITY>INFO</STATUS>\r\n"+
+		"<INVSTMTRS><DTASOF>%s<CURDEF>%s<INVACCTFROM><BROKERID>infinivest<ACCTID>%s</INVACCTFROM>\r\n"+
+		"<INVTRANLIST><DTSTART>%s<DTEND>%s\r\n",
+		now.Format(ofxDateFormat), now.Format(ofxDateFormat), ow.currency, ofxEscape(ow.account), start.Format(ofxDateFormat), end.Format(ofxDateFormat))
+	return err
+}
+
+func (ow *ofxTransactionWriter) write(t exportTransaction) error {
+	date := t.Date.UTC().Format(ofxDateFormat)
+	invTran := fmt.Sprintf("<INVTRAN><FITID>%d<DTTRADE>%s<MEMO>%s</INVTRAN>", t.ID, date, ofxEscape(t.Type))
+	secID := fmt.Sprintf("<SECID><UNIQUEID>%s<UNIQUEIDTYPE>TICKER</SECID>", ofxEscape(t.Symbol))
+	if t.Symbol != "" {
+		ow.securities[t.Symbol] = t.Name
+	}
+
+	var err error
+	switch {
+	case isExportBuy(t):
+		_, err = fmt.Fprintf(ow.w, "<BUYSTOCK><INVBUY>%s%s<UNITS>%s<UNITPRICE>%s<COMMISSION>%s<TOTAL>%s<SUBACCTSEC>CASH<SUBACCTFUND>CASH</INVBUY><BUYTYPE>BUY</BUYSTOCK>\r\n",
+			invTran, secID, formatExportNumber(t.Shares), formatExportNumber(t.Price), formatExportAmount(t.Fee), formatExportAmount(t.Amount))
+	case isExportSell(t):
+		_, err = fmt.Fprintf(ow.w, "<SELLSTOCK><INVSELL>%s%s<UNITS>%s<UNITPRICE>%s<COMMISSION>%s<TOTAL>%s<SUBACCTSEC>CASH<SUBACCTFUND>CASH</INVSELL><SELLTYPE>SELL</SELLSTOCK>\r\n",
+			invTran, secID, formatExportNumber(t.Shares), formatExportNumber(t.Price), formatExportAmount(t.Fee), formatExportAmount(t.Amount))
+	case t.Symbol != "":
+		action := "IN"
+		if t.Shares.IsNegative() {
+			action = "OUT"
+		}
+		_, err = fmt.Fprintf(ow.w, "<TRANSFER>%s%s<SUBACCTSEC>CASH<UNITS>%s<TFERACTION>%s<POSTYPE>LONG</TRANSFER>\r\n",
+			invTran, secID, formatExportNumber(t.Shares.Abs()), action)
+	default:
+		trnType := "CREDIT"
+		if t.Amount.IsNegative() {
+			trnType = "DEBIT"
+		}
+		if t.Type == "dividend" {
+			trnType = "DIV"
+		}
+		_, err = fmt.Fprintf(ow.w, "<INVBANKTRAN><STMTTRN><TRNTYPE>%s<DTPOSTED>%s<TRNAMT>%s<FITID>%d<NAME>%s</STMTTRN><SUBACCTFUND>CASH</INVBANKTRAN>\r\n",
+			trnType, date, formatExportAmount(t.Amount), t.ID, ofxEscape(t.Type))
+	}
+	return err
+}
+
+func (ow *ofxTransactionWriter) end() error {
+	if _, err := io.WriteString(ow.w, "</INVTRANLIST></INVSTMTRS></INVSTMTTRNRS></INVSTMTMSGSRSV1>\r\n"); err != nil {
+		return err
+	}
+	if len(ow.securities) > 0 {
+		symbols := make([]string, 0, len(ow.securities))
+		for symbol := range ow.securities {
+			symbols = append(symbols, symbol)
+		}
+		sort.Strings(symbols)
+		if _, err := io.WriteString(ow.w, "<SECLISTMSGSRSV1><SECLIST>\r\n"); err != nil {
+			return err
+		}
+		for _, symbol := range symbols {
+			if _, err := fmt.Fprintf(ow.w, "<STOCKINFO><SECINFO><SECID><UNIQUEID>%s<UNIQUEIDTYPE>TICKER</SECID><SECNAME>%s<TICKER>%s</SECINFO></STOCKINFO>\r\n",
+				ofxEscape(symbol), ofxEscape(ow.securities[symbol]), ofxEscape(symbol)); err != nil {
+				return err
+			}
+		}
+		if _, err := io.WriteString(ow.w, "</SECLIST></SECLISTMSGSRSV1>\r\n"); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(ow.w, "</OFX>\r\n")
+	return err
+}
+
+var ofxReplacer = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\r", " ", "\n", " ")
+
+func ofxEscape(value string) string {
+	return ofxReplacer.Replace(value)
+}
+
+// qifTransactionWriter writes a QIF investment account
+type qifTransactionWriter struct {
+	w io.Writer
+}
+
+func (qw *qifTransactionWriter) begin() error {
+	_, err := io.WriteString(qw.w, "!Type:Invst\n")
+	return err
+}
+
+func (qw *qifTransactionWriter) write(t exportTransaction) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "D%s\n", t.Date.Format("01/02/2006"))
+	amount := t.Amount
+	switch {
+	case isExportBuy(t):
+		fmt.Fprintf(&b, "NBuy\nY%s\nI%s\nQ%s\nO%s\n", t.Symbol, formatExportNumber(t.Price), formatExportNumber(t.Shares), formatExportAmount(t.Fee))
+	case isExportSell(t):
+		fmt.Fprintf(&b, "NSell\nY%s\nI%s\nQ%s\nO%s\n", t.Symbol, formatExportNumber(t.Price), formatExportNumber(t.Shares.Neg()), formatExportAmount(t.Fee))
+	case t.Symbol != "":
+		action := "ShrsIn"
+		if t.Shares.IsNegative() {
+			action = "ShrsOut"
+		}
+		fmt.Fprintf(&b, "N%s\nY%s\nQ%s\n", action, t.Symbol, formatExportNumber(t.Shares.Abs()))
+	case t.Type == "dividend":
+		b.WriteString("NMiscInc\n")
+	case amount.IsNegative():
+		b.WriteString("NXOut\n")
+	default:
+		b.WriteString("NXIn\n")
+	}
+	fmt.Fprintf(&b, "T%s\nM%s\n^\n", formatExportAmount(amount.Abs()), t.Type)
+	_, err := io.WriteString(qw.w, b.String())
+	return err
+}
+
+func (qw *qifTransactionWriter) end() error {
+	return nil
+}
@@ -0,0 +1,174 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KZY20112001/infinivest-backend/internal/commons/decimal"
+	"github.com/KZY20112001/infinivest-backend/internal/models"
+)
+
+func exportFixture() []exportTransaction {
+	symbol, name := "VTI", "Vanguard & Co"
+	transaction := func(id uint, day int, kind string, shares, price *decimal.Decimal, amount, fee string) *models.ManualPortfolioTransaction {
+		t := &models.ManualPortfolioTransaction{
+			TransactionType: kind,
+			TotalAmount:     decimal.MustParse(amount),
+			Fee:             decimal.MustParse(fee),
+			SharesAmount:    shares,
+			Price:           price,
+		}
+		t.ID = id
+		t.CreatedAt = time.Date(2024, 1, day, 9, 30, 0, 0, time.UTC)
+		if shares != nil {
+			t.Symbol, t.Name = &symbol, &name
+		}
+		return t
+	}
+	history := []*models.ManualPortfolioTransaction{
+		transaction(1, 2, "deposit", nil, nil, "1000", "0"),
+		transaction(2, 3, "buy", decimalPtr("2"), decimalPtr("100"), "201", "1"),
+		transaction(3, 4, "sell", decimalPtr("1"), decimalPtr("120"), "119.5", "0.5"),
+		transaction(4, 5, "dividend", nil, nil, "5", "0"),
+		transaction(5, 6, "transfer:out", decimalPtr("1"), nil, "100", "0"),
+		transaction(6, 7, "withdrawal", nil, nil, "20", "0"),
+	}
+	transactions := make([]exportTransaction, len(history))
+	for i, t := range history {
+		transactions[i] = newManualExportTransaction(t)
+	}
+	return transactions
+}
+
+func TestNewExportTransaction(t *testing.T) {
+	tests := []struct {
+		name       string
+		index      int
+		wantAmount string
+		wantShares string
+		wantBuy    bool
+		wantSell   bool
+	}{
+		{name: "deposit adds cash", index: 0, wantAmount: "1000", wantShares: "0"},
+		{name: "buy spends cash", index: 1, wantAmount: "-201", wantShares: "2", wantBuy: true},
+		{name: "sell removes shares", index: 2, wantAmount: "119.5", wantShares: "-1", wantSell: true},
+		{name: "dividend adds cash", index: 3, wantAmount: "5", wantShares: "0"},
+		{name: "in-kind transfer moves no cash", index: 4, wantAmount: "0", wantShares: "-1"},
+		{name: "withdrawal spends cash", index: 5, wantAmount: "-20", wantShares: "0"},
+	}
+	transactions := exportFixture()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transaction := transactions[tt.index]
+			if transaction.Amount.String() != tt.wantAmount || transaction.Shares.String() != tt.wantShares {
+				t.Errorf("amount, shares = %s, %s, want %s, %s", transaction.Amount, transaction.Shares, tt.wantAmount, tt.wantShares)
+			}
+			if isExportBuy(transaction) != tt.wantBuy || isExportSell(transaction) != tt.wantSell {
+				t.Errorf("buy, sell = %v, %v, want %v, %v", isExportBuy(transaction), isExportSell(transaction), tt.wantBuy, tt.wantSell)
+			}
+		})
+	}
+}
+
+func TestTransactionExport(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC)
+	stream := func(fn func(exportTransaction) error) error {
+		for _, transaction := range exportFixture() {
+			if err := fn(transaction); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	tests := []struct {
+		name            string
+		format          string
+		wantContentType string
+		want            string
+		wantContains    []string
+		wantErr         bool
+	}{
+		{
+			name:            "csv",
+			format:          "csv",
+			wantContentType: "text/csv",
+			want: "Date,Type,Symbol,Name,Shares,Price,Amount,Fee,ID\n" +
+				"2024-01-02,deposit,,,0,0,1000.00,0.00,1\n" +
+				"2024-01-03,buy,VTI,Vanguard & Co,2,100,-201.00,1.00,2\n" +
+				"2024-01-04,sell,VTI,Vanguard & Co,-1,120,119.50,0.50,3\n" +
+				"2024-01-05,dividend,,,0,0,5.00,0.00,4\n" +
+				"2024-01-06,transfer:out,VTI,Vanguard & Co,-1,0,0.00,0.00,5\n" +
+				"2024-01-07,withdrawal,,,0,0,-20.00,0.00,6\n",
+		},
+		{
+			name:            "qif",
+			format:          "qif",
+			wantContentType: "application/qif",
+			want: "!Type:Invst\n" +
+				"D01/02/2024\nNXIn\nT1000.00\nMdeposit\n^\n" +
+				"D01/03/2024\nNBuy\nYVTI\nI100\nQ2\nO1.00\nT201.00\nMbuy\n^\n" +
+				"D01/04/2024\nNSell\nYVTI\nI120\nQ1\nO0.50\nT119.50\nMsell\n^\n" +
+				"D01/05/2024\nNMiscInc\nT5.00\nMdividend\n^\n" +
+				"D01/06/2024\nNShrsOut\nYVTI\nQ1\nT0.00\nMtransfer:out\n^\n" +
+				"D01/07/2024\nNXOut\nT20.00\nMwithdrawal\n^\n",
+		},
+		{
+			name:            "ofx",
+			format:          "ofx",
+			wantContentType: "application/x-ofx",
+			wantContains: []string{
+				"OFXHEADER:100\r\n",
+				"<CURDEF>EUR<INVACCTFROM><BROKERID>infinivest<ACCTID>manual-7</INVACCTFROM>",
+				"<DTSTART>20240101000000<DTEND>20240131000000\r\n",
+				"<TRNTYPE>CREDIT<DTPOSTED>20240102093000<TRNAMT>1000.00<FITID>1<NAME>deposit</STMTTRN>",
+				"<BUYSTOCK><INVBUY><INVTRAN><FITID>2<DTTRADE>20240103093000<MEMO>buy</INVTRAN><SECID><UNIQUEID>VTI<UNIQUEIDTYPE>TICKER</SECID>" +
+					"<UNITS>2<UNITPRICE>100<COMMISSION>1.00<TOTAL>-201.00",
+				"<SELLSTOCK><INVSELL><INVTRAN><FITID>3",
+				"<UNITS>-1<UNITPRICE>120<COMMISSION>0.50<TOTAL>119.50",
+				"<TRNTYPE>DIV<DTPOSTED>20240105093000<TRNAMT>5.00",
+				"<TRANSFER><INVTRAN><FITID>5",
+				"<UNITS>1<TFERACTION>OUT<POSTYPE>LONG</TRANSFER>",
+				"<TRNTYPE>DEBIT<DTPOSTED>20240107093000<TRNAMT>-20.00",
+				"<STOCKINFO><SECINFO><SECID><UNIQUEID>VTI<UNIQUEIDTYPE>TICKER</SECID><SECNAME>Vanguard &amp; Co<TICKER>VTI</SECINFO></STOCKINFO>",
+				"</SECLIST></SECLISTMSGSRSV1>\r\n</OFX>\r\n",
+			},
+		},
+		{name: "unknown format", format: "xlsx", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			export, err := newTransactionExport(tt.format, "manual-7", "EUR", &from, &to, stream)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("newTransactionExport() error = nil, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("newTransactionExport() error = %v", err)
+			}
+			if export.ContentType != tt.wantContentType {
+				t.Errorf("ContentType = %s, want %s", export.ContentType, tt.wantContentType)
+			}
+			if want := "manual-7-transactions." + tt.format; export.Filename != want {
+				t.Errorf("Filename = %s, want %s", export.Filename, want)
+			}
+
+			var out strings.Builder
+			if err := export.WriteTo(&out); err != nil {
+				t.Fatalf("WriteTo() error = %v", err)
+			}
+			if tt.want != "" && out.String() != tt.want {
+				t.Errorf("WriteTo() wrote\n%s\nwant\n%s", out.String(), tt.want)
+			}
+			for _, want := range tt.wantContains {
+				if !strings.Contains(out.String(), want) {
+					t.Errorf("WriteTo() output is missing %q", want)
+				}
+			}
+		})
+	}
+}
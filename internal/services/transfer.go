@@ -0,0 +1,365 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/KZY20112001/infinivest-backend/internal/commons"
+	"github.com/KZY20112001/infinivest-backend/internal/commons/decimal"
+	"github.com/KZY20112001/infinivest-backend/internal/dto"
+	"github.com/KZY20112001/infinivest-backend/internal/models"
+	"github.com/KZY20112001/infinivest-backend/internal/redis"
+	"github.com/KZY20112001/infinivest-backend/internal/repositories"
+)
+
+type TransferService interface {
+	CreateTransfer(ctx context.Context, userID uint, req dto.TransferRequest) (*models.Transfer, error)
+	GetTransfers(userID uint) ([]*models.Transfer, error)
+}
+
+type transferServiceImpl struct {
+	repo       repositories.TransferRepo
+	manualRepo repositories.ManualPortfolioRepo
+	roboRepo   repositories.RoboPortfolioRepo
+	roboRedis  redis.RoboPortfolioRedis
+	fxService  FXService
+}
+
+func NewTransferService(tr repositories.TransferRepo, mr repositories.ManualPortfolioRepo, rr repositories.RoboPortfolioRepo, rc redis.RoboPortfolioRedis, fs FXService) *transferServiceImpl {
+	return &transferServiceImpl{repo: tr, manualRepo: mr, roboRepo: rr, roboRedis: rc, fxService: fs}
+}
+
+// transferSide is one end of a transfer, holding either a manual or a robo portfolio
+type transferSide struct {
+	manual *models.ManualPortfolio
+	robo   *models.RoboPortfolio
+}
+
+func (side *transferSide) id() uint {
+	if side.manual != nil {
+		return side.manual.ID
+	}
+	return side.robo.ID
+}
+
+func (side *transferSide) name() string {
+	if side.manual != nil {
+		return side.manual.Name
+	}
+	return side.robo.Name
+}
+
+func (side *transferSide) currency() string {
+	if side.manual != nil {
+		return side.manual.Currency
+	}
+	return side.robo.Currency
+}
+
+func (s *transferServiceImpl) CreateTransfer(ctx context.Context, userID uint, req dto.TransferRequest) (*models.Transfer, error) {
+	if !commons.TransferKinds[req.Kind] {
+		return nil, fmt.Errorf("invalid transfer kind: %s", req.Kind)
+	}
+	if !commons.TransferPortfolioTypes[req.From.Type] || !commons.TransferPortfolioTypes[req.To.Type] {
+		return nil, fmt.Errorf("transfers must be between manual and robo portfolios")
+	}
+	if req.From.Type == "robo" && req.To.Type == "robo" {
+		return nil, fmt.Errorf("transfers between robo portfolios are not supported")
+	}
+
+	from, err := s.getTransferSide(userID, req.From)
+	if err != nil {
+		return nil, err
+	}
+	to, err := s.getTransferSide(userID, req.To)
+	if err != nil {
+		return nil, err
+	}
+	if req.From.Type == req.To.Type && from.id() == to.id() {
+		return nil, fmt.Errorf("cannot transfer a portfolio to itself")
+	}
+	fxRate, err := s.fxService.GetRate(from.currency(), to.currency())
+	if err != nil {
+		return nil, err
+	}
+
+	// keep the scheduler away from the robo side until the transfer is saved
+	for _, side := range []*transferSide{from, to} {
+		if side.robo == nil {
+			continue
+		}
+		if side.robo.IsRebalancing {
+			return nil, fmt.Errorf("portfolio %s is being rebalanced, please try again later", side.robo.Name)
+		}
+		success, err := s.roboRedis.AcquireLock(ctx, userID, side.robo.ID, 2*time.Minute)
+		if err != nil {
+			return nil, err
+		}
+		if !success {
+			return nil, fmt.Errorf("portfolio %s is being rebalanced, please try again later", side.robo.Name)
+		}
+		portfolioID := side.robo.ID
+		defer func() {
+			if err := s.roboRedis.ReleaseLock(ctx, userID, portfolioID); err != nil {
+				log.Printf("Failed to release lock for portfolio %d:%d: %v\n", userID, portfolioID, err)
+			}
+		}()
+	}
+
+	transfer := &models.Transfer{
+		UserID:          userID,
+		Kind:            req.Kind,
+		SourceType:      req.From.Type,
+		SourceID:        from.id(),
+		DestinationType: req.To.Type,
+		DestinationID:   to.id(),
+		FxRate:          fxRate,
+	}
+	err = s.repo.InTransaction(func(repo repositories.TransferRepo) error {
+		// fills, orders, deposits and withdrawals may have changed either side since it was read, so both are read
+		// again with their rows locked and the transfer is checked against what they hold now
+		if err := lockTransferSides(repo, userID, from, to); err != nil {
+			return err
+		}
+		for _, side := range []*transferSide{from, to} {
+			if side.robo != nil && side.robo.IsRebalancing {
+				return fmt.Errorf("portfolio %s is being rebalanced, please try again later", side.robo.Name)
+			}
+		}
+
+		var acquiredFxRate *decimal.Decimal // of in-kind shares, from their currency to the destination currency
+		var err error
+		if req.Kind == "cash" {
+			err = transferCash(transfer, from, to, req.Amount)
+		} else {
+			var fxRate decimal.Decimal
+			fxRate, err = transferShares(transfer, from, to, strings.ToUpper(strings.TrimSpace(req.Symbol)), req.Shares)
+			acquiredFxRate = &fxRate
+		}
+		if err != nil {
+			return err
+		}
+
+		changes := repositories.TransferChanges{}
+		for _, side := range []*transferSide{from, to} {
+			transactionType := "transfer:out"
+			amount := transfer.Amount
+			var fxRate *decimal.Decimal
+			if side == to {
+				transactionType = "transfer:in"
+				amount = commons.RoundCash(amount.Mul(transfer.FxRate), to.currency())
+				fxRate = acquiredFxRate
+			}
+			if side.manual != nil {
+				changes.ManualPortfolios = append(changes.ManualPortfolios, side.manual)
+				changes.ManualTransactions = append(changes.ManualTransactions, &models.ManualPortfolioTransaction{
+					ManualPortfolioUserID: userID,
+					ManualPortfolioID:     side.manual.ID,
+					TransactionType:       transactionType,
+					TotalAmount:           amount,
+					Symbol:                transfer.Symbol,
+					SharesAmount:          transfer.Shares,
+					FxRate:                fxRate,
+				})
+			} else {
+				changes.RoboPortfolios = append(changes.RoboPortfolios, side.robo)
+				changes.RoboTransactions = append(changes.RoboTransactions, &models.RoboPortfolioTransaction{
+					RoboPortfolioID: side.robo.ID,
+					TransactionType: transactionType,
+					TotalAmount:     amount,
+					Symbol:          transfer.Symbol,
+					SharesAmount:    transfer.Shares,
+				})
+			}
+		}
+		return repo.CreateTransfer(transfer, changes)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return transfer, nil
+}
+
+func (s *transferServiceImpl) GetTransfers(userID uint) ([]*models.Transfer, error) {
+	return s.repo.GetTransfers(userID)
+}
+
+func (s *transferServiceImpl) getTransferSide(userID uint, endpoint dto.TransferEndpoint) (*transferSide, error) {
+	if endpoint.Type == "manual" {
+		portfolio, err := s.manualRepo.GetManualPortfolio(userID, endpoint.Name)
+		if err != nil {
+			return nil, err
+		}
+		return &transferSide{manual: portfolio}, nil
+	}
+	portfolio, err := s.roboRepo.GetRoboPortfolioDetails(userID, endpoint.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &transferSide{robo: portfolio}, nil
+}
+
+// lockTransferSides reads both sides again with their rows locked. They are locked in a fixed order, manual
+// portfolios before robo ones and then by ID, so two transfers in opposite directions cannot deadlock.
+func lockTransferSides(repo repositories.TransferRepo, userID uint, from, to *transferSide) error {
+	sides := []*transferSide{from, to}
+	sort.Slice(sides, func(i, j int) bool {
+		if (sides[i].manual != nil) != (sides[j].manual != nil) {
+			return sides[i].manual != nil
+		}
+		return sides[i].id() < sides[j].id()
+	})
+	for _, side := range sides {
+		var err error
+		if side.manual != nil {
+			side.manual, err = repo.LockManualPortfolio(userID, side.manual.ID)
+		} else {
+			side.robo, err = repo.LockRoboPortfolio(userID, side.robo.ID)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// transferCash moves the amount out of the source and converts it into the destination currency
+func transferCash(transfer *models.Transfer, from, to *transferSide, amount decimal.Decimal) error {
+	amount = commons.RoundCash(amount, from.currency())
+	if !amount.IsPositive() {
+		return fmt.Errorf("transfer amount must be positive")
+	}
+	if from.manual != nil {
+		if available := from.manual.TotalCash.Sub(from.manual.ReservedCash); available.LessThan(amount) {
+			return fmt.Errorf("insufficient cash in portfolio %s: %s available", from.name(), commons.FormatCash(available, from.currency()))
+		}
+		from.manual.TotalCash = from.manual.TotalCash.Sub(amount)
+	} else {
+		cash := roboCashCategory(from.robo)
+		if cash == nil || cash.TotalAmount.LessThan(amount) {
+			available := decimal.Zero
+			if cash != nil {
+				available = cash.TotalAmount
+			}
+			return fmt.Errorf("insufficient cash in portfolio %s: %s available", from.name(), commons.FormatCash(available, from.currency()))
+		}
+		cash.TotalAmount = cash.TotalAmount.Sub(amount)
+	}
+
+	received := commons.RoundCash(amount.Mul(transfer.FxRate), to.currency())
+	if to.manual != nil {
+		to.manual.TotalCash = to.manual.TotalCash.Add(received)
+	} else {
+		cash := roboCashCategory(to.robo)
+		if cash == nil {
+			cash = &models.RoboPortfolioCategory{RoboPortfolioID: to.robo.ID, Name: "cash"}
+			to.robo.Categories = append(to.robo.Categories, cash)
+		}
+		cash.TotalAmount = cash.TotalAmount.Add(received)
+	}
+	transfer.Amount = amount
+	return nil
+}
+
+// transferShares moves the shares with their cost basis; robo lots are taken oldest first. The cost basis keeps
+// the exchange rate the shares were bought at, converted into the destination currency, and that rate is returned.
+func transferShares(transfer *models.Transfer, from, to *transferSide, symbol string, shares decimal.Decimal) (decimal.Decimal, error) {
+	if symbol == "" {
+		return decimal.Zero, fmt.Errorf("symbol is required for in-kind transfers")
+	}
+	shares = commons.RoundShares(shares)
+	if !shares.IsPositive() {
+		return decimal.Zero, fmt.Errorf("transfer shares must be positive")
+	}
+
+	// the destination is checked first so a failed transfer leaves the source untouched
+	var roboTarget *models.RoboPortfolioAsset
+	if to.robo != nil {
+		if roboTarget = findRoboAsset(to.robo, symbol); roboTarget == nil {
+			return decimal.Zero, fmt.Errorf("portfolio %s does not hold %s", to.name(), symbol)
+		}
+	}
+
+	var name, currency string
+	var cost, assetFxRate decimal.Decimal // in the asset currency, and the rate it was bought at
+	if from.manual != nil {
+		asset := findManualAsset(from.manual, symbol)
+		if asset == nil || asset.SharesOwned.Sub(asset.SharesReserved).LessThan(shares) {
+			return decimal.Zero, fmt.Errorf("insufficient shares of %s in portfolio %s", symbol, from.name())
+		}
+		name, currency = asset.Name, asset.Currency
+		cost, assetFxRate = commons.RoundCash(asset.AvgBuyPrice.Mul(shares), asset.Currency), asset.AvgFxRate
+		costBasis := commons.RoundCash(cost.Mul(assetFxRate), from.currency())
+		asset.SharesOwned = asset.SharesOwned.Sub(shares)
+		asset.TotalInvested = decimal.Max(asset.TotalInvested.Sub(costBasis), decimal.Zero)
+		if !asset.SharesOwned.IsPositive() {
+			asset.SharesOwned = decimal.Zero
+			asset.TotalInvested = decimal.Zero
+		}
+	} else {
+		asset := findRoboAsset(from.robo, symbol)
+		if asset == nil || asset.SharesOwned.LessThan(shares) {
+			return decimal.Zero, fmt.Errorf("insufficient shares of %s in portfolio %s", symbol, from.name())
+		}
+		name, currency = asset.Name, asset.Currency
+		cost, assetFxRate = sellSharesInOrder(asset, shares, oldestLotsFirst), decimal.One
+	}
+
+	acquiredFxRate := assetFxRate.Mul(transfer.FxRate)
+	if roboTarget != nil {
+		buyShares(roboTarget, shares, cost.Div(shares))
+	} else {
+		receiveManualShares(to.manual, name, symbol, currency, shares, cost, acquiredFxRate)
+	}
+
+	transfer.Amount = commons.RoundCash(cost.Mul(assetFxRate), from.currency())
+	transfer.Symbol = &symbol
+	transfer.Shares = &shares
+	return acquiredFxRate, nil
+}
+
+// receiveManualShares adds transferred shares to a manual portfolio without touching its cash
+func receiveManualShares(portfolio *models.ManualPortfolio, name, symbol, currency string, shares, cost, fxRate decimal.Decimal) {
+	asset := findManualAsset(portfolio, symbol)
+	if asset == nil {
+		if currency == "" {
+			currency = commons.SymbolCurrency(symbol)
+		}
+		asset = &models.ManualPortfolioAsset{
+			ManualPortfolioID:     portfolio.ID,
+			ManualPortfolioUserID: portfolio.UserID,
+			Symbol:                symbol,
+			Name:                  name,
+			Currency:              currency,
+		}
+		portfolio.Assets = append(portfolio.Assets, asset)
+	}
+	addManualShares(asset, portfolio.Currency, shares, cost, fxRate)
+}
+
+func roboCashCategory(portfolio *models.RoboPortfolio) *models.RoboPortfolioCategory {
+	for _, category := range portfolio.Categories {
+		if category.Name == "cash" {
+			return category
+		}
+	}
+	return nil
+}
+
+func findRoboAsset(portfolio *models.RoboPortfolio, symbol string) *models.RoboPortfolioAsset {
+	for _, category := range portfolio.Categories {
+		if category.Name == "cash" {
+			continue
+		}
+		for _, asset := range category.Assets {
+			if asset.Symbol == symbol {
+				return asset
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,308 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/KZY20112001/infinivest-backend/internal/commons"
+	"github.com/KZY20112001/infinivest-backend/internal/commons/decimal"
+	"github.com/KZY20112001/infinivest-backend/internal/commons/email"
+	"github.com/KZY20112001/infinivest-backend/internal/dto"
+	"github.com/KZY20112001/infinivest-backend/internal/models"
+	"github.com/KZY20112001/infinivest-backend/internal/repositories"
+	"gorm.io/gorm"
+)
+
+// enough history to find the previous close across weekends and holidays
+const quoteHistoryDays = 7
+
+type WatchlistService interface {
+	CreateWatchlist(userID uint, name string) (*models.Watchlist, error)
+	GetWatchlists(userID uint) ([]dto.WatchlistResponse, error)
+	GetWatchlist(userID, watchlistID uint) (dto.WatchlistResponse, error)
+	DeleteWatchlist(userID, watchlistID uint) error
+	AddSymbol(userID, watchlistID uint, symbol string) (*models.WatchlistItem, error)
+	RemoveSymbol(userID, watchlistID uint, symbol string) error
+	CreatePriceAlert(userID, watchlistID uint, symbol string, req dto.PriceAlertRequest) (*models.PriceAlert, error)
+	DeletePriceAlert(userID, alertID uint) error
+	ProcessPriceAlerts(ctx context.Context)
+}
+
+type watchlistServiceImpl struct {
+	repo                repositories.WatchlistRepo
+	genAIService        GenAIService
+	notificationService NotificationService
+	userService         UserService
+	alertCooldown       time.Duration
+}
+
+func NewWatchlistService(wr repositories.WatchlistRepo, gs GenAIService, ns NotificationService, us UserService, alertCooldown time.Duration) *watchlistServiceImpl {
+	return &watchlistServiceImpl{repo: wr, genAIService: gs, notificationService: ns, userService: us, alertCooldown: alertCooldown}
+}
+
+// quote is the latest price of a symbol and its previous close, which is zero when the history is unavailable
+type quote struct {
+	price         decimal.Decimal
+	previousClose decimal.Decimal
+}
+
+func (q quote) dayChangePercent() float64 {
+	if !q.previousClose.IsPositive() {
+		return 0
+	}
+	return percentOf(q.price.Sub(q.previousClose), q.previousClose)
+}
+
+func (s *watchlistServiceImpl) CreateWatchlist(userID uint, name string) (*models.Watchlist, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, fmt.Errorf("watchlist name is required")
+	}
+	watchlist := &models.Watchlist{UserID: userID, Name: name}
+	if err := s.repo.CreateWatchlist(watchlist); err != nil {
+		return nil, err
+	}
+	return watchlist, nil
+}
+
+func (s *watchlistServiceImpl) GetWatchlists(userID uint) ([]dto.WatchlistResponse, error) {
+	watchlists, err := s.repo.GetWatchlists(userID)
+	if err != nil {
+		return nil, err
+	}
+	quotes := make(map[string]quote)
+	res := make([]dto.WatchlistResponse, 0, len(watchlists))
+	for _, watchlist := range watchlists {
+		res = append(res, s.buildWatchlistResponse(watchlist, quotes))
+	}
+	return res, nil
+}
+
+func (s *watchlistServiceImpl) GetWatchlist(userID, watchlistID uint) (dto.WatchlistResponse, error) {
+	watchlist, err := s.repo.GetWatchlist(userID, watchlistID)
+	if err != nil {
+		return dto.WatchlistResponse{}, err
+	}
+	return s.buildWatchlistResponse(watchlist, make(map[string]quote)), nil
+}
+
+func (s *watchlistServiceImpl) DeleteWatchlist(userID, watchlistID uint) error {
+	watchlist, err := s.repo.GetWatchlist(userID, watchlistID)
+	if err != nil {
+		return err
+	}
+	return s.repo.DeleteWatchlist(watchlist)
+}
+
+func (s *watchlistServiceImpl) AddSymbol(userID, watchlistID uint, symbol string) (*models.WatchlistItem, error) {
+	watchlist, err := s.repo.GetWatchlist(userID, watchlistID)
+	if err != nil {
+		return nil, err
+	}
+	symbol = strings.ToUpper(strings.TrimSpace(symbol))
+	if !commons.IsValidSymbol(symbol) {
+		return nil, fmt.Errorf("invalid symbol: %q", symbol)
+	}
+	if findWatchlistItem(watchlist, symbol) != nil {
+		return nil, fmt.Errorf("%s is already in watchlist %s", symbol, watchlist.Name)
+	}
+	// reject unknown symbols before they are saved
+	if _, err := s.genAIService.GetLatestAssetPrice(symbol); err != nil {
+		return nil, fmt.Errorf("failed to get price for %s: %w", symbol, err)
+	}
+	item := &models.WatchlistItem{WatchlistID: watchlist.ID, Symbol: symbol}
+	if err := s.repo.CreateWatchlistItem(item); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+func (s *watchlistServiceImpl) RemoveSymbol(userID, watchlistID uint, symbol string) error {
+	watchlist, err := s.repo.GetWatchlist(userID, watchlistID)
+	if err != nil {
+		return err
+	}
+	item := findWatchlistItem(watchlist, strings.ToUpper(symbol))
+	if item == nil {
+		return gorm.ErrRecordNotFound
+	}
+	return s.repo.DeleteWatchlistItem(item)
+}
+
+func (s *watchlistServiceImpl) CreatePriceAlert(userID, watchlistID uint, symbol string, req dto.PriceAlertRequest) (*models.PriceAlert, error) {
+	if !commons.PriceAlertTypes[req.Type] {
+		return nil, fmt.Errorf("invalid alert type: %s", req.Type)
+	}
+	threshold := req.Threshold
+	if req.Type != "percent-move" {
+		threshold = commons.RoundPrice(threshold)
+	}
+	if !threshold.IsPositive() {
+		return nil, fmt.Errorf("alert threshold must be positive")
+	}
+	watchlist, err := s.repo.GetWatchlist(userID, watchlistID)
+	if err != nil {
+		return nil, err
+	}
+	item := findWatchlistItem(watchlist, strings.ToUpper(symbol))
+	if item == nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+	alert := &models.PriceAlert{
+		WatchlistItemID: item.ID,
+		UserID:          userID,
+		Symbol:          item.Symbol,
+		AlertType:       req.Type,
+		Threshold:       threshold,
+		Active:          true,
+	}
+	if err := s.repo.CreatePriceAlert(alert); err != nil {
+		return nil, err
+	}
+	return alert, nil
+}
+
+func (s *watchlistServiceImpl) DeletePriceAlert(userID, alertID uint) error {
+	alert, err := s.repo.GetPriceAlert(userID, alertID)
+	if err != nil {
+		return err
+	}
+	return s.repo.DeletePriceAlert(alert)
+}
+
+// ProcessPriceAlerts fetches each watched symbol once and delivers the alerts that fired outside their cooldown
+func (s *watchlistServiceImpl) ProcessPriceAlerts(ctx context.Context) {
+	alerts, err := s.repo.GetActivePriceAlerts()
+	if err != nil {
+		log.Println("Failed to get price alerts:", err)
+		return
+	}
+
+	quotes := make(map[string]quote)
+	now := time.Now()
+	for _, alert := range alerts {
+		if ctx.Err() != nil {
+			return
+		}
+		if alert.LastTriggeredAt != nil && now.Sub(*alert.LastTriggeredAt) < s.alertCooldown {
+			continue
+		}
+		q, err := s.getQuote(alert.Symbol, quotes)
+		if err != nil {
+			log.Printf("Failed to get price for %s: %v\n", alert.Symbol, err)
+			continue
+		}
+		message, triggered := evaluatePriceAlert(alert, q)
+		if !triggered {
+			continue
+		}
+
+		alert.LastTriggeredAt = &now
+		alert.LastPrice = q.price
+		if err := s.repo.UpdatePriceAlert(alert); err != nil {
+			log.Printf("Failed to update price alert %d: %v\n", alert.ID, err)
+			continue
+		}
+		s.deliverPriceAlert(ctx, alert, message)
+	}
+}
+
+func (s *watchlistServiceImpl) deliverPriceAlert(ctx context.Context, alert *models.PriceAlert, message string) {
+	if err := s.notificationService.AddNotification(ctx, alert.UserID, "price-alert", message); err != nil {
+		log.Printf("Error adding price alert notification for user %d: %v\n", alert.UserID, err)
+	}
+	user, err := s.userService.GetUser(alert.UserID)
+	if err != nil {
+		log.Printf("Failed to get user %d: %v\n", alert.UserID, err)
+		return
+	}
+	subject := fmt.Sprintf("Price alert for %s", alert.Symbol)
+	body := fmt.Sprintf(`
+			<p>Dear User,</p>
+			<p>%s.</p>
+			<p>Best regards,<br>
+			The InfiniVest Team</p>
+		`, message)
+	if err := email.SendEmail(user.Email, subject, body); err != nil {
+		log.Println("Failed to send email:", err)
+	}
+}
+
+func evaluatePriceAlert(alert *models.PriceAlert, q quote) (string, bool) {
+	switch alert.AlertType {
+	case "above":
+		if q.price.GreaterThanOrEqual(alert.Threshold) {
+			return fmt.Sprintf("%s is at %s, above your alert price of %s", alert.Symbol, q.price.StringFixed(2), alert.Threshold), true
+		}
+	case "below":
+		if q.price.LessThanOrEqual(alert.Threshold) {
+			return fmt.Sprintf("%s is at %s, below your alert price of %s", alert.Symbol, q.price.StringFixed(2), alert.Threshold), true
+		}
+	case "percent-move":
+		if change := q.dayChangePercent(); q.previousClose.IsPositive() && math.Abs(change) >= alert.Threshold.Float64() {
+			return fmt.Sprintf("%s moved %+.2f%% today to %s", alert.Symbol, change, q.price.StringFixed(2)), true
+		}
+	}
+	return "", false
+}
+
+func (s *watchlistServiceImpl) buildWatchlistResponse(watchlist *models.Watchlist, quotes map[string]quote) dto.WatchlistResponse {
+	res := dto.WatchlistResponse{ID: watchlist.ID, Name: watchlist.Name, CreatedAt: watchlist.CreatedAt, Items: make([]dto.WatchlistQuote, 0, len(watchlist.Items))}
+	for _, item := range watchlist.Items {
+		itemQuote := dto.WatchlistQuote{ID: item.ID, Symbol: item.Symbol, Alerts: item.Alerts}
+		q, err := s.getQuote(item.Symbol, quotes)
+		if err != nil {
+			log.Printf("Failed to get price for %s: %v\n", item.Symbol, err)
+			res.Items = append(res.Items, itemQuote)
+			continue
+		}
+		itemQuote.Price = &q.price
+		if q.previousClose.IsPositive() {
+			dayChange := q.price.Sub(q.previousClose)
+			dayChangePercent := q.dayChangePercent()
+			itemQuote.PreviousClose = &q.previousClose
+			itemQuote.DayChange = &dayChange
+			itemQuote.DayChangePercent = &dayChangePercent
+		}
+		res.Items = append(res.Items, itemQuote)
+	}
+	return res
+}
+
+// getQuote returns the cached quote for the symbol or fetches it; a missing history only leaves out the day change
+func (s *watchlistServiceImpl) getQuote(symbol string, quotes map[string]quote) (quote, error) {
+	if q, ok := quotes[symbol]; ok {
+		return q, nil
+	}
+	price, err := s.genAIService.GetLatestAssetPrice(symbol)
+	if err != nil {
+		return quote{}, err
+	}
+	q := quote{price: price}
+	history, err := s.genAIService.GetAssetPriceHistory(symbol, quoteHistoryDays)
+	if err != nil {
+		log.Printf("Failed to get price history for %s: %v\n", symbol, err)
+	}
+	today := time.Now().Format("2006-01-02")
+	for i := len(history) - 1; i >= 0; i-- {
+		if history[i].Date < today {
+			q.previousClose = commons.RoundPrice(decimal.NewFromFloat(history[i].Close))
+			break
+		}
+	}
+	quotes[symbol] = q
+	return q, nil
+}
+
+func findWatchlistItem(watchlist *models.Watchlist, symbol string) *models.WatchlistItem {
+	for _, item := range watchlist.Items {
+		if item.Symbol == symbol {
+			return item
+		}
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/KZY20112001/infinivest-backend/internal/commons/decimal"
+	"github.com/KZY20112001/infinivest-backend/internal/models"
+)
+
+func TestEvaluatePriceAlert(t *testing.T) {
+	tests := []struct {
+		name          string
+		alertType     string
+		threshold     string
+		price         string
+		previousClose string
+		wantMessage   string
+		wantFired     bool
+	}{
+		{
+			name:        "price reaches the above threshold",
+			alertType:   "above",
+			threshold:   "150.1",
+			price:       "150.10",
+			wantMessage: "VTI is at 150.10, above your alert price of 150.1",
+			wantFired:   true,
+		},
+		{
+			name:      "price just under the above threshold",
+			alertType: "above",
+			threshold: "150.0001",
+			price:     "150",
+		},
+		{
+			name:        "price falls to the below threshold",
+			alertType:   "below",
+			threshold:   "0.1234",
+			price:       "0.12",
+			wantMessage: "VTI is at 0.12, below your alert price of 0.1234",
+			wantFired:   true,
+		},
+		{
+			name:          "move larger than the percentage",
+			alertType:     "percent-move",
+			threshold:     "5",
+			price:         "94",
+			previousClose: "100",
+			wantMessage:   "VTI moved -6.00% today to 94.00",
+			wantFired:     true,
+		},
+		{
+			name:          "move smaller than the percentage",
+			alertType:     "percent-move",
+			threshold:     "5",
+			price:         "104",
+			previousClose: "100",
+		},
+		{
+			name:      "percent move without a previous close",
+			alertType: "percent-move",
+			threshold: "5",
+			price:     "104",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			alert := &models.PriceAlert{Symbol: "VTI", AlertType: tt.alertType, Threshold: decimal.MustParse(tt.threshold)}
+			q := quote{price: decimal.MustParse(tt.price)}
+			if tt.previousClose != "" {
+				q.previousClose = decimal.MustParse(tt.previousClose)
+			}
+			message, fired := evaluatePriceAlert(alert, q)
+			if fired != tt.wantFired || message != tt.wantMessage {
+				t.Errorf("evaluatePriceAlert() = %q, %v, want %q, %v", message, fired, tt.wantMessage, tt.wantFired)
+			}
+		})
+	}
+}
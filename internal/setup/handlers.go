@@ -13,6 +13,10 @@ func Handlers(
 	notificationService services.NotificationService,
 	s3Service services.S3Service,
 	genAIService services.GenAIService,
+	goalService services.GoalService,
+	screeningService services.ScreeningService,
+	transferService services.TransferService,
+	watchlistService services.WatchlistService,
 ) (
 	*handlers.UserHandler,
 	*handlers.ProfileHandler,
@@ -20,11 +24,19 @@ func Handlers(
 	*handlers.ManualPortfolioHandler,
 	*handlers.NotificationHandler,
 	*handlers.S3Handler,
+	*handlers.GoalHandler,
+	*handlers.ScreeningHandler,
+	*handlers.TransferHandler,
+	*handlers.WatchlistHandler,
 ) {
 	return handlers.NewUserHandler(userService),
 		handlers.NewProfileHandler(profileService),
-		handlers.NewRoboPortfolioHandler(roboPortfolioService, genAIService),
+		handlers.NewRoboPortfolioHandler(roboPortfolioService, genAIService, screeningService, profileService),
 		handlers.NewManualPortfolioHandler(manualPortfolioService),
 		handlers.NewNotificationHandler(notificationService),
-		handlers.NewS3Handler(s3Service)
+		handlers.NewS3Handler(s3Service),
+		handlers.NewGoalHandler(goalService),
+		handlers.NewScreeningHandler(screeningService),
+		handlers.NewTransferHandler(transferService),
+		handlers.NewWatchlistHandler(watchlistService)
 }
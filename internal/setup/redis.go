@@ -5,6 +5,6 @@ import (
 	"github.com/redis/go-redis/v9"
 )
 
-func Redis(client *redis.Client) (customRedis.RoboPortfolioRedis, customRedis.NotificationRedis) {
-	return customRedis.NewRoboPortfolioRedis(client), customRedis.NewNotificationRedis(client)
+func Redis(client *redis.Client) (customRedis.RoboPortfolioRedis, customRedis.NotificationRedis, customRedis.IdempotencyRedis) {
+	return customRedis.NewRoboPortfolioRedis(client), customRedis.NewNotificationRedis(client), customRedis.NewIdempotencyRedis(client)
 }
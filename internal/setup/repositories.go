@@ -1,6 +1,9 @@
 package setup
 
 import (
+	"fmt"
+
+	"github.com/KZY20112001/infinivest-backend/internal/conf"
 	"github.com/KZY20112001/infinivest-backend/internal/repositories"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"gorm.io/gorm"
@@ -17,11 +20,30 @@ func Repositories(
 	repositories.ManualPortfolioRepo,
 	repositories.S3Repository,
 	repositories.GenAIRepository,
+	repositories.GoalRepo,
+	repositories.ScreeningRepo,
+	repositories.TransferRepo,
+	repositories.WatchlistRepo,
 ) {
 	return repositories.NewPostgresUserRepo(db),
 		repositories.NewPostgresProfileRepo(db),
 		repositories.NewPostgresRoboPortfolioRepo(db),
 		repositories.NewPostgresManualPortfolioRepo(db),
 		repositories.NewS3RepositoryImpl(s3Client),
-		repositories.NewFlaskMicroservice(genAIUrl)
+		repositories.NewFlaskMicroservice(genAIUrl),
+		repositories.NewPostgresGoalRepo(db),
+		repositories.NewPostgresScreeningRepo(db),
+		repositories.NewPostgresTransferRepo(db),
+		repositories.NewPostgresWatchlistRepo(db)
+}
+
+func FXRateRepository(appConf *conf.Config) (repositories.FXRateRepository, error) {
+	switch appConf.FXProvider {
+	case "file":
+		return repositories.NewFileFXRateRepository(appConf.FXRatesFile)
+	case "http":
+		return repositories.NewHTTPFXRateRepository(appConf.FXRatesURL), nil
+	default:
+		return nil, fmt.Errorf("unknown fx provider: %s", appConf.FXProvider)
+	}
 }
@@ -1,6 +1,7 @@
 package setup
 
 import (
+	"github.com/KZY20112001/infinivest-backend/internal/conf"
 	"github.com/KZY20112001/infinivest-backend/internal/redis"
 	"github.com/KZY20112001/infinivest-backend/internal/repositories"
 	"github.com/KZY20112001/infinivest-backend/internal/scheduler"
@@ -17,3 +18,30 @@ func PortfolioScheduler(
 		portfolioRedis,
 	)
 }
+
+func OrderMonitor(
+	manualPortfolioService services.ManualPortfolioService,
+	appConf *conf.Config) scheduler.PortfolioScheduler {
+	return scheduler.NewOrderMonitorImpl(manualPortfolioService, appConf.OrderCheckInterval)
+}
+
+func AlertMonitor(
+	watchlistService services.WatchlistService,
+	appConf *conf.Config) scheduler.PortfolioScheduler {
+	return scheduler.NewAlertMonitorImpl(watchlistService, appConf.AlertCheckInterval)
+}
+
+func DriftMonitor(
+	roboPortfolioService services.RoboPortfolioService,
+	portfolioRepo repositories.RoboPortfolioRepo,
+	portfolioRedis redis.RoboPortfolioRedis,
+	appConf *conf.Config) scheduler.PortfolioScheduler {
+	return scheduler.NewDriftMonitorImpl(
+		roboPortfolioService,
+		portfolioRepo,
+		portfolioRedis,
+		appConf.DriftBand,
+		appConf.DriftCooldown,
+		appConf.DriftCheckInterval,
+	)
+}
@@ -1,6 +1,9 @@
 package setup
 
 import (
+	"time"
+
+	"github.com/KZY20112001/infinivest-backend/internal/analytics"
 	"github.com/KZY20112001/infinivest-backend/internal/redis"
 	"github.com/KZY20112001/infinivest-backend/internal/repositories"
 	"github.com/KZY20112001/infinivest-backend/internal/services"
@@ -15,6 +18,15 @@ func Services(
 	manualPortfolioRepo repositories.ManualPortfolioRepo,
 	s3Repo repositories.S3Repository,
 	genAIRepo repositories.GenAIRepository,
+	goalRepo repositories.GoalRepo,
+	screeningRepo repositories.ScreeningRepo,
+	transferRepo repositories.TransferRepo,
+	watchlistRepo repositories.WatchlistRepo,
+	fxRateRepo repositories.FXRateRepository,
+	assumptions map[string]analytics.CategoryAssumption,
+	rebalanceFeeRate float64,
+	alertCooldown time.Duration,
+	fxRateTTL time.Duration,
 ) (
 	services.UserService,
 	services.ProfileService,
@@ -23,6 +35,10 @@ func Services(
 	services.NotificationService,
 	services.S3Service,
 	services.GenAIService,
+	services.GoalService,
+	services.ScreeningService,
+	services.TransferService,
+	services.WatchlistService,
 ) {
 	userService := services.NewUserServiceImpl(userRepo)
 
@@ -30,16 +46,27 @@ func Services(
 
 	s3Service := services.NewS3ServiceImpl(s3Repo)
 
-	genAIService := services.NewGenAIService(genAIRepo)
+	genAIService := services.NewGenAIService(genAIRepo, assumptions)
 
 	notificationService := services.NewNotificationService(notificationRedis)
-	roboPortfolioService := services.NewRoboPortfolioService(
-		roboPortfolioRepo, portfolioRedis, genAIService, notificationService, userService,
-	)
+
+	fxService := services.NewFXService(fxRateRepo, fxRateTTL)
 
 	manualPortfolioService := services.NewManualPortfolioService(
-		manualPortfolioRepo, genAIService,
+		manualPortfolioRepo, genAIService, notificationService, profileService, fxService,
 	)
 
-	return userService, profileService, roboPortfolioService, manualPortfolioService, notificationService, s3Service, genAIService
+	screeningService := services.NewScreeningService(screeningRepo)
+
+	roboPortfolioService := services.NewRoboPortfolioService(
+		roboPortfolioRepo, portfolioRedis, genAIService, notificationService, userService, profileService, manualPortfolioService, fxService, screeningService, rebalanceFeeRate,
+	)
+
+	goalService := services.NewGoalService(goalRepo, roboPortfolioService, profileService, assumptions)
+
+	transferService := services.NewTransferService(transferRepo, manualPortfolioRepo, roboPortfolioRepo, portfolioRedis, fxService)
+
+	watchlistService := services.NewWatchlistService(watchlistRepo, genAIService, notificationService, userService, alertCooldown)
+
+	return userService, profileService, roboPortfolioService, manualPortfolioService, notificationService, s3Service, genAIService, goalService, screeningService, transferService, watchlistService
 }